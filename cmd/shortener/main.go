@@ -3,11 +3,21 @@ package main
 import (
 	"github.com/dubrovsky1/url-shortener/internal/app"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"log"
+	"os"
 )
 
 func main() {
 	logger.Initialize()
 
+	//подкоманда управления схемой базы данных: shortener migrate up|down|status|version
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(os.Args[2:]); err != nil {
+			log.Fatal("Migrate error. ", err)
+		}
+		return
+	}
+
 	a := app.New()
 	logger.Sugar.Infow("Flags:", "-a", a.Flags.Host, "-b", a.Flags.ResultShortURL, "-f", a.Flags.FileStoragePath, "-d", a.Flags.ConnectionString)
 
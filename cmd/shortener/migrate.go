@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/dubrovsky1/url-shortener/internal/storage/postgresql"
+	"os"
+	"strconv"
+	"time"
+)
+
+const migrateUsage = `usage: shortener migrate [-d dsn] <command>
+
+commands:
+  up          apply all pending migrations
+  down [N]    revert N last migrations (default 1)
+  status      list migrations and their state
+  version     print current schema version`
+
+// migrate - подкоманда управления схемой базы данных
+func migrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	d := fs.String("d", "", "database connection string")
+	fs.Usage = func() { fmt.Fprintln(fs.Output(), migrateUsage) }
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	connString := *d
+	if cn := os.Getenv("DATABASE_DSN"); cn != "" {
+		connString = cn
+	}
+	if connString == "" {
+		return fmt.Errorf("database connection string is required: -d or DATABASE_DSN")
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("migrate command is required")
+	}
+
+	db, err := postgresql.Open(connString, postgresql.PoolConfig{MaxConns: 1})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := postgresql.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	switch fs.Arg(0) {
+	case "up":
+		applied, errUp := migrator.Up(ctx)
+		if errUp != nil {
+			return errUp
+		}
+		fmt.Printf("applied %d migrations, schema version %d\n", applied, migrator.Latest())
+	case "down":
+		steps := 1
+		if fs.NArg() > 1 {
+			if steps, err = strconv.Atoi(fs.Arg(1)); err != nil || steps < 1 {
+				return fmt.Errorf("down: steps must be a positive number")
+			}
+		}
+		reverted, errDown := migrator.Down(ctx, steps)
+		if errDown != nil {
+			return errDown
+		}
+		fmt.Printf("reverted %d migrations\n", reverted)
+	case "status":
+		statuses, errStatus := migrator.Status(ctx)
+		if errStatus != nil {
+			return errStatus
+		}
+		for _, st := range statuses {
+			applied := "pending"
+			if st.AppliedAt != nil {
+				applied = "applied " + st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", st.Version, st.Name, applied)
+		}
+	case "version":
+		version, errVersion := migrator.Version(ctx)
+		if errVersion != nil {
+			return errVersion
+		}
+		fmt.Printf("database version %d, application version %d\n", version, migrator.Latest())
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown migrate command %q", fs.Arg(0))
+	}
+	return nil
+}
@@ -3,29 +3,42 @@ package app
 import (
 	"context"
 	"errors"
+	"github.com/dubrovsky1/url-shortener/internal/cache"
 	"github.com/dubrovsky1/url-shortener/internal/config"
+	"github.com/dubrovsky1/url-shortener/internal/generator"
 	"github.com/dubrovsky1/url-shortener/internal/handlers/api/shorten"
+	"github.com/dubrovsky1/url-shortener/internal/handlers/api/teams"
 	"github.com/dubrovsky1/url-shortener/internal/handlers/api/user"
+	"github.com/dubrovsky1/url-shortener/internal/handlers/cachestats"
 	"github.com/dubrovsky1/url-shortener/internal/handlers/geturl"
 	"github.com/dubrovsky1/url-shortener/internal/handlers/ping"
 	"github.com/dubrovsky1/url-shortener/internal/handlers/saveurl"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/auth"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/gzip"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/dubrovsky1/url-shortener/internal/oidc"
 	"github.com/dubrovsky1/url-shortener/internal/service"
 	"github.com/dubrovsky1/url-shortener/internal/storage"
+	"github.com/dubrovsky1/url-shortener/internal/storage/postgresql"
 	"github.com/go-chi/chi/v5"
 	"log"
 	"net/http"
+	"net/netip"
 	"os/signal"
 	"syscall"
 	"time"
 )
 
+// время на завершение обрабатываемых запросов при остановке сервера
+const shutdownTimeout = 10 * time.Second
+
 type App struct {
 	Flags   config.Config
 	Storage storage.Storager
+	Cache   *cache.Storage
 	Service *service.Service
+	Proxies []netip.Prefix //доверенные прокси, которым разрешено передавать адрес клиента в заголовках
 }
 
 func New() *App {
@@ -36,25 +49,103 @@ func New() *App {
 		log.Fatal("Get storage error. ", err)
 	}
 
+	proxies, err := geturl.ParseTrustedProxies(flags.TrustedProxies)
+	if err != nil {
+		log.Fatal("Parse trusted proxies error. ", err)
+	}
+
+	gen, err := generator.New(flags.CodeStrategy, flags.CodeLength, flags.HashidsSalt, stor)
+	if err != nil {
+		log.Fatal("Get short code generator error. ", err)
+	}
+
+	//ключ хеширования IP-адресов не должен меняться между перезапусками, иначе посетители до и после перезапуска
+	//считаются разными, поэтому без явного ключа он хранится в файле
+	clickSalt := flags.ClickSalt
+	if clickSalt == "" {
+		if clickSalt, err = service.LoadClickSecret(flags.ClickSaltFile); err != nil {
+			log.Fatal("Load click salt error. ", err)
+		}
+	}
+
+	//переходы по ссылкам читаем через кеш, остальные запросы идут в хранилище напрямую
+	var links service.Storager = stor
+	var c *cache.Storage
+	if flags.CacheSize > 0 {
+		c = cache.New(stor, flags.CacheSize, flags.CacheTTL, flags.CacheNegativeTTL)
+		links = c
+	}
+
 	//создаем объект стоя бизнес-логики, который взаимодействует с базой
-	serv := service.New(stor, 10, time.Second*10)
+	serv := service.New(links, flags.DeleteBatchSize, flags.DeleteInterval,
+		service.WithGenerator(gen),
+		service.WithExpireInterval(flags.ExpireInterval),
+		service.WithClicks(flags.ClickBatchSize, flags.ClickInterval),
+		service.WithClickSalt(clickSalt),
+	)
+
+	//вход через провайдера включается адресом issuer, discovery провайдера читается один раз при старте
+	var provider auth.OIDCProvider
+	if flags.OIDCIssuer != "" {
+		provider, err = oidc.New(context.Background(), oidc.Config{
+			Issuer:       flags.OIDCIssuer,
+			ClientID:     flags.OIDCClientID,
+			ClientSecret: flags.OIDCClientSecret,
+			RedirectURL:  flags.OIDCRedirectURL,
+			JWKSURL:      flags.OIDCJWKSURL,
+		})
+		if err != nil {
+			log.Fatal("OIDC provider init error. ", err)
+		}
+	}
+
+	//API-ключи проверяет сервис, поэтому авторизация настраивается после него
+	if err = initAuth(flags, serv, provider); err != nil {
+		log.Fatal("Auth init error. ", err)
+	}
 
 	return &App{
 		Flags:   flags,
 		Storage: stor,
+		Cache:   c,
 		Service: serv,
+		Proxies: proxies,
 	}
 }
 
 func (a *App) Run() {
 	r := chi.NewRouter()
-	r.Post("/", auth.Auth(logger.WithLogging(gzip.GzipMiddleware(saveurl.SaveURL(a.Service, a.Flags.ResultShortURL)))))
-	r.Post("/api/shorten", auth.Auth(logger.WithLogging(gzip.GzipMiddleware(shorten.Shorten(a.Service, a.Flags.ResultShortURL)))))
-	r.Post("/api/shorten/batch", auth.Auth(logger.WithLogging(gzip.GzipMiddleware(shorten.Batch(a.Service)))))
-	r.Get("/{id}", logger.WithLogging(gzip.GzipMiddleware(geturl.GetURL(a.Service))))
+	r.Post("/", auth.Auth(auth.Require(models.ScopeWrite, logger.WithLogging(gzip.GzipMiddleware(saveurl.SaveURL(a.Service, a.Flags.ResultShortURL))))))
+	r.Post("/api/shorten", auth.Auth(auth.Require(models.ScopeWrite, logger.WithLogging(gzip.GzipMiddleware(shorten.Shorten(a.Service, a.Flags.ResultShortURL))))))
+	r.Post("/api/shorten/batch", auth.Auth(auth.Require(models.ScopeWrite, logger.WithLogging(gzip.GzipMiddleware(shorten.Batch(a.Service))))))
+	r.Get("/{id}", logger.WithLogging(gzip.GzipMiddleware(geturl.GetURL(a.Service, a.Proxies...))))
 	r.Get("/ping", logger.WithLogging(gzip.GzipMiddleware(ping.Ping(a.Flags.ConnectionString))))
-	r.Get("/api/user/urls", auth.Auth(logger.WithLogging(gzip.GzipMiddleware(user.ListByUserID(a.Service)))))
-	r.Delete("/api/user/urls", auth.Auth(logger.WithLogging(gzip.GzipMiddleware(user.DeleteURL(a.Service)))))
+	r.Get("/api/user/urls", auth.Auth(auth.Require(models.ScopeRead, logger.WithLogging(gzip.GzipMiddleware(user.ListByUserID(a.Service))))))
+	r.Delete("/api/user/urls", auth.Auth(auth.Require(models.ScopeDelete, logger.WithLogging(gzip.GzipMiddleware(user.DeleteURL(a.Service))))))
+	r.Get("/api/user/urls/{id}/stats", auth.Auth(auth.Require(models.ScopeRead, logger.WithLogging(gzip.GzipMiddleware(user.Stats(a.Service))))))
+	r.Get("/api/user/deletions/dead", auth.Auth(auth.Require(models.ScopeRead, logger.WithLogging(gzip.GzipMiddleware(user.DeadDeletes(a.Service))))))
+	r.Get("/api/user/deletions/{job_id}", auth.Auth(auth.Require(models.ScopeRead, logger.WithLogging(gzip.GzipMiddleware(user.DeleteJob(a.Service))))))
+
+	//вход и регистрация не заводят анонимного пользователя, а забирают ссылки уже существующего
+	r.Post("/api/user/register", auth.Identify(logger.WithLogging(gzip.GzipMiddleware(user.Register(a.Service)))))
+	r.Post("/api/user/login", auth.Identify(logger.WithLogging(gzip.GzipMiddleware(user.Login(a.Service)))))
+
+	if a.Flags.OIDCIssuer != "" {
+		r.Get("/api/user/oidc/login", logger.WithLogging(auth.OIDCLogin))
+		r.Get("/api/user/oidc/callback", auth.OIDCCallback(logger.WithLogging(gzip.GzipMiddleware(user.OIDCCallback(a.Service)))))
+	}
+
+	//ключами управляет только сам пользователь, а не сервис с ключом
+	r.Post("/api/user/keys", auth.Auth(auth.RequireSession(logger.WithLogging(gzip.GzipMiddleware(user.CreateKey(a.Service))))))
+	r.Get("/api/user/keys", auth.Auth(auth.RequireSession(logger.WithLogging(gzip.GzipMiddleware(user.ListKeys(a.Service))))))
+	r.Delete("/api/user/keys/{id}", auth.Auth(auth.RequireSession(logger.WithLogging(gzip.GzipMiddleware(user.RevokeKey(a.Service))))))
+
+	//состав команд читается и ключом, меняется только самим пользователем, роли проверяет сервис
+	r.Post("/api/teams", auth.Auth(auth.RequireSession(logger.WithLogging(gzip.GzipMiddleware(teams.CreateTeam(a.Service))))))
+	r.Get("/api/teams", auth.Auth(auth.Require(models.ScopeRead, logger.WithLogging(gzip.GzipMiddleware(teams.ListTeams(a.Service))))))
+	r.Get("/api/teams/{id}/members", auth.Auth(auth.Require(models.ScopeRead, logger.WithLogging(gzip.GzipMiddleware(teams.ListMembers(a.Service))))))
+	r.Put("/api/teams/{id}/members/{user_id}", auth.Auth(auth.RequireSession(logger.WithLogging(gzip.GzipMiddleware(teams.SetMember(a.Service))))))
+	r.Delete("/api/teams/{id}/members/{user_id}", auth.Auth(auth.RequireSession(logger.WithLogging(gzip.GzipMiddleware(teams.RemoveMember(a.Service))))))
 
 	serv := http.Server{
 		Addr:    a.Flags.Host,
@@ -68,27 +159,100 @@ func (a *App) Run() {
 	}()
 	logger.Sugar.Infow("Server is listening", "host", a.Flags.Host)
 
+	//служебные маршруты не публикуются на основном адресе, их отдает отдельный сервер на внутреннем адресе
+	var internal *http.Server
+	if a.Flags.InternalHost != "" {
+		ir := chi.NewRouter()
+		if a.Cache != nil {
+			ir.Get("/api/internal/cache/stats", logger.WithLogging(gzip.GzipMiddleware(cachestats.CacheStats(a.Cache))))
+		}
+
+		internal = &http.Server{
+			Addr:    a.Flags.InternalHost,
+			Handler: ir,
+		}
+
+		go func() {
+			if err := internal.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("Internal listen and serve returned err: %v", err)
+			}
+		}()
+		logger.Sugar.Infow("Internal server is listening", "host", a.Flags.InternalHost)
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
 	//запуск удаления записей
 	a.Service.Run(ctx)
 
+	//ссылки могут менять и другие экземпляры сервиса, их изменения сбрасывают локальный кеш
+	if pg, ok := a.Storage.(*postgresql.Storage); ok && a.Cache != nil {
+		go pg.Listen(ctx, a.Cache)
+	}
+
 	<-ctx.Done()
 
-	if err := serv.Shutdown(ctx); err != nil {
+	//ctx к этому моменту уже отменен, на завершение текущих запросов даем отдельное время
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := serv.Shutdown(shutdownCtx); err != nil {
 		logger.Sugar.Infow("Server shutdown error", "err", err.Error())
 	}
 
+	if internal != nil {
+		if err := internal.Shutdown(shutdownCtx); err != nil {
+			logger.Sugar.Infow("Internal server shutdown error", "err", err.Error())
+		}
+	}
+
 	a.Close()
 
 	logger.Sugar.Infow("Shutting down server gracefully")
 }
 
 func (a *App) Close() {
+	//сначала останавливаем сервис, чтобы его фоновые процессы успели записать остатки буферов в хранилище
+	a.Service.Close()
+	logger.Sugar.Infow("Service closed")
+
 	a.Storage.Close()
 	logger.Sugar.Infow("Storage closed")
+}
 
-	a.Service.Close()
-	logger.Sugar.Infow("Service closed")
+// initAuth настраивает подпись токенов и атрибуты куки. Без ключей в настройках токены подписываются
+// случайным ключом процесса и перестают приниматься после перезапуска
+func initAuth(flags config.Config, apiKeys auth.APIKeyResolver, provider auth.OIDCProvider) error {
+	keys, err := auth.LoadKeys(flags.JWTKeyFile, flags.JWTSecret)
+	if errors.Is(err, auth.ErrNoKeys) {
+		logger.Sugar.Infow("JWT signing key is not configured, using ephemeral key.")
+		key, errKey := auth.RandomKey()
+		if errKey != nil {
+			return errKey
+		}
+		keys, err = []auth.Key{key}, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	sameSite, err := auth.ParseSameSite(flags.CookieSameSite)
+	if err != nil {
+		return err
+	}
+
+	return auth.Initialize(auth.Config{
+		Keys:          keys,
+		TokenExp:      flags.JWTTokenExp,
+		RefreshBefore: flags.JWTRefresh,
+		APIKeys:       apiKeys,
+		OIDC:          provider,
+		Cookie: auth.CookieConfig{
+			Domain:   flags.CookieDomain,
+			Secure:   flags.CookieSecure,
+			HTTPOnly: flags.CookieHTTPOnly,
+			SameSite: sameSite,
+		},
+	})
 }
@@ -0,0 +1,193 @@
+// Package cache - кеш ссылок для перехода по короткому коду, декоратор service.Storager
+package cache
+
+import (
+	"context"
+	"errors"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/dubrovsky1/url-shortener/internal/service"
+	"github.com/google/uuid"
+	"golang.org/x/sync/singleflight"
+	"hash/fnv"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	maxShards   = 16              //максимальное число сегментов, запросы к разным сегментам не блокируют друг друга
+	loadTimeout = 5 * time.Second //предел общего запроса в хранилище при промахе
+)
+
+// Storage кеширует GetURL поверх хранилища, остальные методы передаются хранилищу без изменений.
+// Неизвестные коды тоже кешируются, но на меньший срок, чтобы перебор кодов не доходил до базы
+type Storage struct {
+	service.Storager
+	shards       []*lru
+	capacity     int
+	ttl          time.Duration
+	negativeTTL  time.Duration
+	loads        singleflight.Group //одновременные промахи по одному коду идут в хранилище одним запросом
+	hits         atomic.Int64
+	negativeHits atomic.Int64
+	misses       atomic.Int64
+	evictions    atomic.Int64
+	now          func() time.Time
+}
+
+func New(storage service.Storager, size int, ttl, negativeTTL time.Duration) *Storage {
+	shardCount := min(maxShards, max(size, 1))
+	perShard := (size + shardCount - 1) / shardCount
+
+	s := &Storage{
+		Storager:    storage,
+		shards:      make([]*lru, shardCount),
+		capacity:    perShard * shardCount,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		now:         time.Now,
+	}
+
+	for i := range s.shards {
+		s.shards[i] = newLRU(perShard)
+	}
+	return s
+}
+
+func (s *Storage) shard(shortURL models.ShortURL) *lru {
+	h := fnv.New32a()
+	h.Write([]byte(shortURL))
+	return s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+// GetURL отдает ссылку из кеша, при промахе читает хранилище и запоминает результат
+func (s *Storage) GetURL(ctx context.Context, shortURL models.ShortURL) (models.ShortenURL, error) {
+	shard := s.shard(shortURL)
+
+	e, gen, ok := shard.get(shortURL, s.now())
+	if ok {
+		if e.notFound {
+			s.negativeHits.Add(1)
+			return models.ShortenURL{}, errs.ErrShortURLNotFound
+		}
+		s.hits.Add(1)
+		return e.row, nil
+	}
+	s.misses.Add(1)
+
+	//запрос в хранилище общий для всех ждущих, поэтому отмена запроса, который его начал, не должна прерывать его
+	//для остальных. Результат кешируется в самом запросе, даже если ждущих уже не осталось.
+	//Поколение сегмента в ключе не дает промаху после инвалидации дождаться загрузки, начатой до нее
+	key := strconv.FormatUint(gen, 10) + "/" + string(shortURL)
+	ch := s.loads.DoChan(key, func() (any, error) {
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+		defer cancel()
+
+		row, err := s.Storager.GetURL(loadCtx, shortURL)
+
+		//кешируем только ответ хранилища по существу, временные ошибки должны дойти до следующего запроса
+		switch {
+		case err == nil:
+			s.evictions.Add(int64(shard.add(entry{shortURL: shortURL, row: row, expiresAt: s.now().Add(s.ttl)}, gen)))
+		case errors.Is(err, errs.ErrShortURLNotFound):
+			s.evictions.Add(int64(shard.add(entry{shortURL: shortURL, notFound: true, expiresAt: s.now().Add(s.negativeTTL)}, gen)))
+		}
+		return row, err
+	})
+
+	//каждый ждущий перестает ждать по своему контексту
+	select {
+	case <-ctx.Done():
+		return models.ShortenURL{}, ctx.Err()
+	case res := <-ch:
+		row, _ := res.Val.(models.ShortenURL)
+		return row, res.Err
+	}
+}
+
+// SaveURL убирает из кеша отметку, что кода нет
+func (s *Storage) SaveURL(ctx context.Context, item models.ShortenURL) (models.ShortURL, error) {
+	defer s.Invalidate(item.ShortURL)
+	return s.Storager.SaveURL(ctx, item)
+}
+
+// InsertBatch убирает из кеша отметки, что кодов пачки нет
+func (s *Storage) InsertBatch(ctx context.Context, batch []models.BatchRequest, host models.Host, userID uuid.UUID) ([]models.BatchResponse, error) {
+	codes := make([]models.ShortURL, len(batch))
+	for i, row := range batch {
+		codes[i] = row.ShortURL
+	}
+
+	defer s.Invalidate(codes...)
+	return s.Storager.InsertBatch(ctx, batch, host, userID)
+}
+
+// DeleteURL убирает из кеша ссылки, которые могли быть помечены удаленными
+func (s *Storage) DeleteURL(ctx context.Context, deletedItems []models.DeletedURLS) ([]models.DeletedURLS, error) {
+	codes := make([]models.ShortURL, len(deletedItems))
+	for i, item := range deletedItems {
+		codes[i] = item.ShortURL
+	}
+
+	//инвалидируем и при ошибке: часть ссылок могла быть удалена до нее
+	defer s.Invalidate(codes...)
+	return s.Storager.DeleteURL(ctx, deletedItems)
+}
+
+// MergeUser меняет владельца ссылок, коды которых заранее неизвестны, поэтому кеш сбрасывается целиком.
+// Вход с переносом ссылок редок, а промахи после сброса дешевле устаревшего владельца в проверках доступа
+func (s *Storage) MergeUser(ctx context.Context, from, to uuid.UUID) (int64, error) {
+	merged, err := s.Storager.MergeUser(ctx, from, to)
+	if merged > 0 || err != nil {
+		s.Reset()
+	}
+	return merged, err
+}
+
+// Invalidate убирает коды из кеша, загрузки этих кодов, начатые раньше, в кеш не попадут
+func (s *Storage) Invalidate(shortURLs ...models.ShortURL) {
+	byShard := make(map[*lru][]models.ShortURL)
+	for _, shortURL := range shortURLs {
+		shard := s.shard(shortURL)
+		byShard[shard] = append(byShard[shard], shortURL)
+	}
+
+	for shard, codes := range byShard {
+		shard.remove(codes...)
+	}
+}
+
+// Reset очищает кеш целиком, когда нельзя узнать, какие ссылки изменились
+func (s *Storage) Reset() {
+	for _, shard := range s.shards {
+		shard.clear()
+	}
+}
+
+// Stats - счетчики попаданий и промахов для подбора размера кеша
+func (s *Storage) Stats() models.CacheStats {
+	size := 0
+	for _, shard := range s.shards {
+		size += shard.len()
+	}
+
+	hits := s.hits.Load()
+	negativeHits := s.negativeHits.Load()
+	misses := s.misses.Load()
+
+	var ratio float64
+	if total := hits + negativeHits + misses; total > 0 {
+		ratio = float64(hits+negativeHits) / float64(total)
+	}
+
+	return models.CacheStats{
+		Size:         size,
+		Capacity:     s.capacity,
+		Hits:         hits,
+		NegativeHits: negativeHits,
+		Misses:       misses,
+		Evictions:    s.evictions.Load(),
+		HitRatio:     ratio,
+	}
+}
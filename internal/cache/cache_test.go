@@ -0,0 +1,310 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/dubrovsky1/url-shortener/internal/storage/memory"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingStorage считает обращения к хранилищу за ссылкой
+type countingStorage struct {
+	*memory.Storage
+	calls   atomic.Int64
+	err     error
+	release chan struct{} //если задан, ответ ждет его закрытия, как медленный ответ базы, прочитанный до изменений
+}
+
+func (s *countingStorage) GetURL(ctx context.Context, shortURL models.ShortURL) (models.ShortenURL, error) {
+	if s.err != nil {
+		s.calls.Add(1)
+		return models.ShortenURL{}, s.err
+	}
+
+	row, err := s.Storage.GetURL(ctx, shortURL)
+	s.calls.Add(1)
+
+	if s.release != nil {
+		select {
+		case <-ctx.Done():
+			return models.ShortenURL{}, ctx.Err()
+		case <-s.release:
+		}
+	}
+	return row, err
+}
+
+func TestStorage(t *testing.T) {
+	logger.Initialize()
+	ctx := context.Background()
+	userID := uuid.New()
+
+	t.Run("Cache. Hit after first read.", func(t *testing.T) {
+		next := &countingStorage{Storage: memory.New()}
+		c := New(next, 100, time.Minute, time.Minute)
+
+		_, err := c.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk", UserID: userID})
+		require.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			row, err := c.GetURL(ctx, "jB9Wbk")
+			require.NoError(t, err)
+			assert.Equal(t, models.OriginalURL("https://practicum.yandex.ru/"), row.OriginalURL)
+		}
+
+		assert.Equal(t, int64(1), next.calls.Load())
+		stats := c.Stats()
+		assert.Equal(t, int64(2), stats.Hits)
+		assert.Equal(t, int64(1), stats.Misses)
+		assert.Equal(t, 1, stats.Size)
+	})
+
+	t.Run("Cache. Unknown code is cached until saved.", func(t *testing.T) {
+		next := &countingStorage{Storage: memory.New()}
+		c := New(next, 100, time.Minute, time.Minute)
+
+		_, err := c.GetURL(ctx, "jB9Wbk")
+		assert.ErrorIs(t, err, errs.ErrShortURLNotFound)
+		_, err = c.GetURL(ctx, "jB9Wbk")
+		assert.ErrorIs(t, err, errs.ErrShortURLNotFound)
+
+		assert.Equal(t, int64(1), next.calls.Load())
+		assert.Equal(t, int64(1), c.Stats().NegativeHits)
+
+		_, err = c.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk", UserID: userID})
+		require.NoError(t, err)
+
+		row, err := c.GetURL(ctx, "jB9Wbk")
+		require.NoError(t, err)
+		assert.Equal(t, models.OriginalURL("https://practicum.yandex.ru/"), row.OriginalURL)
+	})
+
+	t.Run("Cache. Batch clears unknown codes.", func(t *testing.T) {
+		next := &countingStorage{Storage: memory.New()}
+		c := New(next, 100, time.Minute, time.Minute)
+
+		_, err := c.GetURL(ctx, "wqev4E")
+		assert.ErrorIs(t, err, errs.ErrShortURLNotFound)
+
+		_, err = c.InsertBatch(ctx, []models.BatchRequest{{CorrelationID: "1", URL: "https://yandex.ru/", ShortURL: "wqev4E"}}, "localhost:8080", userID)
+		require.NoError(t, err)
+
+		_, err = c.GetURL(ctx, "wqev4E")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Cache. Delete invalidates entry.", func(t *testing.T) {
+		next := &countingStorage{Storage: memory.New()}
+		c := New(next, 100, time.Minute, time.Minute)
+
+		_, err := c.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk", UserID: userID})
+		require.NoError(t, err)
+
+		row, err := c.GetURL(ctx, "jB9Wbk")
+		require.NoError(t, err)
+		assert.False(t, row.IsDel)
+
+		_, err = c.DeleteURL(ctx, []models.DeletedURLS{{UserID: userID, ShortURL: "jB9Wbk"}})
+		require.NoError(t, err)
+
+		row, err = c.GetURL(ctx, "jB9Wbk")
+		require.NoError(t, err)
+		assert.True(t, row.IsDel)
+		assert.Equal(t, int64(2), next.calls.Load())
+	})
+
+	t.Run("Cache. Reset drops all entries.", func(t *testing.T) {
+		next := &countingStorage{Storage: memory.New()}
+		c := New(next, 100, time.Minute, time.Minute)
+
+		_, err := c.GetURL(ctx, "jB9Wbk")
+		assert.ErrorIs(t, err, errs.ErrShortURLNotFound)
+		_, err = c.GetURL(ctx, "wqev4E")
+		assert.ErrorIs(t, err, errs.ErrShortURLNotFound)
+		assert.Equal(t, 2, c.Stats().Size)
+
+		c.Reset()
+		assert.Equal(t, 0, c.Stats().Size)
+
+		_, err = c.GetURL(ctx, "jB9Wbk")
+		assert.ErrorIs(t, err, errs.ErrShortURLNotFound)
+		assert.Equal(t, int64(3), next.calls.Load())
+	})
+
+	t.Run("Cache. Entries expire.", func(t *testing.T) {
+		next := &countingStorage{Storage: memory.New()}
+		c := New(next, 100, time.Minute, time.Second)
+		now := time.Now()
+		c.now = func() time.Time { return now }
+
+		_, err := c.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk", UserID: userID})
+		require.NoError(t, err)
+
+		_, err = c.GetURL(ctx, "jB9Wbk")
+		require.NoError(t, err)
+		_, err = c.GetURL(ctx, "abcdef")
+		assert.ErrorIs(t, err, errs.ErrShortURLNotFound)
+
+		//отметка об отсутствии кода живет меньше найденной ссылки
+		now = now.Add(2 * time.Second)
+		_, err = c.GetURL(ctx, "jB9Wbk")
+		require.NoError(t, err)
+		_, err = c.GetURL(ctx, "abcdef")
+		assert.ErrorIs(t, err, errs.ErrShortURLNotFound)
+		assert.Equal(t, int64(3), next.calls.Load())
+
+		now = now.Add(time.Minute)
+		_, err = c.GetURL(ctx, "jB9Wbk")
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), next.calls.Load())
+	})
+
+	t.Run("Cache. Storage errors are not cached.", func(t *testing.T) {
+		next := &countingStorage{Storage: memory.New(), err: errors.New("connection refused")}
+		c := New(next, 100, time.Minute, time.Minute)
+
+		_, err := c.GetURL(ctx, "jB9Wbk")
+		assert.Error(t, err)
+		_, err = c.GetURL(ctx, "jB9Wbk")
+		assert.Error(t, err)
+
+		assert.Equal(t, int64(2), next.calls.Load())
+		assert.Equal(t, 0, c.Stats().Size)
+	})
+
+	t.Run("Cache. Least recently used entry is evicted.", func(t *testing.T) {
+		next := &countingStorage{Storage: memory.New()}
+		c := New(next, 1, time.Minute, time.Minute)
+
+		_, err := c.GetURL(ctx, "jB9Wbk")
+		assert.ErrorIs(t, err, errs.ErrShortURLNotFound)
+		_, err = c.GetURL(ctx, "wqev4E")
+		assert.ErrorIs(t, err, errs.ErrShortURLNotFound)
+
+		stats := c.Stats()
+		assert.Equal(t, 1, stats.Size)
+		assert.Equal(t, 1, stats.Capacity)
+		assert.Equal(t, int64(1), stats.Evictions)
+
+		_, err = c.GetURL(ctx, "jB9Wbk")
+		assert.ErrorIs(t, err, errs.ErrShortURLNotFound)
+		assert.Equal(t, int64(3), next.calls.Load())
+	})
+
+	t.Run("Cache. User merge drops stale owners.", func(t *testing.T) {
+		next := &countingStorage{Storage: memory.New()}
+		c := New(next, 100, time.Minute, time.Minute)
+		accountID := uuid.New()
+
+		_, err := c.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk", UserID: userID})
+		require.NoError(t, err)
+
+		row, err := c.GetURL(ctx, "jB9Wbk")
+		require.NoError(t, err)
+		assert.Equal(t, userID, row.UserID)
+
+		merged, err := c.MergeUser(ctx, userID, accountID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), merged)
+
+		row, err = c.GetURL(ctx, "jB9Wbk")
+		require.NoError(t, err)
+		assert.Equal(t, accountID, row.UserID)
+		assert.Equal(t, int64(2), next.calls.Load())
+	})
+
+	t.Run("Cache. Canceled first reader does not cancel shared load.", func(t *testing.T) {
+		next := &countingStorage{Storage: memory.New(), release: make(chan struct{})}
+		c := New(next, 100, time.Minute, time.Minute)
+
+		_, err := c.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk", UserID: userID})
+		require.NoError(t, err)
+
+		//первый читатель уходит, пока запрос в хранилище еще выполняется
+		firstCtx, cancel := context.WithCancel(ctx)
+		done := make(chan error)
+		go func() {
+			_, errGet := c.GetURL(firstCtx, "jB9Wbk")
+			done <- errGet
+		}()
+
+		require.Eventually(t, func() bool { return next.calls.Load() == 1 }, time.Second, time.Millisecond)
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+
+		//запрос дочитывается и попадает в кеш
+		close(next.release)
+		require.Eventually(t, func() bool { return c.Stats().Size == 1 }, time.Second, time.Millisecond)
+
+		row, err := c.GetURL(ctx, "jB9Wbk")
+		require.NoError(t, err)
+		assert.Equal(t, models.OriginalURL("https://practicum.yandex.ru/"), row.OriginalURL)
+		assert.Equal(t, int64(1), next.calls.Load())
+	})
+
+	t.Run("Cache. Miss after invalidation does not join earlier load.", func(t *testing.T) {
+		next := &countingStorage{Storage: memory.New(), release: make(chan struct{})}
+		c := New(next, 100, time.Minute, time.Minute)
+
+		_, err := c.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk", UserID: userID})
+		require.NoError(t, err)
+
+		//первая загрузка прочитала ссылку до удаления и еще не вернулась
+		first := make(chan models.ShortenURL)
+		go func() {
+			row, _ := c.GetURL(ctx, "jB9Wbk")
+			first <- row
+		}()
+		require.Eventually(t, func() bool { return next.calls.Load() == 1 }, time.Second, time.Millisecond)
+
+		_, err = c.DeleteURL(ctx, []models.DeletedURLS{{UserID: userID, ShortURL: "jB9Wbk"}})
+		require.NoError(t, err)
+
+		//промах после инвалидации идет в хранилище сам, а не ждет старую загрузку
+		second := make(chan models.ShortenURL)
+		go func() {
+			row, _ := c.GetURL(ctx, "jB9Wbk")
+			second <- row
+		}()
+		require.Eventually(t, func() bool { return next.calls.Load() == 2 }, time.Second, time.Millisecond)
+
+		close(next.release)
+		assert.False(t, (<-first).IsDel)
+		assert.True(t, (<-second).IsDel)
+	})
+
+	t.Run("Cache. Concurrent reads of hot link.", func(t *testing.T) {
+		next := &countingStorage{Storage: memory.New()}
+		c := New(next, 100, time.Minute, time.Minute)
+
+		_, err := c.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk", UserID: userID})
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					row, err := c.GetURL(ctx, "jB9Wbk")
+					assert.NoError(t, err)
+					assert.Equal(t, models.OriginalURL("https://practicum.yandex.ru/"), row.OriginalURL)
+				}
+			}()
+		}
+		wg.Wait()
+
+		stats := c.Stats()
+		assert.Equal(t, int64(5000), stats.Hits+stats.Misses)
+		assert.LessOrEqual(t, next.calls.Load(), stats.Misses)
+	})
+}
@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"container/list"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"sync"
+	"time"
+)
+
+// entry - закешированный результат GetURL: ссылка или отметка, что кода нет
+type entry struct {
+	shortURL  models.ShortURL
+	row       models.ShortenURL
+	notFound  bool
+	expiresAt time.Time
+}
+
+// lru - сегмент кеша, вытесняет давно не запрошенные записи при заполнении
+type lru struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[models.ShortURL]*list.Element
+	order    *list.List //в начале - последние запрошенные записи
+	gen      uint64     //растет при каждой инвалидации, устаревшие загрузки по нему не попадают в кеш
+}
+
+func newLRU(capacity int) *lru {
+	return &lru{
+		capacity: capacity,
+		items:    make(map[models.ShortURL]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// get - запись по коду и поколение сегмента на момент чтения, истекшая запись удаляется
+func (c *lru) get(shortURL models.ShortURL, now time.Time) (entry, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[shortURL]
+	if !ok {
+		return entry{}, c.gen, false
+	}
+
+	e := el.Value.(entry)
+	if !now.Before(e.expiresAt) {
+		c.order.Remove(el)
+		delete(c.items, shortURL)
+		return entry{}, c.gen, false
+	}
+
+	c.order.MoveToFront(el)
+	return e, c.gen, true
+}
+
+// add сохраняет запись, если с момента чтения gen сегмент не инвалидировали. Возвращает число вытесненных записей
+func (c *lru) add(e entry, gen uint64) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return 0
+	}
+
+	if el, ok := c.items[e.shortURL]; ok {
+		el.Value = e
+		c.order.MoveToFront(el)
+		return 0
+	}
+
+	c.items[e.shortURL] = c.order.PushFront(e)
+
+	evicted := 0
+	for c.order.Len() > c.capacity {
+		last := c.order.Back()
+		c.order.Remove(last)
+		delete(c.items, last.Value.(entry).shortURL)
+		evicted++
+	}
+	return evicted
+}
+
+// remove удаляет записи и отменяет незавершенные загрузки сегмента
+func (c *lru) remove(shortURLs ...models.ShortURL) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+
+	for _, shortURL := range shortURLs {
+		if el, ok := c.items[shortURL]; ok {
+			c.order.Remove(el)
+			delete(c.items, shortURL)
+		}
+	}
+}
+
+func (c *lru) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// clear удаляет все записи и отменяет незавершенные загрузки сегмента
+func (c *lru) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.items = make(map[models.ShortURL]*list.Element)
+	c.order.Init()
+}
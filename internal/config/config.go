@@ -3,6 +3,8 @@ package config
 import (
 	"flag"
 	"os"
+	"strconv"
+	"time"
 )
 
 type Config struct {
@@ -10,6 +12,41 @@ type Config struct {
 	ResultShortURL   string
 	FileStoragePath  string
 	ConnectionString string
+	ExpireInterval   time.Duration
+	ClickSalt        string
+	ClickSaltFile    string
+	CodeStrategy     string
+	CodeLength       int
+	HashidsSalt      string
+	DBMaxConns       int
+	DBMinConns       int
+	DBMaxConnLife    time.Duration
+	DBMaxConnIdle    time.Duration
+	DeleteChunkSize  int
+	DeleteBatchSize  int
+	DeleteInterval   time.Duration
+	ClickBatchSize   int
+	ClickInterval    time.Duration
+	FileSync         string
+	BoltStoragePath  string
+	CacheSize        int
+	CacheTTL         time.Duration
+	CacheNegativeTTL time.Duration
+	JWTSecret        string
+	JWTKeyFile       string
+	JWTTokenExp      time.Duration
+	JWTRefresh       time.Duration
+	CookieSecure     bool
+	CookieHTTPOnly   bool
+	CookieSameSite   string
+	CookieDomain     string
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCJWKSURL      string
+	TrustedProxies   string
+	InternalHost     string
 }
 
 func ParseFlags() Config {
@@ -17,6 +54,41 @@ func ParseFlags() Config {
 	b := flag.String("b", "http://localhost:8080/", "base address result url")
 	f := flag.String("f", "/tmp/short-url-db.json", "short url file")
 	d := flag.String("d", "", "database connection string")
+	e := flag.Duration("expire-interval", time.Minute, "interval of marking expired urls as deleted")
+	cs := flag.String("click-salt", "", "secret key for hashing client ip in click analytics, prefer CLICK_IP_SALT env, empty - key from click-salt-file")
+	cf := flag.String("click-salt-file", "/tmp/click-ip-salt", "file with secret key for hashing client ip, generated on first start when missing")
+	g := flag.String("code-strategy", "random", "short code strategy: random, counter, hashids, hash")
+	l := flag.Int("code-length", 6, "short code length (minimal length for hashids)")
+	hs := flag.String("hashids-salt", "", "salt for hashids short code strategy")
+	mc := flag.Int("db-max-conns", 0, "database pool max connections, 0 - pgxpool default")
+	mn := flag.Int("db-min-conns", 0, "database pool min connections")
+	ml := flag.Duration("db-max-conn-lifetime", 0, "database connection max lifetime, 0 - pgxpool default")
+	mi := flag.Duration("db-max-conn-idle-time", 0, "database connection max idle time, 0 - pgxpool default")
+	dc := flag.Int("delete-chunk-size", 1000, "max count of urls deleted by one database query")
+	wb := flag.Int("delete-batch-size", 10, "count of urls taken from delete queue by one batch")
+	wi := flag.Duration("delete-interval", 10*time.Second, "interval of checking delete queue")
+	cb := flag.Int("click-batch-size", 100, "count of click events written to storage by one batch")
+	ci := flag.Duration("click-interval", 5*time.Second, "max interval between writes of click events")
+	bp := flag.String("bolt-storage-path", "", "embedded bbolt database file, used when database connection string is empty")
+	cz := flag.Int("cache-size", 10000, "max count of short urls in redirect cache, 0 - cache disabled")
+	ct := flag.Duration("cache-ttl", 5*time.Minute, "redirect cache entry lifetime")
+	cn := flag.Duration("cache-negative-ttl", 30*time.Second, "redirect cache lifetime of unknown short url")
+	js := flag.String("jwt-secret", "", "jwt signing secret, prefer JWT_SECRET env or key file to keep it out of process list")
+	jf := flag.String("jwt-key-file", "", "jwt signing keys file with <kid>:<secret> lines, the first key signs new tokens")
+	je := flag.Duration("jwt-ttl", 3*time.Hour, "jwt token lifetime")
+	jr := flag.Duration("jwt-refresh-before", time.Hour, "reissue jwt token when it expires sooner than this")
+	ks := flag.Bool("cookie-secure", false, "set Secure attribute of auth cookie")
+	kh := flag.Bool("cookie-http-only", true, "set HttpOnly attribute of auth cookie")
+	kp := flag.String("cookie-samesite", "lax", "SameSite attribute of auth cookie: lax, strict or none")
+	kd := flag.String("cookie-domain", "", "Domain attribute of auth cookie")
+	oi := flag.String("oidc-issuer", "", "OpenID Connect issuer url, empty - oidc login disabled")
+	oc := flag.String("oidc-client-id", "", "OpenID Connect client id")
+	ot := flag.String("oidc-client-secret", "", "OpenID Connect client secret, prefer OIDC_CLIENT_SECRET env, empty for public client")
+	or := flag.String("oidc-redirect-url", "", "OpenID Connect redirect url, must point to /api/user/oidc/callback")
+	oj := flag.String("oidc-jwks-url", "", "OpenID Connect id token keys url, empty - taken from issuer discovery")
+	tp := flag.String("trusted-proxies", "", "comma separated ip addresses or cidr of proxies allowed to set X-Forwarded-For and X-Real-IP")
+	ia := flag.String("internal-address", "", "address and port of internal server with service endpoints like cache stats, empty - disabled")
+	fs := flag.String("file-fsync", "1s", "file storage fsync policy: always, never or interval like 100ms")
 
 	flag.Parse()
 
@@ -40,10 +112,256 @@ func ParseFlags() Config {
 		connString = cn
 	}
 
+	expireInterval := *e
+	if ei := os.Getenv("EXPIRE_INTERVAL"); ei != "" {
+		if d, err := time.ParseDuration(ei); err == nil {
+			expireInterval = d
+		}
+	}
+
+	clickSalt := *cs
+	if salt := os.Getenv("CLICK_IP_SALT"); salt != "" {
+		clickSalt = salt
+	}
+
+	clickSaltFile := *cf
+	if v := os.Getenv("CLICK_IP_SALT_FILE"); v != "" {
+		clickSaltFile = v
+	}
+
+	codeStrategy := *g
+	if st := os.Getenv("SHORT_CODE_STRATEGY"); st != "" {
+		codeStrategy = st
+	}
+
+	codeLength := *l
+	if cl := os.Getenv("SHORT_CODE_LENGTH"); cl != "" {
+		if n, err := strconv.Atoi(cl); err == nil {
+			codeLength = n
+		}
+	}
+
+	hashidsSalt := *hs
+	if salt := os.Getenv("HASHIDS_SALT"); salt != "" {
+		hashidsSalt = salt
+	}
+
+	dbMaxConns := *mc
+	if v := os.Getenv("DB_MAX_CONNS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			dbMaxConns = n
+		}
+	}
+
+	dbMinConns := *mn
+	if v := os.Getenv("DB_MIN_CONNS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			dbMinConns = n
+		}
+	}
+
+	dbMaxConnLife := *ml
+	if v := os.Getenv("DB_MAX_CONN_LIFETIME"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			dbMaxConnLife = d
+		}
+	}
+
+	dbMaxConnIdle := *mi
+	if v := os.Getenv("DB_MAX_CONN_IDLE_TIME"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			dbMaxConnIdle = d
+		}
+	}
+
+	deleteChunkSize := *dc
+	if v := os.Getenv("DELETE_CHUNK_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			deleteChunkSize = n
+		}
+	}
+
+	deleteBatchSize := *wb
+	if v := os.Getenv("DELETE_BATCH_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			deleteBatchSize = n
+		}
+	}
+
+	deleteInterval := *wi
+	if v := os.Getenv("DELETE_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			deleteInterval = d
+		}
+	}
+
+	clickBatchSize := *cb
+	if v := os.Getenv("CLICK_BATCH_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			clickBatchSize = n
+		}
+	}
+
+	clickInterval := *ci
+	if v := os.Getenv("CLICK_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			clickInterval = d
+		}
+	}
+
+	fileSync := *fs
+	if v := os.Getenv("FILE_FSYNC"); v != "" {
+		fileSync = v
+	}
+
+	boltPath := *bp
+	if v := os.Getenv("BOLT_STORAGE_PATH"); v != "" {
+		boltPath = v
+	}
+
+	cacheSize := *cz
+	if v := os.Getenv("CACHE_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cacheSize = n
+		}
+	}
+
+	cacheTTL := *ct
+	if v := os.Getenv("CACHE_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cacheTTL = d
+		}
+	}
+
+	cacheNegativeTTL := *cn
+	if v := os.Getenv("CACHE_NEGATIVE_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cacheNegativeTTL = d
+		}
+	}
+
+	jwtSecret := *js
+	if v := os.Getenv("JWT_SECRET"); v != "" {
+		jwtSecret = v
+	}
+
+	jwtKeyFile := *jf
+	if v := os.Getenv("JWT_KEY_FILE"); v != "" {
+		jwtKeyFile = v
+	}
+
+	jwtTokenExp := *je
+	if v := os.Getenv("JWT_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			jwtTokenExp = d
+		}
+	}
+
+	jwtRefresh := *jr
+	if v := os.Getenv("JWT_REFRESH_BEFORE"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			jwtRefresh = d
+		}
+	}
+
+	cookieSecure := *ks
+	if v := os.Getenv("COOKIE_SECURE"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cookieSecure = b
+		}
+	}
+
+	cookieHTTPOnly := *kh
+	if v := os.Getenv("COOKIE_HTTP_ONLY"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cookieHTTPOnly = b
+		}
+	}
+
+	cookieSameSite := *kp
+	if v := os.Getenv("COOKIE_SAMESITE"); v != "" {
+		cookieSameSite = v
+	}
+
+	cookieDomain := *kd
+	if v := os.Getenv("COOKIE_DOMAIN"); v != "" {
+		cookieDomain = v
+	}
+
+	oidcIssuer := *oi
+	if v := os.Getenv("OIDC_ISSUER"); v != "" {
+		oidcIssuer = v
+	}
+
+	oidcClientID := *oc
+	if v := os.Getenv("OIDC_CLIENT_ID"); v != "" {
+		oidcClientID = v
+	}
+
+	oidcClientSecret := *ot
+	if v := os.Getenv("OIDC_CLIENT_SECRET"); v != "" {
+		oidcClientSecret = v
+	}
+
+	oidcRedirectURL := *or
+	if v := os.Getenv("OIDC_REDIRECT_URL"); v != "" {
+		oidcRedirectURL = v
+	}
+
+	oidcJWKSURL := *oj
+	if v := os.Getenv("OIDC_JWKS_URL"); v != "" {
+		oidcJWKSURL = v
+	}
+
+	trustedProxies := *tp
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		trustedProxies = v
+	}
+
+	internalAddr := *ia
+	if v := os.Getenv("INTERNAL_ADDRESS"); v != "" {
+		internalAddr = v
+	}
+
 	return Config{
 		Host:             runAddr,
 		ResultShortURL:   baseURL,
 		FileStoragePath:  fileName,
 		ConnectionString: connString,
+		ExpireInterval:   expireInterval,
+		ClickSalt:        clickSalt,
+		ClickSaltFile:    clickSaltFile,
+		CodeStrategy:     codeStrategy,
+		CodeLength:       codeLength,
+		HashidsSalt:      hashidsSalt,
+		DBMaxConns:       dbMaxConns,
+		DBMinConns:       dbMinConns,
+		DBMaxConnLife:    dbMaxConnLife,
+		DBMaxConnIdle:    dbMaxConnIdle,
+		DeleteChunkSize:  deleteChunkSize,
+		DeleteBatchSize:  deleteBatchSize,
+		DeleteInterval:   deleteInterval,
+		ClickBatchSize:   clickBatchSize,
+		ClickInterval:    clickInterval,
+		FileSync:         fileSync,
+		BoltStoragePath:  boltPath,
+		CacheSize:        cacheSize,
+		CacheTTL:         cacheTTL,
+		CacheNegativeTTL: cacheNegativeTTL,
+		JWTSecret:        jwtSecret,
+		JWTKeyFile:       jwtKeyFile,
+		JWTTokenExp:      jwtTokenExp,
+		JWTRefresh:       jwtRefresh,
+		CookieSecure:     cookieSecure,
+		CookieHTTPOnly:   cookieHTTPOnly,
+		CookieSameSite:   cookieSameSite,
+		CookieDomain:     cookieDomain,
+		OIDCIssuer:       oidcIssuer,
+		OIDCClientID:     oidcClientID,
+		OIDCClientSecret: oidcClientSecret,
+		OIDCRedirectURL:  oidcRedirectURL,
+		OIDCJWKSURL:      oidcJWKSURL,
+		TrustedProxies:   trustedProxies,
+		InternalHost:     internalAddr,
 	}
 }
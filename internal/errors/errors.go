@@ -4,5 +4,82 @@ import (
 	"errors"
 )
 
-var ErrUniqueIndex = errors.New("unique index error")
-var ErrShortURLNotFound = errors.New("not found short_url error")
+// Kind - категория доменной ошибки, по ней слой обработчиков выбирает HTTP статус
+type Kind int
+
+const (
+	KindInternal     Kind = iota //непредвиденная ошибка, подробности клиенту не раскрываются
+	KindNotFound                 //запрошенного объекта нет
+	KindGone                     //объект был, но удален или истек
+	KindConflict                 //объект уже существует
+	KindForbidden                //объект принадлежит другому пользователю
+	KindValidation               //некорректный запрос
+	KindUnavailable              //хранилище временно недоступно, запрос можно повторить
+	KindUnauthorized             //пользователь не опознан
+)
+
+// Error - доменная ошибка со стабильным кодом, на который могут опираться клиенты API
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+}
+
+func New(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// As - первая доменная ошибка в цепочке err
+func As(err error) (*Error, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+// KindOf - категория первой доменной ошибки в цепочке, для остальных ошибок KindInternal
+func KindOf(err error) Kind {
+	if e, ok := As(err); ok {
+		return e.Kind
+	}
+	return KindInternal
+}
+
+var ErrUniqueIndex = New(KindConflict, "url_exists", "unique index error")
+var ErrShortURLNotFound = New(KindNotFound, "short_url_not_found", "not found short_url error")
+var ErrShortURLExists = New(KindConflict, "short_url_exists", "short_url already exists error")
+var ErrShortURLDeleted = New(KindGone, "short_url_deleted", "short_url deleted error")
+var ErrShortURLExpired = New(KindGone, "short_url_expired", "short_url expired error")
+var ErrAliasNotValid = New(KindValidation, "alias_not_valid", "not valid alias error")
+var ErrAliasNotApplied = New(KindConflict, "alias_not_applied", "alias not applied, url is already shortened error")
+var ErrExpiresNotValid = New(KindValidation, "expires_not_valid", "not valid expiration error")
+var ErrRedirectTypeNotValid = New(KindValidation, "redirect_type_not_valid", "not valid redirect type error")
+var ErrURLNotValid = New(KindValidation, "url_not_valid", "not valid url error")
+var ErrBodyMissing = New(KindValidation, "body_missing", "request body is missing error")
+var ErrBadJSON = New(KindValidation, "bad_json", "bad json error")
+var ErrDeleteURLsEmpty = New(KindValidation, "delete_urls_empty", "empty list of urls to delete error")
+var ErrJobIDNotValid = New(KindValidation, "job_id_not_valid", "not valid job id error")
+var ErrForbidden = New(KindForbidden, "forbidden", "forbidden error")
+var ErrStatsParamsNotValid = New(KindValidation, "stats_params_not_valid", "not valid stats params error")
+var ErrShortURLGenerate = New(KindUnavailable, "short_url_generate", "short_url generation attempts exceeded error")
+var ErrDeleteJobNotFound = New(KindNotFound, "delete_job_not_found", "not found delete job error")
+var ErrAPIKeyNotValid = New(KindValidation, "api_key_not_valid", "not valid api key params error")
+var ErrAPIKeyNotFound = New(KindNotFound, "api_key_not_found", "not found api key error")
+var ErrUserNotValid = New(KindValidation, "user_not_valid", "not valid login or password error")
+var ErrUserExists = New(KindConflict, "user_exists", "user already exists error")
+var ErrUserNotFound = New(KindNotFound, "user_not_found", "not found user error")
+var ErrCredentialsNotValid = New(KindUnauthorized, "credentials_not_valid", "wrong login or password error")
+var ErrUnauthorized = New(KindUnauthorized, "unauthorized", "missing or not valid credentials error")
+var ErrOIDCFlowNotValid = New(KindValidation, "oidc_flow_not_valid", "not valid oidc login flow error")
+var ErrOIDCLoginFailed = New(KindUnauthorized, "oidc_login_failed", "oidc login failed error")
+var ErrTeamNotValid = New(KindValidation, "team_not_valid", "not valid team params error")
+var ErrTeamNotFound = New(KindNotFound, "team_not_found", "not found team error")
+var ErrTeamMemberNotFound = New(KindNotFound, "team_member_not_found", "not found team member error")
+var ErrTeamLastOwner = New(KindConflict, "team_last_owner", "team must keep at least one owner error")
+var ErrStorageUnavailable = New(KindUnavailable, "storage_unavailable", "storage unavailable error")
+var ErrInternal = New(KindInternal, "internal", "internal error")
@@ -0,0 +1,75 @@
+package generator
+
+import (
+	"context"
+	"github.com/speps/go-hashids/v2"
+)
+
+// IDSource - источник монотонно растущих числовых идентификаторов (последовательность в postgresql, счетчик в файле)
+type IDSource interface {
+	NextID(context.Context) (int64, error)
+}
+
+// Counter кодирует очередной идентификатор в base62 - короткие последовательные коды
+type Counter struct {
+	source IDSource
+}
+
+func NewCounter(source IDSource) *Counter {
+	return &Counter{source: source}
+}
+
+// Generate - при коллизии (например, код уже занят пользовательским alias) просто берется следующий идентификатор
+func (g *Counter) Generate(ctx context.Context, originalURL string, attempt int) (string, error) {
+	id, err := g.source.NextID(ctx)
+	if err != nil {
+		return "", err
+	}
+	return EncodeBase62(uint64(id)), nil
+}
+
+// Hashids кодирует очередной идентификатор через hashids - коды не раскрывают порядок и количество ссылок
+type Hashids struct {
+	source IDSource
+	hd     *hashids.HashID
+}
+
+func NewHashids(source IDSource, salt string, minLength int) (*Hashids, error) {
+	data := hashids.NewData()
+	data.Alphabet = alphabet
+	data.Salt = salt
+	data.MinLength = minLength
+
+	hd, err := hashids.NewWithData(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Hashids{source: source, hd: hd}, nil
+}
+
+func (g *Hashids) Generate(ctx context.Context, originalURL string, attempt int) (string, error) {
+	id, err := g.source.NextID(ctx)
+	if err != nil {
+		return "", err
+	}
+	return g.hd.EncodeInt64([]int64{id})
+}
+
+// EncodeBase62 переводит число в строку из символов алфавита
+func EncodeBase62(n uint64) string {
+	if n == 0 {
+		return string(alphabet[0])
+	}
+
+	var result []byte
+	for n > 0 {
+		result = append(result, alphabet[n%uint64(len(alphabet))])
+		n /= uint64(len(alphabet))
+	}
+
+	//старший разряд должен быть первым
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return string(result)
+}
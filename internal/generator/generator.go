@@ -1,15 +1,129 @@
 package generator
 
-import "math/rand"
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"sync"
+)
 
 const (
 	alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+	DefaultLength = 6
+
+	maxLength      = 32
+	fillThreshold  = 0.25 //доля коллизий в окне наблюдений, при превышении которой длина кода увеличивается
+	fillWindow     = 200  //количество попыток в окне наблюдений
+	forceGrowAfter = 3    //номер попытки для одной ссылки, начиная с которого ее код длиннее текущей длины
+)
+
+// стратегии генерации коротких ссылок, выбираются в конфигурации
+const (
+	StrategyRandom  = "random"
+	StrategyCounter = "counter"
+	StrategyHashids = "hashids"
+	StrategyHash    = "hash"
 )
 
-func GetShortURL() string {
-	s := make([]byte, 6)
-	for i := range s {
-		s[i] = alphabet[rand.Intn(len(alphabet))]
+// Generator - стратегия получения коротких ссылок
+type Generator interface {
+	// Generate возвращает код для originalURL, attempt - номер попытки после коллизии, начиная с нуля
+	Generate(ctx context.Context, originalURL string, attempt int) (string, error)
+}
+
+// New создает генератор выбранной стратегии, source нужен стратегиям на основе числового идентификатора
+func New(strategy string, length int, salt string, source IDSource) (Generator, error) {
+	switch strategy {
+	case StrategyRandom, "":
+		return NewRandom(length), nil
+	case StrategyCounter:
+		return NewCounter(source), nil
+	case StrategyHashids:
+		return NewHashids(source, salt, length)
+	case StrategyHash:
+		return NewHash(length), nil
+	default:
+		return nil, fmt.Errorf("unknown short code strategy %q", strategy)
+	}
+}
+
+// Random генерирует случайные коды через crypto/rand.
+// При равномерной генерации доля коллизий равна доле занятого пространства кодов текущей длины,
+// поэтому по ней оценивается заполненность, и при превышении порога длина кода увеличивается.
+// Длина не сохраняется: после перезапуска она снова растет по доле коллизий, заполненность пространства при этом не меняется
+type Random struct {
+	mu         sync.Mutex
+	length     int
+	attempts   int
+	collisions int
+}
+
+func NewRandom(length int) *Random {
+	if length <= 0 {
+		length = DefaultLength
+	}
+	return &Random{length: length}
+}
+
+func (g *Random) Generate(ctx context.Context, originalURL string, attempt int) (string, error) {
+	return RandomString(g.observe(attempt))
+}
+
+// Length - текущая длина генерируемых кодов
+func (g *Random) Length() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.length
+}
+
+// observe учитывает попытку в окне наблюдений и возвращает длину кода для нее.
+// Повторные коллизии одной ссылки длину не меняют: для нее берется код длиннее только в этой попытке,
+// иначе несколько неудачных попыток подряд навсегда удлиняли бы коды всех ссылок
+func (g *Random) observe(attempt int) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.attempts++
+	if attempt > 0 {
+		g.collisions++
+	}
+
+	if g.attempts >= fillWindow {
+		if float64(g.collisions)/float64(g.attempts) > fillThreshold && g.length < maxLength {
+			g.length++
+		}
+		g.attempts, g.collisions = 0, 0
+	}
+
+	if attempt >= forceGrowAfter && g.length < maxLength {
+		return g.length + 1
+	}
+	return g.length
+}
+
+// RandomString возвращает строку из символов алфавита заданной длины без смещения распределения
+func RandomString(length int) (string, error) {
+	//байты >= limit отбрасываем, чтобы остаток от деления на размер алфавита был равновероятным
+	const limit = 256 - 256%len(alphabet)
+
+	result := make([]byte, 0, length)
+	buf := make([]byte, length*2)
+
+	for len(result) < length {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+
+		for _, b := range buf {
+			if int(b) >= limit {
+				continue
+			}
+			result = append(result, alphabet[int(b)%len(alphabet)])
+			if len(result) == length {
+				break
+			}
+		}
 	}
-	return string(s)
+	return string(result), nil
 }
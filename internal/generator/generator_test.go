@@ -0,0 +1,135 @@
+package generator
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestRandom(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Random. Length and alphabet.", func(t *testing.T) {
+		g := NewRandom(DefaultLength)
+
+		for i := 0; i < 1000; i++ {
+			code, err := g.Generate(ctx, "https://practicum.yandex.ru/", 0)
+			require.NoError(t, err)
+
+			assert.Len(t, code, DefaultLength, "Длина кода не совпадает с ожидаемой")
+			for _, c := range code {
+				assert.True(t, strings.ContainsRune(alphabet, c), "Символ не из алфавита")
+			}
+		}
+		assert.Equal(t, DefaultLength, g.Length(), "Длина не должна расти без коллизий")
+	})
+
+	t.Run("Random. Longer code after repeated collisions of one url.", func(t *testing.T) {
+		g := NewRandom(DefaultLength)
+
+		code, err := g.Generate(ctx, "https://practicum.yandex.ru/", forceGrowAfter)
+		require.NoError(t, err)
+		assert.Len(t, code, DefaultLength+1, "Код после повторных коллизий должен быть длиннее")
+
+		//длина для остальных ссылок от коллизий одной ссылки не меняется
+		code, err = g.Generate(ctx, "https://practicum.yandex.ru/", 0)
+		require.NoError(t, err)
+		assert.Len(t, code, DefaultLength, "Длина кода не должна вырасти")
+		assert.Equal(t, DefaultLength, g.Length(), "Длина кода не должна вырасти")
+	})
+
+	t.Run("Random. Rare collisions do not grow length.", func(t *testing.T) {
+		g := NewRandom(DefaultLength)
+
+		//коллизия - каждая десятая попытка, доля ниже порога
+		for i := 0; i < fillWindow*3; i++ {
+			attempt := 0
+			if i%10 == 9 {
+				attempt = 1
+			}
+			_, err := g.Generate(ctx, "https://practicum.yandex.ru/", attempt)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, DefaultLength, g.Length(), "Длина кода не должна вырасти")
+	})
+
+	t.Run("Random. Grow when keyspace fill exceeds threshold.", func(t *testing.T) {
+		g := NewRandom(DefaultLength)
+
+		//каждая вторая попытка - коллизия, то есть пространство кодов заполнено наполовину
+		for i := 0; i < fillWindow; i++ {
+			_, err := g.Generate(ctx, "https://practicum.yandex.ru/", i%2)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, DefaultLength+1, g.Length(), "Длина кода должна вырасти")
+	})
+}
+
+// idSource - счетчик-заглушка вместо хранилища
+type idSource struct {
+	id int64
+}
+
+func (s *idSource) NextID(ctx context.Context) (int64, error) {
+	s.id++
+	return s.id, nil
+}
+
+func TestStrategies(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Counter. Sequential base62 codes.", func(t *testing.T) {
+		g, err := New(StrategyCounter, DefaultLength, "", &idSource{id: 60})
+		require.NoError(t, err)
+
+		codes := make([]string, 0, 3)
+		for i := 0; i < 3; i++ {
+			code, errGenerate := g.Generate(ctx, "https://practicum.yandex.ru/", 0)
+			require.NoError(t, errGenerate)
+			codes = append(codes, code)
+		}
+		assert.Equal(t, []string{"9", "ba", "bb"}, codes, "Коды не совпадают с ожидаемыми")
+	})
+
+	t.Run("Hashids. Unique codes with minimal length.", func(t *testing.T) {
+		g, err := New(StrategyHashids, DefaultLength, "salt", &idSource{})
+		require.NoError(t, err)
+
+		seen := make(map[string]struct{})
+		for i := 0; i < 1000; i++ {
+			code, errGenerate := g.Generate(ctx, "https://practicum.yandex.ru/", 0)
+			require.NoError(t, errGenerate)
+			assert.GreaterOrEqual(t, len(code), DefaultLength, "Код короче минимальной длины")
+
+			_, ok := seen[code]
+			assert.False(t, ok, "Код повторился")
+			seen[code] = struct{}{}
+		}
+	})
+
+	t.Run("Hash. Deterministic codes.", func(t *testing.T) {
+		g, err := New(StrategyHash, DefaultLength, "", nil)
+		require.NoError(t, err)
+
+		first, err := g.Generate(ctx, "https://practicum.yandex.ru/", 0)
+		require.NoError(t, err)
+		second, err := g.Generate(ctx, "https://practicum.yandex.ru/", 0)
+		require.NoError(t, err)
+		other, err := g.Generate(ctx, "https://yandex.ru/", 0)
+		require.NoError(t, err)
+		retry, err := g.Generate(ctx, "https://practicum.yandex.ru/", 1)
+		require.NoError(t, err)
+
+		assert.Len(t, first, DefaultLength, "Длина кода не совпадает с ожидаемой")
+		assert.Equal(t, first, second, "Одинаковые ссылки должны получать одинаковые коды")
+		assert.NotEqual(t, first, other, "Разные ссылки должны получать разные коды")
+		assert.NotEqual(t, first, retry, "После коллизии код должен меняться")
+	})
+
+	t.Run("Unknown strategy.", func(t *testing.T) {
+		_, err := New("uuid", DefaultLength, "", nil)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,49 @@
+package generator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"strconv"
+)
+
+// Hash - детерминированный код из хеша оригинальной ссылки, одинаковые ссылки получают одинаковые коды
+type Hash struct {
+	length int
+}
+
+func NewHash(length int) *Hash {
+	if length <= 0 {
+		length = DefaultLength
+	}
+	return &Hash{length: length}
+}
+
+// Generate - при коллизии с другой ссылкой номер попытки подмешивается в хеш, а после нескольких попыток код удлиняется
+func (g *Hash) Generate(ctx context.Context, originalURL string, attempt int) (string, error) {
+	input := originalURL
+	if attempt > 0 {
+		input += "#" + strconv.Itoa(attempt)
+	}
+
+	length := g.length
+	if attempt >= forceGrowAfter {
+		length += attempt - forceGrowAfter + 1
+	}
+
+	sum := sha256.Sum256([]byte(input))
+
+	//каждые 8 байт хеша дают 10 символов base62, при нехватке хешируем повторно
+	result := make([]byte, 0, length)
+	for len(result) < length {
+		for i := 0; i < len(sum) && len(result) < length; i += 8 {
+			n := binary.BigEndian.Uint64(sum[i : i+8])
+			for j := 0; j < 10 && len(result) < length; j++ {
+				result = append(result, alphabet[n%uint64(len(alphabet))])
+				n /= uint64(len(alphabet))
+			}
+		}
+		sum = sha256.Sum256(sum[:])
+	}
+	return string(result), nil
+}
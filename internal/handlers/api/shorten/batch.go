@@ -2,6 +2,9 @@ package shorten
 
 import (
 	"encoding/json"
+	"fmt"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/handlers/problem"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
 	"github.com/dubrovsky1/url-shortener/internal/models"
 	"github.com/dubrovsky1/url-shortener/internal/service"
@@ -20,7 +23,7 @@ func Batch(s *service.Service) http.HandlerFunc {
 		logger.Sugar.Infow("Request batch Log.", "Body", string(body), "userID", userID)
 
 		if err != nil {
-			http.Error(res, "The request body is missing", http.StatusBadRequest)
+			problem.Write(res, req, errs.ErrBodyMissing)
 			return
 		}
 
@@ -28,31 +31,47 @@ func Batch(s *service.Service) http.HandlerFunc {
 		var data []models.BatchRequest
 
 		if err = json.Unmarshal(body, &data); err != nil {
-			http.Error(res, "Bad json", http.StatusBadRequest)
+			problem.Write(res, req, fmt.Errorf("%w: %s", errs.ErrBadJSON, err.Error()))
 			return
 		}
 
-		for _, row := range data {
+		for i, row := range data {
 			logger.Sugar.Infow("Request body urls.",
 				"correlation_id", row.CorrelationID,
 				"original_url", row.URL)
 
 			if _, errParseURL := url.Parse(row.URL); errParseURL != nil {
-				http.Error(res, "Not valid original URL.", http.StatusBadRequest)
+				problem.Write(res, req, fmt.Errorf("%w: %s", errs.ErrURLNotValid, errParseURL.Error()))
 				return
 			}
+
+			//приводим срок жизни к абсолютному моменту, чтобы хранилищу было достаточно expires_at
+			expiresAt, errExpires := service.ExpiresAt(row.ExpiresAt, row.TTLSeconds)
+			if errExpires != nil {
+				problem.Write(res, req, errExpires)
+				return
+			}
+			data[i].ExpiresAt = expiresAt
+			data[i].TTLSeconds = 0
+
+			redirectType, errRedirect := service.RedirectType(row.RedirectType)
+			if errRedirect != nil {
+				problem.Write(res, req, errRedirect)
+				return
+			}
+			data[i].RedirectType = redirectType
 		}
 
 		result, err := s.InsertBatch(ctx, data, models.Host(req.Host), userID)
 		if err != nil {
-			http.Error(res, "Insert error", http.StatusBadRequest)
+			problem.Write(res, req, err)
 			return
 		}
 
 		//создаем объект ответа models.Response и сериализуем его в json resp, который возвращаем в теле ответа
 		resp, err := json.Marshal(result)
 		if err != nil {
-			http.Error(res, "resp marshal error", http.StatusBadRequest)
+			problem.Write(res, req, err)
 			return
 		}
 
@@ -95,7 +95,8 @@ func TestBatch(t *testing.T) {
 												`),
 			},
 			Want: models.Want{
-				ExpectedCode: http.StatusBadRequest,
+				ExpectedCode:        http.StatusConflict,
+				ExpectedContentType: "application/problem+json",
 			},
 		},
 		{
@@ -125,6 +126,27 @@ func TestBatch(t *testing.T) {
 				ExpectedCode: http.StatusBadRequest,
 			},
 		},
+		{
+			Name: "Batch. Both ttl and expires_at.",
+			Ms: models.MockStorage{
+				Ctrl:  gomock.NewController(t),
+				Error: nil,
+			},
+			Rp: models.RequestParams{
+				Method: http.MethodPost,
+				JSONBody: bytes.NewBufferString(`
+													[{
+													    "correlation_id": "a",
+													    "original_url": "https://123456.ru/",
+													    "expires_at": "2100-01-01T00:00:00Z",
+													    "ttl_seconds": 60
+													}]
+												`),
+			},
+			Want: models.Want{
+				ExpectedCode: http.StatusBadRequest,
+			},
+		},
 		{
 			Name: "Batch. Bad json.",
 			Ms: models.MockStorage{
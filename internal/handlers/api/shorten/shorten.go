@@ -3,7 +3,9 @@ package shorten
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/handlers/problem"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
 	"github.com/dubrovsky1/url-shortener/internal/models"
 	"github.com/dubrovsky1/url-shortener/internal/service"
@@ -23,7 +25,7 @@ func Shorten(s *service.Service, resultShortURL string) http.HandlerFunc {
 
 		//проверяем корректность url из тела запроса
 		if err != nil {
-			http.Error(res, "The request body is missing", http.StatusBadRequest)
+			problem.Write(res, req, errs.ErrBodyMissing)
 			return
 		}
 
@@ -31,29 +33,49 @@ func Shorten(s *service.Service, resultShortURL string) http.HandlerFunc {
 		var r models.Request
 
 		if err = json.Unmarshal(body, &r); err != nil {
-			http.Error(res, "Bad json", http.StatusBadRequest)
+			problem.Write(res, req, fmt.Errorf("%w: %s", errs.ErrBadJSON, err.Error()))
 			return
 		}
 
 		if _, errParseURL := url.Parse(r.URL); errParseURL != nil {
-			http.Error(res, "Not valid result URL", http.StatusBadRequest)
+			problem.Write(res, req, fmt.Errorf("%w: %s", errs.ErrURLNotValid, errParseURL.Error()))
 			return
 		}
 
-		res.Header().Set("content-type", "application/json")
+		//срок жизни ссылки может быть задан абсолютным моментом или количеством секунд
+		expiresAt, errExpires := service.ExpiresAt(r.ExpiresAt, r.TTLSeconds)
+		if errExpires != nil {
+			problem.Write(res, req, errExpires)
+			return
+		}
+
+		redirectType, errRedirect := service.RedirectType(r.RedirectType)
+		if errRedirect != nil {
+			problem.Write(res, req, errRedirect)
+			return
+		}
 
 		item := models.ShortenURL{
-			OriginalURL: models.OriginalURL(r.URL),
-			UserID:      userID,
+			ShortURL:     models.ShortURL(r.Alias),
+			OriginalURL:  models.OriginalURL(r.URL),
+			UserID:       userID,
+			ExpiresAt:    expiresAt,
+			RedirectType: redirectType,
+			ForwardQuery: r.ForwardQuery,
+			TeamID:       r.TeamID,
 		}
 
 		//сохраняем в базу
 		shortURL, errSave := s.SaveURL(ctx, item)
+
+		//ошибки, кроме уже сокращенного URL: невалидный или занятый alias, недоступное хранилище
 		if errSave != nil && !errors.Is(errSave, errs.ErrUniqueIndex) {
-			http.Error(res, "Save shortURL error", http.StatusBadRequest)
+			problem.Write(res, req, errSave)
 			return
 		}
 
+		res.Header().Set("content-type", "application/json")
+
 		//если сохраняемый URL уже есть в базе, также формируем и возвращаем его короткую ссылку, но со статусом 409
 		if errors.Is(errSave, errs.ErrUniqueIndex) {
 			res.WriteHeader(http.StatusConflict)
@@ -70,15 +92,14 @@ func Shorten(s *service.Service, resultShortURL string) http.HandlerFunc {
 		}
 
 		if _, e := url.Parse(responseURL); e != nil {
-			http.Error(res, "Not valid result URL", http.StatusBadRequest)
+			logger.Sugar.Infow("Not valid result URL.", "error", e.Error())
 			return
 		}
 
 		//создаем объект ответа models.Response и сериализуем его в json resp, который возвращаем в теле ответа
 		resp, err := json.Marshal(models.Response{Result: responseURL})
-
 		if err != nil {
-			http.Error(res, "resp marshal error", http.StatusBadRequest)
+			logger.Sugar.Infow("Response marshal error.", "error", err.Error())
 			return
 		}
 
@@ -60,6 +60,159 @@ func TestShorten(t *testing.T) {
 				ExpectedShortURL:    "2Yy05g",
 			},
 		},
+		{
+			Name: "Shorten save url. Alias success.",
+			Ms: models.MockStorage{
+				Ctrl:        gomock.NewController(t),
+				OriginalURL: "https://practicum.yandex.ru/",
+				ShortURL:    "spring-sale",
+				Error:       nil,
+			},
+			Rp: models.RequestParams{
+				Method:   http.MethodPost,
+				JSONBody: bytes.NewBufferString(`{"url": "https://practicum.yandex.ru/", "alias": "spring-sale"}`),
+			},
+			Want: models.Want{
+				ExpectedCode:        http.StatusCreated,
+				ExpectedContentType: "application/json",
+				ExpectedShortURL:    "spring-sale",
+			},
+		},
+		{
+			Name: "Shorten save url. Alias already exists.",
+			Ms: models.MockStorage{
+				Ctrl:        gomock.NewController(t),
+				OriginalURL: "https://practicum.yandex.ru/",
+				ShortURL:    "",
+				Error:       errs.ErrShortURLExists,
+			},
+			Rp: models.RequestParams{
+				Method:   http.MethodPost,
+				JSONBody: bytes.NewBufferString(`{"url": "https://practicum.yandex.ru/", "alias": "spring-sale"}`),
+			},
+			Want: models.Want{
+				ExpectedCode: http.StatusConflict,
+			},
+		},
+		{
+			Name: "Shorten save url. Alias on already shortened URL.",
+			Ms: models.MockStorage{
+				Ctrl:        gomock.NewController(t),
+				OriginalURL: "https://yandex.ru/",
+				ShortURL:    "2Yy05g",
+				Error:       errs.ErrUniqueIndex,
+			},
+			Rp: models.RequestParams{
+				Method:   http.MethodPost,
+				JSONBody: bytes.NewBufferString(`{"url": "https://yandex.ru/", "alias": "spring-sale"}`),
+			},
+			Want: models.Want{
+				ExpectedCode:        http.StatusConflict,
+				ExpectedContentType: "application/problem+json",
+				ExpectedJSONBody: `{"type":"about:blank","title":"Conflict","status":409,"detail":"alias not applied, url is already shortened error: url is already shortened as 2Yy05g",` +
+					`"instance":"/api/shorten","code":"alias_not_applied"}`,
+			},
+		},
+		{
+			Name: "Shorten save url. Reserved alias.",
+			Ms: models.MockStorage{
+				Ctrl:        gomock.NewController(t),
+				OriginalURL: "https://practicum.yandex.ru/",
+				ShortURL:    "ping",
+				Error:       nil,
+			},
+			Rp: models.RequestParams{
+				Method:   http.MethodPost,
+				JSONBody: bytes.NewBufferString(`{"url": "https://practicum.yandex.ru/", "alias": "ping"}`),
+			},
+			Want: models.Want{
+				ExpectedCode: http.StatusBadRequest,
+			},
+		},
+		{
+			Name: "Shorten save url. Not valid alias.",
+			Ms: models.MockStorage{
+				Ctrl:        gomock.NewController(t),
+				OriginalURL: "https://practicum.yandex.ru/",
+				ShortURL:    "spring sale!",
+				Error:       nil,
+			},
+			Rp: models.RequestParams{
+				Method:   http.MethodPost,
+				JSONBody: bytes.NewBufferString(`{"url": "https://practicum.yandex.ru/", "alias": "spring sale!"}`),
+			},
+			Want: models.Want{
+				ExpectedCode: http.StatusBadRequest,
+			},
+		},
+		{
+			Name: "Shorten save url. TTL success.",
+			Ms: models.MockStorage{
+				Ctrl:        gomock.NewController(t),
+				OriginalURL: "https://practicum.yandex.ru/",
+				ShortURL:    "jB9Wbk",
+				Error:       nil,
+			},
+			Rp: models.RequestParams{
+				Method:   http.MethodPost,
+				JSONBody: bytes.NewBufferString(`{"url": "https://practicum.yandex.ru/", "ttl_seconds": 3600}`),
+			},
+			Want: models.Want{
+				ExpectedCode:        http.StatusCreated,
+				ExpectedContentType: "application/json",
+				ExpectedShortURL:    "jB9Wbk",
+			},
+		},
+		{
+			Name: "Shorten save url. Expires in the past.",
+			Ms: models.MockStorage{
+				Ctrl:        gomock.NewController(t),
+				OriginalURL: "https://practicum.yandex.ru/",
+				ShortURL:    "jB9Wbk",
+				Error:       nil,
+			},
+			Rp: models.RequestParams{
+				Method:   http.MethodPost,
+				JSONBody: bytes.NewBufferString(`{"url": "https://practicum.yandex.ru/", "expires_at": "2000-01-01T00:00:00Z"}`),
+			},
+			Want: models.Want{
+				ExpectedCode: http.StatusBadRequest,
+			},
+		},
+		{
+			Name: "Shorten save url. Redirect type success.",
+			Ms: models.MockStorage{
+				Ctrl:        gomock.NewController(t),
+				OriginalURL: "https://practicum.yandex.ru/",
+				ShortURL:    "jB9Wbk",
+				Error:       nil,
+			},
+			Rp: models.RequestParams{
+				Method:   http.MethodPost,
+				JSONBody: bytes.NewBufferString(`{"url": "https://practicum.yandex.ru/", "redirect_type": 308, "forward_query": true}`),
+			},
+			Want: models.Want{
+				ExpectedCode:        http.StatusCreated,
+				ExpectedContentType: "application/json",
+				ExpectedShortURL:    "jB9Wbk",
+			},
+		},
+		{
+			Name: "Shorten save url. Not valid redirect type.",
+			Ms: models.MockStorage{
+				Ctrl:        gomock.NewController(t),
+				OriginalURL: "https://practicum.yandex.ru/",
+				ShortURL:    "jB9Wbk",
+				Error:       nil,
+			},
+			Rp: models.RequestParams{
+				Method:   http.MethodPost,
+				JSONBody: bytes.NewBufferString(`{"url": "https://practicum.yandex.ru/", "redirect_type": 303}`),
+			},
+			Want: models.Want{
+				ExpectedCode: http.StatusBadRequest,
+			},
+		},
 		{
 			Name: "Shorten save url. No exists body.",
 			Ms: models.MockStorage{
@@ -118,6 +271,8 @@ func TestShorten(t *testing.T) {
 			serv := service.New(storage, 10, 10*time.Second)
 
 			storage.EXPECT().SaveURL(gomock.Any(), gomock.Any()).Return(tt.Ms.ShortURL, tt.Ms.Error).AnyTimes()
+			//уже сохраненная ссылка жива - отдается ее код
+			storage.EXPECT().GetURL(gomock.Any(), tt.Ms.ShortURL).Return(models.ShortenURL{ShortURL: tt.Ms.ShortURL}, nil).AnyTimes()
 
 			r := chi.NewRouter()
 			r.Post("/api/shorten", auth.Auth(logger.WithLogging(gzip.GzipMiddleware(Shorten(serv, "http://localhost:8080/")))))
@@ -141,13 +296,57 @@ func TestShorten(t *testing.T) {
 
 			assert.Equal(t, tt.Want.ExpectedCode, resp.StatusCode, "Код ответа не совпадает с ожидаемым")
 
-			if tt.Want.ExpectedCode != http.StatusBadRequest {
+			if tt.Want.ExpectedCode != http.StatusBadRequest && tt.Want.ExpectedShortURL != "" {
 				assert.Equal(t, tt.Want.ExpectedContentType, resp.Header.Get("content-type"), "content-type не совпадает с ожидаемым")
 				assert.Equal(t, `{"result":"`+ts.URL+`/`+tt.Want.ExpectedShortURL+`"}`, string(respBody), "Body не совпадает с ожидаемым")
 			}
 
+			if tt.Want.ExpectedJSONBody != "" {
+				assert.Equal(t, tt.Want.ExpectedContentType, resp.Header.Get("content-type"), "content-type не совпадает с ожидаемым")
+				assert.JSONEq(t, tt.Want.ExpectedJSONBody, string(respBody), "Body не совпадает с ожидаемым")
+			}
+
 			t.Log("=============================================================>")
 		})
 	}
 
 }
+
+func TestShortenExpiredDuplicate(t *testing.T) {
+	logger.Initialize()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := mocks.NewMockStorager(ctrl)
+	serv := service.New(storage, 10, 10*time.Second)
+
+	//URL уже сокращен, но срок жизни ссылки истек раньше, чем ее пометил обработчик: выдается новый код, а не мертвый
+	expiredAt := time.Now().Add(-time.Minute)
+	gomock.InOrder(
+		storage.EXPECT().SaveURL(gomock.Any(), gomock.Any()).Return(models.ShortURL("2Yy05g"), errs.ErrUniqueIndex),
+		storage.EXPECT().GetURL(gomock.Any(), models.ShortURL("2Yy05g")).Return(models.ShortenURL{ShortURL: "2Yy05g", ExpiresAt: &expiredAt}, nil),
+		storage.EXPECT().DeleteExpired(gomock.Any(), gomock.Any()).Return(int64(1), nil),
+		storage.EXPECT().SaveURL(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ any, item models.ShortenURL) (models.ShortURL, error) {
+				return item.ShortURL, nil
+			}),
+	)
+
+	r := chi.NewRouter()
+	r.Post("/api/shorten", auth.Auth(logger.WithLogging(gzip.GzipMiddleware(Shorten(serv, "http://localhost:8080/")))))
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	resp, err := ts.Client().Post(ts.URL+"/api/shorten", "application/json", bytes.NewBufferString(`{"url": "https://yandex.ru/"}`))
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, "Код ответа не совпадает с ожидаемым")
+	assert.NotContains(t, string(respBody), "2Yy05g", "Мертвый код не должен возвращаться")
+}
@@ -0,0 +1,178 @@
+package teams
+
+import (
+	"encoding/json"
+	"fmt"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/handlers/problem"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/dubrovsky1/url-shortener/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"io"
+	"net/http"
+)
+
+func CreateTeam(s *service.Service) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		userID := ctx.Value(models.KeyUserID("UserID")).(uuid.UUID)
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			problem.Write(res, req, errs.ErrBodyMissing)
+			return
+		}
+
+		var data models.TeamRequest
+
+		if err = json.Unmarshal(body, &data); err != nil {
+			problem.Write(res, req, fmt.Errorf("%w: %s", errs.ErrBadJSON, err.Error()))
+			return
+		}
+
+		logger.Sugar.Infow("Request create team Log.", "userID", userID, "name", data.Name)
+
+		team, err := s.CreateTeam(ctx, userID, data)
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		res.Header().Set("Location", "/api/teams/"+team.ID.String())
+		writeJSON(res, req, http.StatusCreated, team)
+	}
+}
+
+func ListTeams(s *service.Service) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		userID := ctx.Value(models.KeyUserID("UserID")).(uuid.UUID)
+
+		result, err := s.ListTeams(ctx, userID)
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		//пустой список отдаем массивом, а не null
+		if result == nil {
+			result = []models.Team{}
+		}
+		writeJSON(res, req, http.StatusOK, result)
+	}
+}
+
+func ListMembers(s *service.Service) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		userID := ctx.Value(models.KeyUserID("UserID")).(uuid.UUID)
+
+		teamID, err := parseID(req, "id")
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		result, err := s.ListTeamMembers(ctx, userID, teamID)
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		if result == nil {
+			result = []models.TeamMember{}
+		}
+		writeJSON(res, req, http.StatusOK, result)
+	}
+}
+
+func SetMember(s *service.Service) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		userID := ctx.Value(models.KeyUserID("UserID")).(uuid.UUID)
+
+		teamID, err := parseID(req, "id")
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		memberID, err := parseID(req, "user_id")
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			problem.Write(res, req, errs.ErrBodyMissing)
+			return
+		}
+
+		var data models.TeamMemberRequest
+
+		if err = json.Unmarshal(body, &data); err != nil {
+			problem.Write(res, req, fmt.Errorf("%w: %s", errs.ErrBadJSON, err.Error()))
+			return
+		}
+
+		logger.Sugar.Infow("Request set team member Log.", "userID", userID, "teamID", teamID, "memberID", memberID, "role", data.Role)
+
+		member, err := s.SetTeamMember(ctx, userID, teamID, memberID, data)
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+		writeJSON(res, req, http.StatusOK, member)
+	}
+}
+
+func RemoveMember(s *service.Service) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		userID := ctx.Value(models.KeyUserID("UserID")).(uuid.UUID)
+
+		teamID, err := parseID(req, "id")
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		memberID, err := parseID(req, "user_id")
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		logger.Sugar.Infow("Request remove team member Log.", "userID", userID, "teamID", teamID, "memberID", memberID)
+
+		if err = s.RemoveTeamMember(ctx, userID, teamID, memberID); err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		res.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// parseID - идентификатор из пути запроса
+func parseID(req *http.Request, name string) (uuid.UUID, error) {
+	id, err := uuid.Parse(chi.URLParam(req, name))
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%w: %s: %s", errs.ErrTeamNotValid, name, err.Error())
+	}
+	return id, nil
+}
+
+func writeJSON(res http.ResponseWriter, req *http.Request, status int, v any) {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		problem.Write(res, req, err)
+		return
+	}
+
+	res.Header().Set("content-type", "application/json")
+	res.WriteHeader(status)
+	res.Write(resp)
+}
@@ -0,0 +1,259 @@
+package teams
+
+import (
+	"bytes"
+	"encoding/json"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/auth"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/gzip"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/dubrovsky1/url-shortener/internal/service"
+	"github.com/dubrovsky1/url-shortener/internal/storage/mocks"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTeams(t *testing.T) {
+	logger.Initialize()
+
+	teamID := uuid.MustParse("5c1f6a1e-3f0e-4b8a-9d0e-2a7c3f1b6d42")
+	memberID := uuid.MustParse("9e2d7c4b-1a6f-4e3d-8b5c-0f1e2d3c4b5a")
+	createdAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	members := "/api/teams/" + teamID.String() + "/members"
+
+	//role - роль пользователя из куки в команде teamID, пустая - не участник
+	member := func(s *mocks.MockStorager, userID uuid.UUID, role models.Role) {
+		if role == "" {
+			s.EXPECT().GetTeamMember(gomock.Any(), teamID, userID).Return(models.TeamMember{}, errs.ErrTeamMemberNotFound)
+			return
+		}
+		s.EXPECT().GetTeamMember(gomock.Any(), teamID, userID).Return(models.TeamMember{TeamID: teamID, UserID: userID, Role: role, CreatedAt: createdAt}, nil)
+	}
+
+	tests := []struct {
+		name   string
+		rp     models.RequestParams
+		setup  func(s *mocks.MockStorager, userID uuid.UUID) //ожидания хранилища
+		want   models.Want
+		status int
+	}{
+		{
+			name: "CreateTeam. Success.",
+			rp:   models.RequestParams{Method: http.MethodPost, URL: "/api/teams", Body: `{"name":" marketing "}`},
+			setup: func(s *mocks.MockStorager, userID uuid.UUID) {
+				s.EXPECT().CreateTeam(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ any, team models.Team, owner models.TeamMember) error {
+						//создатель становится владельцем
+						assert.Equal(t, "marketing", team.Name)
+						assert.Equal(t, team.ID, owner.TeamID)
+						assert.Equal(t, userID, owner.UserID)
+						assert.Equal(t, models.RoleOwner, owner.Role)
+						return nil
+					})
+			},
+			want: models.Want{ExpectedCode: http.StatusCreated, ExpectedContentType: "application/json"},
+		},
+		{
+			name:  "CreateTeam. Empty name.",
+			rp:    models.RequestParams{Method: http.MethodPost, URL: "/api/teams", Body: `{"name":"  "}`},
+			setup: func(*mocks.MockStorager, uuid.UUID) {},
+			want:  models.Want{ExpectedCode: http.StatusBadRequest, ExpectedContentType: "application/problem+json"},
+		},
+		{
+			name: "ListTeams. Success.",
+			rp:   models.RequestParams{Method: http.MethodGet, URL: "/api/teams"},
+			setup: func(s *mocks.MockStorager, userID uuid.UUID) {
+				s.EXPECT().ListTeams(gomock.Any(), userID).Return([]models.Team{{ID: teamID, Name: "marketing", CreatedAt: createdAt, Role: models.RoleEditor}}, nil)
+			},
+			want: models.Want{
+				ExpectedCode:        http.StatusOK,
+				ExpectedContentType: "application/json",
+				ExpectedJSONBody:    `[{"id":"5c1f6a1e-3f0e-4b8a-9d0e-2a7c3f1b6d42","name":"marketing","created_at":"2024-01-01T10:00:00Z","role":"editor"}]`,
+			},
+		},
+		{
+			name: "ListTeams. Empty.",
+			rp:   models.RequestParams{Method: http.MethodGet, URL: "/api/teams"},
+			setup: func(s *mocks.MockStorager, userID uuid.UUID) {
+				s.EXPECT().ListTeams(gomock.Any(), userID).Return(nil, nil)
+			},
+			want: models.Want{ExpectedCode: http.StatusOK, ExpectedContentType: "application/json", ExpectedJSONBody: `[]`},
+		},
+		{
+			name: "ListMembers. Viewer.",
+			rp:   models.RequestParams{Method: http.MethodGet, URL: members},
+			setup: func(s *mocks.MockStorager, userID uuid.UUID) {
+				member(s, userID, models.RoleViewer)
+				s.EXPECT().ListTeamMembers(gomock.Any(), teamID).Return([]models.TeamMember{{TeamID: teamID, UserID: memberID, Role: models.RoleOwner, CreatedAt: createdAt}}, nil)
+			},
+			want: models.Want{
+				ExpectedCode:        http.StatusOK,
+				ExpectedContentType: "application/json",
+				ExpectedJSONBody:    `[{"user_id":"9e2d7c4b-1a6f-4e3d-8b5c-0f1e2d3c4b5a","role":"owner","created_at":"2024-01-01T10:00:00Z"}]`,
+			},
+		},
+		{
+			name: "ListMembers. Not a member.",
+			rp:   models.RequestParams{Method: http.MethodGet, URL: members},
+			setup: func(s *mocks.MockStorager, userID uuid.UUID) {
+				member(s, userID, "")
+			},
+			want: models.Want{ExpectedCode: http.StatusNotFound, ExpectedContentType: "application/problem+json"},
+		},
+		{
+			name:  "ListMembers. Not valid team id.",
+			rp:    models.RequestParams{Method: http.MethodGet, URL: "/api/teams/abc/members"},
+			setup: func(*mocks.MockStorager, uuid.UUID) {},
+			want:  models.Want{ExpectedCode: http.StatusBadRequest, ExpectedContentType: "application/problem+json"},
+		},
+		{
+			name: "SetMember. Owner adds member.",
+			rp:   models.RequestParams{Method: http.MethodPut, URL: members + "/" + memberID.String(), Body: `{"role":"editor"}`},
+			setup: func(s *mocks.MockStorager, userID uuid.UUID) {
+				member(s, userID, models.RoleOwner)
+				s.EXPECT().GetTeamMember(gomock.Any(), teamID, memberID).Return(models.TeamMember{}, errs.ErrTeamMemberNotFound)
+				s.EXPECT().SaveTeamMember(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ any, m models.TeamMember) error {
+						assert.Equal(t, teamID, m.TeamID)
+						assert.Equal(t, memberID, m.UserID)
+						assert.Equal(t, models.RoleEditor, m.Role)
+						return nil
+					})
+			},
+			want: models.Want{ExpectedCode: http.StatusOK, ExpectedContentType: "application/json"},
+		},
+		{
+			name: "SetMember. Editor can not manage members.",
+			rp:   models.RequestParams{Method: http.MethodPut, URL: members + "/" + memberID.String(), Body: `{"role":"editor"}`},
+			setup: func(s *mocks.MockStorager, userID uuid.UUID) {
+				member(s, userID, models.RoleEditor)
+			},
+			want: models.Want{ExpectedCode: http.StatusForbidden, ExpectedContentType: "application/problem+json"},
+		},
+		{
+			name:  "SetMember. Unknown role.",
+			rp:    models.RequestParams{Method: http.MethodPut, URL: members + "/" + memberID.String(), Body: `{"role":"admin"}`},
+			setup: func(*mocks.MockStorager, uuid.UUID) {},
+			want:  models.Want{ExpectedCode: http.StatusBadRequest, ExpectedContentType: "application/problem+json"},
+		},
+		{
+			name: "SetMember. Last owner can not be demoted.",
+			rp:   models.RequestParams{Method: http.MethodPut, URL: members + "/" + memberID.String(), Body: `{"role":"viewer"}`},
+			setup: func(s *mocks.MockStorager, userID uuid.UUID) {
+				member(s, userID, models.RoleOwner)
+				s.EXPECT().GetTeamMember(gomock.Any(), teamID, memberID).Return(models.TeamMember{TeamID: teamID, UserID: memberID, Role: models.RoleOwner}, nil)
+				s.EXPECT().SaveTeamMember(gomock.Any(), gomock.Any()).Return(errs.ErrTeamLastOwner)
+			},
+			want: models.Want{ExpectedCode: http.StatusConflict, ExpectedContentType: "application/problem+json"},
+		},
+		{
+			name: "RemoveMember. Member leaves.",
+			rp:   models.RequestParams{Method: http.MethodDelete},
+			setup: func(s *mocks.MockStorager, userID uuid.UUID) {
+				member(s, userID, models.RoleViewer)
+				s.EXPECT().DeleteTeamMember(gomock.Any(), teamID, userID).Return(nil)
+			},
+			want: models.Want{ExpectedCode: http.StatusNoContent},
+		},
+		{
+			name: "RemoveMember. Viewer can not remove others.",
+			rp:   models.RequestParams{Method: http.MethodDelete, URL: members + "/" + memberID.String()},
+			setup: func(s *mocks.MockStorager, userID uuid.UUID) {
+				member(s, userID, models.RoleViewer)
+			},
+			want: models.Want{ExpectedCode: http.StatusForbidden, ExpectedContentType: "application/problem+json"},
+		},
+		{
+			name: "RemoveMember. Last owner can not leave.",
+			rp:   models.RequestParams{Method: http.MethodDelete},
+			setup: func(s *mocks.MockStorager, userID uuid.UUID) {
+				member(s, userID, models.RoleOwner)
+				s.EXPECT().DeleteTeamMember(gomock.Any(), teamID, userID).Return(errs.ErrTeamLastOwner)
+			},
+			want: models.Want{ExpectedCode: http.StatusConflict, ExpectedContentType: "application/problem+json"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//хранилище-заглушка
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			storage := mocks.NewMockStorager(ctrl)
+			serv := service.New(storage, 10, 10*time.Second)
+
+			tokenString, errToken := auth.BuildJWTString()
+			require.NoError(t, errToken)
+
+			userID, errGetUserID := auth.GetUserID(tokenString)
+			require.NoError(t, errGetUserID)
+
+			tt.setup(storage, userID)
+
+			//выход из команды - удаление самого себя
+			if tt.rp.URL == "" {
+				tt.rp.URL = members + "/" + userID.String()
+			}
+
+			//маршрутизация запроса
+			r := chi.NewRouter()
+			r.Post("/api/teams", auth.Auth(logger.WithLogging(gzip.GzipMiddleware(CreateTeam(serv)))))
+			r.Get("/api/teams", auth.Auth(logger.WithLogging(gzip.GzipMiddleware(ListTeams(serv)))))
+			r.Get("/api/teams/{id}/members", auth.Auth(logger.WithLogging(gzip.GzipMiddleware(ListMembers(serv)))))
+			r.Put("/api/teams/{id}/members/{user_id}", auth.Auth(logger.WithLogging(gzip.GzipMiddleware(SetMember(serv)))))
+			r.Delete("/api/teams/{id}/members/{user_id}", auth.Auth(logger.WithLogging(gzip.GzipMiddleware(RemoveMember(serv)))))
+
+			//создание http сервера
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			req, errReq := http.NewRequest(tt.rp.Method, ts.URL+tt.rp.URL, bytes.NewBufferString(tt.rp.Body))
+			require.NoError(t, errReq)
+
+			req.AddCookie(&http.Cookie{
+				Name:  "userid",
+				Value: tokenString,
+			})
+
+			client := ts.Client()
+			resp, errResp := client.Do(req)
+			require.NoError(t, errResp)
+
+			defer resp.Body.Close()
+
+			respBody, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want.ExpectedCode, resp.StatusCode, "Код ответа не совпадает с ожидаемым")
+
+			if tt.want.ExpectedContentType != "" {
+				assert.Equal(t, tt.want.ExpectedContentType, resp.Header.Get("content-type"), "content-type не совпадает с ожидаемым")
+			}
+
+			if tt.want.ExpectedJSONBody != "" {
+				assert.JSONEq(t, tt.want.ExpectedJSONBody, string(respBody), "Body не совпадает с ожидаемым")
+			}
+
+			if tt.want.ExpectedCode == http.StatusCreated {
+				var team models.Team
+				require.NoError(t, json.Unmarshal(respBody, &team))
+
+				assert.Equal(t, "marketing", team.Name)
+				assert.Equal(t, models.RoleOwner, team.Role)
+				assert.Equal(t, "/api/teams/"+team.ID.String(), resp.Header.Get("Location"))
+			}
+
+			t.Log("=============================================================>")
+		})
+	}
+}
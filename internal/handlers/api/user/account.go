@@ -0,0 +1,102 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/handlers/problem"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/auth"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/dubrovsky1/url-shortener/internal/service"
+	"github.com/google/uuid"
+	"io"
+	"net/http"
+)
+
+// signFunc - регистрация или вход с переносом ссылок анонимного пользователя
+type signFunc func(context.Context, uuid.UUID, models.Credentials) (models.User, int64, error)
+
+func Register(s *service.Service) http.HandlerFunc {
+	return sign(s.Register, http.StatusCreated)
+}
+
+func Login(s *service.Service) http.HandlerFunc {
+	return sign(s.Login, http.StatusOK)
+}
+
+// sign проверяет учетные данные и выдает сессию учетной записи в куке и в теле ответа
+func sign(f signFunc, status int) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		anonymous := ctx.Value(models.KeyUserID("UserID")).(uuid.UUID)
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			problem.Write(res, req, errs.ErrBodyMissing)
+			return
+		}
+
+		var data models.Credentials
+
+		if err = json.Unmarshal(body, &data); err != nil {
+			problem.Write(res, req, fmt.Errorf("%w: %s", errs.ErrBadJSON, err.Error()))
+			return
+		}
+
+		//пароль в лог не пишем
+		logger.Sugar.Infow("Request sign Log.", "path", req.URL.Path, "login", data.Login, "anonymous", anonymous)
+
+		user, merged, err := f(ctx, anonymous, data)
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		writeSession(res, req, user, merged, status)
+	}
+}
+
+// OIDCCallback завершает вход через провайдера OIDC, вызывается внутри auth.OIDCCallback
+func OIDCCallback(s *service.Service) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		anonymous := ctx.Value(models.KeyUserID("UserID")).(uuid.UUID)
+
+		identity, ok := auth.OIDCIdentity(ctx)
+		if !ok {
+			problem.Write(res, req, errs.ErrCredentialsNotValid)
+			return
+		}
+
+		logger.Sugar.Infow("Request OIDC callback Log.", "issuer", identity.Issuer, "sub", identity.Subject, "anonymous", anonymous)
+
+		user, merged, err := s.LoginOIDC(ctx, anonymous, identity)
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		writeSession(res, req, user, merged, http.StatusOK)
+	}
+}
+
+// writeSession выдает сессию учетной записи в куке и в теле ответа
+func writeSession(res http.ResponseWriter, req *http.Request, user models.User, merged int64, status int) {
+	token, err := auth.IssueSession(res, user.ID)
+	if err != nil {
+		problem.Write(res, req, err)
+		return
+	}
+
+	resp, err := json.Marshal(models.SessionResponse{User: user, Token: token, MergedURLs: merged})
+	if err != nil {
+		problem.Write(res, req, err)
+		return
+	}
+
+	res.Header().Set("content-type", "application/json")
+	res.Header().Set("Cache-Control", "no-store")
+	res.WriteHeader(status)
+	res.Write(resp)
+}
@@ -0,0 +1,221 @@
+package user
+
+import (
+	"encoding/json"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/auth"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/gzip"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/dubrovsky1/url-shortener/internal/service"
+	"github.com/dubrovsky1/url-shortener/internal/storage/mocks"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccount(t *testing.T) {
+	logger.Initialize()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	account := models.User{ID: uuid.New(), Login: "alice", PasswordHash: string(hash), CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		name      string
+		url       string
+		body      string
+		anonymous bool                                             //запрос с кукой анонимного пользователя
+		setup     func(s *mocks.MockStorager, anonymous uuid.UUID) //ожидания хранилища
+		want      models.Want
+		merged    int64
+	}{
+		{
+			name:      "Register. Anonymous links are merged.",
+			url:       "/api/user/register",
+			body:      `{"login":" Alice ","password":"correct horse"}`,
+			anonymous: true,
+			setup: func(s *mocks.MockStorager, anonymous uuid.UUID) {
+				s.EXPECT().CreateUser(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ any, user models.User) error {
+						//логин хранится нормализованным, пароль - только хешем
+						assert.Equal(t, "alice", user.Login)
+						assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte("correct horse")))
+						return nil
+					})
+				s.EXPECT().GetUserByID(gomock.Any(), anonymous).Return(models.User{}, errs.ErrUserNotFound)
+				s.EXPECT().MergeUser(gomock.Any(), anonymous, gomock.Any()).Return(int64(2), nil)
+			},
+			want:   models.Want{ExpectedCode: http.StatusCreated, ExpectedContentType: "application/json"},
+			merged: 2,
+		},
+		{
+			name: "Register. Login is taken.",
+			url:  "/api/user/register",
+			body: `{"login":"alice","password":"correct horse"}`,
+			setup: func(s *mocks.MockStorager, _ uuid.UUID) {
+				s.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Return(errs.ErrUserExists)
+			},
+			want: models.Want{ExpectedCode: http.StatusConflict},
+		},
+		{
+			name:  "Register. Short password.",
+			url:   "/api/user/register",
+			body:  `{"login":"alice","password":"short"}`,
+			setup: func(s *mocks.MockStorager, _ uuid.UUID) {},
+			want:  models.Want{ExpectedCode: http.StatusBadRequest},
+		},
+		{
+			name:  "Register. Bad json.",
+			url:   "/api/user/register",
+			body:  `{"login":`,
+			setup: func(s *mocks.MockStorager, _ uuid.UUID) {},
+			want:  models.Want{ExpectedCode: http.StatusBadRequest},
+		},
+		{
+			name: "Login. Success without anonymous user.",
+			url:  "/api/user/login",
+			body: `{"login":"ALICE","password":"correct horse"}`,
+			setup: func(s *mocks.MockStorager, _ uuid.UUID) {
+				s.EXPECT().GetUserByLogin(gomock.Any(), "alice").Return(account, nil)
+			},
+			want: models.Want{ExpectedCode: http.StatusOK, ExpectedContentType: "application/json"},
+		},
+		{
+			name:      "Login. Anonymous links are merged.",
+			url:       "/api/user/login",
+			body:      `{"login":"alice","password":"correct horse"}`,
+			anonymous: true,
+			setup: func(s *mocks.MockStorager, anonymous uuid.UUID) {
+				s.EXPECT().GetUserByLogin(gomock.Any(), "alice").Return(account, nil)
+				s.EXPECT().GetUserByID(gomock.Any(), anonymous).Return(models.User{}, errs.ErrUserNotFound)
+				s.EXPECT().MergeUser(gomock.Any(), anonymous, account.ID).Return(int64(1), nil)
+			},
+			want:   models.Want{ExpectedCode: http.StatusOK, ExpectedContentType: "application/json"},
+			merged: 1,
+		},
+		{
+			name:      "Login. Another account in cookie is not merged.",
+			url:       "/api/user/login",
+			body:      `{"login":"alice","password":"correct horse"}`,
+			anonymous: true,
+			setup: func(s *mocks.MockStorager, anonymous uuid.UUID) {
+				s.EXPECT().GetUserByLogin(gomock.Any(), "alice").Return(account, nil)
+				s.EXPECT().GetUserByID(gomock.Any(), anonymous).Return(models.User{ID: anonymous, Login: "bob"}, nil)
+			},
+			want: models.Want{ExpectedCode: http.StatusOK, ExpectedContentType: "application/json"},
+		},
+		{
+			name: "Login. Wrong password.",
+			url:  "/api/user/login",
+			body: `{"login":"alice","password":"wrong horse"}`,
+			setup: func(s *mocks.MockStorager, _ uuid.UUID) {
+				s.EXPECT().GetUserByLogin(gomock.Any(), "alice").Return(account, nil)
+			},
+			want: models.Want{ExpectedCode: http.StatusUnauthorized},
+		},
+		{
+			name: "Login. Unknown login.",
+			url:  "/api/user/login",
+			body: `{"login":"bob","password":"correct horse"}`,
+			setup: func(s *mocks.MockStorager, _ uuid.UUID) {
+				s.EXPECT().GetUserByLogin(gomock.Any(), "bob").Return(models.User{}, errs.ErrUserNotFound)
+			},
+			want: models.Want{ExpectedCode: http.StatusUnauthorized},
+		},
+		{
+			name: "Login. OIDC account has no password.",
+			url:  "/api/user/login",
+			body: `{"login":"oidc:https://idp.example#alice","password":"correct horse"}`,
+			setup: func(s *mocks.MockStorager, _ uuid.UUID) {
+				s.EXPECT().GetUserByLogin(gomock.Any(), "oidc:https://idp.example#alice").Return(models.User{ID: uuid.New(), Login: "oidc:https://idp.example#alice"}, nil)
+			},
+			want: models.Want{ExpectedCode: http.StatusUnauthorized},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//хранилище-заглушка
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			storage := mocks.NewMockStorager(ctrl)
+			serv := service.New(storage, 10, 10*time.Second, service.WithPasswordCost(bcrypt.MinCost))
+
+			tokenString, errToken := auth.BuildJWTString()
+			require.NoError(t, errToken)
+
+			anonymous, errGetUserID := auth.GetUserID(tokenString)
+			require.NoError(t, errGetUserID)
+
+			tt.setup(storage, anonymous)
+
+			//маршрутизация запроса
+			r := chi.NewRouter()
+			r.Post("/api/user/register", auth.Identify(logger.WithLogging(gzip.GzipMiddleware(Register(serv)))))
+			r.Post("/api/user/login", auth.Identify(logger.WithLogging(gzip.GzipMiddleware(Login(serv)))))
+
+			//создание http сервера
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			req, errReq := http.NewRequest(http.MethodPost, ts.URL+tt.url, strings.NewReader(tt.body))
+			require.NoError(t, errReq)
+
+			if tt.anonymous {
+				req.AddCookie(&http.Cookie{
+					Name:  "userid",
+					Value: tokenString,
+				})
+			}
+
+			client := ts.Client()
+			resp, errResp := client.Do(req)
+			require.NoError(t, errResp)
+
+			defer resp.Body.Close()
+
+			respBody, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want.ExpectedCode, resp.StatusCode, "Код ответа не совпадает с ожидаемым")
+
+			if tt.want.ExpectedContentType == "" {
+				assert.Empty(t, resp.Cookies(), "Сессия выдается только после успешного входа")
+				return
+			}
+
+			assert.Equal(t, tt.want.ExpectedContentType, resp.Header.Get("content-type"), "content-type не совпадает с ожидаемым")
+
+			var session models.SessionResponse
+			require.NoError(t, json.Unmarshal(respBody, &session))
+
+			assert.Equal(t, "alice", session.Login)
+			assert.Equal(t, tt.merged, session.MergedURLs)
+			assert.NotContains(t, string(respBody), "password")
+
+			//сессия учетной записи и в куке, и в теле ответа
+			cookies := resp.Cookies()
+			require.Len(t, cookies, 1)
+			assert.Equal(t, session.Token, cookies[0].Value)
+
+			userID, err := auth.GetUserID(session.Token)
+			require.NoError(t, err)
+			assert.Equal(t, session.ID, userID)
+			assert.NotEqual(t, anonymous, userID)
+
+			t.Log("=============================================================>")
+		})
+	}
+}
@@ -2,6 +2,9 @@ package user
 
 import (
 	"encoding/json"
+	"fmt"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/handlers/problem"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
 	"github.com/dubrovsky1/url-shortener/internal/models"
 	"github.com/dubrovsky1/url-shortener/internal/service"
@@ -19,14 +22,14 @@ func DeleteURL(s *service.Service) http.HandlerFunc {
 		logger.Sugar.Infow("Request Log.", "Body", string(body), "userID", userID)
 
 		if err != nil {
-			http.Error(res, "The request body is missing", http.StatusBadRequest)
+			problem.Write(res, req, errs.ErrBodyMissing)
 			return
 		}
 
 		var data []models.ShortURL
 
 		if err = json.Unmarshal(body, &data); err != nil {
-			http.Error(res, "Bad json", http.StatusBadRequest)
+			problem.Write(res, req, fmt.Errorf("%w: %s", errs.ErrBadJSON, err.Error()))
 			return
 		}
 
@@ -38,13 +41,22 @@ func DeleteURL(s *service.Service) http.HandlerFunc {
 
 		//logger.Sugar.Infow("DeleteURL handler log.", "data", data, "deletedItems", deletedItems)
 
-		err = s.DeleteURL(ctx, deletedItems)
+		jobID, err := s.DeleteURL(ctx, deletedItems)
 		if err != nil {
-			http.Error(res, err.Error(), http.StatusBadRequest)
+			problem.Write(res, req, err)
 			return
 		}
 
-		res.Header().Set("content-type", "text/plain")
+		//ход удаления можно отследить по заданию
+		resp, err := json.Marshal(models.DeleteJobResponse{JobID: jobID})
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		res.Header().Set("content-type", "application/json")
+		res.Header().Set("Location", "/api/user/deletions/"+jobID.String())
 		res.WriteHeader(http.StatusAccepted)
+		res.Write(resp)
 	}
 }
@@ -3,6 +3,9 @@ package user
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/auth"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/gzip"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
@@ -11,15 +14,126 @@ import (
 	"github.com/dubrovsky1/url-shortener/internal/storage/mocks"
 	"github.com/go-chi/chi/v5"
 	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"io"
 	"net/http"
-	"net/http/cookiejar"
 	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 )
 
+// outboxMock - очередь на удаление поверх заглушки хранилища: что поставлено в очередь, то и будет выдано обработчику
+type outboxMock struct {
+	mu      sync.Mutex
+	items   []models.OutboxItem
+	updated chan []models.OutboxItem
+}
+
+func newOutboxMock(storage *mocks.MockStorager, enqueueErr error) *outboxMock {
+	o := &outboxMock{updated: make(chan []models.OutboxItem, 10)}
+
+	storage.EXPECT().EnqueueDeletes(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, jobID uuid.UUID, items []models.DeletedURLS) error {
+			if enqueueErr != nil {
+				return enqueueErr
+			}
+			o.mu.Lock()
+			defer o.mu.Unlock()
+			for _, item := range items {
+				o.items = append(o.items, models.OutboxItem{
+					ID:       int64(len(o.items) + 1),
+					JobID:    jobID,
+					UserID:   item.UserID,
+					ShortURL: item.ShortURL,
+					Status:   models.OutboxPending,
+				})
+			}
+			return nil
+		}).AnyTimes()
+
+	storage.EXPECT().FetchDeletes(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ time.Time, limit int) ([]models.OutboxItem, error) {
+			o.mu.Lock()
+			defer o.mu.Unlock()
+			var result []models.OutboxItem
+			for _, item := range o.items {
+				if item.Status == models.OutboxPending && item.Attempts == 0 && len(result) < limit {
+					result = append(result, item)
+				}
+			}
+			return result, nil
+		}).AnyTimes()
+
+	storage.EXPECT().UpdateDeletes(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, items []models.OutboxItem) error {
+			o.mu.Lock()
+			defer o.mu.Unlock()
+			for _, item := range items {
+				o.items[item.ID-1] = item
+			}
+			o.updated <- items
+			return nil
+		}).AnyTimes()
+
+	storage.EXPECT().GetDeleteJob(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, jobID uuid.UUID) ([]models.OutboxItem, error) {
+			o.mu.Lock()
+			defer o.mu.Unlock()
+			var result []models.OutboxItem
+			for _, item := range o.items {
+				if item.JobID == jobID {
+					result = append(result, item)
+				}
+			}
+			return result, nil
+		}).AnyTimes()
+
+	storage.EXPECT().PurgeDeletes(gomock.Any(), gomock.Any()).Return(int64(0), nil).AnyTimes()
+
+	return o
+}
+
+// deleteClient - пользователь с кукой авторизации и сервер с ручками удаления
+type deleteClient struct {
+	ts     *httptest.Server
+	token  string
+	userID uuid.UUID
+}
+
+func newDeleteClient(t *testing.T, serv *service.Service) *deleteClient {
+	//маршрутизация запроса
+	r := chi.NewRouter()
+	r.Delete("/api/user/urls", auth.Auth(logger.WithLogging(gzip.GzipMiddleware(DeleteURL(serv)))))
+	r.Get("/api/user/deletions/{job_id}", auth.Auth(logger.WithLogging(gzip.GzipMiddleware(DeleteJob(serv)))))
+
+	tokenString, errToken := auth.BuildJWTString()
+	require.NoError(t, errToken)
+
+	userID, errGetUserID := auth.GetUserID(tokenString)
+	require.NoError(t, errGetUserID)
+
+	return &deleteClient{ts: httptest.NewServer(r), token: tokenString, userID: userID}
+}
+
+func (c *deleteClient) do(t *testing.T, method, path, body string) (*http.Response, []byte) {
+	req, errReq := http.NewRequest(method, c.ts.URL+path, bytes.NewBufferString(body))
+	require.NoError(t, errReq)
+
+	req.AddCookie(&http.Cookie{Name: "userid", Value: c.token})
+
+	resp, errResp := c.ts.Client().Do(req)
+	require.NoError(t, errResp)
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return resp, respBody
+}
+
 func TestDeleteURL(t *testing.T) {
 	logger.Initialize()
 
@@ -32,18 +146,54 @@ func TestDeleteURL(t *testing.T) {
 					{
 						ShortURL: "MlFSA8",
 					},
-					{
-						ShortURL: "BUuk89",
-					},
 				},
 				Error: nil,
 			},
 			Rp: models.RequestParams{
-				Method:   http.MethodDelete,
-				JSONBody: bytes.NewBufferString(`["MlFSA8","BUuk89"]`),
+				Body: `["MlFSA8","BUuk89","abcdef"]`,
 			},
 			Want: models.Want{
 				ExpectedCode: http.StatusAccepted,
+				ExpectedJSONBody: `[{"short_url":"MlFSA8","result":"deleted"},
+									{"short_url":"BUuk89","result":"not_owned"},
+									{"short_url":"abcdef","result":"not_found"}]`,
+			},
+		},
+		{
+			Name: "Delete. Enqueue error.",
+			Ms: models.MockStorage{
+				Ctrl:  gomock.NewController(t),
+				Error: errors.New("outbox unavailable"),
+			},
+			Rp: models.RequestParams{
+				Body: `["MlFSA8"]`,
+			},
+			Want: models.Want{
+				ExpectedCode: http.StatusInternalServerError,
+			},
+		},
+		{
+			Name: "Delete. Bad json.",
+			Ms: models.MockStorage{
+				Ctrl: gomock.NewController(t),
+			},
+			Rp: models.RequestParams{
+				Body: `["MlFSA8",`,
+			},
+			Want: models.Want{
+				ExpectedCode: http.StatusBadRequest,
+			},
+		},
+		{
+			Name: "Delete. Empty list.",
+			Ms: models.MockStorage{
+				Ctrl: gomock.NewController(t),
+			},
+			Rp: models.RequestParams{
+				Body: `[]`,
+			},
+			Want: models.Want{
+				ExpectedCode: http.StatusBadRequest,
 			},
 		},
 	}
@@ -54,58 +204,205 @@ func TestDeleteURL(t *testing.T) {
 			defer tt.Ms.Ctrl.Finish()
 
 			storage := mocks.NewMockStorager(tt.Ms.Ctrl)
-			serv := service.New(storage, 2, 1*time.Second)
+			serv := service.New(storage, 10, 1*time.Second)
+			outbox := newOutboxMock(storage, tt.Ms.Error)
+
+			client := newDeleteClient(t, serv)
+			defer client.ts.Close()
+
+			for i := range tt.Ms.DeletedURLS {
+				tt.Ms.DeletedURLS[i].UserID = client.userID
+			}
+
+			//удаляется только MlFSA8, BUuk89 принадлежит другому пользователю, abcdef не существует
+			storage.EXPECT().DeleteURL(gomock.Any(), gomock.Any()).Return(tt.Ms.DeletedURLS, nil).AnyTimes()
+			storage.EXPECT().GetURL(gomock.Any(), models.ShortURL("BUuk89")).Return(models.ShortenURL{ShortURL: "BUuk89", UserID: uuid.New()}, nil).AnyTimes()
+			storage.EXPECT().GetURL(gomock.Any(), models.ShortURL("abcdef")).Return(models.ShortenURL{}, errs.ErrShortURLNotFound).AnyTimes()
+
 			serv.Run(context.Background())
+			defer serv.Close()
 
-			//маршрутизация запроса
-			r := chi.NewRouter()
-			r.Delete("/api/user/urls", auth.Auth(logger.WithLogging(gzip.GzipMiddleware(DeleteURL(serv)))))
+			resp, body := client.do(t, http.MethodDelete, "/api/user/urls", tt.Rp.Body)
+			assert.Equal(t, tt.Want.ExpectedCode, resp.StatusCode, "Код ответа не совпадает с ожидаемым")
 
-			//создание http сервера
-			ts := httptest.NewServer(r)
-			defer ts.Close()
+			if tt.Want.ExpectedCode != http.StatusAccepted {
+				return
+			}
 
-			URL := ts.URL + "/api/user/urls"
+			var accepted models.DeleteJobResponse
+			require.NoError(t, json.Unmarshal(body, &accepted))
+			assert.Equal(t, "/api/user/deletions/"+accepted.JobID.String(), resp.Header.Get("Location"), "Location не совпадает с ожидаемым")
 
-			req, errReq := http.NewRequest(tt.Rp.Method, URL, tt.Rp.JSONBody)
-			require.NoError(t, errReq)
+			//после 202 записи должны быть обработаны
+			select {
+			case <-outbox.updated:
+			case <-time.After(3 * time.Second):
+				t.Fatal("Очередь на удаление не обработана")
+			}
 
-			client := ts.Client()
+			resp, body = client.do(t, http.MethodGet, resp.Header.Get("Location"), "")
+			require.Equal(t, http.StatusOK, resp.StatusCode, "Код ответа не совпадает с ожидаемым")
 
-			//добавляем куку к запросу
-			jar, err := cookiejar.New(nil)
+			var job models.DeleteJob
+			require.NoError(t, json.Unmarshal(body, &job))
+			assert.Equal(t, accepted.JobID, job.JobID, "Задание не совпадает с ожидаемым")
+			assert.Equal(t, models.DeleteJobDone, job.Status, "Статус задания не совпадает с ожидаемым")
+			assert.NotNil(t, job.FinishedAt, "У завершенного задания должен быть момент завершения")
+
+			results, err := json.Marshal(job.Results)
 			require.NoError(t, err)
+			assert.JSONEq(t, tt.Want.ExpectedJSONBody, string(results), "Результаты не совпадают с ожидаемыми")
 
-			client.Jar = jar
+			t.Log("=============================================================>")
+		})
+	}
+}
 
-			tokenString, errToken := auth.BuildJWTString()
-			require.NoError(t, errToken)
+func TestDeleteTeamURL(t *testing.T) {
+	logger.Initialize()
 
-			c := http.Cookie{
-				Name:  "userid",
-				Value: tokenString,
-			}
-			req.AddCookie(&c)
+	tests := []struct {
+		name string
+		role models.Role //роль пользователя в команде ссылки
+		want string
+	}{
+		{name: "Delete team link. Editor.", role: models.RoleEditor, want: models.DeleteResultDeleted},
+		{name: "Delete team link. Viewer.", role: models.RoleViewer, want: models.DeleteResultNotOwned},
+	}
 
-			userID, errGetUserID := auth.GetUserID(tokenString)
-			require.NoError(t, errGetUserID)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//хранилище-заглушка
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
 
-			for i := range tt.Ms.DeletedURLS {
-				tt.Ms.DeletedURLS[i].UserID = userID
-			}
+			storage := mocks.NewMockStorager(ctrl)
+			serv := service.New(storage, 10, 1*time.Second)
+			outbox := newOutboxMock(storage, nil)
+
+			client := newDeleteClient(t, serv)
+			defer client.ts.Close()
 
-			storage.EXPECT().DeleteURL(gomock.Any(), tt.Ms.DeletedURLS).Return(tt.Ms.Error).AnyTimes()
+			teamID := uuid.New()
+			teamItem := models.DeletedURLS{UserID: client.userID, ShortURL: "MlFSA8", TeamID: teamID}
 
-			resp, errResp := client.Do(req)
-			require.NoError(t, errResp)
+			//ссылку создал другой участник, как личная она не удаляется, команда удаляет ее вторым проходом
+			storage.EXPECT().DeleteURL(gomock.Any(), []models.DeletedURLS{{UserID: client.userID, ShortURL: "MlFSA8"}}).Return(nil, nil)
+			storage.EXPECT().GetURL(gomock.Any(), models.ShortURL("MlFSA8")).Return(models.ShortenURL{ShortURL: "MlFSA8", UserID: uuid.New(), TeamID: teamID}, nil)
+			storage.EXPECT().GetTeamMember(gomock.Any(), teamID, client.userID).Return(models.TeamMember{TeamID: teamID, UserID: client.userID, Role: tt.role}, nil)
+			if tt.role.Can(models.RoleEditor) {
+				storage.EXPECT().DeleteURL(gomock.Any(), []models.DeletedURLS{teamItem}).Return([]models.DeletedURLS{teamItem}, nil)
+			}
 
-			defer resp.Body.Close()
+			serv.Run(context.Background())
+			defer serv.Close()
 
-			serv.Close()
+			resp, _ := client.do(t, http.MethodDelete, "/api/user/urls", `["MlFSA8"]`)
+			require.Equal(t, http.StatusAccepted, resp.StatusCode, "Код ответа не совпадает с ожидаемым")
 
-			assert.Equal(t, tt.Want.ExpectedCode, resp.StatusCode, "Код ответа не совпадает с ожидаемым")
+			select {
+			case items := <-outbox.updated:
+				require.Len(t, items, 1)
+				assert.Equal(t, tt.want, items[0].Result, "Результат не совпадает с ожидаемым")
+			case <-time.After(3 * time.Second):
+				t.Fatal("Очередь на удаление не обработана")
+			}
 
 			t.Log("=============================================================>")
 		})
 	}
 }
+
+func TestDeleteJob(t *testing.T) {
+	logger.Initialize()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := mocks.NewMockStorager(ctrl)
+	serv := service.New(storage, 10, 1*time.Second)
+
+	client := newDeleteClient(t, serv)
+	defer client.ts.Close()
+
+	ownJob, otherJob := uuid.New(), uuid.New()
+
+	storage.EXPECT().GetDeleteJob(gomock.Any(), ownJob).Return([]models.OutboxItem{
+		{ID: 1, JobID: ownJob, UserID: client.userID, ShortURL: "MlFSA8", Status: models.OutboxPending, Attempts: 1, LastError: "database unavailable"},
+		{ID: 2, JobID: ownJob, UserID: client.userID, ShortURL: "BUuk89", Status: models.OutboxDone, Result: models.DeleteResultDeleted},
+	}, nil).AnyTimes()
+	storage.EXPECT().GetDeleteJob(gomock.Any(), otherJob).Return([]models.OutboxItem{
+		{ID: 3, JobID: otherJob, UserID: uuid.New(), ShortURL: "abcdef", Status: models.OutboxDone, Result: models.DeleteResultDeleted},
+	}, nil).AnyTimes()
+	storage.EXPECT().GetDeleteJob(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+
+	t.Run("Delete job. Pending.", func(t *testing.T) {
+		resp, body := client.do(t, http.MethodGet, "/api/user/deletions/"+ownJob.String(), "")
+		require.Equal(t, http.StatusOK, resp.StatusCode, "Код ответа не совпадает с ожидаемым")
+
+		var job models.DeleteJob
+		require.NoError(t, json.Unmarshal(body, &job))
+		assert.Equal(t, models.DeleteJobPending, job.Status, "Статус задания не совпадает с ожидаемым")
+		assert.Nil(t, job.FinishedAt, "У незавершенного задания не должно быть момента завершения")
+		assert.Equal(t, []models.DeleteJobResult{
+			{ShortURL: "MlFSA8", Result: models.DeleteResultPending, Error: "database unavailable"},
+			{ShortURL: "BUuk89", Result: models.DeleteResultDeleted},
+		}, job.Results, "Результаты не совпадают с ожидаемыми")
+	})
+
+	t.Run("Delete job. Another user.", func(t *testing.T) {
+		resp, _ := client.do(t, http.MethodGet, "/api/user/deletions/"+otherJob.String(), "")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "Код ответа не совпадает с ожидаемым")
+	})
+
+	t.Run("Delete job. Not found.", func(t *testing.T) {
+		resp, _ := client.do(t, http.MethodGet, "/api/user/deletions/"+uuid.New().String(), "")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "Код ответа не совпадает с ожидаемым")
+	})
+
+	t.Run("Delete job. Not valid job id.", func(t *testing.T) {
+		resp, _ := client.do(t, http.MethodGet, "/api/user/deletions/123", "")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "Код ответа не совпадает с ожидаемым")
+	})
+}
+
+func TestDeleteURLRetry(t *testing.T) {
+	logger.Initialize()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := mocks.NewMockStorager(ctrl)
+	serv := service.New(storage, 10, 1*time.Second, service.WithDeleteRetry(1, time.Second, time.Minute))
+	outbox := newOutboxMock(storage, nil)
+
+	storage.EXPECT().DeleteURL(gomock.Any(), gomock.Any()).Return(nil, errors.New("database unavailable")).AnyTimes()
+
+	client := newDeleteClient(t, serv)
+	defer client.ts.Close()
+
+	serv.Run(context.Background())
+	defer serv.Close()
+
+	resp, _ := client.do(t, http.MethodDelete, "/api/user/urls", `["MlFSA8"]`)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode, "Код ответа не совпадает с ожидаемым")
+
+	//единственная попытка не удалась - запись уходит в dead с текстом ошибки
+	select {
+	case items := <-outbox.updated:
+		require.Len(t, items, 1)
+		assert.Equal(t, models.OutboxDead, items[0].Status, "Статус записи не совпадает с ожидаемым")
+		assert.Equal(t, 1, items[0].Attempts, "Число попыток не совпадает с ожидаемым")
+		assert.Equal(t, "database unavailable", items[0].LastError, "Ошибка попытки не совпадает с ожидаемой")
+		assert.True(t, items[0].NextAttemptAt.After(time.Now()), "Следующая попытка должна быть отложена")
+	case <-time.After(3 * time.Second):
+		t.Fatal("Неудачная попытка удаления не сохранена")
+	}
+
+	resp, body := client.do(t, http.MethodGet, resp.Header.Get("Location"), "")
+	require.Equal(t, http.StatusOK, resp.StatusCode, "Код ответа не совпадает с ожидаемым")
+
+	var job models.DeleteJob
+	require.NoError(t, json.Unmarshal(body, &job))
+	assert.Equal(t, models.DeleteJobFailed, job.Status, "Статус задания не совпадает с ожидаемым")
+}
@@ -0,0 +1,77 @@
+package user
+
+import (
+	"encoding/json"
+	"fmt"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/handlers/problem"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/dubrovsky1/url-shortener/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"net/http"
+)
+
+// DeadDeletes - ссылки пользователя, удалить которые не удалось за отведенное число попыток
+func DeadDeletes(s *service.Service) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		userID := ctx.Value(models.KeyUserID("UserID")).(uuid.UUID)
+		logger.Sugar.Infow("Request Log.", "UserId", userID)
+
+		result, err := s.ListDeadDeletes(ctx, userID)
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		if len(result) == 0 {
+			res.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		resp, err := json.Marshal(result)
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		res.Header().Set("content-type", "application/json")
+		res.WriteHeader(http.StatusOK)
+		res.Write(resp)
+	}
+}
+
+// DeleteJob - состояние задания на удаление с результатом по каждой ссылке
+func DeleteJob(s *service.Service) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		userID := ctx.Value(models.KeyUserID("UserID")).(uuid.UUID)
+		logger.Sugar.Infow("Request delete job Log.", "UserId", userID, "jobID", chi.URLParam(req, "job_id"))
+
+		jobID, err := uuid.Parse(chi.URLParam(req, "job_id"))
+		if err != nil {
+			problem.Write(res, req, fmt.Errorf("%w: %s", errs.ErrJobIDNotValid, err.Error()))
+			return
+		}
+
+		job, err := s.GetDeleteJob(ctx, userID, jobID)
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		resp, err := json.Marshal(job)
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		res.Header().Set("content-type", "application/json")
+		res.WriteHeader(http.StatusOK)
+		res.Write(resp)
+
+		logger.Sugar.Infow("Response delete job Log.", "jobID", job.JobID, "status", job.Status)
+	}
+}
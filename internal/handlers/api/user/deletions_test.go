@@ -0,0 +1,130 @@
+package user
+
+import (
+	"errors"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/auth"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/gzip"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/dubrovsky1/url-shortener/internal/service"
+	"github.com/dubrovsky1/url-shortener/internal/storage/mocks"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeadDeletes(t *testing.T) {
+	logger.Initialize()
+
+	failedAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []models.TestCase{
+		{
+			Name: "Dead deletes. Success.",
+			Ms: models.MockStorage{
+				Ctrl: gomock.NewController(t),
+				Outbox: []models.OutboxItem{
+					{
+						ID:            7,
+						JobID:         uuid.MustParse("a9c5bd76-9a5d-4f5a-9a1a-0e1c1b0b2e11"),
+						ShortURL:      "MlFSA8",
+						Status:        models.OutboxDead,
+						Attempts:      10,
+						NextAttemptAt: failedAt,
+						LastError:     "database unavailable",
+						CreatedAt:     failedAt,
+						UpdatedAt:     failedAt,
+					},
+				},
+			},
+			Rp: models.RequestParams{
+				Method: http.MethodGet,
+			},
+			Want: models.Want{
+				ExpectedCode:        http.StatusOK,
+				ExpectedContentType: "application/json",
+				ExpectedJSONBody: `[{"id":7,"job_id":"a9c5bd76-9a5d-4f5a-9a1a-0e1c1b0b2e11","short_url":"MlFSA8",
+									"status":"dead","attempts":10,"next_attempt_at":"2024-01-01T10:00:00Z",
+									"last_error":"database unavailable","created_at":"2024-01-01T10:00:00Z",
+									"updated_at":"2024-01-01T10:00:00Z"}]`,
+			},
+		},
+		{
+			Name: "Dead deletes. No content.",
+			Ms: models.MockStorage{
+				Ctrl: gomock.NewController(t),
+			},
+			Rp: models.RequestParams{
+				Method: http.MethodGet,
+			},
+			Want: models.Want{
+				ExpectedCode: http.StatusNoContent,
+			},
+		},
+		{
+			Name: "Dead deletes. Error.",
+			Ms: models.MockStorage{
+				Ctrl:  gomock.NewController(t),
+				Error: errors.New("error"),
+			},
+			Rp: models.RequestParams{
+				Method: http.MethodGet,
+			},
+			Want: models.Want{
+				ExpectedCode: http.StatusInternalServerError,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			//хранилище-заглушка
+			defer tt.Ms.Ctrl.Finish()
+
+			storage := mocks.NewMockStorager(tt.Ms.Ctrl)
+			serv := service.New(storage, 10, 10*time.Second)
+
+			storage.EXPECT().ListDeadDeletes(gomock.Any(), gomock.Any()).Return(tt.Ms.Outbox, tt.Ms.Error)
+
+			//маршрутизация запроса
+			r := chi.NewRouter()
+			r.Get("/api/user/deletions/dead", auth.Auth(logger.WithLogging(gzip.GzipMiddleware(DeadDeletes(serv)))))
+
+			//создание http сервера
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			req, errReq := http.NewRequest(tt.Rp.Method, ts.URL+"/api/user/deletions/dead", nil)
+			require.NoError(t, errReq)
+
+			tokenString, errToken := auth.BuildJWTString()
+			require.NoError(t, errToken)
+
+			req.AddCookie(&http.Cookie{Name: "userid", Value: tokenString})
+
+			resp, errResp := ts.Client().Do(req)
+			require.NoError(t, errResp)
+
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.Want.ExpectedCode, resp.StatusCode, "Код ответа не совпадает с ожидаемым")
+
+			if tt.Want.ExpectedCode == http.StatusOK {
+				assert.Equal(t, tt.Want.ExpectedContentType, resp.Header.Get("content-type"), "content-type не совпадает с ожидаемым")
+
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.JSONEq(t, tt.Want.ExpectedJSONBody, string(body), "Тело ответа не совпадает с ожидаемым")
+			}
+
+			t.Log("=============================================================>")
+		})
+	}
+}
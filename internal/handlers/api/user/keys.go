@@ -0,0 +1,104 @@
+package user
+
+import (
+	"encoding/json"
+	"fmt"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/handlers/problem"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/dubrovsky1/url-shortener/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"io"
+	"net/http"
+)
+
+func CreateKey(s *service.Service) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		userID := ctx.Value(models.KeyUserID("UserID")).(uuid.UUID)
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			problem.Write(res, req, errs.ErrBodyMissing)
+			return
+		}
+
+		var data models.APIKeyRequest
+
+		if err = json.Unmarshal(body, &data); err != nil {
+			problem.Write(res, req, fmt.Errorf("%w: %s", errs.ErrBadJSON, err.Error()))
+			return
+		}
+
+		//сам ключ в лог не пишем
+		logger.Sugar.Infow("Request create api key Log.", "userID", userID, "name", data.Name, "scopes", data.Scopes)
+
+		result, err := s.CreateAPIKey(ctx, userID, data)
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		resp, err := json.Marshal(result)
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		res.Header().Set("content-type", "application/json")
+		res.Header().Set("Location", "/api/user/keys/"+result.ID.String())
+		res.WriteHeader(http.StatusCreated)
+		res.Write(resp)
+	}
+}
+
+func ListKeys(s *service.Service) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		userID := ctx.Value(models.KeyUserID("UserID")).(uuid.UUID)
+
+		result, err := s.ListAPIKeys(ctx, userID)
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		//пустой список отдаем массивом, а не null
+		if result == nil {
+			result = []models.APIKey{}
+		}
+
+		resp, err := json.Marshal(result)
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		res.Header().Set("content-type", "application/json")
+		res.WriteHeader(http.StatusOK)
+		res.Write(resp)
+	}
+}
+
+func RevokeKey(s *service.Service) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		userID := ctx.Value(models.KeyUserID("UserID")).(uuid.UUID)
+
+		keyID, err := uuid.Parse(chi.URLParam(req, "id"))
+		if err != nil {
+			problem.Write(res, req, fmt.Errorf("%w: %s", errs.ErrAPIKeyNotValid, err.Error()))
+			return
+		}
+
+		logger.Sugar.Infow("Request revoke api key Log.", "userID", userID, "keyID", keyID)
+
+		if err = s.RevokeAPIKey(ctx, userID, keyID); err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		res.WriteHeader(http.StatusNoContent)
+	}
+}
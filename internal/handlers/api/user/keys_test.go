@@ -0,0 +1,242 @@
+package user
+
+import (
+	"bytes"
+	"encoding/json"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/auth"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/gzip"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/dubrovsky1/url-shortener/internal/service"
+	"github.com/dubrovsky1/url-shortener/internal/storage/mocks"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeys(t *testing.T) {
+	logger.Initialize()
+
+	keyID := uuid.MustParse("0b4bd1b4-8c7e-4d3c-9a53-6b3f0d9b1a55")
+	createdAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []models.TestCase{
+		{
+			Name: "CreateKey. Success.",
+			Ms: models.MockStorage{
+				Ctrl:  gomock.NewController(t),
+				Error: nil,
+			},
+			Rp: models.RequestParams{
+				Method:   http.MethodPost,
+				URL:      "/api/user/keys",
+				JSONBody: bytes.NewBufferString(`{"name":" ci ","scopes":["write","read","write"]}`),
+			},
+			Want: models.Want{
+				ExpectedCode:        http.StatusCreated,
+				ExpectedContentType: "application/json",
+			},
+		},
+		{
+			Name: "CreateKey. Unknown scope.",
+			Ms: models.MockStorage{
+				Ctrl:  gomock.NewController(t),
+				Error: nil,
+			},
+			Rp: models.RequestParams{
+				Method:   http.MethodPost,
+				URL:      "/api/user/keys",
+				JSONBody: bytes.NewBufferString(`{"name":"ci","scopes":["admin"]}`),
+			},
+			Want: models.Want{
+				ExpectedCode: http.StatusBadRequest,
+			},
+		},
+		{
+			Name: "CreateKey. Bad json.",
+			Ms: models.MockStorage{
+				Ctrl:  gomock.NewController(t),
+				Error: nil,
+			},
+			Rp: models.RequestParams{
+				Method:   http.MethodPost,
+				URL:      "/api/user/keys",
+				JSONBody: bytes.NewBufferString(`{"name":`),
+			},
+			Want: models.Want{
+				ExpectedCode: http.StatusBadRequest,
+			},
+		},
+		{
+			Name: "ListKeys. Success.",
+			Ms: models.MockStorage{
+				Ctrl: gomock.NewController(t),
+				APIKeys: []models.APIKey{
+					{ID: keyID, Name: "ci", Prefix: "usk_abcdefgh", Hash: "secret-hash", Scopes: []models.Scope{models.ScopeRead}, CreatedAt: createdAt},
+				},
+				Error: nil,
+			},
+			Rp: models.RequestParams{
+				Method: http.MethodGet,
+				URL:    "/api/user/keys",
+			},
+			Want: models.Want{
+				ExpectedCode:        http.StatusOK,
+				ExpectedContentType: "application/json",
+				ExpectedJSONBody:    `[{"id":"0b4bd1b4-8c7e-4d3c-9a53-6b3f0d9b1a55","name":"ci","prefix":"usk_abcdefgh","scopes":["read"],"created_at":"2024-01-01T10:00:00Z"}]`,
+			},
+		},
+		{
+			Name: "ListKeys. Empty.",
+			Ms: models.MockStorage{
+				Ctrl:  gomock.NewController(t),
+				Error: nil,
+			},
+			Rp: models.RequestParams{
+				Method: http.MethodGet,
+				URL:    "/api/user/keys",
+			},
+			Want: models.Want{
+				ExpectedCode:        http.StatusOK,
+				ExpectedContentType: "application/json",
+				ExpectedJSONBody:    `[]`,
+			},
+		},
+		{
+			Name: "RevokeKey. Success.",
+			Ms: models.MockStorage{
+				Ctrl:  gomock.NewController(t),
+				Error: nil,
+			},
+			Rp: models.RequestParams{
+				Method: http.MethodDelete,
+				URL:    "/api/user/keys/" + keyID.String(),
+			},
+			Want: models.Want{
+				ExpectedCode: http.StatusNoContent,
+			},
+		},
+		{
+			Name: "RevokeKey. Not found.",
+			Ms: models.MockStorage{
+				Ctrl:  gomock.NewController(t),
+				Error: errs.ErrAPIKeyNotFound,
+			},
+			Rp: models.RequestParams{
+				Method: http.MethodDelete,
+				URL:    "/api/user/keys/" + keyID.String(),
+			},
+			Want: models.Want{
+				ExpectedCode: http.StatusNotFound,
+			},
+		},
+		{
+			Name: "RevokeKey. Not valid id.",
+			Ms: models.MockStorage{
+				Ctrl:  gomock.NewController(t),
+				Error: nil,
+			},
+			Rp: models.RequestParams{
+				Method: http.MethodDelete,
+				URL:    "/api/user/keys/abc",
+			},
+			Want: models.Want{
+				ExpectedCode: http.StatusBadRequest,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			//хранилище-заглушка
+			defer tt.Ms.Ctrl.Finish()
+
+			storage := mocks.NewMockStorager(tt.Ms.Ctrl)
+			serv := service.New(storage, 10, 10*time.Second)
+
+			tokenString, errToken := auth.BuildJWTString()
+			require.NoError(t, errToken)
+
+			userID, errGetUserID := auth.GetUserID(tokenString)
+			require.NoError(t, errGetUserID)
+
+			var saved models.APIKey
+			storage.EXPECT().SaveAPIKey(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ any, key models.APIKey) error {
+					saved = key
+					return tt.Ms.Error
+				}).AnyTimes()
+			storage.EXPECT().ListAPIKeys(gomock.Any(), userID).Return(tt.Ms.APIKeys, tt.Ms.Error).AnyTimes()
+			storage.EXPECT().RevokeAPIKey(gomock.Any(), userID, keyID, gomock.Any()).Return(tt.Ms.Error).AnyTimes()
+
+			//маршрутизация запроса
+			r := chi.NewRouter()
+			r.Post("/api/user/keys", auth.Auth(auth.RequireSession(logger.WithLogging(gzip.GzipMiddleware(CreateKey(serv))))))
+			r.Get("/api/user/keys", auth.Auth(auth.RequireSession(logger.WithLogging(gzip.GzipMiddleware(ListKeys(serv))))))
+			r.Delete("/api/user/keys/{id}", auth.Auth(auth.RequireSession(logger.WithLogging(gzip.GzipMiddleware(RevokeKey(serv))))))
+
+			//создание http сервера
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			var body io.Reader
+			if tt.Rp.JSONBody != nil {
+				body = tt.Rp.JSONBody
+			}
+
+			req, errReq := http.NewRequest(tt.Rp.Method, ts.URL+tt.Rp.URL, body)
+			require.NoError(t, errReq)
+
+			req.AddCookie(&http.Cookie{
+				Name:  "userid",
+				Value: tokenString,
+			})
+
+			client := ts.Client()
+			resp, errResp := client.Do(req)
+			require.NoError(t, errResp)
+
+			defer resp.Body.Close()
+
+			respBody, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.Want.ExpectedCode, resp.StatusCode, "Код ответа не совпадает с ожидаемым")
+
+			if tt.Want.ExpectedContentType != "" {
+				assert.Equal(t, tt.Want.ExpectedContentType, resp.Header.Get("content-type"), "content-type не совпадает с ожидаемым")
+			}
+
+			if tt.Want.ExpectedJSONBody != "" {
+				assert.JSONEq(t, tt.Want.ExpectedJSONBody, string(respBody), "Body не совпадает с ожидаемым")
+			}
+
+			//ключ отдается один раз, в хранилище попадает только его хеш
+			if tt.Want.ExpectedCode == http.StatusCreated {
+				var created models.APIKeyResponse
+				require.NoError(t, json.Unmarshal(respBody, &created))
+
+				assert.True(t, strings.HasPrefix(created.Key, models.APIKeyPrefix))
+				assert.Equal(t, created.Key[:len(created.Prefix)], created.Prefix)
+				assert.Equal(t, "ci", created.Name)
+				assert.Equal(t, []models.Scope{models.ScopeRead, models.ScopeWrite}, created.Scopes)
+				assert.Equal(t, "/api/user/keys/"+created.ID.String(), resp.Header.Get("Location"))
+
+				assert.Equal(t, userID, saved.UserID)
+				assert.Equal(t, service.HashAPIKey(created.Key), saved.Hash)
+				assert.NotContains(t, string(respBody), saved.Hash)
+			}
+
+			t.Log("=============================================================>")
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/auth"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/gzip"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/dubrovsky1/url-shortener/internal/oidc"
+	"github.com/dubrovsky1/url-shortener/internal/oidc/oidctest"
+	"github.com/dubrovsky1/url-shortener/internal/service"
+	"github.com/dubrovsky1/url-shortener/internal/storage/mocks"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestOIDCCallback(t *testing.T) {
+	logger.Initialize()
+
+	issuer, err := oidctest.New("shortener")
+	require.NoError(t, err)
+	defer issuer.Close()
+
+	issuer.SetSubject("alice")
+	identity := oidc.Identity{Issuer: issuer.URL, Subject: "alice"}
+
+	tests := []struct {
+		name      string
+		anonymous bool                                             //вход с кукой анонимного пользователя
+		setup     func(s *mocks.MockStorager, anonymous uuid.UUID) //ожидания хранилища
+		want      models.Want
+		merged    int64
+	}{
+		{
+			name:      "OIDC. First login creates account and merges anonymous links.",
+			anonymous: true,
+			setup: func(s *mocks.MockStorager, anonymous uuid.UUID) {
+				s.EXPECT().GetUserByID(gomock.Any(), identity.UserID()).Return(models.User{}, errs.ErrUserNotFound)
+				s.EXPECT().CreateUser(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ any, user models.User) error {
+						//у учетной записи провайдера нет пароля, войти по паролю в нее нельзя
+						assert.Equal(t, identity.UserID(), user.ID)
+						assert.Equal(t, identity.Login(), user.Login)
+						assert.Empty(t, user.PasswordHash)
+						return nil
+					})
+				s.EXPECT().GetUserByID(gomock.Any(), anonymous).Return(models.User{}, errs.ErrUserNotFound)
+				s.EXPECT().MergeUser(gomock.Any(), anonymous, identity.UserID()).Return(int64(3), nil)
+			},
+			want:   models.Want{ExpectedCode: http.StatusOK, ExpectedContentType: "application/json"},
+			merged: 3,
+		},
+		{
+			name: "OIDC. Returning user.",
+			setup: func(s *mocks.MockStorager, _ uuid.UUID) {
+				s.EXPECT().GetUserByID(gomock.Any(), identity.UserID()).Return(models.User{ID: identity.UserID(), Login: identity.Login()}, nil)
+			},
+			want: models.Want{ExpectedCode: http.StatusOK, ExpectedContentType: "application/json"},
+		},
+		{
+			name: "OIDC. Concurrent first login.",
+			setup: func(s *mocks.MockStorager, _ uuid.UUID) {
+				s.EXPECT().GetUserByID(gomock.Any(), identity.UserID()).Return(models.User{}, errs.ErrUserNotFound)
+				s.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Return(errs.ErrUserExists)
+				s.EXPECT().GetUserByID(gomock.Any(), identity.UserID()).Return(models.User{ID: identity.UserID(), Login: identity.Login()}, nil)
+			},
+			want: models.Want{ExpectedCode: http.StatusOK, ExpectedContentType: "application/json"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//хранилище-заглушка
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			storage := mocks.NewMockStorager(ctrl)
+			serv := service.New(storage, 10, 10*time.Second)
+
+			//маршрутизация запроса
+			r := chi.NewRouter()
+			r.Get("/api/user/oidc/login", logger.WithLogging(auth.OIDCLogin))
+			r.Get("/api/user/oidc/callback", auth.OIDCCallback(logger.WithLogging(gzip.GzipMiddleware(OIDCCallback(serv)))))
+
+			//создание http сервера
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			provider, err := oidc.New(context.Background(), oidc.Config{
+				Issuer:      issuer.URL,
+				ClientID:    "shortener",
+				RedirectURL: ts.URL + "/api/user/oidc/callback",
+			})
+			require.NoError(t, err)
+
+			key, err := auth.RandomKey()
+			require.NoError(t, err)
+			require.NoError(t, auth.Initialize(auth.Config{Keys: []auth.Key{key}, OIDC: provider}))
+			defer auth.Initialize(auth.Config{Keys: []auth.Key{key}, Cookie: auth.CookieConfig{HTTPOnly: true}})
+
+			tokenString, errToken := auth.BuildJWTString()
+			require.NoError(t, errToken)
+
+			anonymous, errGetUserID := auth.GetUserID(tokenString)
+			require.NoError(t, errGetUserID)
+
+			tt.setup(storage, anonymous)
+
+			//браузер проходит перенаправления к провайдеру и обратно, сохраняя куки
+			jar, err := cookiejar.New(nil)
+			require.NoError(t, err)
+
+			serverURL, _ := url.Parse(ts.URL)
+			if tt.anonymous {
+				jar.SetCookies(serverURL, []*http.Cookie{{Name: "userid", Value: tokenString, Path: "/"}})
+			}
+
+			client := &http.Client{Jar: jar}
+			resp, errResp := client.Get(ts.URL + "/api/user/oidc/login")
+			require.NoError(t, errResp)
+
+			defer resp.Body.Close()
+
+			respBody, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want.ExpectedCode, resp.StatusCode, "Код ответа не совпадает с ожидаемым")
+			assert.Equal(t, tt.want.ExpectedContentType, resp.Header.Get("content-type"), "content-type не совпадает с ожидаемым")
+
+			var session models.SessionResponse
+			require.NoError(t, json.Unmarshal(respBody, &session))
+
+			assert.Equal(t, identity.UserID(), session.ID)
+			assert.Equal(t, identity.Login(), session.Login)
+			assert.Equal(t, tt.merged, session.MergedURLs)
+
+			//сессия учетной записи теперь в куке браузера
+			userID, err := auth.GetUserID(session.Token)
+			require.NoError(t, err)
+			assert.Equal(t, identity.UserID(), userID)
+
+			cookies := map[string]string{}
+			for _, cookie := range jar.Cookies(serverURL) {
+				cookies[cookie.Name] = cookie.Value
+			}
+			assert.Equal(t, session.Token, cookies["userid"])
+			assert.NotContains(t, cookies, auth.FlowCookieName)
+
+			t.Log("=============================================================>")
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package user
+
+import (
+	"encoding/json"
+	"github.com/dubrovsky1/url-shortener/internal/handlers/problem"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/dubrovsky1/url-shortener/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+)
+
+func Stats(s *service.Service) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		userID := ctx.Value(models.KeyUserID("UserID")).(uuid.UUID)
+		shortURL := models.ShortURL(chi.URLParam(req, "id"))
+
+		query := req.URL.Query()
+		logger.Sugar.Infow("Request stats Log.", "shortURL", shortURL, "userID", userID, "query", query.Encode())
+
+		params, err := service.ParseStatsParams(query.Get("from"), query.Get("to"), query.Get("bucket"), time.Now())
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		result, err := s.Stats(ctx, userID, shortURL, params)
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		resp, err := json.Marshal(result)
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		res.Header().Set("content-type", "application/json")
+		res.WriteHeader(http.StatusOK)
+		res.Write(resp)
+
+		logger.Sugar.Infow("Response stats Log.", "shortURL", shortURL, "total_clicks", result.TotalClicks)
+	}
+}
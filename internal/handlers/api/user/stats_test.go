@@ -0,0 +1,233 @@
+package user
+
+import (
+	"context"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/auth"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/gzip"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/dubrovsky1/url-shortener/internal/service"
+	"github.com/dubrovsky1/url-shortener/internal/stats"
+	"github.com/dubrovsky1/url-shortener/internal/storage/mocks"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	logger.Initialize()
+
+	//пользователь из куки - участник команды teamID, но не otherTeamID
+	teamID, otherTeamID := uuid.New(), uuid.New()
+
+	clicks := []models.Click{
+		{
+			ShortURL:  "jB9Wbk",
+			ClickedAt: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+			Referrer:  "https://www.google.com/search?q=sale",
+			UserAgent: "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36",
+			IPHash:    "a",
+		},
+		{
+			ShortURL:  "jB9Wbk",
+			ClickedAt: time.Date(2024, 1, 2, 11, 0, 0, 0, time.UTC),
+			UserAgent: "curl/8.4.0",
+			IPHash:    "a",
+		},
+		{
+			ShortURL:  "jB9Wbk",
+			ClickedAt: time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC),
+			Referrer:  "https://google.com/",
+			UserAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+			IPHash:    "b",
+		},
+		{
+			ShortURL:  "jB9Wbk",
+			ClickedAt: time.Date(2024, 1, 3, 15, 0, 0, 0, time.UTC),
+			IPHash:    "c",
+		},
+	}
+
+	tests := []models.TestCase{
+		{
+			Name: "Stats. Success.",
+			Ms: models.MockStorage{
+				Ctrl:       gomock.NewController(t),
+				ShortURL:   "jB9Wbk",
+				ShortenURL: models.ShortenURL{ShortURL: "jB9Wbk", OriginalURL: "https://practicum.yandex.ru/"},
+				Clicks:     clicks,
+				Error:      nil,
+			},
+			Rp: models.RequestParams{
+				Method: http.MethodGet,
+				URL:    "?from=2024-01-01&to=2024-01-03&bucket=day",
+			},
+			Want: models.Want{
+				ExpectedCode:        http.StatusOK,
+				ExpectedContentType: "application/json",
+				ExpectedJSONBody: `{"short_url":"jB9Wbk","from":"2024-01-01T00:00:00Z","to":"2024-01-04T00:00:00Z","bucket":"day",` +
+					`"total_clicks":4,"unique_visitors":3,` +
+					`"series":[{"time":"2024-01-01T00:00:00Z","clicks":1,"unique_visitors":1},{"time":"2024-01-02T00:00:00Z","clicks":2,"unique_visitors":2},` +
+					`{"time":"2024-01-03T00:00:00Z","clicks":1,"unique_visitors":1}],` +
+					`"top_referrers":[{"name":"(direct)","count":2},{"name":"google.com","count":2}],` +
+					`"user_agents":[{"name":"Chrome","count":1},{"name":"Firefox","count":1},{"name":"Unknown","count":1},{"name":"curl","count":1}]}`,
+			},
+		},
+		{
+			Name: "Stats. Another owner.",
+			Ms: models.MockStorage{
+				Ctrl:       gomock.NewController(t),
+				ShortURL:   "jB9Wbk",
+				ShortenURL: models.ShortenURL{ShortURL: "jB9Wbk", OriginalURL: "https://practicum.yandex.ru/", UserID: uuid.New()},
+				Error:      nil,
+			},
+			Rp: models.RequestParams{
+				Method: http.MethodGet,
+			},
+			Want: models.Want{
+				ExpectedCode: http.StatusNotFound,
+			},
+		},
+		{
+			Name: "Stats. Team link, viewer.",
+			Ms: models.MockStorage{
+				Ctrl:       gomock.NewController(t),
+				ShortURL:   "jB9Wbk",
+				ShortenURL: models.ShortenURL{ShortURL: "jB9Wbk", OriginalURL: "https://practicum.yandex.ru/", UserID: uuid.New(), TeamID: teamID},
+				Clicks:     clicks,
+				Error:      nil,
+			},
+			Rp: models.RequestParams{
+				Method: http.MethodGet,
+				URL:    "?from=2024-01-01&to=2024-01-03T00:00:00Z&bucket=day",
+			},
+			Want: models.Want{
+				ExpectedCode:        http.StatusOK,
+				ExpectedContentType: "application/json",
+				ExpectedJSONBody: `{"short_url":"jB9Wbk","from":"2024-01-01T00:00:00Z","to":"2024-01-03T00:00:00Z","bucket":"day",` +
+					`"total_clicks":3,"unique_visitors":2,` +
+					`"series":[{"time":"2024-01-01T00:00:00Z","clicks":1,"unique_visitors":1},{"time":"2024-01-02T00:00:00Z","clicks":2,"unique_visitors":2}],` +
+					`"top_referrers":[{"name":"google.com","count":2},{"name":"(direct)","count":1}],` +
+					`"user_agents":[{"name":"Chrome","count":1},{"name":"Firefox","count":1},{"name":"curl","count":1}]}`,
+			},
+		},
+		{
+			Name: "Stats. Team link, not a member.",
+			Ms: models.MockStorage{
+				Ctrl:       gomock.NewController(t),
+				ShortURL:   "jB9Wbk",
+				ShortenURL: models.ShortenURL{ShortURL: "jB9Wbk", OriginalURL: "https://practicum.yandex.ru/", UserID: uuid.New(), TeamID: otherTeamID},
+				Error:      nil,
+			},
+			Rp: models.RequestParams{
+				Method: http.MethodGet,
+			},
+			Want: models.Want{
+				ExpectedCode: http.StatusNotFound,
+			},
+		},
+		{
+			Name: "Stats. Not valid bucket.",
+			Ms: models.MockStorage{
+				Ctrl:     gomock.NewController(t),
+				ShortURL: "jB9Wbk",
+				Error:    nil,
+			},
+			Rp: models.RequestParams{
+				Method: http.MethodGet,
+				URL:    "?bucket=month",
+			},
+			Want: models.Want{
+				ExpectedCode: http.StatusBadRequest,
+			},
+		},
+		{
+			Name: "Stats. Not exists short url.",
+			Ms: models.MockStorage{
+				Ctrl:     gomock.NewController(t),
+				ShortURL: "abcdef",
+				Error:    errs.ErrShortURLNotFound,
+			},
+			Rp: models.RequestParams{
+				Method: http.MethodGet,
+			},
+			Want: models.Want{
+				ExpectedCode: http.StatusNotFound,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			//хранилище-заглушка
+			defer tt.Ms.Ctrl.Finish()
+
+			storage := mocks.NewMockStorager(tt.Ms.Ctrl)
+			serv := service.New(storage, 10, 10*time.Second)
+
+			tokenString, errToken := auth.BuildJWTString()
+			require.NoError(t, errToken)
+
+			userID, errGetUserID := auth.GetUserID(tokenString)
+			require.NoError(t, errGetUserID)
+
+			//если владелец не задан в тесте - ссылка принадлежит пользователю из куки
+			if tt.Ms.ShortenURL.UserID == uuid.Nil {
+				tt.Ms.ShortenURL.UserID = userID
+			}
+
+			storage.EXPECT().GetURL(gomock.Any(), tt.Ms.ShortURL).Return(tt.Ms.ShortenURL, tt.Ms.Error).AnyTimes()
+			storage.EXPECT().ClickStats(gomock.Any(), tt.Ms.ShortURL, gomock.Any()).DoAndReturn(
+				func(_ context.Context, shortURL models.ShortURL, params models.StatsParams) (models.Stats, error) {
+					return stats.Build(shortURL, params, tt.Ms.Clicks), nil
+				},
+			).AnyTimes()
+			storage.EXPECT().GetTeamMember(gomock.Any(), teamID, userID).Return(models.TeamMember{TeamID: teamID, UserID: userID, Role: models.RoleViewer}, nil).AnyTimes()
+			storage.EXPECT().GetTeamMember(gomock.Any(), otherTeamID, userID).Return(models.TeamMember{}, errs.ErrTeamMemberNotFound).AnyTimes()
+
+			//маршрутизация запроса
+			r := chi.NewRouter()
+			r.Get("/api/user/urls/{id}/stats", auth.Auth(logger.WithLogging(gzip.GzipMiddleware(Stats(serv)))))
+
+			//создание http сервера
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			URL := ts.URL + "/api/user/urls/" + string(tt.Ms.ShortURL) + "/stats" + tt.Rp.URL
+
+			req, errReq := http.NewRequest(tt.Rp.Method, URL, nil)
+			require.NoError(t, errReq)
+
+			req.AddCookie(&http.Cookie{
+				Name:  "userid",
+				Value: tokenString,
+			})
+
+			client := ts.Client()
+			resp, errResp := client.Do(req)
+			require.NoError(t, errResp)
+
+			defer resp.Body.Close()
+
+			respBody, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.Want.ExpectedCode, resp.StatusCode, "Код ответа не совпадает с ожидаемым")
+
+			if tt.Want.ExpectedCode == http.StatusOK {
+				assert.Equal(t, tt.Want.ExpectedContentType, resp.Header.Get("content-type"), "content-type не совпадает с ожидаемым")
+				assert.JSONEq(t, tt.Want.ExpectedJSONBody, string(respBody), "Body не совпадает с ожидаемым")
+			}
+
+			t.Log("=============================================================>")
+		})
+	}
+}
@@ -2,6 +2,9 @@ package user
 
 import (
 	"encoding/json"
+	"fmt"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/handlers/problem"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
 	"github.com/dubrovsky1/url-shortener/internal/models"
 	"github.com/dubrovsky1/url-shortener/internal/service"
@@ -15,21 +18,34 @@ func ListByUserID(s *service.Service) http.HandlerFunc {
 		userID := ctx.Value(models.KeyUserID("UserID")).(uuid.UUID)
 		logger.Sugar.Infow("Request Log.", "UserId", userID)
 
-		result, err := s.ListByUserID(ctx, models.Host(req.Host), userID)
+		//с team_id отдаются ссылки команды, участником которой является пользователь
+		var result []models.ShortenURL
+		var err error
+
+		if param := req.URL.Query().Get("team_id"); param != "" {
+			teamID, errParse := uuid.Parse(param)
+			if errParse != nil {
+				problem.Write(res, req, fmt.Errorf("%w: team_id: %s", errs.ErrTeamNotValid, errParse.Error()))
+				return
+			}
+			result, err = s.ListByTeamID(ctx, models.Host(req.Host), userID, teamID)
+		} else {
+			result, err = s.ListByUserID(ctx, models.Host(req.Host), userID)
+		}
 		if err != nil {
-			http.Error(res, err.Error(), http.StatusBadRequest)
+			problem.Write(res, req, err)
 			return
 		}
 
 		if len(result) == 0 {
-			http.Error(res, "resp no content", http.StatusNoContent)
+			res.WriteHeader(http.StatusNoContent)
 			return
 		}
 
 		//создаем объект ответа models.Response и сериализуем его в json resp, который возвращаем в теле ответа
 		resp, err := json.Marshal(result)
 		if err != nil {
-			http.Error(res, "resp marshal error", http.StatusBadRequest)
+			problem.Write(res, req, err)
 			return
 		}
 
@@ -2,6 +2,7 @@ package user
 
 import (
 	"errors"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/auth"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/gzip"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
@@ -10,6 +11,7 @@ import (
 	"github.com/dubrovsky1/url-shortener/internal/storage/mocks"
 	"github.com/go-chi/chi/v5"
 	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"io"
@@ -103,7 +105,9 @@ func TestListByUserID(t *testing.T) {
 				Method: http.MethodGet,
 			},
 			Want: models.Want{
-				ExpectedCode: http.StatusBadRequest,
+				ExpectedCode:        http.StatusInternalServerError,
+				ExpectedContentType: "application/problem+json",
+				ExpectedJSONBody:    `{"type":"about:blank","title":"Internal Server Error","status":500,"detail":"internal error","instance":"/api/user/urls","code":"internal"}`,
 			},
 		},
 	}
@@ -182,3 +186,94 @@ func TestListByUserID(t *testing.T) {
 		})
 	}
 }
+
+func TestListByTeamID(t *testing.T) {
+	logger.Initialize()
+
+	teamID := uuid.New()
+
+	tests := []struct {
+		name   string
+		query  string
+		member bool //пользователь из куки - участник команды
+		want   models.Want
+	}{
+		{
+			name:   "Get team list. Member.",
+			query:  "?team_id=" + teamID.String(),
+			member: true,
+			want: models.Want{
+				ExpectedCode:        http.StatusOK,
+				ExpectedContentType: "application/json",
+				ExpectedJSONBody:    `[{"short_url":"jB9Wbk","original_url":"https://practicum.yandex.ru/"}]`,
+			},
+		},
+		{
+			name:  "Get team list. Not a member.",
+			query: "?team_id=" + teamID.String(),
+			want:  models.Want{ExpectedCode: http.StatusNotFound, ExpectedContentType: "application/problem+json"},
+		},
+		{
+			name:  "Get team list. Not valid team id.",
+			query: "?team_id=abc",
+			want:  models.Want{ExpectedCode: http.StatusBadRequest, ExpectedContentType: "application/problem+json"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//хранилище-заглушка
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			storage := mocks.NewMockStorager(ctrl)
+			serv := service.New(storage, 10, 10*time.Second)
+
+			tokenString, errToken := auth.BuildJWTString()
+			require.NoError(t, errToken)
+
+			userID, errGetUserID := auth.GetUserID(tokenString)
+			require.NoError(t, errGetUserID)
+
+			if tt.member {
+				storage.EXPECT().GetTeamMember(gomock.Any(), teamID, userID).Return(models.TeamMember{TeamID: teamID, UserID: userID, Role: models.RoleViewer}, nil)
+				storage.EXPECT().ListByTeamID(gomock.Any(), gomock.Any(), teamID).Return([]models.ShortenURL{{ShortURL: "jB9Wbk", OriginalURL: "https://practicum.yandex.ru/"}}, nil)
+			} else {
+				storage.EXPECT().GetTeamMember(gomock.Any(), teamID, userID).Return(models.TeamMember{}, errs.ErrTeamMemberNotFound).AnyTimes()
+			}
+
+			//маршрутизация запроса
+			r := chi.NewRouter()
+			r.Get("/api/user/urls", auth.Auth(logger.WithLogging(gzip.GzipMiddleware(ListByUserID(serv)))))
+
+			//создание http сервера
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			req, errReq := http.NewRequest(http.MethodGet, ts.URL+"/api/user/urls"+tt.query, nil)
+			require.NoError(t, errReq)
+
+			req.AddCookie(&http.Cookie{
+				Name:  "userid",
+				Value: tokenString,
+			})
+
+			resp, errResp := ts.Client().Do(req)
+			require.NoError(t, errResp)
+
+			defer resp.Body.Close()
+
+			respBody, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want.ExpectedCode, resp.StatusCode, "Код ответа не совпадает с ожидаемым")
+			assert.Equal(t, tt.want.ExpectedContentType, resp.Header.Get("content-type"), "content-type не совпадает с ожидаемым")
+
+			if tt.want.ExpectedJSONBody != "" {
+				assert.JSONEq(t, tt.want.ExpectedJSONBody, string(respBody), "Body не совпадает с ожидаемым")
+			}
+
+			t.Log("=============================================================>")
+		})
+	}
+}
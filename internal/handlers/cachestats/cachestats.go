@@ -0,0 +1,27 @@
+package cachestats
+
+import (
+	"encoding/json"
+	"github.com/dubrovsky1/url-shortener/internal/handlers/problem"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"net/http"
+)
+
+// Statser - источник счетчиков кеша
+type Statser interface {
+	Stats() models.CacheStats
+}
+
+func CacheStats(c Statser) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		resp, err := json.Marshal(c.Stats())
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		res.Header().Set("content-type", "application/json")
+		res.WriteHeader(http.StatusOK)
+		res.Write(resp)
+	}
+}
@@ -1,34 +1,47 @@
 package geturl
 
 import (
+	"fmt"
+	"github.com/dubrovsky1/url-shortener/internal/handlers/problem"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
 	"github.com/dubrovsky1/url-shortener/internal/models"
 	"github.com/dubrovsky1/url-shortener/internal/service"
 	"github.com/go-chi/chi/v5"
+	"net"
 	"net/http"
+	"net/netip"
+	"strings"
+	"time"
 )
 
-func GetURL(s *service.Service) http.HandlerFunc {
+// GetURL - переход по короткой ссылке. Заголовкам X-Forwarded-For и X-Real-IP верим, только если запрос
+// пришел от одного из доверенных прокси trusted
+func GetURL(s *service.Service, trusted ...netip.Prefix) http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
 		ctx := req.Context()
 
 		shortURL := models.ShortURL(chi.URLParam(req, "id"))
 		logger.Sugar.Infow("Request Log.", "shortURL", shortURL)
 
+		//неизвестный код - 404, удаленная или истекшая ссылка - 410
 		result, err := s.GetURL(ctx, shortURL)
 		if err != nil {
-			http.Error(res, err.Error(), http.StatusBadRequest)
+			problem.Write(res, req, err)
 			return
 		}
 
-		if result.IsDel {
-			http.Error(res, "deleted", http.StatusGone)
-			return
-		}
+		//регистрируем переход асинхронно, запись в хранилище выполняет фоновый процесс сервиса
+		s.RegisterClick(models.Click{
+			ShortURL:  shortURL,
+			ClickedAt: time.Now().UTC(),
+			Referrer:  req.Referer(),
+			UserAgent: req.UserAgent(),
+		}, clientIP(req, trusted))
 
+		//301 и 308 браузеры кешируют, повторные переходы по такой ссылке могут не дойти до сервиса
 		res.Header().Set("content-type", "text/plain")
-		res.Header().Set("Location", string(result.OriginalURL))
-		res.WriteHeader(http.StatusTemporaryRedirect)
+		res.Header().Set("Location", service.RedirectLocation(result, req.URL))
+		res.WriteHeader(result.RedirectStatus())
 
 		logger.Sugar.Infow(
 			"Response Log.",
@@ -37,3 +50,75 @@ func GetURL(s *service.Service) http.HandlerFunc {
 		)
 	}
 }
+
+// ParseTrustedProxies разбирает список IP-адресов и подсетей доверенных прокси через запятую
+func ParseTrustedProxies(list string) ([]netip.Prefix, error) {
+	var result []netip.Prefix
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("trusted proxy %q: %w", item, err)
+			}
+			result = append(result, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", item, err)
+		}
+		result = append(result, prefix.Masked())
+	}
+	return result, nil
+}
+
+// clientIP определяет IP-адрес клиента. Заголовки прокси учитываются, только если соединение пришло
+// от доверенного прокси, иначе клиент мог бы подставить в них любой адрес
+func clientIP(req *http.Request, trusted []netip.Prefix) string {
+	remote := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		remote = host
+	}
+
+	if !isTrusted(remote, trusted) {
+		return remote
+	}
+
+	//адреса в X-Forwarded-For дописывает каждый прокси, клиент - первый справа адрес, не принадлежащий доверенным прокси
+	if forwarded := req.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		ips := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(ips) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(ips[i])
+			if ip != "" && (!isTrusted(ip, trusted) || i == 0) {
+				return ip
+			}
+		}
+	}
+
+	if realIP := strings.TrimSpace(req.Header.Get("X-Real-IP")); realIP != "" {
+		return realIP
+	}
+	return remote
+}
+
+// isTrusted - входит ли адрес в одну из подсетей доверенных прокси
+func isTrusted(ip string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,7 +1,11 @@
 package geturl
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/handlers/problem"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/gzip"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
 	"github.com/dubrovsky1/url-shortener/internal/models"
@@ -13,6 +17,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"strings"
 	"testing"
 	"time"
@@ -21,6 +26,8 @@ import (
 func TestGetURL(t *testing.T) {
 	logger.Initialize()
 
+	expired := time.Now().Add(-time.Hour)
+
 	tests := []models.TestCase{
 		{
 			Name: "Get url. Success.",
@@ -40,20 +47,96 @@ func TestGetURL(t *testing.T) {
 				ExpectedLocation:    "https://practicum.yandex.ru/",
 			},
 		},
+		{
+			Name: "Get url. Permanent redirect.",
+			Ms: models.MockStorage{
+				Ctrl:       gomock.NewController(t),
+				ShortURL:   "4fafrx",
+				ShortenURL: models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", RedirectType: http.StatusMovedPermanently},
+				Error:      nil,
+			},
+			Rp: models.RequestParams{
+				Method: http.MethodGet,
+				URL:    "?utm_source=mail",
+				Body:   "",
+			},
+			Want: models.Want{
+				ExpectedCode:        http.StatusMovedPermanently,
+				ExpectedContentType: "text/plain",
+				ExpectedLocation:    "https://practicum.yandex.ru/",
+			},
+		},
+		{
+			Name: "Get url. Forward query.",
+			Ms: models.MockStorage{
+				Ctrl:     gomock.NewController(t),
+				ShortURL: "4fafrx",
+				ShortenURL: models.ShortenURL{
+					OriginalURL:  "https://practicum.yandex.ru/catalog?lang=ru&utm_source=site",
+					RedirectType: http.StatusFound,
+					ForwardQuery: true,
+				},
+				Error: nil,
+			},
+			Rp: models.RequestParams{
+				Method: http.MethodGet,
+				URL:    "?utm_source=mail&utm_campaign=spring%20sale",
+				Body:   "",
+			},
+			Want: models.Want{
+				ExpectedCode:        http.StatusFound,
+				ExpectedContentType: "text/plain",
+				ExpectedLocation:    "https://practicum.yandex.ru/catalog?lang=ru&utm_source=mail&utm_campaign=spring%20sale",
+			},
+		},
+		{
+			Name: "Get url. Forward empty query.",
+			Ms: models.MockStorage{
+				Ctrl:       gomock.NewController(t),
+				ShortURL:   "4fafrx",
+				ShortenURL: models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/?lang=ru#top", ForwardQuery: true},
+				Error:      nil,
+			},
+			Rp: models.RequestParams{
+				Method: http.MethodGet,
+				Body:   "",
+			},
+			Want: models.Want{
+				ExpectedCode:        http.StatusTemporaryRedirect,
+				ExpectedContentType: "text/plain",
+				ExpectedLocation:    "https://practicum.yandex.ru/?lang=ru#top",
+			},
+		},
 		{
 			Name: "Get. Not exists short url.",
 			Ms: models.MockStorage{
 				Ctrl:       gomock.NewController(t),
 				ShortURL:   "abcdef",
 				ShortenURL: models.ShortenURL{},
-				Error:      errors.New("the short url is missing"),
+				Error:      errs.ErrShortURLNotFound,
+			},
+			Rp: models.RequestParams{
+				Method: http.MethodGet,
+				Body:   "",
+			},
+			Want: models.Want{
+				ExpectedCode: http.StatusNotFound,
+			},
+		},
+		{
+			Name: "Get. Storage error.",
+			Ms: models.MockStorage{
+				Ctrl:       gomock.NewController(t),
+				ShortURL:   "abcdef",
+				ShortenURL: models.ShortenURL{},
+				Error:      errors.New("connection reset by peer"),
 			},
 			Rp: models.RequestParams{
 				Method: http.MethodGet,
 				Body:   "",
 			},
 			Want: models.Want{
-				ExpectedCode: http.StatusBadRequest,
+				ExpectedCode: http.StatusInternalServerError,
 			},
 		},
 		{
@@ -72,6 +155,22 @@ func TestGetURL(t *testing.T) {
 				ExpectedCode: http.StatusGone,
 			},
 		},
+		{
+			Name: "Get. Expired url.",
+			Ms: models.MockStorage{
+				Ctrl:       gomock.NewController(t),
+				ShortURL:   "4fafrx",
+				ShortenURL: models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ExpiresAt: &expired},
+				Error:      nil,
+			},
+			Rp: models.RequestParams{
+				Method: http.MethodGet,
+				Body:   "",
+			},
+			Want: models.Want{
+				ExpectedCode: http.StatusGone,
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -83,6 +182,16 @@ func TestGetURL(t *testing.T) {
 			serv := service.New(storage, 10, 10*time.Second)
 
 			storage.EXPECT().GetURL(gomock.Any(), tt.Ms.ShortURL).Return(tt.Ms.ShortenURL, tt.Ms.Error)
+			storage.EXPECT().FetchDeletes(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+
+			//успешный переход должен быть записан в хранилище при остановке сервиса
+			if tt.Want.ExpectedLocation != "" {
+				storage.EXPECT().SaveClicks(gomock.Any(), gomock.Len(1)).Return(nil)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			serv.Run(ctx)
 
 			//маршрутизация запроса
 			r := chi.NewRouter()
@@ -92,7 +201,7 @@ func TestGetURL(t *testing.T) {
 			ts := httptest.NewServer(r)
 			defer ts.Close()
 
-			URL := ts.URL + "/" + string(tt.Ms.ShortURL)
+			URL := ts.URL + "/" + string(tt.Ms.ShortURL) + tt.Rp.URL
 
 			req, errReq := http.NewRequest(tt.Rp.Method, URL, strings.NewReader(tt.Rp.Body))
 			require.NoError(t, errReq)
@@ -108,14 +217,93 @@ func TestGetURL(t *testing.T) {
 
 			defer resp.Body.Close()
 
+			cancel()
+			serv.Close()
+
 			assert.Equal(t, tt.Want.ExpectedCode, resp.StatusCode, "Код ответа не совпадает с ожидаемым")
 
-			if tt.Want.ExpectedCode != http.StatusBadRequest && tt.Want.ExpectedCode != http.StatusGone {
+			if tt.Want.ExpectedLocation != "" {
 				assert.Equal(t, tt.Want.ExpectedContentType, resp.Header.Get("content-type"), "content-type не совпадает с ожидаемым")
-				assert.Equal(t, string(tt.Ms.ShortenURL.OriginalURL), resp.Header.Get("Location"), "Location не совпадает с ожидаемым")
+				assert.Equal(t, tt.Want.ExpectedLocation, resp.Header.Get("Location"), "Location не совпадает с ожидаемым")
+			} else {
+				//ошибки отдаются в формате RFC 7807, статус в теле совпадает со статусом ответа
+				var p problem.Problem
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&p))
+
+				assert.Equal(t, problem.ContentType, resp.Header.Get("content-type"), "content-type не совпадает с ожидаемым")
+				assert.Equal(t, tt.Want.ExpectedCode, p.Status, "Статус в теле ответа не совпадает с ожидаемым")
+				assert.NotEmpty(t, p.Code, "Пустой код ошибки")
 			}
 
 			t.Log("=============================================================>")
 		})
 	}
 }
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8, 192.168.1.1")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		trusted    []netip.Prefix
+		want       string
+	}{
+		{
+			name:       "Client ip. No proxies configured, headers ignored.",
+			remoteAddr: "203.0.113.5:1234",
+			forwarded:  "198.51.100.1",
+			realIP:     "198.51.100.2",
+			want:       "203.0.113.5",
+		},
+		{
+			name:       "Client ip. Untrusted remote, headers ignored.",
+			remoteAddr: "203.0.113.5:1234",
+			forwarded:  "198.51.100.1",
+			trusted:    trusted,
+			want:       "203.0.113.5",
+		},
+		{
+			name:       "Client ip. Trusted proxy, forwarded for.",
+			remoteAddr: "10.1.2.3:1234",
+			forwarded:  "198.51.100.1",
+			trusted:    trusted,
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "Client ip. Spoofed forwarded for, rightmost untrusted address taken.",
+			remoteAddr: "10.1.2.3:1234",
+			forwarded:  "1.1.1.1, 198.51.100.1, 192.168.1.1",
+			trusted:    trusted,
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "Client ip. Trusted proxy, real ip.",
+			remoteAddr: "192.168.1.1:1234",
+			realIP:     "198.51.100.2",
+			trusted:    trusted,
+			want:       "198.51.100.2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			assert.Equal(t, tt.want, clientIP(req, tt.trusted))
+		})
+	}
+
+	_, err = ParseTrustedProxies("10.0.0.0/33")
+	assert.Error(t, err)
+}
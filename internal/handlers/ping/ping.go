@@ -1,18 +1,22 @@
 package ping
 
 import (
+	"fmt"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/handlers/problem"
 	"github.com/dubrovsky1/url-shortener/internal/storage/postgresql"
 	"net/http"
 )
 
 func Ping(connectionString string) http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
-		db, err := postgresql.New(connectionString)
+		//только проверка соединения, миграции здесь не нужны
+		pool, err := postgresql.Open(connectionString, postgresql.PoolConfig{MaxConns: 1})
 		if err != nil {
-			http.Error(res, "database connection error", http.StatusInternalServerError)
+			problem.Write(res, req, fmt.Errorf("%w: %s", errs.ErrStorageUnavailable, err.Error()))
 			return
 		}
-		defer db.DB.Close()
+		defer pool.Close()
 
 		res.Header().Set("content-type", "text/plain")
 		res.WriteHeader(http.StatusOK)
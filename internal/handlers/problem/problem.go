@@ -0,0 +1,83 @@
+// Package problem переводит доменные ошибки в HTTP статусы и тела application/problem+json (RFC 7807)
+package problem
+
+import (
+	"encoding/json"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"net/http"
+)
+
+const ContentType = "application/problem+json"
+
+// Problem - тело ответа с ошибкой, Code - стабильный код, по которому клиенты различают ошибки
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+}
+
+// Status - HTTP статус для категории ошибки
+func Status(kind errs.Kind) int {
+	switch kind {
+	case errs.KindNotFound:
+		return http.StatusNotFound
+	case errs.KindGone:
+		return http.StatusGone
+	case errs.KindConflict:
+		return http.StatusConflict
+	case errs.KindForbidden:
+		return http.StatusForbidden
+	case errs.KindValidation:
+		return http.StatusBadRequest
+	case errs.KindUnavailable:
+		return http.StatusServiceUnavailable
+	case errs.KindUnauthorized:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// New собирает тело ответа для ошибки err. Текст непредвиденных ошибок клиенту не отдается
+func New(err error, instance string) Problem {
+	e, ok := errs.As(err)
+	if !ok || e.Kind == errs.KindInternal {
+		e = errs.ErrInternal
+		err = e
+	}
+
+	status := Status(e.Kind)
+
+	return Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   err.Error(),
+		Instance: instance,
+		Code:     e.Code,
+	}
+}
+
+// Write отвечает на запрос ошибкой err в формате application/problem+json
+func Write(res http.ResponseWriter, req *http.Request, err error) {
+	p := New(err, req.URL.Path)
+
+	if p.Status == http.StatusInternalServerError || p.Status == http.StatusServiceUnavailable {
+		logger.Sugar.Infow("Request error.", "path", req.URL.Path, "error", err.Error())
+	}
+
+	body, errMarshal := json.Marshal(p)
+	if errMarshal != nil {
+		http.Error(res, http.StatusText(p.Status), p.Status)
+		return
+	}
+
+	res.Header().Set("content-type", ContentType)
+	res.Header().Set("X-Content-Type-Options", "nosniff")
+	res.WriteHeader(p.Status)
+	res.Write(body)
+}
@@ -0,0 +1,71 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	logger.Initialize()
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+		wantDetail string
+	}{
+		{name: "Not found.", err: errs.ErrShortURLNotFound, wantStatus: http.StatusNotFound, wantCode: "short_url_not_found", wantDetail: "not found short_url error"},
+		{name: "Gone.", err: errs.ErrShortURLDeleted, wantStatus: http.StatusGone, wantCode: "short_url_deleted", wantDetail: "short_url deleted error"},
+		{name: "Conflict.", err: errs.ErrShortURLExists, wantStatus: http.StatusConflict, wantCode: "short_url_exists", wantDetail: "short_url already exists error"},
+		{name: "Forbidden.", err: errs.ErrForbidden, wantStatus: http.StatusForbidden, wantCode: "forbidden", wantDetail: "forbidden error"},
+		{name: "Unauthorized.", err: errs.ErrCredentialsNotValid, wantStatus: http.StatusUnauthorized, wantCode: "credentials_not_valid", wantDetail: "wrong login or password error"},
+		{
+			name:       "Wrapped validation.",
+			err:        fmt.Errorf("%w: ttl_seconds must be positive", errs.ErrExpiresNotValid),
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "expires_not_valid",
+			wantDetail: "not valid expiration error: ttl_seconds must be positive",
+		},
+		{
+			name:       "Storage unavailable.",
+			err:        fmt.Errorf("%w: %w", errs.ErrStorageUnavailable, errors.New("dial tcp: connection refused")),
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   "storage_unavailable",
+			wantDetail: "storage unavailable error: dial tcp: connection refused",
+		},
+		{name: "Unknown error is hidden.", err: errors.New("pq: password authentication failed"), wantStatus: http.StatusInternalServerError, wantCode: "internal", wantDetail: "internal error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/abcdef", nil)
+			res := httptest.NewRecorder()
+
+			Write(res, req, tt.err)
+
+			assert.Equal(t, tt.wantStatus, res.Code, "Код ответа не совпадает с ожидаемым")
+			assert.Equal(t, ContentType, res.Header().Get("content-type"), "content-type не совпадает с ожидаемым")
+
+			var p Problem
+			require.NoError(t, json.Unmarshal(res.Body.Bytes(), &p))
+
+			assert.Equal(t, Problem{
+				Type:     "about:blank",
+				Title:    http.StatusText(tt.wantStatus),
+				Status:   tt.wantStatus,
+				Detail:   tt.wantDetail,
+				Instance: "/abcdef",
+				Code:     tt.wantCode,
+			}, p)
+		})
+	}
+}
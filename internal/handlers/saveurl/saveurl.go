@@ -2,7 +2,9 @@ package saveurl
 
 import (
 	"errors"
+	"fmt"
 	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/handlers/problem"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
 	"github.com/dubrovsky1/url-shortener/internal/models"
 	"github.com/dubrovsky1/url-shortener/internal/service"
@@ -21,30 +23,31 @@ func SaveURL(s *service.Service, resultShortURL string) http.HandlerFunc {
 		logger.Sugar.Infow("Request Log.", "Body", string(body), "userID", userID)
 
 		item := models.ShortenURL{
-			OriginalURL: models.OriginalURL(body),
-			UserID:      userID,
+			OriginalURL:  models.OriginalURL(body),
+			UserID:       userID,
+			RedirectType: service.DefaultRedirectType,
 		}
 
 		//проверяем корректность url из тела запроса
 		if err != nil || len(body) == 0 {
-			http.Error(res, "The request body is missing", http.StatusBadRequest)
+			problem.Write(res, req, errs.ErrBodyMissing)
 			return
 		}
 
 		if _, errParseURL := url.Parse(string(body)); errParseURL != nil {
-			http.Error(res, "Not valid result URL", http.StatusBadRequest)
+			problem.Write(res, req, fmt.Errorf("%w: %s", errs.ErrURLNotValid, errParseURL.Error()))
 			return
 		}
 
-		res.Header().Set("content-type", "text/plain")
-
 		//сохраняем в базу
 		shortURL, errSave := s.SaveURL(ctx, item)
 		if errSave != nil && !errors.Is(errSave, errs.ErrUniqueIndex) {
-			http.Error(res, "Save shortURL error", http.StatusBadRequest)
+			problem.Write(res, req, errSave)
 			return
 		}
 
+		res.Header().Set("content-type", "text/plain")
+
 		//если сохраняемый URL уже есть в базе, также формируем и возвращаем его короткую ссылку, но со статусом 409
 		if errors.Is(errSave, errs.ErrUniqueIndex) {
 			res.WriteHeader(http.StatusConflict)
@@ -61,7 +64,7 @@ func SaveURL(s *service.Service, resultShortURL string) http.HandlerFunc {
 		}
 
 		if _, e := url.Parse(responseBody); e != nil {
-			http.Error(res, "Not valid result URL", http.StatusBadRequest)
+			logger.Sugar.Infow("Not valid result URL.", "error", e.Error())
 			return
 		}
 
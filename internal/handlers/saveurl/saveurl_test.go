@@ -102,6 +102,8 @@ func TestSaveURL(t *testing.T) {
 			serv := service.New(storage, 10, 10*time.Second)
 
 			storage.EXPECT().SaveURL(gomock.Any(), gomock.Any()).Return(tt.Ms.ShortURL, tt.Ms.Error).AnyTimes()
+			//уже сохраненная ссылка жива - отдается ее код
+			storage.EXPECT().GetURL(gomock.Any(), tt.Ms.ShortURL).Return(models.ShortenURL{ShortURL: tt.Ms.ShortURL}, nil).AnyTimes()
 
 			r := chi.NewRouter()
 			r.Post("/", auth.Auth(logger.WithLogging(gzip.GzipMiddleware(SaveURL(serv, "http://localhost:8080/")))))
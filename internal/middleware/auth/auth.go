@@ -2,11 +2,18 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/handlers/problem"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
 	"github.com/dubrovsky1/url-shortener/internal/models"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
 	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,98 +23,385 @@ type Claims struct {
 }
 
 const (
-	TokenExp                   = time.Hour * 3
-	SecretKey                  = "supersecretkey"
-	KeyName   models.KeyUserID = "UserID"
+	DefaultTokenExp                       = time.Hour * 3
+	DefaultRefreshBefore                  = time.Hour
+	DefaultCookieName                     = "userid"
+	KeyName              models.KeyUserID = "UserID"
 )
 
+// CookieConfig - атрибуты куки с токеном
+type CookieConfig struct {
+	Name     string
+	Path     string
+	Domain   string
+	Secure   bool
+	HTTPOnly bool
+	SameSite http.SameSite
+}
+
+// Config - настройки выдачи и проверки токенов, нулевые значения заменяются значениями по умолчанию
+type Config struct {
+	Keys          []Key
+	TokenExp      time.Duration
+	RefreshBefore time.Duration //токен, которому осталось жить меньше, перевыпускается для того же пользователя
+	Cookie        CookieConfig
+	APIKeys       APIKeyResolver //без него API-ключи не принимаются
+	OIDC          OIDCProvider   //без него вход через провайдера и его ID-токены не принимаются
+}
+
+type settings struct {
+	keys          *keySet
+	tokenExp      time.Duration
+	refreshBefore time.Duration
+	cookie        CookieConfig
+	apiKeys       APIKeyResolver
+	oidc          OIDCProvider
+}
+
+// текущие настройки, до Initialize токены подписываются случайным ключом процесса
+var current atomic.Pointer[settings]
+
+func init() {
+	key, err := RandomKey()
+	if err != nil {
+		panic(err)
+	}
+
+	s, err := newSettings(Config{Keys: []Key{key}, Cookie: CookieConfig{HTTPOnly: true}})
+	if err != nil {
+		panic(err)
+	}
+	current.Store(s)
+}
+
+// Initialize применяет настройки токенов, вызывается при старте приложения
+func Initialize(cfg Config) error {
+	s, err := newSettings(cfg)
+	if err != nil {
+		return err
+	}
+	current.Store(s)
+	return nil
+}
+
+func newSettings(cfg Config) (*settings, error) {
+	keys, err := newKeySet(cfg.Keys)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &settings{
+		keys:          keys,
+		tokenExp:      cfg.TokenExp,
+		refreshBefore: cfg.RefreshBefore,
+		cookie:        cfg.Cookie,
+		apiKeys:       cfg.APIKeys,
+		oidc:          cfg.OIDC,
+	}
+
+	if s.tokenExp <= 0 {
+		s.tokenExp = DefaultTokenExp
+	}
+	if s.refreshBefore <= 0 {
+		s.refreshBefore = min(DefaultRefreshBefore, s.tokenExp/3)
+	}
+	if s.refreshBefore >= s.tokenExp {
+		return nil, fmt.Errorf("jwt refresh interval %s must be less than token lifetime %s", s.refreshBefore, s.tokenExp)
+	}
+
+	if s.cookie.Name == "" {
+		s.cookie.Name = DefaultCookieName
+	}
+	if s.cookie.Path == "" {
+		s.cookie.Path = "/"
+	}
+	if s.cookie.SameSite == 0 {
+		s.cookie.SameSite = http.SameSiteLaxMode
+	}
+	//браузеры отбрасывают куку SameSite=None без Secure
+	if s.cookie.SameSite == http.SameSiteNoneMode && !s.cookie.Secure {
+		return nil, errors.New("cookie SameSite=None requires Secure")
+	}
+
+	return s, nil
+}
+
+// ParseSameSite - значение атрибута SameSite по названию: lax, strict или none
+func ParseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(value) {
+	case "", "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("unknown cookie SameSite %q: expected lax, strict or none", value)
+	}
+}
+
+// APIKeyHeader - заголовок с API-ключом для клиентов, которые не передают Authorization
+const APIKeyHeader = "X-API-Key"
+
+// ключ контекста с правами API-ключа, у пользователей с кукой или JWT прав в контексте нет - им доступно все
+type contextKey string
+
+const scopesKey contextKey = "scopes"
+
+// APIKeyResolver находит владельца и права API-ключа
+type APIKeyResolver interface {
+	AuthenticateAPIKey(context.Context, string) (uuid.UUID, []models.Scope, error)
+}
+
+// Auth определяет пользователя по заголовку Authorization (JWT, ID-токен провайдера или API-ключ), заголовку X-API-Key или куке.
+// Новый анонимный пользователь заводится только для изменяющих запросов без каких-либо учетных данных
 func Auth(h http.HandlerFunc) http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
-		var tokenString string
-		var userID uuid.UUID
-		var errToken, errGetUserID error
-
-		//нужно получить токен для расшифровки id пользователя
-		//токен лежит в куке, если её нет - создаем новую, в которою записываем новый userID
-		cookie, err := req.Cookie("userid")
-
-		if err == http.ErrNoCookie {
-			if req.Method != http.MethodGet {
-				tokenString, errToken = BuildJWTString()
-				if errToken != nil {
-					http.Error(res, errToken.Error(), http.StatusUnauthorized)
-					return
-				}
-
-				c := &http.Cookie{
-					Name:  "userid",
-					Value: tokenString,
-					Path:  "/",
-				}
+		s := current.Load()
 
-				http.SetCookie(res, c)
-			} else {
-				http.Error(res, err.Error(), http.StatusUnauthorized)
+		userID, scopes, err := s.authenticate(res, req)
+		if err != nil {
+			//недоступность хранилища ключей - не повод считать ключ неверным
+			if e, ok := errs.As(err); ok && e.Kind != errs.KindNotFound {
+				problem.Write(res, req, err)
 				return
 			}
-		} else {
-			if err = cookie.Valid(); err != nil {
-				http.Error(res, err.Error(), http.StatusUnauthorized)
-				return
+			//причину отказа пишем в лог, клиенту отдаем только код ошибки
+			logger.Sugar.Infow("Auth. Authentication error.", "err", err.Error())
+			problem.Write(res, req, errs.ErrUnauthorized)
+			return
+		}
+
+		//Наследуем от контекста запроса новый контекст и записываем в него полученный или новый UserID
+		authContext := context.WithValue(req.Context(), KeyName, userID)
+		if scopes != nil {
+			authContext = context.WithValue(authContext, scopesKey, scopes)
+		}
+		h.ServeHTTP(res, req.WithContext(authContext))
+	}
+}
+
+func (s *settings) authenticate(res http.ResponseWriter, req *http.Request) (uuid.UUID, []models.Scope, error) {
+	if header := req.Header.Get("Authorization"); header != "" {
+		scheme, token, _ := strings.Cut(header, " ")
+		token = strings.TrimSpace(token)
+
+		if !strings.EqualFold(scheme, "Bearer") || token == "" {
+			return uuid.Nil, nil, errors.New("unsupported authorization scheme, expected Bearer")
+		}
+
+		if strings.HasPrefix(token, models.APIKeyPrefix) {
+			return s.apiKey(req.Context(), token)
+		}
+
+		_, claims, err := s.parse(token)
+		if err != nil {
+			//не наш токен может быть ID-токеном провайдера, но в ответе остается ошибка нашего
+			if s.oidc != nil {
+				if userID, errID := s.oidc.VerifyUserID(req.Context(), token); errID == nil {
+					return userID, nil, nil
+				}
 			}
-			tokenString = cookie.Value
+			return uuid.Nil, nil, err
 		}
+		return claims.UserID, nil, nil
+	}
+
+	if key := req.Header.Get(APIKeyHeader); key != "" {
+		return s.apiKey(req.Context(), key)
+	}
+
+	userID, err := s.cookieUser(res, req)
+	return userID, nil, err
+}
+
+func (s *settings) apiKey(ctx context.Context, key string) (uuid.UUID, []models.Scope, error) {
+	if s.apiKeys == nil {
+		return uuid.Nil, nil, errors.New("api keys are not supported")
+	}
+
+	userID, scopes, err := s.apiKeys.AuthenticateAPIKey(ctx, key)
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
 
-		userID, errGetUserID = GetUserID(tokenString)
-		if errGetUserID != nil {
-			http.Error(res, errGetUserID.Error(), http.StatusUnauthorized)
+	//ключ без прав не должен получить полный доступ пользователя
+	if scopes == nil {
+		scopes = []models.Scope{}
+	}
+	return userID, scopes, nil
+}
+
+// cookieUser - пользователь из куки, для изменяющих запросов без куки заводится новый
+func (s *settings) cookieUser(res http.ResponseWriter, req *http.Request) (uuid.UUID, error) {
+	//нужно получить токен для расшифровки id пользователя
+	//токен лежит в куке, если её нет - создаем новую, в которою записываем новый userID
+	cookie, err := req.Cookie(s.cookie.Name)
+
+	if errors.Is(err, http.ErrNoCookie) {
+		if req.Method == http.MethodGet {
+			return uuid.Nil, err
+		}
+
+		userID := uuid.New()
+		if err = s.setCookie(res, userID); err != nil {
+			return uuid.Nil, err
+		}
+		return userID, nil
+	}
+
+	if err = cookie.Valid(); err != nil {
+		return uuid.Nil, err
+	}
+
+	token, claims, err := s.parse(cookie.Value)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	//токен скоро истечет или подписан ключом, выводимым из ротации, - незаметно для клиента выдаем новый
+	if time.Until(claims.ExpiresAt.Time) < s.refreshBefore || token.Header["kid"] != s.keys.active.ID {
+		if err = s.setCookie(res, claims.UserID); err != nil {
+			logger.Sugar.Infow("Auth. Refresh token error.", "err", err.Error())
+		}
+	}
+	return claims.UserID, nil
+}
+
+// Require пропускает запрос с API-ключом, только если у ключа есть право scope. Вызывается внутри Auth
+func Require(scope models.Scope, h http.HandlerFunc) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if scopes, ok := req.Context().Value(scopesKey).([]models.Scope); ok && !slices.Contains(scopes, scope) {
+			problem.Write(res, req, fmt.Errorf("%w: api key has no %s scope", errs.ErrForbidden, scope))
 			return
 		}
+		h.ServeHTTP(res, req)
+	}
+}
 
-		//logger.Sugar.Infow("Auth Log.", "token", tokenString, "userID", userID)
+// RequireSession не пропускает запросы с API-ключом: ключами нельзя управлять ключами
+func RequireSession(h http.HandlerFunc) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		if _, ok := req.Context().Value(scopesKey).([]models.Scope); ok {
+			problem.Write(res, req, fmt.Errorf("%w: not allowed with api key", errs.ErrForbidden))
+			return
+		}
+		h.ServeHTTP(res, req)
+	}
+}
 
-		//Наследуем от контекста запроса новый контекст и записываем в него полученный или новый UserID
-		authContext := context.WithValue(req.Context(), KeyName, userID)
-		h.ServeHTTP(res, req.WithContext(authContext))
+// Identify определяет пользователя только по куке и не заводит нового: для входа и регистрации, где
+// анонимный пользователь нужен лишь для переноса его ссылок. Без действующей куки в контексте uuid.Nil
+func Identify(h http.HandlerFunc) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := current.Load().identify(req)
+		h.ServeHTTP(res, req.WithContext(context.WithValue(req.Context(), KeyName, userID)))
 	}
 }
 
-func BuildJWTString() (string, error) {
+func (s *settings) identify(req *http.Request) uuid.UUID {
+	if cookie, err := req.Cookie(s.cookie.Name); err == nil {
+		if _, claims, errParse := s.parse(cookie.Value); errParse == nil {
+			return claims.UserID
+		}
+	}
+	return uuid.Nil
+}
+
+// IssueSession выпускает токен пользователя, отдает его в куке и возвращает для передачи в заголовке Authorization
+func IssueSession(res http.ResponseWriter, userID uuid.UUID) (string, error) {
+	s := current.Load()
+
+	tokenString, err := s.build(userID)
+	if err != nil {
+		return "", err
+	}
+
+	s.writeCookie(res, tokenString)
+	return tokenString, nil
+}
+
+// setCookie выпускает токен пользователя и отдает его в куке
+func (s *settings) setCookie(res http.ResponseWriter, userID uuid.UUID) error {
+	tokenString, err := s.build(userID)
+	if err != nil {
+		return err
+	}
+
+	s.writeCookie(res, tokenString)
+	return nil
+}
+
+func (s *settings) writeCookie(res http.ResponseWriter, tokenString string) {
+	http.SetCookie(res, &http.Cookie{
+		Name:     s.cookie.Name,
+		Value:    tokenString,
+		Path:     s.cookie.Path,
+		Domain:   s.cookie.Domain,
+		MaxAge:   int(s.tokenExp.Seconds()),
+		Secure:   s.cookie.Secure,
+		HttpOnly: s.cookie.HTTPOnly,
+		SameSite: s.cookie.SameSite,
+	})
+}
+
+func (s *settings) build(userID uuid.UUID) (string, error) {
+	now := time.Now()
+
 	// создаём новый токен с алгоритмом подписи HS256 и утверждениями — Claims
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			// когда создан токен
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(TokenExp)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.tokenExp)),
 		},
 		// собственное утверждение
-		UserID: uuid.New(),
+		UserID: userID,
 	})
 
-	// создаём строку токена
-	tokenString, err := token.SignedString([]byte(SecretKey))
-	if err != nil {
-		return "", err
-	}
+	//по kid при проверке выбирается ключ, которым подписан токен
+	token.Header["kid"] = s.keys.active.ID
 
-	// возвращаем строку токена
-	return tokenString, nil
+	return token.SignedString(s.keys.active.Secret)
 }
 
-func GetUserID(tokenString string) (uuid.UUID, error) {
+func (s *settings) parse(tokenString string) (*jwt.Token, *Claims, error) {
 	claims := &Claims{}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims,
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+
+	token, err := parser.ParseWithClaims(tokenString, claims,
 		func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+			kid, _ := t.Header["kid"].(string)
+			//токены, выпущенные до появления ключей с kid, подписаны ключом из строки secret
+			if _, ok := t.Header["kid"]; !ok {
+				kid = defaultKeyID
 			}
-			return []byte(SecretKey), nil
+			secret, ok := s.keys.byID[kid]
+			if !ok {
+				return nil, fmt.Errorf("unknown jwt key id %q", kid)
+			}
+			return secret, nil
 		})
 	if err != nil {
-		return uuid.Nil, err
+		return nil, nil, err
 	}
 
-	if !token.Valid {
+	//токен без срока жизни или пользователя не выпускается сервисом
+	if !token.Valid || claims.ExpiresAt == nil || claims.UserID == uuid.Nil {
+		return nil, nil, errors.New("invalid token")
+	}
+	return token, claims, nil
+}
+
+// BuildJWTString - токен для нового пользователя
+func BuildJWTString() (string, error) {
+	return current.Load().build(uuid.New())
+}
+
+// GetUserID - пользователь из токена, токен должен быть подписан одним из действующих ключей
+func GetUserID(tokenString string) (uuid.UUID, error) {
+	_, claims, err := current.Load().parse(tokenString)
+	if err != nil {
 		return uuid.Nil, err
 	}
 	return claims.UserID, nil
@@ -0,0 +1,355 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/handlers/problem"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	oldKey = Key{ID: "2024-01", Secret: []byte(strings.Repeat("o", MinSecretLen))}
+	newKey = Key{ID: "2024-02", Secret: []byte(strings.Repeat("n", MinSecretLen))}
+)
+
+// configure подменяет настройки на время теста
+func configure(t *testing.T, cfg Config) {
+	prev := current.Load()
+	require.NoError(t, Initialize(cfg))
+	t.Cleanup(func() { current.Store(prev) })
+}
+
+// serve выполняет запрос через Auth и возвращает ответ и пользователя из контекста
+func serve(t *testing.T, method, token string) (*httptest.ResponseRecorder, uuid.UUID) {
+	var userID uuid.UUID
+
+	h := Auth(func(res http.ResponseWriter, req *http.Request) {
+		userID = req.Context().Value(KeyName).(uuid.UUID)
+	})
+
+	req := httptest.NewRequest(method, "/api/user/urls", nil)
+	if token != "" {
+		req.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: token})
+	}
+
+	res := httptest.NewRecorder()
+	h(res, req)
+	return res, userID
+}
+
+// sign подписывает токен с произвольными утверждениями
+func sign(t *testing.T, key Key, claims Claims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = key.ID
+
+	tokenString, err := token.SignedString(key.Secret)
+	require.NoError(t, err)
+	return tokenString
+}
+
+func TestAuth(t *testing.T) {
+	logger.Initialize()
+
+	t.Run("Auth. New user gets hardened cookie.", func(t *testing.T) {
+		configure(t, Config{Keys: []Key{newKey}, TokenExp: time.Hour, Cookie: CookieConfig{Secure: true, HTTPOnly: true, SameSite: http.SameSiteStrictMode}})
+
+		res, userID := serve(t, http.MethodPost, "")
+		require.Equal(t, http.StatusOK, res.Code)
+		assert.NotEqual(t, uuid.Nil, userID)
+
+		cookies := res.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, DefaultCookieName, cookies[0].Name)
+		assert.True(t, cookies[0].Secure)
+		assert.True(t, cookies[0].HttpOnly)
+		assert.Equal(t, http.SameSiteStrictMode, cookies[0].SameSite)
+		assert.Equal(t, 3600, cookies[0].MaxAge)
+
+		got, err := GetUserID(cookies[0].Value)
+		require.NoError(t, err)
+		assert.Equal(t, userID, got)
+	})
+
+	t.Run("Auth. Read without cookie is unauthorized.", func(t *testing.T) {
+		res, _ := serve(t, http.MethodGet, "")
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+		//отказ отдается в формате RFC 7807 без текста внутренней ошибки
+		var p problem.Problem
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), &p))
+		assert.Equal(t, problem.ContentType, res.Header().Get("content-type"))
+		assert.Equal(t, errs.ErrUnauthorized.Code, p.Code)
+		assert.Equal(t, errs.ErrUnauthorized.Error(), p.Detail)
+	})
+
+	t.Run("Auth. Forged token is rejected.", func(t *testing.T) {
+		configure(t, Config{Keys: []Key{newKey}})
+
+		exp := jwt.NewNumericDate(time.Now().Add(time.Hour))
+
+		//токен, подписанный прежним зашитым в код ключом
+		forged := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: exp}, UserID: uuid.New()})
+		forgedString, err := forged.SignedString([]byte("supersecretkey"))
+		require.NoError(t, err)
+
+		res, _ := serve(t, http.MethodGet, forgedString)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+		//неизвестный kid
+		res, _ = serve(t, http.MethodGet, sign(t, Key{ID: "other", Secret: newKey.Secret}, Claims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: exp}, UserID: uuid.New()}))
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+		//токен без срока жизни
+		res, _ = serve(t, http.MethodGet, sign(t, newKey, Claims{UserID: uuid.New()}))
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("Auth. Rotated key is accepted and replaced.", func(t *testing.T) {
+		configure(t, Config{Keys: []Key{oldKey}})
+		token, err := BuildJWTString()
+		require.NoError(t, err)
+		userID, err := GetUserID(token)
+		require.NoError(t, err)
+
+		//новый ключ подписывает, старый еще принимается
+		configure(t, Config{Keys: []Key{newKey, oldKey}})
+
+		res, got := serve(t, http.MethodGet, token)
+		require.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, userID, got)
+
+		cookies := res.Result().Cookies()
+		require.Len(t, cookies, 1, "Токен старого ключа должен быть перевыпущен")
+
+		parsed, _, err := current.Load().parse(cookies[0].Value)
+		require.NoError(t, err)
+		assert.Equal(t, newKey.ID, parsed.Header["kid"])
+
+		//после удаления старого ключа его токены не принимаются, перевыпущенные - принимаются
+		configure(t, Config{Keys: []Key{newKey}})
+
+		res, _ = serve(t, http.MethodGet, token)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+		res, got = serve(t, http.MethodGet, cookies[0].Value)
+		require.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, userID, got)
+	})
+
+	t.Run("Auth. Token without kid is accepted and replaced.", func(t *testing.T) {
+		secret := Key{ID: defaultKeyID, Secret: []byte(strings.Repeat("s", MinSecretLen))}
+		configure(t, Config{Keys: []Key{secret}})
+
+		//токен в формате до ротации ключей: без заголовка kid
+		userID := uuid.New()
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+			RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+			UserID:           userID,
+		}).SignedString(secret.Secret)
+		require.NoError(t, err)
+
+		res, got := serve(t, http.MethodGet, token)
+		require.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, userID, got)
+
+		cookies := res.Result().Cookies()
+		require.Len(t, cookies, 1, "Токен без kid должен быть перевыпущен")
+
+		parsed, _, err := current.Load().parse(cookies[0].Value)
+		require.NoError(t, err)
+		assert.Equal(t, defaultKeyID, parsed.Header["kid"])
+
+		//без ключа default такой токен не принимается
+		configure(t, Config{Keys: []Key{newKey}})
+
+		res, _ = serve(t, http.MethodGet, token)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+	})
+
+	t.Run("Auth. Token is refreshed before expiry.", func(t *testing.T) {
+		configure(t, Config{Keys: []Key{newKey}, TokenExp: time.Hour, RefreshBefore: 10 * time.Minute})
+		userID := uuid.New()
+
+		fresh := sign(t, newKey, Claims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}, UserID: userID})
+		res, _ := serve(t, http.MethodGet, fresh)
+		require.Equal(t, http.StatusOK, res.Code)
+		assert.Empty(t, res.Result().Cookies())
+
+		expiring := sign(t, newKey, Claims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}, UserID: userID})
+		res, got := serve(t, http.MethodGet, expiring)
+		require.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, userID, got)
+
+		cookies := res.Result().Cookies()
+		require.Len(t, cookies, 1)
+
+		refreshed, err := GetUserID(cookies[0].Value)
+		require.NoError(t, err)
+		assert.Equal(t, userID, refreshed)
+	})
+}
+
+// keyResolver - API-ключи теста, отозванный ключ в хранилище неотличим от несуществующего
+type keyResolver map[string]models.APIKey
+
+func (r keyResolver) AuthenticateAPIKey(_ context.Context, key string) (uuid.UUID, []models.Scope, error) {
+	if key == models.APIKeyPrefix+"unavailable" {
+		return uuid.Nil, nil, errs.ErrStorageUnavailable
+	}
+
+	item, ok := r[key]
+	if !ok || item.RevokedAt != nil {
+		return uuid.Nil, nil, errs.ErrAPIKeyNotFound
+	}
+	return item.UserID, item.Scopes, nil
+}
+
+// serveHeader выполняет запрос с заголовками через Auth и Require
+func serveHeader(t *testing.T, method string, header http.Header, scope models.Scope) (*httptest.ResponseRecorder, uuid.UUID) {
+	var userID uuid.UUID
+
+	h := Auth(Require(scope, func(res http.ResponseWriter, req *http.Request) {
+		userID = req.Context().Value(KeyName).(uuid.UUID)
+	}))
+
+	req := httptest.NewRequest(method, "/api/user/urls", nil)
+	for name, values := range header {
+		req.Header.Set(name, values[0])
+	}
+
+	res := httptest.NewRecorder()
+	h(res, req)
+	return res, userID
+}
+
+func TestAuthHeader(t *testing.T) {
+	logger.Initialize()
+
+	owner := uuid.New()
+	revokedAt := time.Now()
+
+	readKey := models.APIKeyPrefix + "read"
+	revokedKey := models.APIKeyPrefix + "revoked"
+
+	configure(t, Config{Keys: []Key{newKey}, APIKeys: keyResolver{
+		readKey:    {UserID: owner, Scopes: []models.Scope{models.ScopeRead}},
+		revokedKey: {UserID: owner, Scopes: []models.Scope{models.ScopeRead}, RevokedAt: &revokedAt},
+	}})
+
+	t.Run("Auth. Bearer JWT.", func(t *testing.T) {
+		token := sign(t, newKey, Claims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}, UserID: owner})
+
+		//токен в заголовке не перевыпускается в куке, даже если скоро истечет
+		res, got := serveHeader(t, http.MethodDelete, http.Header{"Authorization": {"Bearer " + token}}, models.ScopeDelete)
+		require.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, owner, got)
+		assert.Empty(t, res.Result().Cookies())
+	})
+
+	t.Run("Auth. API key with scope.", func(t *testing.T) {
+		res, got := serveHeader(t, http.MethodGet, http.Header{"Authorization": {"Bearer " + readKey}}, models.ScopeRead)
+		require.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, owner, got)
+
+		res, got = serveHeader(t, http.MethodGet, http.Header{APIKeyHeader: {readKey}}, models.ScopeRead)
+		require.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, owner, got)
+	})
+
+	t.Run("Auth. API key without scope.", func(t *testing.T) {
+		res, _ := serveHeader(t, http.MethodPost, http.Header{APIKeyHeader: {readKey}}, models.ScopeWrite)
+		require.Equal(t, http.StatusForbidden, res.Code)
+		assert.Empty(t, res.Result().Cookies(), "Запрос с ключом не должен заводить анонимного пользователя")
+
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+		assert.Equal(t, "forbidden", body["code"])
+	})
+
+	t.Run("Auth. Revoked and unknown keys.", func(t *testing.T) {
+		res, _ := serveHeader(t, http.MethodGet, http.Header{"Authorization": {"Bearer " + revokedKey}}, models.ScopeRead)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+		res, _ = serveHeader(t, http.MethodPost, http.Header{APIKeyHeader: {models.APIKeyPrefix + "unknown"}}, models.ScopeWrite)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+		assert.Empty(t, res.Result().Cookies())
+	})
+
+	t.Run("Auth. Key storage unavailable.", func(t *testing.T) {
+		res, _ := serveHeader(t, http.MethodGet, http.Header{APIKeyHeader: {models.APIKeyPrefix + "unavailable"}}, models.ScopeRead)
+		assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+	})
+
+	t.Run("Auth. Malformed authorization header.", func(t *testing.T) {
+		for _, header := range []string{"Basic dXNlcjpwYXNz", "Bearer", "Bearer ", "Bearer not-a-jwt"} {
+			res, _ := serveHeader(t, http.MethodPost, http.Header{"Authorization": {header}}, models.ScopeWrite)
+			assert.Equal(t, http.StatusUnauthorized, res.Code, header)
+			assert.Empty(t, res.Result().Cookies(), header)
+		}
+	})
+
+	t.Run("Auth. Session required.", func(t *testing.T) {
+		h := Auth(RequireSession(func(res http.ResponseWriter, req *http.Request) {}))
+
+		req := httptest.NewRequest(http.MethodGet, "/api/user/keys", nil)
+		req.Header.Set(APIKeyHeader, readKey)
+		res := httptest.NewRecorder()
+		h(res, req)
+		assert.Equal(t, http.StatusForbidden, res.Code)
+
+		token, err := BuildJWTString()
+		require.NoError(t, err)
+
+		req = httptest.NewRequest(http.MethodGet, "/api/user/keys", nil)
+		req.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: token})
+		res = httptest.NewRecorder()
+		h(res, req)
+		assert.Equal(t, http.StatusOK, res.Code)
+	})
+}
+
+func TestConfig(t *testing.T) {
+	t.Run("Config. Short secret.", func(t *testing.T) {
+		assert.Error(t, Initialize(Config{Keys: []Key{{ID: defaultKeyID, Secret: []byte("supersecretkey")}}}))
+	})
+
+	t.Run("Config. SameSite none requires secure.", func(t *testing.T) {
+		assert.Error(t, Initialize(Config{Keys: []Key{newKey}, Cookie: CookieConfig{SameSite: http.SameSiteNoneMode}}))
+	})
+
+	t.Run("Config. Refresh interval longer than lifetime.", func(t *testing.T) {
+		assert.Error(t, Initialize(Config{Keys: []Key{newKey}, TokenExp: time.Hour, RefreshBefore: 2 * time.Hour}))
+	})
+
+	t.Run("Config. Key file.", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "jwt.keys")
+		content := "# ключ для новых токенов\n" + newKey.ID + ":" + string(newKey.Secret) + "\n\n" + oldKey.ID + ":" + string(oldKey.Secret) + "\n"
+		require.NoError(t, os.WriteFile(filename, []byte(content), 0600))
+
+		keys, err := LoadKeys(filename, "ignored")
+		require.NoError(t, err)
+		assert.Equal(t, []Key{newKey, oldKey}, keys)
+
+		require.NoError(t, os.WriteFile(filename, []byte("no-separator\n"), 0600))
+		_, err = LoadKeyFile(filename)
+		assert.Error(t, err)
+	})
+
+	t.Run("Config. No keys.", func(t *testing.T) {
+		_, err := LoadKeys("", "")
+		assert.ErrorIs(t, err, ErrNoKeys)
+	})
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// MinSecretLen - минимальная длина ключа подписи, короткие ключи подбираются перебором
+const MinSecretLen = 32
+
+// идентификатор ключа, заданного одной строкой без файла ключей
+const defaultKeyID = "default"
+
+var ErrNoKeys = errors.New("no jwt signing keys")
+
+// Key - ключ подписи токенов, ID попадает в заголовок kid токена
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// keySet - действующие ключи: первым подписываются новые токены, остальные принимаются до окончания ротации
+type keySet struct {
+	active Key
+	byID   map[string][]byte
+}
+
+func newKeySet(keys []Key) (*keySet, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	ks := &keySet{active: keys[0], byID: make(map[string][]byte, len(keys))}
+
+	for _, key := range keys {
+		if key.ID == "" {
+			return nil, errors.New("jwt key id is empty")
+		}
+		if len(key.Secret) < MinSecretLen {
+			return nil, fmt.Errorf("jwt key %q: secret must be at least %d bytes", key.ID, MinSecretLen)
+		}
+		if _, ok := ks.byID[key.ID]; ok {
+			return nil, fmt.Errorf("jwt key %q: duplicate id", key.ID)
+		}
+		ks.byID[key.ID] = key.Secret
+	}
+	return ks, nil
+}
+
+// LoadKeys собирает ключи подписи из файла ключей или строки secret, файл имеет приоритет.
+// Если не задано ни то, ни другое, возвращается ErrNoKeys
+func LoadKeys(keyFile, secret string) ([]Key, error) {
+	if keyFile != "" {
+		return LoadKeyFile(keyFile)
+	}
+
+	if secret != "" {
+		return []Key{{ID: defaultKeyID, Secret: []byte(secret)}}, nil
+	}
+
+	return nil, ErrNoKeys
+}
+
+// LoadKeyFile читает файл ключей: по одному ключу в строке в виде <kid>:<secret>, пустые строки и строки с # пропускаются.
+// Первый ключ подписывает новые токены, при ротации новый ключ ставится первым, а старый удаляется, когда истекут его токены
+func LoadKeyFile(filename string) ([]Key, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var keys []Key
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		id, secret, ok := strings.Cut(text, ":")
+		if !ok {
+			return nil, fmt.Errorf("jwt key file %s:%d: expected <kid>:<secret>", filename, line)
+		}
+		keys = append(keys, Key{ID: strings.TrimSpace(id), Secret: []byte(strings.TrimSpace(secret))})
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("jwt key file %s: %w", filename, ErrNoKeys)
+	}
+	return keys, nil
+}
+
+// RandomKey - ключ на время жизни процесса, выданные им токены перестанут приниматься после перезапуска
+func RandomKey() (Key, error) {
+	secret := make([]byte, MinSecretLen)
+	if _, err := rand.Read(secret); err != nil {
+		return Key{}, err
+	}
+
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return Key{}, err
+	}
+
+	return Key{ID: "ephemeral-" + hex.EncodeToString(id), Secret: secret}, nil
+}
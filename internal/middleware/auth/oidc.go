@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/handlers/problem"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/oidc"
+	"github.com/google/uuid"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	FlowCookieName            = "oidc_flow"
+	flowTTL                   = 10 * time.Minute
+	identityKey    contextKey = "oidc_identity"
+)
+
+// OIDCProvider - внешний провайдер OpenID Connect, реализуется oidc.Provider
+type OIDCProvider interface {
+	AuthCodeURL(oidc.Flow) string
+	Exchange(context.Context, string, oidc.Flow) (oidc.Identity, error)
+	VerifyUserID(context.Context, string) (uuid.UUID, error)
+}
+
+// OIDCLogin начинает вход через провайдера: одноразовые значения входа сохраняются в куке,
+// клиент уходит на страницу входа провайдера
+func OIDCLogin(res http.ResponseWriter, req *http.Request) {
+	s := current.Load()
+	if s.oidc == nil {
+		http.NotFound(res, req)
+		return
+	}
+
+	flow := oidc.NewFlow()
+	s.writeFlowCookie(res, strings.Join([]string{flow.State, flow.Nonce, flow.Verifier}, "."), int(flowTTL.Seconds()))
+
+	http.Redirect(res, req, s.oidc.AuthCodeURL(flow), http.StatusFound)
+}
+
+// OIDCCallback принимает возврат от провайдера: сверяет state с кукой входа, обменивает код и проверяет ID-токен.
+// В контексте обработчика пользователь провайдера и, как в Identify, анонимный пользователь из куки
+func OIDCCallback(h http.HandlerFunc) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		s := current.Load()
+		if s.oidc == nil {
+			http.NotFound(res, req)
+			return
+		}
+
+		flow, err := readFlow(req)
+
+		//значения входа одноразовые, кука удаляется при любом исходе
+		s.writeFlowCookie(res, "", -1)
+
+		if err != nil {
+			problem.Write(res, req, err)
+			return
+		}
+
+		q := req.URL.Query()
+
+		if subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(flow.State)) != 1 {
+			problem.Write(res, req, fmt.Errorf("%w: state mismatch", errs.ErrOIDCFlowNotValid))
+			return
+		}
+
+		if e := q.Get("error"); e != "" {
+			logger.Sugar.Infow("Auth. OIDC provider error.", "error", e, "description", q.Get("error_description"))
+			problem.Write(res, req, errs.ErrOIDCLoginFailed)
+			return
+		}
+
+		identity, err := s.oidc.Exchange(req.Context(), q.Get("code"), flow)
+		if err != nil {
+			logger.Sugar.Infow("Auth. OIDC exchange error.", "err", err.Error())
+			problem.Write(res, req, errs.ErrOIDCLoginFailed)
+			return
+		}
+
+		ctx := context.WithValue(req.Context(), KeyName, s.identify(req))
+		ctx = context.WithValue(ctx, identityKey, identity)
+		h.ServeHTTP(res, req.WithContext(ctx))
+	}
+}
+
+// OIDCIdentity - пользователь провайдера, подтвержденный OIDCCallback
+func OIDCIdentity(ctx context.Context) (oidc.Identity, bool) {
+	identity, ok := ctx.Value(identityKey).(oidc.Identity)
+	return identity, ok
+}
+
+func readFlow(req *http.Request) (oidc.Flow, error) {
+	cookie, err := req.Cookie(FlowCookieName)
+	if err != nil {
+		return oidc.Flow{}, fmt.Errorf("%w: login flow not found", errs.ErrOIDCFlowNotValid)
+	}
+
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return oidc.Flow{}, fmt.Errorf("%w: login flow is malformed", errs.ErrOIDCFlowNotValid)
+	}
+	return oidc.Flow{State: parts[0], Nonce: parts[1], Verifier: parts[2]}, nil
+}
+
+func (s *settings) writeFlowCookie(res http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(res, &http.Cookie{
+		Name:     FlowCookieName,
+		Value:    value,
+		Path:     s.cookie.Path,
+		Domain:   s.cookie.Domain,
+		MaxAge:   maxAge,
+		Secure:   s.cookie.Secure,
+		HttpOnly: true,
+		//провайдер возвращает клиента переходом с другого сайта, куку Strict браузер не передаст
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"context"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/dubrovsky1/url-shortener/internal/oidc"
+	"github.com/dubrovsky1/url-shortener/internal/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// oidcServer - сокращатель с входом через тестовый провайдер, в identities - пользователи, прошедшие вход
+type oidcServer struct {
+	*httptest.Server
+	issuer     *oidctest.Issuer
+	identities []oidc.Identity
+	anonymous  []uuid.UUID
+}
+
+func newOIDCServer(t *testing.T) *oidcServer {
+	issuer, err := oidctest.New("shortener")
+	require.NoError(t, err)
+	t.Cleanup(issuer.Close)
+
+	s := &oidcServer{issuer: issuer}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/user/oidc/login", OIDCLogin)
+	mux.HandleFunc("/api/user/oidc/callback", OIDCCallback(func(res http.ResponseWriter, req *http.Request) {
+		identity, ok := OIDCIdentity(req.Context())
+		require.True(t, ok)
+
+		s.identities = append(s.identities, identity)
+		s.anonymous = append(s.anonymous, req.Context().Value(KeyName).(uuid.UUID))
+	}))
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	provider, err := oidc.New(context.Background(), oidc.Config{
+		Issuer:      issuer.URL,
+		ClientID:    "shortener",
+		RedirectURL: s.URL + "/api/user/oidc/callback",
+	})
+	require.NoError(t, err)
+
+	configure(t, Config{Keys: []Key{newKey}, OIDC: provider})
+	return s
+}
+
+// client - браузер с кукой, follow - проходить ли перенаправления
+func (s *oidcServer) client(t *testing.T, follow bool) *http.Client {
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+
+	client := &http.Client{Jar: jar}
+	if !follow {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	}
+	return client
+}
+
+// redirect выполняет запрос и возвращает адрес перенаправления
+func redirect(t *testing.T, client *http.Client, target string) *url.URL {
+	resp, err := client.Get(target)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	location, err := resp.Location()
+	require.NoError(t, err)
+	return location
+}
+
+func get(t *testing.T, client *http.Client, target string) int {
+	resp, err := client.Get(target)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestOIDC(t *testing.T) {
+	logger.Initialize()
+
+	t.Run("OIDC. Login flow.", func(t *testing.T) {
+		s := newOIDCServer(t)
+		s.issuer.SetSubject("alice")
+
+		client := s.client(t, true)
+		require.Equal(t, http.StatusOK, get(t, client, s.URL+"/api/user/oidc/login"))
+
+		require.Len(t, s.identities, 1)
+		assert.Equal(t, oidc.Identity{Issuer: s.issuer.URL, Subject: "alice"}, s.identities[0])
+		assert.Equal(t, uuid.Nil, s.anonymous[0])
+
+		//кука входа одноразовая
+		serverURL, _ := url.Parse(s.URL)
+		for _, cookie := range client.Jar.Cookies(serverURL) {
+			assert.NotEqual(t, FlowCookieName, cookie.Name)
+		}
+	})
+
+	t.Run("OIDC. Stable user id.", func(t *testing.T) {
+		s := newOIDCServer(t)
+
+		s.issuer.SetSubject("alice")
+		require.Equal(t, http.StatusOK, get(t, s.client(t, true), s.URL+"/api/user/oidc/login"))
+		require.Equal(t, http.StatusOK, get(t, s.client(t, true), s.URL+"/api/user/oidc/login"))
+
+		s.issuer.SetSubject("bob")
+		require.Equal(t, http.StatusOK, get(t, s.client(t, true), s.URL+"/api/user/oidc/login"))
+
+		require.Len(t, s.identities, 3)
+		assert.Equal(t, s.identities[0].UserID(), s.identities[1].UserID())
+		assert.NotEqual(t, s.identities[0].UserID(), s.identities[2].UserID())
+
+		//тот же sub другого провайдера - другой пользователь
+		other := oidc.Identity{Issuer: "https://other.example", Subject: "alice"}
+		assert.NotEqual(t, s.identities[0].UserID(), other.UserID())
+	})
+
+	t.Run("OIDC. Anonymous user is passed on.", func(t *testing.T) {
+		s := newOIDCServer(t)
+
+		token, err := BuildJWTString()
+		require.NoError(t, err)
+		anonymous, err := GetUserID(token)
+		require.NoError(t, err)
+
+		client := s.client(t, true)
+		serverURL, _ := url.Parse(s.URL)
+		client.Jar.SetCookies(serverURL, []*http.Cookie{{Name: DefaultCookieName, Value: token, Path: "/"}})
+
+		require.Equal(t, http.StatusOK, get(t, client, s.URL+"/api/user/oidc/login"))
+		require.Len(t, s.anonymous, 1)
+		assert.Equal(t, anonymous, s.anonymous[0])
+	})
+
+	t.Run("OIDC. State mismatch.", func(t *testing.T) {
+		s := newOIDCServer(t)
+		client := s.client(t, false)
+
+		authorize := redirect(t, client, s.URL+"/api/user/oidc/login")
+		callback := redirect(t, client, authorize.String())
+
+		q := callback.Query()
+		state := q.Get("state")
+		q.Set("state", "forged")
+		callback.RawQuery = q.Encode()
+
+		assert.Equal(t, http.StatusBadRequest, get(t, client, callback.String()))
+
+		//после неудачной попытки кука входа удалена, и верный state тоже не принимается
+		q.Set("state", state)
+		callback.RawQuery = q.Encode()
+		assert.Equal(t, http.StatusBadRequest, get(t, client, callback.String()))
+		assert.Empty(t, s.identities)
+	})
+
+	t.Run("OIDC. Callback without login flow.", func(t *testing.T) {
+		s := newOIDCServer(t)
+
+		authorize := redirect(t, s.client(t, false), s.URL+"/api/user/oidc/login")
+		callback := redirect(t, s.client(t, false), authorize.String())
+
+		//код и state украдены, но кука входа осталась у настоящего клиента
+		assert.Equal(t, http.StatusBadRequest, get(t, s.client(t, false), callback.String()))
+		assert.Empty(t, s.identities)
+	})
+
+	t.Run("OIDC. Provider error.", func(t *testing.T) {
+		s := newOIDCServer(t)
+		client := s.client(t, false)
+
+		authorize := redirect(t, client, s.URL+"/api/user/oidc/login")
+
+		callback := s.URL + "/api/user/oidc/callback?" + url.Values{
+			"state": {authorize.Query().Get("state")},
+			"error": {"access_denied"},
+		}.Encode()
+		assert.Equal(t, http.StatusUnauthorized, get(t, client, callback))
+		assert.Empty(t, s.identities)
+	})
+
+	t.Run("OIDC. Disabled.", func(t *testing.T) {
+		configure(t, Config{Keys: []Key{newKey}})
+
+		res := httptest.NewRecorder()
+		OIDCLogin(res, httptest.NewRequest(http.MethodGet, "/api/user/oidc/login", nil))
+		assert.Equal(t, http.StatusNotFound, res.Code)
+	})
+}
+
+func TestOIDCBearer(t *testing.T) {
+	logger.Initialize()
+
+	s := newOIDCServer(t)
+
+	other, err := oidctest.New("shortener")
+	require.NoError(t, err)
+	defer other.Close()
+
+	t.Run("Auth. Bearer ID token.", func(t *testing.T) {
+		token, err := s.issuer.IDToken("alice")
+		require.NoError(t, err)
+
+		res, got := serveHeader(t, http.MethodPost, http.Header{"Authorization": {"Bearer " + token}}, models.ScopeWrite)
+		require.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, oidc.Identity{Issuer: s.issuer.URL, Subject: "alice"}.UserID(), got)
+		assert.Empty(t, res.Result().Cookies())
+	})
+
+	t.Run("Auth. Bearer JWT still works.", func(t *testing.T) {
+		owner := uuid.New()
+		token := sign(t, newKey, Claims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}, UserID: owner})
+
+		res, got := serveHeader(t, http.MethodPost, http.Header{"Authorization": {"Bearer " + token}}, models.ScopeWrite)
+		require.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, owner, got)
+	})
+
+	t.Run("Auth. Bad ID tokens.", func(t *testing.T) {
+		now := time.Now()
+
+		wrongAudience, err := s.issuer.Sign(jwt.MapClaims{"iss": s.issuer.URL, "aud": "another-client", "sub": "alice", "exp": now.Add(time.Hour).Unix()})
+		require.NoError(t, err)
+
+		expired, err := s.issuer.Sign(jwt.MapClaims{"iss": s.issuer.URL, "aud": "shortener", "sub": "alice", "exp": now.Add(-time.Hour).Unix()})
+		require.NoError(t, err)
+
+		foreignIssuer, err := other.IDToken("alice")
+		require.NoError(t, err)
+
+		//подписан ключом, которого нет в JWKS провайдера
+		forged, err := other.Sign(jwt.MapClaims{"iss": s.issuer.URL, "aud": "shortener", "sub": "alice", "exp": now.Add(time.Hour).Unix()})
+		require.NoError(t, err)
+
+		for name, token := range map[string]string{"audience": wrongAudience, "expired": expired, "issuer": foreignIssuer, "forged": forged} {
+			res, _ := serveHeader(t, http.MethodPost, http.Header{"Authorization": {"Bearer " + token}}, models.ScopeWrite)
+			assert.Equal(t, http.StatusUnauthorized, res.Code, name)
+		}
+	})
+}
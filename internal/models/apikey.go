@@ -0,0 +1,41 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Scope - право, выданное API-ключу
+type Scope string
+
+const (
+	ScopeRead   Scope = "read"   //чтение своих ссылок, статистики и заданий на удаление
+	ScopeWrite  Scope = "write"  //сокращение ссылок
+	ScopeDelete Scope = "delete" //удаление ссылок
+)
+
+// APIKeyPrefix - начало API-ключа, по нему ключ отличается от JWT в заголовке Authorization
+const APIKeyPrefix = "usk_"
+
+// APIKey - долгоживущий ключ доступа сервисов к API. Сам ключ не хранится, только его хеш
+type APIKey struct {
+	ID        uuid.UUID  `json:"id"`
+	UserID    uuid.UUID  `json:"-"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"` //начало ключа, чтобы пользователь мог узнать ключ в списке
+	Hash      string     `json:"-"`
+	Scopes    []Scope    `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type APIKeyRequest struct {
+	Name   string  `json:"name"`
+	Scopes []Scope `json:"scopes"`
+}
+
+// APIKeyResponse - созданный ключ, сам ключ отдается только в этом ответе
+type APIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
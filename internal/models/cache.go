@@ -0,0 +1,12 @@
+package models
+
+// CacheStats - счетчики кеша ссылок для подбора его размера
+type CacheStats struct {
+	Size         int     `json:"size"`
+	Capacity     int     `json:"capacity"`
+	Hits         int64   `json:"hits"`
+	NegativeHits int64   `json:"negative_hits"`
+	Misses       int64   `json:"misses"`
+	Evictions    int64   `json:"evictions"`
+	HitRatio     float64 `json:"hit_ratio"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Click - событие перехода по короткой ссылке
+type Click struct {
+	ShortURL  ShortURL  `json:"short_url"`
+	ClickedAt time.Time `json:"clicked_at"`
+	Referrer  string    `json:"referrer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	IPHash    string    `json:"ip_hash,omitempty"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// состояния записи в очереди на удаление
+const (
+	OutboxPending = "pending" //ожидает обработки или повторной попытки
+	OutboxDone    = "done"    //обработана, результат сохранен в Result
+	OutboxDead    = "dead"    //попытки исчерпаны, запись ждет ручного разбора
+)
+
+// результаты удаления отдельной ссылки
+const (
+	DeleteResultDeleted  = "deleted"
+	DeleteResultNotFound = "not_found"
+	DeleteResultNotOwned = "not_owned"
+	DeleteResultPending  = "pending"
+	DeleteResultFailed   = "failed"
+)
+
+// состояния задания на удаление
+const (
+	DeleteJobPending = "pending"
+	DeleteJobDone    = "done"
+	DeleteJobFailed  = "failed"
+)
+
+// OutboxItem - принятая к удалению ссылка, сохраненная до ответа пользователю
+type OutboxItem struct {
+	ID            int64     `json:"id"`
+	JobID         uuid.UUID `json:"job_id"`
+	UserID        uuid.UUID `json:"-"`
+	ShortURL      ShortURL  `json:"short_url"`
+	Status        string    `json:"status"`
+	Result        string    `json:"result,omitempty"`
+	Attempts      int       `json:"attempts"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	LastError     string    `json:"last_error,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// DeleteJob - состояние задания на удаление, собранное по записям очереди
+type DeleteJob struct {
+	JobID      uuid.UUID         `json:"job_id"`
+	Status     string            `json:"status"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+	Results    []DeleteJobResult `json:"results"`
+}
+
+// DeleteJobResult - результат удаления одной ссылки задания
+type DeleteJobResult struct {
+	ShortURL ShortURL `json:"short_url"`
+	Result   string   `json:"result"`
+	Error    string   `json:"error,omitempty"`
+}
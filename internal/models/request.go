@@ -1,10 +1,26 @@
 package models
 
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
 type Request struct {
-	URL string `json:"url"`
+	URL          string     `json:"url"`
+	Alias        string     `json:"alias,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	TTLSeconds   int64      `json:"ttl_seconds,omitempty"`
+	RedirectType int        `json:"redirect_type,omitempty"`
+	ForwardQuery bool       `json:"forward_query,omitempty"`
+	TeamID       uuid.UUID  `json:"team_id,omitempty"` //ссылка команды, нужна роль editor
 }
 
 type BatchRequest struct {
-	CorrelationID string `json:"correlation_id"`
-	URL           string `json:"original_url"`
+	CorrelationID string     `json:"correlation_id"`
+	URL           string     `json:"original_url"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	TTLSeconds    int64      `json:"ttl_seconds,omitempty"`
+	RedirectType  int        `json:"redirect_type,omitempty"`
+	ForwardQuery  bool       `json:"forward_query,omitempty"`
+	ShortURL      ShortURL   `json:"-"`
 }
@@ -1,5 +1,7 @@
 package models
 
+import "github.com/google/uuid"
+
 type Response struct {
 	Result string `json:"result"`
 }
@@ -7,4 +9,9 @@ type Response struct {
 type BatchResponse struct {
 	CorrelationID string `json:"correlation_id"`
 	ShortURL      string `json:"short_url"`
+	Conflict      bool   `json:"conflict,omitempty"` //URL был сокращен до этой пачки, отдан его прежний код
+}
+
+type DeleteJobResponse struct {
+	JobID uuid.UUID `json:"job_id"`
 }
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// StatsParams - параметры выборки статистики по ссылке
+type StatsParams struct {
+	From   time.Time
+	To     time.Time
+	Bucket string
+}
+
+// Stats - статистика переходов по короткой ссылке
+type Stats struct {
+	ShortURL       ShortURL     `json:"short_url"`
+	From           time.Time    `json:"from"`
+	To             time.Time    `json:"to"`
+	Bucket         string       `json:"bucket"`
+	TotalClicks    int          `json:"total_clicks"`
+	UniqueVisitors int          `json:"unique_visitors"`
+	Series         []StatsPoint `json:"series"`
+	TopReferrers   []StatsCount `json:"top_referrers"`
+	UserAgents     []StatsCount `json:"user_agents"`
+}
+
+// StatsPoint - количество переходов за один интервал временного ряда
+type StatsPoint struct {
+	Time           time.Time `json:"time"`
+	Clicks         int       `json:"clicks"`
+	UniqueVisitors int       `json:"unique_visitors"`
+}
+
+// StatsCount - количество переходов в разрезе источника или семейства User-Agent
+type StatsCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Role - роль участника команды, каждая следующая включает права предыдущей
+type Role string
+
+const (
+	RoleViewer Role = "viewer" //видит ссылки команды и их статистику
+	RoleEditor Role = "editor" //создает и удаляет ссылки команды
+	RoleOwner  Role = "owner"  //управляет участниками команды
+)
+
+var roleLevels = map[Role]int{RoleViewer: 1, RoleEditor: 2, RoleOwner: 3}
+
+// Valid - известна ли роль
+func (r Role) Valid() bool {
+	_, ok := roleLevels[r]
+	return ok
+}
+
+// Can - достаточно ли роли r для действия, которому нужна роль need
+func (r Role) Can(need Role) bool {
+	return r.Valid() && roleLevels[r] >= roleLevels[need]
+}
+
+// Team - команда, ссылки которой доступны всем ее участникам
+type Team struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Role      Role      `json:"role,omitempty"` //роль пользователя, запросившего список своих команд
+}
+
+// TeamMember - участие пользователя в команде
+type TeamMember struct {
+	TeamID    uuid.UUID `json:"-"`
+	UserID    uuid.UUID `json:"user_id"`
+	Role      Role      `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Merge - участие после объединения двух пользователей в одной команде: старшая из ролей и более раннее вступление
+func (m TeamMember) Merge(other TeamMember) TeamMember {
+	if !m.Role.Can(other.Role) {
+		m.Role = other.Role
+	}
+	if other.CreatedAt.Before(m.CreatedAt) {
+		m.CreatedAt = other.CreatedAt
+	}
+	return m
+}
+
+type TeamRequest struct {
+	Name string `json:"name"`
+}
+
+type TeamMemberRequest struct {
+	Role Role `json:"role"`
+}
@@ -29,6 +29,9 @@ type MockStorage struct {
 	List        []ShortenURL
 	ShortenURL  ShortenURL
 	DeletedURLS []DeletedURLS
+	Clicks      []Click
+	Outbox      []OutboxItem
+	APIKeys     []APIKey
 	Error       error
 }
 
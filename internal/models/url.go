@@ -1,6 +1,10 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+)
 
 type (
 	OriginalURL string
@@ -10,14 +14,42 @@ type (
 )
 
 type ShortenURL struct {
-	ID          uuid.UUID   `json:"-"`
-	ShortURL    ShortURL    `json:"short_url,omitempty"`
-	OriginalURL OriginalURL `json:"original_url,omitempty"`
-	UserID      uuid.UUID   `json:"-"`
-	IsDel       bool        `json:"is_deleted,omitempty"`
+	ID           uuid.UUID   `json:"-"`
+	ShortURL     ShortURL    `json:"short_url,omitempty"`
+	OriginalURL  OriginalURL `json:"original_url,omitempty"`
+	UserID       uuid.UUID   `json:"-"`
+	TeamID       uuid.UUID   `json:"-"` //uuid.Nil - личная ссылка пользователя UserID
+	IsDel        bool        `json:"is_deleted,omitempty"`
+	ExpiresAt    *time.Time  `json:"expires_at,omitempty"`
+	RedirectType int         `json:"redirect_type,omitempty"`
+	ForwardQuery bool        `json:"forward_query,omitempty"`
+}
+
+// RedirectStatus - код ответа при переходе, ссылки без сохраненного типа перенаправляют с 307
+func (u ShortenURL) RedirectStatus() int {
+	if u.RedirectType == 0 {
+		return http.StatusTemporaryRedirect
+	}
+	return u.RedirectType
+}
+
+// IsExpired - истек ли срок жизни ссылки на момент now
+func (u ShortenURL) IsExpired(now time.Time) bool {
+	return u.ExpiresAt != nil && !now.Before(*u.ExpiresAt)
+}
+
+// DeletableBy - относится ли ссылка к удалению item: ссылка команды - по команде, личная - по пользователю
+func (u ShortenURL) DeletableBy(item DeletedURLS) bool {
+	if item.TeamID != uuid.Nil {
+		return u.TeamID == item.TeamID
+	}
+	return u.TeamID == uuid.Nil && u.UserID == item.UserID
 }
 
+// DeletedURLS - ссылка на удаление. Без TeamID удаляется только личная ссылка UserID,
+// с TeamID - ссылка команды, права пользователя в команде проверяет сервис
 type DeletedURLS struct {
 	UserID   uuid.UUID `db:"created_user_id"`
 	ShortURL ShortURL  `db:"short_url"`
+	TeamID   uuid.UUID `db:"team_id"`
 }
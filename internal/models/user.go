@@ -0,0 +1,27 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// User - зарегистрированный пользователь. ID совпадает с UserID в токене, поэтому ссылки и ключи привязываются к нему так же,
+// как к анонимному пользователю
+type User struct {
+	ID           uuid.UUID `json:"id"`
+	Login        string    `json:"login"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type Credentials struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+// SessionResponse - пользователь после входа. Токен тот же, что и в куке, его можно передавать в заголовке Authorization
+type SessionResponse struct {
+	User
+	Token      string `json:"token"`
+	MergedURLs int64  `json:"merged_urls"` //ссылок анонимного пользователя, перенесенных в учетную запись
+}
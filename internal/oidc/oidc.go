@@ -0,0 +1,148 @@
+// Package oidc - вход через внешнего провайдера OpenID Connect: authorization code с PKCE и проверка ID-токенов по JWKS
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+// Config - настройки клиента провайдера, Issuer и ClientID обязательны
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string //пустой для публичного клиента, PKCE используется в любом случае
+	RedirectURL  string
+	JWKSURL      string   //ключи проверки ID-токенов, если не задан - берется из discovery
+	Scopes       []string //кроме openid, который запрашивается всегда
+}
+
+// Identity - пользователь провайдера из проверенного ID-токена
+type Identity struct {
+	Issuer  string
+	Subject string
+}
+
+// UserID - постоянный идентификатор пользователя сокращателя для пользователя провайдера.
+// sub уникален только в пределах провайдера, поэтому в идентификатор входит и issuer
+func (i Identity) UserID() uuid.UUID {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(i.Issuer+"#"+i.Subject))
+}
+
+// Login - логин учетной записи пользователя провайдера. Двоеточие недопустимо в логинах регистрации,
+// поэтому такие учетные записи не пересекаются с обычными
+func (i Identity) Login() string {
+	return "oidc:" + i.Issuer + "#" + i.Subject
+}
+
+var ErrNotConfigured = errors.New("oidc issuer and client id are required")
+
+// Provider - клиент провайдера
+type Provider struct {
+	oauth    oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// New читает discovery провайдера. Если задан JWKSURL, ключи проверки берутся из него
+func New(ctx context.Context, cfg Config) (*Provider, error) {
+	if cfg.Issuer == "" || cfg.ClientID == "" {
+		return nil, ErrNotConfigured
+	}
+
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+
+	verifierConfig := &oidc.Config{ClientID: cfg.ClientID}
+
+	verifier := provider.Verifier(verifierConfig)
+	if cfg.JWKSURL != "" {
+		//ключи загружаются и обновляются в фоне, контекст должен жить столько же, сколько приложение
+		verifier = oidc.NewVerifier(cfg.Issuer, oidc.NewRemoteKeySet(ctx, cfg.JWKSURL), verifierConfig)
+	}
+
+	return &Provider{
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       append([]string{oidc.ScopeOpenID}, cfg.Scopes...),
+		},
+		verifier: verifier,
+	}, nil
+}
+
+// Flow - одноразовые значения одного входа, хранятся у клиента до возврата от провайдера
+type Flow struct {
+	State    string
+	Nonce    string
+	Verifier string //PKCE code_verifier
+}
+
+// NewFlow - случайные значения для нового входа
+func NewFlow() Flow {
+	return Flow{
+		State:    oauth2.GenerateVerifier(),
+		Nonce:    oauth2.GenerateVerifier(),
+		Verifier: oauth2.GenerateVerifier(),
+	}
+}
+
+// AuthCodeURL - адрес страницы входа провайдера
+func (p *Provider) AuthCodeURL(flow Flow) string {
+	return p.oauth.AuthCodeURL(flow.State, oidc.Nonce(flow.Nonce), oauth2.S256ChallengeOption(flow.Verifier))
+}
+
+// Exchange обменивает код на токены и проверяет ID-токен: подпись по JWKS, issuer, audience, срок жизни и nonce
+func (p *Provider) Exchange(ctx context.Context, code string, flow Flow) (Identity, error) {
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(flow.Verifier))
+	if err != nil {
+		return Identity{}, fmt.Errorf("oidc code exchange: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return Identity{}, errors.New("oidc token response has no id_token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	if idToken.Nonce != flow.Nonce {
+		return Identity{}, errors.New("oidc id_token nonce mismatch")
+	}
+
+	return identity(idToken)
+}
+
+// Verify проверяет ID-токен, переданный клиентом напрямую в заголовке Authorization
+func (p *Provider) Verify(ctx context.Context, rawIDToken string) (Identity, error) {
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return Identity{}, err
+	}
+	return identity(idToken)
+}
+
+// VerifyUserID - идентификатор пользователя сокращателя по ID-токену, для auth.Auth
+func (p *Provider) VerifyUserID(ctx context.Context, rawIDToken string) (uuid.UUID, error) {
+	id, err := p.Verify(ctx, rawIDToken)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return id.UserID(), nil
+}
+
+func identity(idToken *oidc.IDToken) (Identity, error) {
+	if idToken.Subject == "" {
+		return Identity{}, errors.New("oidc id_token has no sub")
+	}
+	return Identity{Issuer: idToken.Issuer, Subject: idToken.Subject}, nil
+}
@@ -0,0 +1,107 @@
+package oidc
+
+import (
+	"context"
+	"github.com/dubrovsky1/url-shortener/internal/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// authorize проходит страницу входа провайдера и возвращает код
+func authorize(t *testing.T, p *Provider, flow Flow) string {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	resp, err := client.Get(p.AuthCodeURL(flow))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	location, err := resp.Location()
+	require.NoError(t, err)
+	require.Equal(t, flow.State, location.Query().Get("state"))
+	return location.Query().Get("code")
+}
+
+func TestProvider(t *testing.T) {
+	ctx := context.Background()
+
+	issuer, err := oidctest.New("shortener")
+	require.NoError(t, err)
+	defer issuer.Close()
+
+	issuer.SetSubject("alice")
+
+	cfg := Config{Issuer: issuer.URL, ClientID: "shortener", RedirectURL: "http://localhost:8080/api/user/oidc/callback"}
+
+	p, err := New(ctx, cfg)
+	require.NoError(t, err)
+
+	t.Run("Exchange. Success.", func(t *testing.T) {
+		flow := NewFlow()
+
+		identity, err := p.Exchange(ctx, authorize(t, p, flow), flow)
+		require.NoError(t, err)
+		assert.Equal(t, Identity{Issuer: issuer.URL, Subject: "alice"}, identity)
+	})
+
+	t.Run("Exchange. Wrong PKCE verifier.", func(t *testing.T) {
+		flow := NewFlow()
+		code := authorize(t, p, flow)
+
+		flow.Verifier = NewFlow().Verifier
+		_, err := p.Exchange(ctx, code, flow)
+		assert.Error(t, err)
+	})
+
+	t.Run("Exchange. Wrong nonce.", func(t *testing.T) {
+		flow := NewFlow()
+		code := authorize(t, p, flow)
+
+		flow.Nonce = NewFlow().Nonce
+		_, err := p.Exchange(ctx, code, flow)
+		assert.ErrorContains(t, err, "nonce")
+	})
+
+	t.Run("Exchange. Code is single use.", func(t *testing.T) {
+		flow := NewFlow()
+		code := authorize(t, p, flow)
+
+		_, err := p.Exchange(ctx, code, flow)
+		require.NoError(t, err)
+
+		_, err = p.Exchange(ctx, code, flow)
+		assert.Error(t, err)
+	})
+
+	t.Run("Verify. Configured JWKS.", func(t *testing.T) {
+		withJWKS := cfg
+		withJWKS.JWKSURL = issuer.URL + "/jwks"
+
+		pj, err := New(ctx, withJWKS)
+		require.NoError(t, err)
+
+		token, err := issuer.IDToken("bob")
+		require.NoError(t, err)
+
+		userID, err := pj.VerifyUserID(ctx, token)
+		require.NoError(t, err)
+		assert.Equal(t, Identity{Issuer: issuer.URL, Subject: "bob"}.UserID(), userID)
+	})
+
+	t.Run("Verify. Token without sub.", func(t *testing.T) {
+		token, err := issuer.Sign(jwt.MapClaims{"iss": issuer.URL, "aud": "shortener", "exp": time.Now().Add(time.Hour).Unix()})
+		require.NoError(t, err)
+
+		_, err = p.Verify(ctx, token)
+		assert.Error(t, err)
+	})
+
+	t.Run("New. Not configured.", func(t *testing.T) {
+		_, err := New(ctx, Config{Issuer: issuer.URL})
+		assert.ErrorIs(t, err, ErrNotConfigured)
+	})
+}
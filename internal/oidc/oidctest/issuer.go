@@ -0,0 +1,236 @@
+// Package oidctest - провайдер OpenID Connect в процессе для тестов: discovery, JWKS, authorization code с PKCE.
+// Страница входа не показывается, каждый запрос авторизации сразу одобряется для пользователя Subject
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v4"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const keyID = "oidctest"
+
+// grant - выданный, но еще не обмененный код
+type grant struct {
+	redirectURI string
+	challenge   string
+	nonce       string
+	subject     string
+}
+
+// Issuer - тестовый провайдер, URL - его issuer
+type Issuer struct {
+	URL      string
+	ClientID string
+
+	server  *httptest.Server
+	key     *rsa.PrivateKey
+	mu      sync.Mutex
+	subject string
+	codes   map[string]grant
+}
+
+// New запускает провайдер для клиента clientID, остановка - Close
+func New(clientID string) (*Issuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	i := &Issuer{
+		ClientID: clientID,
+		key:      key,
+		subject:  "user-1",
+		codes:    make(map[string]grant),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", i.discovery)
+	mux.HandleFunc("/jwks", i.jwks)
+	mux.HandleFunc("/authorize", i.authorize)
+	mux.HandleFunc("/token", i.token)
+
+	i.server = httptest.NewServer(mux)
+	i.URL = i.server.URL
+	return i, nil
+}
+
+func (i *Issuer) Close() {
+	i.server.Close()
+}
+
+// SetSubject задает пользователя, который войдет при следующих запросах авторизации
+func (i *Issuer) SetSubject(subject string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.subject = subject
+}
+
+// Sign подписывает ключом провайдера произвольные утверждения
+func (i *Issuer) Sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+	return token.SignedString(i.key)
+}
+
+// IDToken - действующий ID-токен пользователя subject для клиента провайдера
+func (i *Issuer) IDToken(subject string) (string, error) {
+	return i.Sign(i.claims(subject, ""))
+}
+
+func (i *Issuer) claims(subject, nonce string) jwt.MapClaims {
+	now := time.Now()
+
+	claims := jwt.MapClaims{
+		"iss": i.URL,
+		"aud": i.ClientID,
+		"sub": subject,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	return claims
+}
+
+func (i *Issuer) discovery(res http.ResponseWriter, req *http.Request) {
+	writeJSON(res, http.StatusOK, map[string]any{
+		"issuer":                                i.URL,
+		"authorization_endpoint":                i.URL + "/authorize",
+		"token_endpoint":                        i.URL + "/token",
+		"jwks_uri":                              i.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (i *Issuer) jwks(res http.ResponseWriter, req *http.Request) {
+	pub := i.key.PublicKey
+
+	writeJSON(res, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": keyID,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize сразу одобряет вход и возвращает клиента на redirect_uri с кодом
+func (i *Issuer) authorize(res http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+
+	switch {
+	case q.Get("response_type") != "code":
+		http.Error(res, "unsupported response_type", http.StatusBadRequest)
+		return
+	case q.Get("client_id") != i.ClientID:
+		http.Error(res, "unknown client_id", http.StatusBadRequest)
+		return
+	case !strings.Contains(" "+q.Get("scope")+" ", " openid "):
+		http.Error(res, "openid scope is required", http.StatusBadRequest)
+		return
+	case q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "":
+		http.Error(res, "pkce S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirectURI.Host == "" {
+		http.Error(res, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+
+	i.mu.Lock()
+	i.codes[code] = grant{redirectURI: q.Get("redirect_uri"), challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), subject: i.subject}
+	i.mu.Unlock()
+
+	back := redirectURI.Query()
+	back.Set("code", code)
+	back.Set("state", q.Get("state"))
+	redirectURI.RawQuery = back.Encode()
+
+	http.Redirect(res, req, redirectURI.String(), http.StatusFound)
+}
+
+// token обменивает код на токены, код одноразовый и принимается только с code_verifier от его code_challenge
+func (i *Issuer) token(res http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil || req.Method != http.MethodPost {
+		tokenError(res, "invalid_request")
+		return
+	}
+
+	clientID, _, ok := req.BasicAuth()
+	if !ok {
+		clientID = req.PostForm.Get("client_id")
+	}
+	if clientID != i.ClientID {
+		tokenError(res, "invalid_client")
+		return
+	}
+
+	if req.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(res, "unsupported_grant_type")
+		return
+	}
+
+	i.mu.Lock()
+	g, ok := i.codes[req.PostForm.Get("code")]
+	delete(i.codes, req.PostForm.Get("code"))
+	i.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(req.PostForm.Get("code_verifier")))
+
+	if !ok || g.redirectURI != req.PostForm.Get("redirect_uri") || base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		tokenError(res, "invalid_grant")
+		return
+	}
+
+	idToken, err := i.Sign(i.claims(g.subject, g.nonce))
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(res, http.StatusOK, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func tokenError(res http.ResponseWriter, code string) {
+	writeJSON(res, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(res http.ResponseWriter, status int, v any) {
+	res.Header().Set("content-type", "application/json")
+	res.WriteHeader(status)
+	json.NewEncoder(res).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
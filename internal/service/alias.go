@@ -0,0 +1,45 @@
+package service
+
+import (
+	"fmt"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"regexp"
+	"strings"
+)
+
+const (
+	aliasMinLen = 3
+	aliasMaxLen = 64
+)
+
+// допустимый алфавит для пользовательских коротких ссылок
+var aliasRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// зарезервированные слова, которые пересекаются с маршрутами сервиса
+var reservedAliases = map[string]struct{}{
+	"api":  {},
+	"ping": {},
+}
+
+// ValidateAlias проверяет, что пользовательская короткая ссылка может быть использована как код
+func ValidateAlias(alias string) error {
+	if len(alias) < aliasMinLen || len(alias) > aliasMaxLen {
+		return fmt.Errorf("%w: length must be from %d to %d characters", errs.ErrAliasNotValid, aliasMinLen, aliasMaxLen)
+	}
+
+	if !aliasRegexp.MatchString(alias) {
+		return fmt.Errorf("%w: only latin letters, digits, '-' and '_' are allowed", errs.ErrAliasNotValid)
+	}
+
+	if _, ok := reservedAliases[strings.ToLower(alias)]; ok {
+		return fmt.Errorf("%w: %q is reserved", errs.ErrAliasNotValid, alias)
+	}
+
+	return nil
+}
+
+// isReserved - сгенерированный код тоже не должен совпадать с маршрутами сервиса
+func isReserved(code string) bool {
+	_, ok := reservedAliases[strings.ToLower(code)]
+	return ok
+}
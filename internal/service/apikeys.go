@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/google/uuid"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	apiKeyNameMaxLen = 64
+	apiKeySecretLen  = 32 //случайных байт в ключе
+	apiKeyPrefixLen  = 12 //символов ключа, которые показываются в списке
+)
+
+// права, которые можно выдать ключу
+var apiKeyScopes = []models.Scope{models.ScopeRead, models.ScopeWrite, models.ScopeDelete}
+
+// HashAPIKey - хеш, под которым ключ хранится. В ключе достаточно случайных байт, поэтому медленный хеш не нужен
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey выпускает ключ пользователя, сам ключ возвращается только здесь
+func (s *Service) CreateAPIKey(ctx context.Context, userID uuid.UUID, r models.APIKeyRequest) (models.APIKeyResponse, error) {
+	name := strings.TrimSpace(r.Name)
+	if name == "" || len(name) > apiKeyNameMaxLen {
+		return models.APIKeyResponse{}, fmt.Errorf("%w: name length must be from 1 to %d characters", errs.ErrAPIKeyNotValid, apiKeyNameMaxLen)
+	}
+
+	if len(r.Scopes) == 0 {
+		return models.APIKeyResponse{}, fmt.Errorf("%w: at least one scope is required", errs.ErrAPIKeyNotValid)
+	}
+
+	for _, scope := range r.Scopes {
+		if !slices.Contains(apiKeyScopes, scope) {
+			return models.APIKeyResponse{}, fmt.Errorf("%w: unknown scope %q, expected read, write or delete", errs.ErrAPIKeyNotValid, scope)
+		}
+	}
+
+	//права храним в постоянном порядке без повторов
+	var scopes []models.Scope
+	for _, scope := range apiKeyScopes {
+		if slices.Contains(r.Scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	secret := make([]byte, apiKeySecretLen)
+	if _, err := rand.Read(secret); err != nil {
+		return models.APIKeyResponse{}, err
+	}
+	key := models.APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	item := models.APIKey{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    key[:apiKeyPrefixLen],
+		Hash:      HashAPIKey(key),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err := s.storage.SaveAPIKey(ctx, item); err != nil {
+		return models.APIKeyResponse{}, err
+	}
+	return models.APIKeyResponse{APIKey: item, Key: key}, nil
+}
+
+// ListAPIKeys - ключи пользователя, включая отозванные
+func (s *Service) ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]models.APIKey, error) {
+	return s.storage.ListAPIKeys(ctx, userID)
+}
+
+// RevokeAPIKey отзывает ключ, чужой ключ неотличим от несуществующего
+func (s *Service) RevokeAPIKey(ctx context.Context, userID, keyID uuid.UUID) error {
+	return s.storage.RevokeAPIKey(ctx, userID, keyID, time.Now().UTC())
+}
+
+// AuthenticateAPIKey - владелец и права действующего ключа
+func (s *Service) AuthenticateAPIKey(ctx context.Context, key string) (uuid.UUID, []models.Scope, error) {
+	if !strings.HasPrefix(key, models.APIKeyPrefix) {
+		return uuid.Nil, nil, errs.ErrAPIKeyNotFound
+	}
+
+	item, err := s.storage.GetAPIKey(ctx, HashAPIKey(key))
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+
+	if item.RevokedAt != nil {
+		return uuid.Nil, nil, errs.ErrAPIKeyNotFound
+	}
+	return item.UserID, item.Scopes, nil
+}
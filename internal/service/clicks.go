@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+// длина случайного ключа хеширования IP-адресов в байтах
+const clickSecretSize = 32
+
+// RegisterClick ставит событие перехода в очередь на запись, не блокируя редирект
+func (s *Service) RegisterClick(click models.Click, clientIP string) {
+	if clientIP != "" {
+		click.IPHash = s.hashIP(clientIP)
+	}
+
+	//после остановки сервиса события не принимаем: канал не закрывается, чтобы запись в него не паниковала,
+	//а фоновый процесс его больше не читает
+	select {
+	case <-s.done:
+		logger.Sugar.Infow("Service is stopped, click dropped.", "shortURL", click.ShortURL)
+		return
+	default:
+	}
+
+	select {
+	case s.clicksCh <- click:
+	default:
+		//очередь переполнена - теряем событие, но не задерживаем ответ пользователю
+		logger.Sugar.Infow("Clicks queue is full, click dropped.", "shortURL", click.ShortURL)
+	}
+}
+
+// hashIP - IP-адрес клиента храним только в виде HMAC с секретным ключом: адресов IPv4 мало,
+// и простой хеш, даже с известной солью, обращается перебором
+func (s *Service) hashIP(ip string) string {
+	mac := hmac.New(sha256.New, s.clickSecret)
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// LoadClickSecret читает ключ хеширования IP-адресов из файла, при первом запуске создает файл со случайным ключом,
+// чтобы хеши посетителей оставались сравнимыми между перезапусками
+func LoadClickSecret(filename string) (string, error) {
+	data, err := os.ReadFile(filename)
+	if err == nil {
+		secret := strings.TrimSpace(string(data))
+		if secret == "" {
+			return "", fmt.Errorf("click secret file %s is empty", filename)
+		}
+		return secret, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	key := make([]byte, clickSecretSize)
+	if _, err = rand.Read(key); err != nil {
+		return "", err
+	}
+	secret := hex.EncodeToString(key)
+
+	//файл мог одновременно создать другой экземпляр сервиса, тогда берем его ключ
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, fs.ErrExist) {
+		return LoadClickSecret(filename)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = file.WriteString(secret + "\n"); err == nil {
+		err = file.Sync()
+	}
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return "", err
+	}
+
+	logger.Sugar.Infow("Click secret generated.", "filename", filename)
+	return secret, nil
+}
+
+// ClickRun копит события переходов в буфере и записывает их пачками по размеру буфера или по таймеру
+func (s *Service) ClickRun(ctx context.Context) {
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		defer logger.Sugar.Infow("Stop clicks saving.")
+		buffer := make([]models.Click, 0, s.clickBatchSize)
+
+		flush := func(ctx context.Context) {
+			if len(buffer) == 0 {
+				return
+			}
+			if err := s.storage.SaveClicks(ctx, buffer); err != nil {
+				logger.Sugar.Infow("Save clicks error.", "err", err.Error(), "count", len(buffer))
+
+				//не даем буферу расти бесконечно, пока хранилище недоступно
+				if len(buffer) >= cap(s.clicksCh) {
+					logger.Sugar.Infow("Clicks buffer overflow, clicks dropped.", "count", len(buffer))
+					buffer = buffer[:0]
+				}
+				return
+			}
+			buffer = buffer[:0]
+		}
+
+		//запись остатков из буфера, контекст к этому моменту уже может быть отменен
+		defer func() {
+			flush(context.WithoutCancel(ctx))
+		}()
+
+		ticker := time.NewTicker(s.clickInterval)
+		defer ticker.Stop()
+
+		logger.Sugar.Infow("Start clicks saving.")
+
+		for {
+			select {
+			case <-ticker.C:
+				flush(ctx)
+			case <-s.done:
+				//забираем из очереди события, поставленные до остановки, остаток запишет отложенный flush
+				for {
+					select {
+					case click := <-s.clicksCh:
+						buffer = append(buffer, click)
+					default:
+						return
+					}
+				}
+			case click := <-s.clicksCh:
+				buffer = append(buffer, click)
+
+				if len(buffer) < s.clickBatchSize {
+					continue
+				}
+				flush(ctx)
+			}
+		}
+	}()
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"time"
+)
+
+// ExpiresAt вычисляет абсолютный момент истечения ссылки по переданным в запросе expires_at или ttl_seconds
+func ExpiresAt(expiresAt *time.Time, ttlSeconds int64) (*time.Time, error) {
+	if expiresAt != nil && ttlSeconds != 0 {
+		return nil, fmt.Errorf("%w: only one of expires_at and ttl_seconds can be set", errs.ErrExpiresNotValid)
+	}
+
+	if ttlSeconds < 0 {
+		return nil, fmt.Errorf("%w: ttl_seconds must be positive", errs.ErrExpiresNotValid)
+	}
+
+	if ttlSeconds > 0 {
+		result := time.Now().Add(time.Duration(ttlSeconds) * time.Second).UTC()
+		return &result, nil
+	}
+
+	if expiresAt != nil {
+		if !expiresAt.After(time.Now()) {
+			return nil, fmt.Errorf("%w: expires_at must be in the future", errs.ErrExpiresNotValid)
+		}
+		result := expiresAt.UTC()
+		return &result, nil
+	}
+
+	return nil, nil
+}
+
+// ExpireRun периодически помечает удаленными ссылки, срок жизни которых истек
+func (s *Service) ExpireRun(ctx context.Context) {
+	go func() {
+		defer logger.Sugar.Infow("Stop expired urls sweeper.")
+
+		ticker := time.NewTicker(s.expireInterval)
+		defer ticker.Stop()
+
+		logger.Sugar.Infow("Start expired urls sweeper.", "interval", s.expireInterval)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				count, err := s.storage.DeleteExpired(ctx, time.Now())
+				if err != nil {
+					logger.Sugar.Infow("Delete expired urls error.", "err", err.Error())
+					continue
+				}
+				if count > 0 {
+					logger.Sugar.Infow("Expired urls deleted.", "count", count)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"github.com/dubrovsky1/url-shortener/internal/generator"
+	"time"
+)
+
+// Option - необязательная настройка сервиса, передается в New
+type Option func(*Service)
+
+// WithExpireInterval задает интервал, с которым фоновый процесс помечает удаленными ссылки с истекшим сроком жизни
+func WithExpireInterval(interval time.Duration) Option {
+	return func(s *Service) {
+		s.expireInterval = interval
+	}
+}
+
+// WithClicks задает размер пачки и интервал записи событий переходов
+func WithClicks(batchSize int, interval time.Duration) Option {
+	return func(s *Service) {
+		s.clickBatchSize = batchSize
+		s.clickInterval = interval
+	}
+}
+
+// WithClickSalt задает секретный ключ, с которым хешируются IP-адреса клиентов, пустой ключ не меняет случайный ключ процесса
+func WithClickSalt(salt string) Option {
+	return func(s *Service) {
+		if salt != "" {
+			s.clickSecret = []byte(salt)
+		}
+	}
+}
+
+// WithGenerator задает стратегию генерации коротких ссылок
+func WithGenerator(g generator.Generator) Option {
+	return func(s *Service) {
+		s.generator = g
+	}
+}
+
+// WithDeleteRetry задает число попыток удаления и границы экспоненциальной задержки между ними
+func WithDeleteRetry(maxAttempts int, baseDelay, maxDelay time.Duration) Option {
+	return func(s *Service) {
+		s.deleteMaxAttempts = maxAttempts
+		s.deleteBaseDelay = baseDelay
+		s.deleteMaxDelay = maxDelay
+	}
+}
+
+// WithDeleteJobRetention задает, сколько хранится состояние завершенных заданий на удаление
+func WithDeleteJobRetention(retention time.Duration) Option {
+	return func(s *Service) {
+		s.deleteJobRetention = retention
+	}
+}
+
+// WithPasswordCost задает стоимость bcrypt для новых паролей, в тестах - bcrypt.MinCost
+func WithPasswordCost(cost int) Option {
+	return func(s *Service) {
+		s.passwordCost = cost
+	}
+}
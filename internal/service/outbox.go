@@ -0,0 +1,304 @@
+package service
+
+import (
+	"context"
+	"errors"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/google/uuid"
+	"time"
+)
+
+// DeleteURL сохраняет ссылки в очередь на удаление под новым заданием, ответ пользователю отдается только после записи.
+// Задание без ссылок не сохранилось бы, и его нельзя было бы отследить, поэтому пустой список - ошибка запроса
+func (s *Service) DeleteURL(ctx context.Context, deletedItems []models.DeletedURLS) (uuid.UUID, error) {
+	if len(deletedItems) == 0 {
+		return uuid.Nil, errs.ErrDeleteURLsEmpty
+	}
+
+	jobID := uuid.New()
+
+	if err := s.storage.EnqueueDeletes(ctx, jobID, deletedItems); err != nil {
+		logger.Sugar.Infow("Enqueue deletes error.", "err", err.Error())
+		return uuid.Nil, err
+	}
+
+	//будим обработчик, не дожидаясь следующего тика
+	select {
+	case s.deleteWakeCh <- struct{}{}:
+	default:
+	}
+	return jobID, nil
+}
+
+// GetDeleteJob собирает состояние задания на удаление по его записям в очереди, чужие задания не видны
+func (s *Service) GetDeleteJob(ctx context.Context, userID, jobID uuid.UUID) (models.DeleteJob, error) {
+	items, err := s.storage.GetDeleteJob(ctx, jobID)
+	if err != nil {
+		return models.DeleteJob{}, err
+	}
+
+	if len(items) == 0 || items[0].UserID != userID {
+		return models.DeleteJob{}, errs.ErrDeleteJobNotFound
+	}
+
+	job := models.DeleteJob{
+		JobID:     jobID,
+		Status:    models.DeleteJobDone,
+		CreatedAt: items[0].CreatedAt,
+		UpdatedAt: items[0].UpdatedAt,
+		Results:   make([]models.DeleteJobResult, len(items)),
+	}
+
+	pending, failed := false, false
+
+	for i, item := range items {
+		result := models.DeleteJobResult{ShortURL: item.ShortURL, Result: item.Result}
+
+		switch item.Status {
+		case models.OutboxPending:
+			pending = true
+			result.Result = models.DeleteResultPending
+			result.Error = item.LastError
+		case models.OutboxDead:
+			failed = true
+			result.Result = models.DeleteResultFailed
+			result.Error = item.LastError
+		}
+		job.Results[i] = result
+
+		if item.CreatedAt.Before(job.CreatedAt) {
+			job.CreatedAt = item.CreatedAt
+		}
+		if item.UpdatedAt.After(job.UpdatedAt) {
+			job.UpdatedAt = item.UpdatedAt
+		}
+	}
+
+	//задание завершено, когда не осталось ожидающих записей
+	switch {
+	case pending:
+		job.Status = models.DeleteJobPending
+	case failed:
+		job.Status = models.DeleteJobFailed
+	}
+
+	if !pending {
+		finishedAt := job.UpdatedAt
+		job.FinishedAt = &finishedAt
+	}
+	return job, nil
+}
+
+// ListDeadDeletes - записи пользователя, удалить которые не удалось за отведенное число попыток
+func (s *Service) ListDeadDeletes(ctx context.Context, userID uuid.UUID) ([]models.OutboxItem, error) {
+	return s.storage.ListDeadDeletes(ctx, userID)
+}
+
+// DeleteRun обрабатывает очередь на удаление: при старте, по таймеру и по сигналу о новых записях
+func (s *Service) DeleteRun(ctx context.Context) {
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		defer logger.Sugar.Infow("Stop urls deletion.")
+
+		ticker := time.NewTicker(s.deleteInterval)
+		defer ticker.Stop()
+
+		logger.Sugar.Infow("Start urls deletion.")
+
+		for {
+			//разбираем все готовые к обработке записи, в том числе оставшиеся с прошлого запуска
+			for {
+				n := s.processDeletes(ctx)
+				if n == 0 || n < s.deleteBatchSize || ctx.Err() != nil {
+					break
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.done:
+				return
+			case <-ticker.C:
+				s.purgeDeletes(ctx)
+			case <-s.deleteWakeCh:
+			}
+		}
+	}()
+}
+
+// processDeletes обрабатывает одну пачку очереди и возвращает ее размер
+func (s *Service) processDeletes(ctx context.Context) int {
+	now := time.Now()
+
+	items, err := s.storage.FetchDeletes(ctx, now, s.deleteBatchSize)
+	if err != nil {
+		logger.Sugar.Infow("Fetch deletes error.", "err", err.Error())
+		return 0
+	}
+	if len(items) == 0 {
+		return 0
+	}
+
+	buffer := make([]models.DeletedURLS, len(items))
+	for i, item := range items {
+		buffer[i] = models.DeletedURLS{UserID: item.UserID, ShortURL: item.ShortURL}
+	}
+
+	results, err := s.deleteBuffer(ctx, buffer)
+	if err != nil {
+		logger.Sugar.Infow("Delete urls batch error.", "err", err.Error(), "count", len(items))
+
+		//откладываем пачку с растущей задержкой, исчерпавшие попытки записи уходят в dead
+		for i := range items {
+			items[i].Attempts++
+			items[i].LastError = err.Error()
+			items[i].NextAttemptAt = now.Add(s.deleteBackoff(items[i].Attempts))
+			items[i].UpdatedAt = now
+
+			if items[i].Attempts >= s.deleteMaxAttempts {
+				items[i].Status = models.OutboxDead
+				logger.Sugar.Infow("Delete moved to dead letter.", "id", items[i].ID, "shortURL", items[i].ShortURL)
+			}
+		}
+
+		if err = s.storage.UpdateDeletes(ctx, items); err != nil {
+			logger.Sugar.Infow("Update deletes error.", "err", err.Error())
+		}
+		return 0
+	}
+
+	for i := range items {
+		items[i].Status = models.OutboxDone
+		items[i].Result = results[i]
+		items[i].LastError = ""
+		items[i].UpdatedAt = now
+	}
+
+	if err = s.storage.UpdateDeletes(ctx, items); err != nil {
+		//ссылки уже удалены, повторная обработка записей безопасна
+		logger.Sugar.Infow("Update deletes error.", "err", err.Error())
+		return 0
+	}
+	return len(items)
+}
+
+// purgeDeletes убирает из очереди записи завершенных заданий старше срока хранения
+func (s *Service) purgeDeletes(ctx context.Context) {
+	count, err := s.storage.PurgeDeletes(ctx, time.Now().Add(-s.deleteJobRetention))
+	if err != nil {
+		logger.Sugar.Infow("Purge deletes error.", "err", err.Error())
+		return
+	}
+	if count > 0 {
+		logger.Sugar.Infow("Finished deletes purged.", "count", count)
+	}
+}
+
+// deleteBackoff - экспоненциальная задержка перед очередной попыткой
+func (s *Service) deleteBackoff(attempts int) time.Duration {
+	delay := s.deleteBaseDelay
+	for i := 1; i < attempts && delay < s.deleteMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, s.deleteMaxDelay)
+}
+
+// deleteBuffer удаляет накопленные ссылки, логирует, сколько из запрошенных каждым пользователем удалено на самом деле,
+// и возвращает результат по каждой ссылке буфера. Очередь хранит только пользователя и код: ссылки команд, которые
+// не удалились как личные, удаляются вторым проходом от имени команды, если пользователь в ней редактор или владелец
+func (s *Service) deleteBuffer(ctx context.Context, buffer []models.DeletedURLS) ([]string, error) {
+	deleted, err := s.storage.DeleteURL(ctx, buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	affected := make(map[models.DeletedURLS]bool, len(deleted))
+	for _, item := range deleted {
+		affected[item] = true
+	}
+
+	results := make([]string, len(buffer))
+	requested := make(map[uuid.UUID]int)
+	deletedByUser := make(map[uuid.UUID]int)
+
+	//права пользователей в командах в пределах одного буфера
+	type membership struct{ teamID, userID uuid.UUID }
+	allowed := make(map[membership]bool)
+
+	var teamItems []models.DeletedURLS
+	var teamIndexes []int
+
+	for i, item := range buffer {
+		requested[item.UserID]++
+
+		if affected[item] {
+			deletedByUser[item.UserID]++
+			results[i] = models.DeleteResultDeleted
+			continue
+		}
+
+		//ссылка не затронута: ее нет, она чужая, командная или уже была удалена
+		link, errGet := s.storage.GetURL(ctx, item.ShortURL)
+		switch {
+		case errors.Is(errGet, errs.ErrShortURLNotFound):
+			results[i] = models.DeleteResultNotFound
+			continue
+		case errGet != nil:
+			return nil, errGet
+		case link.TeamID == uuid.Nil && link.UserID != item.UserID:
+			results[i] = models.DeleteResultNotOwned
+			continue
+		case link.TeamID == uuid.Nil:
+			results[i] = models.DeleteResultDeleted
+			continue
+		}
+
+		key := membership{teamID: link.TeamID, userID: item.UserID}
+		ok, cached := allowed[key]
+		if !cached {
+			if ok, err = s.canAccess(ctx, link, item.UserID, models.RoleEditor); err != nil {
+				return nil, err
+			}
+			allowed[key] = ok
+		}
+
+		switch {
+		case !ok:
+			results[i] = models.DeleteResultNotOwned
+		case link.IsDel:
+			results[i] = models.DeleteResultDeleted
+		default:
+			teamItems = append(teamItems, models.DeletedURLS{UserID: item.UserID, ShortURL: item.ShortURL, TeamID: link.TeamID})
+			teamIndexes = append(teamIndexes, i)
+		}
+	}
+
+	if len(teamItems) > 0 {
+		deleted, err = s.storage.DeleteURL(ctx, teamItems)
+		if err != nil {
+			return nil, err
+		}
+
+		affected = make(map[models.DeletedURLS]bool, len(deleted))
+		for _, item := range deleted {
+			affected[item] = true
+		}
+
+		//не затронутую вторым проходом ссылку уже удалил другой участник команды
+		for j, item := range teamItems {
+			if affected[item] {
+				deletedByUser[item.UserID]++
+			}
+			results[teamIndexes[j]] = models.DeleteResultDeleted
+		}
+	}
+
+	for userID, count := range requested {
+		logger.Sugar.Infow("Urls deleted.", "userID", userID, "requested", count, "deleted", deletedByUser[userID])
+	}
+	return results, nil
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"fmt"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultRedirectType - код ответа при переходе, если тип не задан при сокращении
+const DefaultRedirectType = http.StatusTemporaryRedirect
+
+// допустимые коды ответа при переходе по короткой ссылке
+var redirectTypes = map[int]struct{}{
+	http.StatusMovedPermanently:  {},
+	http.StatusFound:             {},
+	http.StatusTemporaryRedirect: {},
+	http.StatusPermanentRedirect: {},
+}
+
+// RedirectType проверяет тип перенаправления из запроса, незаданный тип заменяется типом по умолчанию
+func RedirectType(redirectType int) (int, error) {
+	if redirectType == 0 {
+		return DefaultRedirectType, nil
+	}
+
+	if _, ok := redirectTypes[redirectType]; !ok {
+		return 0, fmt.Errorf("%w: redirect_type must be one of 301, 302, 307, 308", errs.ErrRedirectTypeNotValid)
+	}
+	return redirectType, nil
+}
+
+// RedirectLocation - адрес перехода. Если у ссылки включена передача параметров, параметры запроса перехода
+// добавляются к параметрам оригинального URL, одноименные заменяются, порядок и кодирование остальных сохраняются.
+// Фрагмент до сервера обычно не доходит: браузер сам переносит его в Location без своего фрагмента
+func RedirectLocation(item models.ShortenURL, incoming *url.URL) string {
+	if !item.ForwardQuery || (incoming.RawQuery == "" && incoming.Fragment == "") {
+		return string(item.OriginalURL)
+	}
+
+	location, err := url.Parse(string(item.OriginalURL))
+	if err != nil {
+		return string(item.OriginalURL)
+	}
+
+	location.RawQuery = mergeQuery(location.RawQuery, incoming.RawQuery)
+
+	if incoming.Fragment != "" {
+		location.Fragment = incoming.Fragment
+		location.RawFragment = incoming.RawFragment
+	}
+	return location.String()
+}
+
+// mergeQuery дописывает к строке параметров base параметры extra, параметры base с теми же именами отбрасываются
+func mergeQuery(base, extra string) string {
+	if extra == "" {
+		return base
+	}
+	if base == "" {
+		return extra
+	}
+
+	names := make(map[string]struct{})
+	for _, pair := range strings.Split(extra, "&") {
+		names[queryName(pair)] = struct{}{}
+	}
+
+	var kept []string
+	for _, pair := range strings.Split(base, "&") {
+		if _, ok := names[queryName(pair)]; !ok && pair != "" {
+			kept = append(kept, pair)
+		}
+	}
+	return strings.Join(append(kept, extra), "&")
+}
+
+// queryName - раскодированное имя параметра из пары имя=значение
+func queryName(pair string) string {
+	name, _, _ := strings.Cut(pair, "=")
+	if unescaped, err := url.QueryUnescape(name); err == nil {
+		return unescaped
+	}
+	return name
+}
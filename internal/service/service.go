@@ -2,10 +2,15 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
 	"github.com/dubrovsky1/url-shortener/internal/generator"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
 	"github.com/dubrovsky1/url-shortener/internal/models"
 	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 	"sync"
 	"time"
 )
@@ -18,54 +23,206 @@ type Storager interface {
 	GetURL(context.Context, models.ShortURL) (models.ShortenURL, error)
 	InsertBatch(context.Context, []models.BatchRequest, models.Host, uuid.UUID) ([]models.BatchResponse, error)
 	ListByUserID(context.Context, models.Host, uuid.UUID) ([]models.ShortenURL, error)
-	DeleteURL(context.Context, []models.DeletedURLS) error
+	DeleteURL(context.Context, []models.DeletedURLS) ([]models.DeletedURLS, error)
+	DeleteExpired(context.Context, time.Time) (int64, error)
+	EnqueueDeletes(context.Context, uuid.UUID, []models.DeletedURLS) error
+	FetchDeletes(context.Context, time.Time, int) ([]models.OutboxItem, error)
+	UpdateDeletes(context.Context, []models.OutboxItem) error
+	GetDeleteJob(context.Context, uuid.UUID) ([]models.OutboxItem, error)
+	ListDeadDeletes(context.Context, uuid.UUID) ([]models.OutboxItem, error)
+	PurgeDeletes(context.Context, time.Time) (int64, error)
+	SaveClicks(context.Context, []models.Click) error
+	ListClicks(context.Context, models.ShortURL, time.Time, time.Time) ([]models.Click, error)
+	ClickStats(context.Context, models.ShortURL, models.StatsParams) (models.Stats, error)
+	SaveAPIKey(context.Context, models.APIKey) error
+	GetAPIKey(context.Context, string) (models.APIKey, error)
+	ListAPIKeys(context.Context, uuid.UUID) ([]models.APIKey, error)
+	RevokeAPIKey(context.Context, uuid.UUID, uuid.UUID, time.Time) error
+	CreateUser(context.Context, models.User) error
+	GetUserByLogin(context.Context, string) (models.User, error)
+	GetUserByID(context.Context, uuid.UUID) (models.User, error)
+	MergeUser(context.Context, uuid.UUID, uuid.UUID) (int64, error)
+	CreateTeam(context.Context, models.Team, models.TeamMember) error
+	ListTeams(context.Context, uuid.UUID) ([]models.Team, error)
+	SaveTeamMember(context.Context, models.TeamMember) error
+	GetTeamMember(context.Context, uuid.UUID, uuid.UUID) (models.TeamMember, error)
+	ListTeamMembers(context.Context, uuid.UUID) ([]models.TeamMember, error)
+	DeleteTeamMember(context.Context, uuid.UUID, uuid.UUID) error
+	ListByTeamID(context.Context, models.Host, uuid.UUID) ([]models.ShortenURL, error)
 }
 
+// количество попыток сохранить ссылку со сгенерированным кодом при коллизиях
+const maxSaveAttempts = 10
+
 type Service struct {
-	storage         Storager
-	wg              *sync.WaitGroup
-	urlsToDeleteCh  chan models.DeletedURLS //канал, куда складываем приходящие из запросов пользователей урлы, которые необходимо удалить
-	deleteInterval  time.Duration           //интервал, по достижении которого происходит удаление
-	deleteBatchSize int                     //либо - размер пачки, после заполнения которой, происходит обращение в базу с удалением
-	isRun           bool
+	storage            Storager
+	generator          generator.Generator
+	workers            *sync.WaitGroup   //фоновые процессы, которые дописывают остатки буферов при закрытии каналов
+	done               chan struct{}     //закрывается при остановке сервиса
+	deleteWakeCh       chan struct{}     //сигнал обработчику очереди на удаление о новых записях
+	deleteInterval     time.Duration     //интервал, с которым проверяется очередь на удаление
+	deleteBatchSize    int               //размер пачки, которая за раз забирается из очереди на удаление
+	deleteMaxAttempts  int               //число попыток удаления, после которого запись уходит в dead
+	deleteBaseDelay    time.Duration     //задержка перед первой повторной попыткой, дальше удваивается
+	deleteMaxDelay     time.Duration     //предел задержки между попытками
+	deleteJobRetention time.Duration     //сколько хранятся записи завершенных заданий на удаление
+	expireInterval     time.Duration     //интервал, с которым ссылки с истекшим сроком жизни помечаются удаленными
+	clicksCh           chan models.Click //буферизированный канал событий переходов по коротким ссылкам
+	clickBatchSize     int               //размер пачки событий переходов для записи в хранилище
+	clickInterval      time.Duration     //интервал принудительной записи накопленных событий переходов
+	clickSecret        []byte            //ключ HMAC для IP-адресов
+	passwordCost       int               //стоимость bcrypt для новых паролей
+	dummyHash          func() []byte     //хеш для сравнения при неизвестном логине, чтобы время ответа не выдавало логины
+	isRun              bool
 }
 
-func New(storage Storager, batchSize int, deleteInterval time.Duration) *Service {
-	return &Service{
-		storage:         storage,
-		wg:              &sync.WaitGroup{},
-		urlsToDeleteCh:  make(chan models.DeletedURLS),
-		deleteBatchSize: batchSize,
-		deleteInterval:  deleteInterval,
-		isRun:           false,
+func New(storage Storager, batchSize int, deleteInterval time.Duration, opts ...Option) *Service {
+	s := &Service{
+		storage:            storage,
+		generator:          generator.NewRandom(generator.DefaultLength),
+		workers:            &sync.WaitGroup{},
+		done:               make(chan struct{}),
+		deleteWakeCh:       make(chan struct{}, 1),
+		deleteBatchSize:    batchSize,
+		deleteInterval:     deleteInterval,
+		deleteMaxAttempts:  10,
+		deleteBaseDelay:    time.Second,
+		deleteMaxDelay:     time.Minute * 10,
+		deleteJobRetention: time.Hour * 24,
+		expireInterval:     time.Minute,
+		clickBatchSize:     100,
+		clickInterval:      time.Second * 5,
+		passwordCost:       bcrypt.DefaultCost,
+		isRun:              false,
+	}
+
+	s.dummyHash = sync.OnceValue(func() []byte {
+		hash, _ := bcrypt.GenerateFromPassword([]byte("dummy password"), s.passwordCost)
+		return hash
+	})
+
+	//без заданного ключа IP-адреса хешируются случайным ключом процесса: хеши не сравнимы между перезапусками,
+	//но и не обращаются перебором. Ошибка источника случайности, как и в uuid.New, - паника
+	s.clickSecret = make([]byte, clickSecretSize)
+	if _, err := rand.Read(s.clickSecret); err != nil {
+		panic(err)
 	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	//очередь событий переходов с запасом, чтобы редиректы не ждали записи в хранилище
+	s.clicksCh = make(chan models.Click, s.clickBatchSize*10)
+	return s
 }
 
 func (s *Service) SaveURL(ctx context.Context, item models.ShortenURL) (models.ShortURL, error) {
-	//гененрируем короткую ссылку
-	item.ShortURL = models.ShortURL(generator.GetShortURL())
+	//ссылки команды создают ее редакторы и владельцы
+	if item.TeamID != uuid.Nil {
+		if _, err := s.authorize(ctx, item.TeamID, item.UserID, models.RoleEditor); err != nil {
+			return "", err
+		}
+	}
+
+	//если пользователь передал свой alias - проверяем его и сохраняем как есть, коллизия здесь - ошибка пользователя
+	if item.ShortURL != "" {
+		if err := ValidateAlias(string(item.ShortURL)); err != nil {
+			return "", err
+		}
 
+		//URL уже сокращен под другим кодом - alias не создан, об этом сообщаем явно, а не отдаем молча старый код
+		shortURL, err := s.save(ctx, item)
+		if errors.Is(err, errs.ErrUniqueIndex) && shortURL != item.ShortURL {
+			return shortURL, fmt.Errorf("%w: url is already shortened as %s", errs.ErrAliasNotApplied, shortURL)
+		}
+		return shortURL, err
+	}
+
+	//гененрируем короткую ссылку, пока не найдем свободную
+	for attempt := 0; attempt < maxSaveAttempts; attempt++ {
+		code, err := s.generator.Generate(ctx, string(item.OriginalURL), attempt)
+		if err != nil {
+			return "", err
+		}
+		if isReserved(code) {
+			continue
+		}
+		item.ShortURL = models.ShortURL(code)
+
+		shortURL, err := s.save(ctx, item)
+		if errors.Is(err, errs.ErrShortURLExists) {
+			logger.Sugar.Infow("Short url collision.", "shortURL", item.ShortURL, "attempt", attempt)
+			continue
+		}
+		return shortURL, err
+	}
+	return "", errs.ErrShortURLGenerate
+}
+
+// save сохраняет ссылку. Удаленные ссылки хранилище при проверке уникальности URL не учитывает, а истекшую,
+// но еще не помеченную обработчиком ссылку помечаем здесь, чтобы не отдавать клиенту мертвый код
+func (s *Service) save(ctx context.Context, item models.ShortenURL) (models.ShortURL, error) {
 	shortURL, err := s.storage.SaveURL(ctx, item)
-	if err != nil {
+	if !errors.Is(err, errs.ErrUniqueIndex) {
+		return shortURL, err
+	}
+
+	now := time.Now()
+	existing, errGet := s.storage.GetURL(ctx, shortURL)
+	if errGet != nil || existing.IsDel || !existing.IsExpired(now) {
 		return shortURL, err
 	}
-	return shortURL, nil
+
+	if _, err = s.storage.DeleteExpired(ctx, now); err != nil {
+		return "", err
+	}
+	return s.storage.SaveURL(ctx, item)
 }
 
+// GetURL - ссылка для перехода, удаленные и истекшие ссылки возвращаются ошибками
 func (s *Service) GetURL(ctx context.Context, shortURL models.ShortURL) (models.ShortenURL, error) {
 	result, err := s.storage.GetURL(ctx, shortURL)
 	if err != nil {
 		return result, err
 	}
+
+	if result.IsDel {
+		return result, errs.ErrShortURLDeleted
+	}
+
+	//ссылка могла истечь раньше, чем фоновый процесс пометил ее удаленной
+	if result.IsExpired(time.Now()) {
+		return result, errs.ErrShortURLExpired
+	}
 	return result, nil
 }
 
 func (s *Service) InsertBatch(ctx context.Context, batch []models.BatchRequest, host models.Host, userID uuid.UUID) ([]models.BatchResponse, error) {
-	result, err := s.storage.InsertBatch(ctx, batch, host, userID)
-	if err != nil {
+	//коды генерируем до обращения в хранилище, при коллизии повторяем пачку с новыми кодами
+	for attempt := 0; attempt < maxSaveAttempts; attempt++ {
+		reserved := false
+		for i := range batch {
+			code, err := s.generator.Generate(ctx, batch[i].URL, attempt)
+			if err != nil {
+				return nil, err
+			}
+			reserved = reserved || isReserved(code)
+			batch[i].ShortURL = models.ShortURL(code)
+		}
+
+		if reserved {
+			continue
+		}
+
+		result, err := s.storage.InsertBatch(ctx, batch, host, userID)
+		if errors.Is(err, errs.ErrShortURLExists) {
+			logger.Sugar.Infow("Short url collision in batch.", "attempt", attempt)
+			continue
+		}
 		return result, err
 	}
-	return result, nil
+	return nil, errs.ErrShortURLGenerate
 }
 
 func (s *Service) ListByUserID(ctx context.Context, host models.Host, userID uuid.UUID) ([]models.ShortenURL, error) {
@@ -76,83 +233,20 @@ func (s *Service) ListByUserID(ctx context.Context, host models.Host, userID uui
 	return result, nil
 }
 
-func (s *Service) DeleteURL(ctx context.Context, deletedItems []models.DeletedURLS) error {
-	//logger.Sugar.Infow("DeleteURL log.", "deletedItems", deletedItems)
-	s.wg.Add(1)
-	go func() {
-		defer s.wg.Done()
-		for _, item := range deletedItems {
-			s.urlsToDeleteCh <- item //при каждом запросе пользователя создается горутина, которая записывает в канал то, что хотим удалить
-		}
-	}()
-	return nil
-}
-
-func (s *Service) DeleteRun(ctx context.Context) {
-	go func() {
-		defer logger.Sugar.Infow("Stop urls deletion.")
-		buffer := make([]models.DeletedURLS, 0, s.deleteBatchSize)
-
-		//удаление остатков из буфера
-		defer func() {
-			if len(buffer) > 0 {
-				logger.Sugar.Infow("Deleting remaining urls.", "count", len(buffer), "buffer", buffer)
-				if err := s.storage.DeleteURL(ctx, buffer); err != nil {
-					logger.Sugar.Infow("Delete urls error.", "err", err.Error())
-				}
-			}
-		}()
-
-		ticker := time.NewTicker(s.deleteInterval)
-		defer ticker.Stop()
-
-		logger.Sugar.Infow("Start urls deletion.")
-
-		for {
-			select {
-			//истекло время - идем в базу с удалением и очищаем буфер
-			case <-ticker.C:
-				if err := s.storage.DeleteURL(ctx, buffer); err != nil {
-					logger.Sugar.Infow("Delete urls after timeout error.", "err", err.Error(), "buffer", buffer)
-					continue
-				}
-				buffer = buffer[:0]
-			//читаем из канала и заполняем буфер пока он не заполнится либо канал не закроется
-			case deletedURL, closed := <-s.urlsToDeleteCh:
-				if !closed {
-					return
-				}
-				buffer = append(buffer, deletedURL)
-				//logger.Sugar.Infow("Buffer.", "values", buffer)
-
-				if len(buffer) < s.deleteBatchSize {
-					continue
-				}
-
-				//обращаемся в базу с удалением при наступлении необходимых условий
-				if err := s.storage.DeleteURL(ctx, buffer); err != nil {
-					logger.Sugar.Infow("Delete urls batch error.", "err", err.Error(), "buffer", buffer)
-					continue
-				}
-
-				//очищаем буфер
-				buffer = buffer[:0]
-			}
-		}
-	}()
-}
-
 func (s *Service) Run(ctx context.Context) error {
 	if s.isRun {
 		return nil
 	}
 	s.isRun = true
 	s.DeleteRun(ctx)
+	s.ExpireRun(ctx)
+	s.ClickRun(ctx)
 	return nil
 }
 
 func (s *Service) Close() error {
-	s.wg.Wait()
-	close(s.urlsToDeleteCh)
+	//канал событий переходов не закрываем: обработчики запросов могут писать в него и после остановки
+	close(s.done)
+	s.workers.Wait()
 	return nil
 }
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/dubrovsky1/url-shortener/internal/stats"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	statsDefaultPeriod = 30 * 24 * time.Hour //период статистики, если from не передан
+	statsMaxPoints     = 2000                //ограничение на количество точек временного ряда
+)
+
+// ParseStatsParams разбирает параметры запроса статистики: границы периода в RFC 3339 или YYYY-MM-DD и размер интервала.
+// Дата без времени в to включает весь этот день
+func ParseStatsParams(from, to, bucket string, now time.Time) (models.StatsParams, error) {
+	params := models.StatsParams{
+		From:   now.Add(-statsDefaultPeriod),
+		To:     now,
+		Bucket: stats.BucketDay,
+	}
+
+	var err error
+
+	if from != "" {
+		if params.From, err = parseStatsTime(from); err != nil {
+			return params, fmt.Errorf("%w: from: %s", errs.ErrStatsParamsNotValid, err.Error())
+		}
+	}
+
+	if to != "" {
+		if params.To, err = parseStatsTime(to); err != nil {
+			return params, fmt.Errorf("%w: to: %s", errs.ErrStatsParamsNotValid, err.Error())
+		}
+
+		//правая граница периода не входит в него, поэтому для даты берем начало следующего дня
+		if _, errDate := time.Parse(time.DateOnly, to); errDate == nil {
+			params.To = params.To.AddDate(0, 0, 1)
+		}
+	}
+
+	if bucket != "" {
+		params.Bucket = bucket
+	}
+
+	duration, ok := stats.Durations[params.Bucket]
+	if !ok {
+		return params, fmt.Errorf("%w: bucket must be one of hour, day, week", errs.ErrStatsParamsNotValid)
+	}
+
+	if !params.From.Before(params.To) {
+		return params, fmt.Errorf("%w: from must be before to", errs.ErrStatsParamsNotValid)
+	}
+
+	if params.To.Sub(params.From)/duration > statsMaxPoints {
+		return params, fmt.Errorf("%w: too many points, use a larger bucket or a shorter period", errs.ErrStatsParamsNotValid)
+	}
+
+	params.From = params.From.UTC()
+	params.To = params.To.UTC()
+	return params, nil
+}
+
+func parseStatsTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+// Stats возвращает статистику переходов по ссылке, доступную только ее владельцу или участникам ее команды.
+// Агрегирует события хранилище, чтобы не выгружать их все в сервис
+func (s *Service) Stats(ctx context.Context, userID uuid.UUID, shortURL models.ShortURL, params models.StatsParams) (models.Stats, error) {
+	link, err := s.storage.GetURL(ctx, shortURL)
+	if err != nil {
+		return models.Stats{}, err
+	}
+
+	allowed, err := s.canAccess(ctx, link, userID, models.RoleViewer)
+	if err != nil {
+		return models.Stats{}, err
+	}
+	//чужая ссылка неотличима от несуществующей, иначе по ответу можно перебирать занятые коды
+	if !allowed {
+		return models.Stats{}, errs.ErrShortURLNotFound
+	}
+
+	return s.storage.ClickStats(ctx, shortURL, params)
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+const teamNameMaxLen = 100
+
+// CreateTeam создает команду, создатель становится ее владельцем
+func (s *Service) CreateTeam(ctx context.Context, userID uuid.UUID, r models.TeamRequest) (models.Team, error) {
+	name := strings.TrimSpace(r.Name)
+	if name == "" || len(name) > teamNameMaxLen {
+		return models.Team{}, fmt.Errorf("%w: name length must be from 1 to %d characters", errs.ErrTeamNotValid, teamNameMaxLen)
+	}
+
+	now := time.Now().UTC()
+	team := models.Team{ID: uuid.New(), Name: name, CreatedAt: now}
+	owner := models.TeamMember{TeamID: team.ID, UserID: userID, Role: models.RoleOwner, CreatedAt: now}
+
+	if err := s.storage.CreateTeam(ctx, team, owner); err != nil {
+		return models.Team{}, err
+	}
+
+	team.Role = models.RoleOwner
+	return team, nil
+}
+
+// ListTeams - команды пользователя с его ролью в каждой
+func (s *Service) ListTeams(ctx context.Context, userID uuid.UUID) ([]models.Team, error) {
+	return s.storage.ListTeams(ctx, userID)
+}
+
+// authorize проверяет, что у пользователя в команде есть роль не ниже need.
+// Для посторонних команда не существует, участнику без нужной роли - ErrForbidden
+func (s *Service) authorize(ctx context.Context, teamID, userID uuid.UUID, need models.Role) (models.TeamMember, error) {
+	member, err := s.storage.GetTeamMember(ctx, teamID, userID)
+	if errors.Is(err, errs.ErrTeamMemberNotFound) {
+		return models.TeamMember{}, errs.ErrTeamNotFound
+	}
+	if err != nil {
+		return models.TeamMember{}, err
+	}
+
+	if !member.Role.Can(need) {
+		return models.TeamMember{}, fmt.Errorf("%w: %s role required", errs.ErrForbidden, need)
+	}
+	return member, nil
+}
+
+// ListTeamMembers - участники команды, видны любому ее участнику
+func (s *Service) ListTeamMembers(ctx context.Context, userID, teamID uuid.UUID) ([]models.TeamMember, error) {
+	if _, err := s.authorize(ctx, teamID, userID, models.RoleViewer); err != nil {
+		return nil, err
+	}
+	return s.storage.ListTeamMembers(ctx, teamID)
+}
+
+// SetTeamMember добавляет пользователя в команду или меняет его роль, доступно только владельцу.
+// Понизить последнего владельца нельзя
+func (s *Service) SetTeamMember(ctx context.Context, actorID, teamID, userID uuid.UUID, r models.TeamMemberRequest) (models.TeamMember, error) {
+	if !r.Role.Valid() {
+		return models.TeamMember{}, fmt.Errorf("%w: unknown role %q, expected owner, editor or viewer", errs.ErrTeamNotValid, r.Role)
+	}
+
+	if _, err := s.authorize(ctx, teamID, actorID, models.RoleOwner); err != nil {
+		return models.TeamMember{}, err
+	}
+
+	member, err := s.storage.GetTeamMember(ctx, teamID, userID)
+	switch {
+	case errors.Is(err, errs.ErrTeamMemberNotFound):
+		member = models.TeamMember{TeamID: teamID, UserID: userID, CreatedAt: time.Now().UTC()}
+	case err != nil:
+		return models.TeamMember{}, err
+	}
+
+	//последнего владельца хранилище проверяет вместе с записью, иначе два владельца, одновременно понижающие друг друга,
+	//оставили бы команду без владельца
+	member.Role = r.Role
+	if err = s.storage.SaveTeamMember(ctx, member); err != nil {
+		return models.TeamMember{}, err
+	}
+	return member, nil
+}
+
+// RemoveTeamMember исключает пользователя из команды: владелец исключает любого, остальные могут только выйти сами.
+// Последний владелец выйти не может, ссылки исключенного остаются у команды
+func (s *Service) RemoveTeamMember(ctx context.Context, actorID, teamID, userID uuid.UUID) error {
+	need := models.RoleOwner
+	if actorID == userID {
+		need = models.RoleViewer
+	}
+
+	if _, err := s.authorize(ctx, teamID, actorID, need); err != nil {
+		return err
+	}
+
+	//последнего владельца хранилище проверяет вместе с удалением
+	return s.storage.DeleteTeamMember(ctx, teamID, userID)
+}
+
+// ListByTeamID - ссылки команды, видны любому ее участнику
+func (s *Service) ListByTeamID(ctx context.Context, host models.Host, userID, teamID uuid.UUID) ([]models.ShortenURL, error) {
+	if _, err := s.authorize(ctx, teamID, userID, models.RoleViewer); err != nil {
+		return nil, err
+	}
+	return s.storage.ListByTeamID(ctx, host, teamID)
+}
+
+// canAccess - доступна ли ссылка пользователю с ролью не ниже need: личная - только владельцу, командная - участникам команды
+func (s *Service) canAccess(ctx context.Context, link models.ShortenURL, userID uuid.UUID, need models.Role) (bool, error) {
+	if link.TeamID == uuid.Nil {
+		return link.UserID == userID, nil
+	}
+
+	_, err := s.authorize(ctx, link.TeamID, userID, need)
+	if errors.Is(err, errs.ErrTeamNotFound) || errors.Is(err, errs.ErrForbidden) {
+		return false, nil
+	}
+	return err == nil, err
+}
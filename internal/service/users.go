@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/dubrovsky1/url-shortener/internal/oidc"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"time"
+)
+
+const (
+	loginMinLen    = 3
+	loginMaxLen    = 64
+	passwordMinLen = 8
+	passwordMaxLen = 72 //bcrypt не учитывает байты дальше 72-го
+)
+
+// NormalizeLogin - логин в том виде, в котором он хранится: без пробелов по краям и в нижнем регистре
+func NormalizeLogin(login string) string {
+	return strings.ToLower(strings.TrimSpace(login))
+}
+
+func validateCredentials(c models.Credentials) error {
+	if len(c.Login) < loginMinLen || len(c.Login) > loginMaxLen {
+		return fmt.Errorf("%w: login length must be from %d to %d characters", errs.ErrUserNotValid, loginMinLen, loginMaxLen)
+	}
+
+	for _, r := range c.Login {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || strings.ContainsRune("._-@+", r)) {
+			return fmt.Errorf("%w: login may contain only latin letters, digits and . _ - @ +", errs.ErrUserNotValid)
+		}
+	}
+
+	if len(c.Password) < passwordMinLen || len(c.Password) > passwordMaxLen {
+		return fmt.Errorf("%w: password length must be from %d to %d bytes", errs.ErrUserNotValid, passwordMinLen, passwordMaxLen)
+	}
+	return nil
+}
+
+// Register заводит учетную запись и переносит в нее ссылки, API-ключи, команды и задания на удаление анонимного пользователя anonymous.
+// Возвращает пользователя и число перенесенных ссылок
+func (s *Service) Register(ctx context.Context, anonymous uuid.UUID, c models.Credentials) (models.User, int64, error) {
+	c.Login = NormalizeLogin(c.Login)
+	if err := validateCredentials(c); err != nil {
+		return models.User{}, 0, err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(c.Password), s.passwordCost)
+	if err != nil {
+		return models.User{}, 0, err
+	}
+
+	user := models.User{
+		ID:           uuid.New(),
+		Login:        c.Login,
+		PasswordHash: string(hash),
+		CreatedAt:    time.Now().UTC(),
+	}
+
+	if err = s.storage.CreateUser(ctx, user); err != nil {
+		return models.User{}, 0, err
+	}
+
+	merged, err := s.adopt(ctx, anonymous, user)
+	return user, merged, err
+}
+
+// Login проверяет пароль и переносит в учетную запись ссылки, API-ключи, команды и задания на удаление анонимного пользователя anonymous.
+// Неизвестный логин и неверный пароль неразличимы ни по ответу, ни по времени ответа
+func (s *Service) Login(ctx context.Context, anonymous uuid.UUID, c models.Credentials) (models.User, int64, error) {
+	user, err := s.storage.GetUserByLogin(ctx, NormalizeLogin(c.Login))
+	if errors.Is(err, errs.ErrUserNotFound) {
+		bcrypt.CompareHashAndPassword(s.dummyHash(), []byte(c.Password))
+		return models.User{}, 0, errs.ErrCredentialsNotValid
+	}
+	if err != nil {
+		return models.User{}, 0, err
+	}
+
+	//у учетных записей провайдера OIDC пароля нет, по времени они неотличимы от неизвестного логина
+	if user.PasswordHash == "" {
+		bcrypt.CompareHashAndPassword(s.dummyHash(), []byte(c.Password))
+		return models.User{}, 0, errs.ErrCredentialsNotValid
+	}
+
+	if err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(c.Password)); err != nil {
+		return models.User{}, 0, errs.ErrCredentialsNotValid
+	}
+
+	merged, err := s.adopt(ctx, anonymous, user)
+	return user, merged, err
+}
+
+// LoginOIDC входит под пользователем провайдера OIDC, при первом входе заводит ему учетную запись без пароля.
+// Идентификатор учетной записи выводится из issuer и sub, поэтому не меняется между входами
+func (s *Service) LoginOIDC(ctx context.Context, anonymous uuid.UUID, identity oidc.Identity) (models.User, int64, error) {
+	user, err := s.storage.GetUserByID(ctx, identity.UserID())
+	if errors.Is(err, errs.ErrUserNotFound) {
+		user = models.User{
+			ID:        identity.UserID(),
+			Login:     identity.Login(),
+			CreatedAt: time.Now().UTC(),
+		}
+
+		err = s.storage.CreateUser(ctx, user)
+		//учетную запись мог только что завести параллельный вход того же пользователя
+		if errors.Is(err, errs.ErrUserExists) {
+			user, err = s.storage.GetUserByID(ctx, identity.UserID())
+		}
+	}
+	if err != nil {
+		return models.User{}, 0, err
+	}
+
+	merged, err := s.adopt(ctx, anonymous, user)
+	return user, merged, err
+}
+
+// adopt переносит данные анонимного пользователя в учетную запись. Чужая учетная запись в куке не переносится:
+// вход под другим логином просто меняет пользователя
+func (s *Service) adopt(ctx context.Context, anonymous uuid.UUID, user models.User) (int64, error) {
+	if anonymous == uuid.Nil || anonymous == user.ID {
+		return 0, nil
+	}
+
+	_, err := s.storage.GetUserByID(ctx, anonymous)
+	if err == nil {
+		return 0, nil
+	}
+	if !errors.Is(err, errs.ErrUserNotFound) {
+		return 0, err
+	}
+
+	merged, err := s.storage.MergeUser(ctx, anonymous, user.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	logger.Sugar.Infow("Anonymous user merged.", "from", anonymous, "to", user.ID, "urls", merged)
+	return merged, nil
+}
@@ -0,0 +1,191 @@
+// Package stats - агрегация событий переходов в статистику ссылки. Хранилища без собственной агрегации
+// считают статистику здесь, хранилище в базе повторяет эти правила запросом
+package stats
+
+import (
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	BucketHour = "hour"
+	BucketDay  = "day"
+	BucketWeek = "week"
+
+	TopReferrers = 10 //количество источников в топе
+)
+
+// Durations - длительность интервала временного ряда
+var Durations = map[string]time.Duration{
+	BucketHour: time.Hour,
+	BucketDay:  24 * time.Hour,
+	BucketWeek: 7 * 24 * time.Hour,
+}
+
+// New - статистика без переходов, временной ряд заполнен нулями, чтобы на графике не было пропусков
+func New(shortURL models.ShortURL, params models.StatsParams) models.Stats {
+	result := models.Stats{
+		ShortURL:     shortURL,
+		From:         params.From,
+		To:           params.To,
+		Bucket:       params.Bucket,
+		Series:       []models.StatsPoint{},
+		TopReferrers: []models.StatsCount{},
+		UserAgents:   []models.StatsCount{},
+	}
+
+	for t := BucketStart(params.From, params.Bucket); t.Before(params.To); t = nextBucket(t, params.Bucket) {
+		result.Series = append(result.Series, models.StatsPoint{Time: t})
+	}
+	return result
+}
+
+// Index - номер точки временного ряда, в которую попадает момент t, -1 - вне периода
+func Index(result models.Stats, t time.Time) int {
+	if len(result.Series) == 0 {
+		return -1
+	}
+
+	//в UTC интервалы имеют постоянную длину, поэтому номер считается делением
+	i := int(BucketStart(t, result.Bucket).Sub(result.Series[0].Time) / Durations[result.Bucket])
+	if i < 0 || i >= len(result.Series) {
+		return -1
+	}
+	return i
+}
+
+// Build агрегирует события переходов: итоги, временной ряд по интервалам, источники и семейства User-Agent
+func Build(shortURL models.ShortURL, params models.StatsParams, clicks []models.Click) models.Stats {
+	result := New(shortURL, params)
+
+	visitors := make(map[string]struct{})
+	bucketVisitors := make(map[int]map[string]struct{})
+	referrers := make(map[string]int)
+	userAgents := make(map[string]int)
+
+	for _, click := range clicks {
+		if click.ClickedAt.Before(params.From) || !click.ClickedAt.Before(params.To) {
+			continue
+		}
+
+		result.TotalClicks++
+		referrers[ReferrerName(click.Referrer)]++
+		userAgents[UserAgentFamily(click.UserAgent)]++
+
+		i := Index(result, click.ClickedAt)
+		if i < 0 {
+			continue
+		}
+		result.Series[i].Clicks++
+
+		if click.IPHash == "" {
+			continue
+		}
+
+		visitors[click.IPHash] = struct{}{}
+
+		if _, ok := bucketVisitors[i]; !ok {
+			bucketVisitors[i] = make(map[string]struct{})
+		}
+		if _, ok := bucketVisitors[i][click.IPHash]; !ok {
+			bucketVisitors[i][click.IPHash] = struct{}{}
+			result.Series[i].UniqueVisitors++
+		}
+	}
+
+	result.UniqueVisitors = len(visitors)
+	result.TopReferrers = TopCounts(referrers, TopReferrers)
+	result.UserAgents = TopCounts(userAgents, 0)
+
+	return result
+}
+
+// BucketStart - начало интервала, в который попадает момент t
+func BucketStart(t time.Time, bucket string) time.Time {
+	t = t.UTC()
+	switch bucket {
+	case BucketHour:
+		return t.Truncate(time.Hour)
+	case BucketWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		//неделя начинается с понедельника
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+func nextBucket(t time.Time, bucket string) time.Time {
+	switch bucket {
+	case BucketHour:
+		return t.Add(time.Hour)
+	case BucketWeek:
+		return t.AddDate(0, 0, 7)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+// TopCounts сортирует счетчики по убыванию, limit = 0 - без ограничения
+func TopCounts(counts map[string]int, limit int) []models.StatsCount {
+	result := make([]models.StatsCount, 0, len(counts))
+	for name, count := range counts {
+		result = append(result, models.StatsCount{Name: name, Count: count})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Name < result[j].Name
+	})
+
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// ReferrerName - источник перехода сводим к хосту, прямые переходы выделяем отдельно
+func ReferrerName(referrer string) string {
+	if referrer == "" {
+		return "(direct)"
+	}
+
+	u, err := url.Parse(referrer)
+	if err != nil || u.Host == "" {
+		return referrer
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+}
+
+// UserAgentFamily определяет семейство клиента по строке User-Agent, порядок проверок важен
+func UserAgentFamily(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+
+	switch {
+	case ua == "":
+		return "Unknown"
+	case strings.Contains(ua, "bot"), strings.Contains(ua, "spider"), strings.Contains(ua, "crawl"):
+		return "Bot"
+	case strings.Contains(ua, "edg/"):
+		return "Edge"
+	case strings.Contains(ua, "yabrowser/"):
+		return "Yandex Browser"
+	case strings.Contains(ua, "opr/"), strings.Contains(ua, "opera"):
+		return "Opera"
+	case strings.Contains(ua, "firefox/"), strings.Contains(ua, "fxios/"):
+		return "Firefox"
+	case strings.Contains(ua, "chrome/"), strings.Contains(ua, "crios/"):
+		return "Chrome"
+	case strings.Contains(ua, "safari/"):
+		return "Safari"
+	case strings.Contains(ua, "curl/"):
+		return "curl"
+	default:
+		return "Other"
+	}
+}
@@ -0,0 +1,131 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/google/uuid"
+	"go.etcd.io/bbolt"
+	"sort"
+	"time"
+)
+
+// apiKeyRecord - значение в бакете API-ключей
+type apiKeyRecord struct {
+	ID        uuid.UUID      `json:"id"`
+	UserID    uuid.UUID      `json:"user_id"`
+	Name      string         `json:"name"`
+	Prefix    string         `json:"prefix"`
+	Hash      string         `json:"hash"`
+	Scopes    []models.Scope `json:"scopes"`
+	CreatedAt time.Time      `json:"created_at"`
+	RevokedAt *time.Time     `json:"revoked_at,omitempty"`
+}
+
+func getAPIKey(tx *bbolt.Tx, hash []byte) (models.APIKey, error) {
+	data := tx.Bucket(apiKeysBucket).Get(hash)
+	if data == nil {
+		return models.APIKey{}, errs.ErrAPIKeyNotFound
+	}
+
+	var record apiKeyRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return models.APIKey{}, err
+	}
+	return models.APIKey(record), nil
+}
+
+func putAPIKey(tx *bbolt.Tx, key models.APIKey) error {
+	data, err := json.Marshal(apiKeyRecord(key))
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(apiKeysBucket).Put([]byte(key.Hash), data)
+}
+
+// SaveAPIKey сохраняет новый API-ключ
+func (s *Storage) SaveAPIKey(ctx context.Context, key models.APIKey) error {
+	err := s.DB.Update(func(tx *bbolt.Tx) error {
+		users := tx.Bucket(apiKeyUsers)
+
+		seq, err := users.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		if err = putAPIKey(tx, key); err != nil {
+			return err
+		}
+		return users.Put(userKey(key.UserID, seq), []byte(key.Hash))
+	})
+	return storageError(err)
+}
+
+// GetAPIKey - ключ по хешу, в том числе отозванный
+func (s *Storage) GetAPIKey(ctx context.Context, hash string) (models.APIKey, error) {
+	var result models.APIKey
+
+	err := s.DB.View(func(tx *bbolt.Tx) error {
+		var e error
+		result, e = getAPIKey(tx, []byte(hash))
+		return e
+	})
+	if err != nil {
+		return models.APIKey{}, storageError(err)
+	}
+	return result, nil
+}
+
+// ListAPIKeys - ключи пользователя в порядке создания
+func (s *Storage) ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]models.APIKey, error) {
+	var result []models.APIKey
+
+	err := s.DB.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(apiKeyUsers).Cursor()
+		prefix := userID[:]
+
+		for k, hash := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, hash = c.Next() {
+			key, err := getAPIKey(tx, hash)
+			if err != nil {
+				return err
+			}
+			result = append(result, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+
+	//ключи лежат в порядке сохранения, а время создания задает сервис
+	sort.SliceStable(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result, nil
+}
+
+// RevokeAPIKey отзывает ключ пользователя, повторный отзыв не меняет момент отзыва
+func (s *Storage) RevokeAPIKey(ctx context.Context, userID, keyID uuid.UUID, now time.Time) error {
+	err := s.DB.Update(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(apiKeyUsers).Cursor()
+		prefix := userID[:]
+
+		for k, hash := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, hash = c.Next() {
+			key, err := getAPIKey(tx, hash)
+			if err != nil {
+				return err
+			}
+			if key.ID != keyID {
+				continue
+			}
+
+			if key.RevokedAt != nil {
+				return nil
+			}
+			key.RevokedAt = &now
+			return putAPIKey(tx, key)
+		}
+		return errs.ErrAPIKeyNotFound
+	})
+	return storageError(err)
+}
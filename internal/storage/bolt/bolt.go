@@ -0,0 +1,482 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/google/uuid"
+	"go.etcd.io/bbolt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// бакеты базы
+var (
+	urlsBucket       = []byte("urls")          //код -> запись ссылки
+	originalsBucket  = []byte("originals")     //оригинальный URL -> код
+	usersBucket      = []byte("users")         //пользователь + порядковый номер ссылки -> код
+	clicksBucket     = []byte("clicks")        //код + время перехода + порядковый номер -> событие перехода
+	outboxBucket     = []byte("outbox")        //номер записи -> запись очереди на удаление
+	outboxJobsBucket = []byte("outbox_jobs")   //задание + номер записи -> пусто
+	counterBucket    = []byte("counter")       //последовательность NextID
+	apiKeysBucket    = []byte("api_keys")      //хеш API-ключа -> запись ключа
+	apiKeyUsers      = []byte("api_key_users") //пользователь + порядковый номер ключа -> хеш ключа
+	accountsBucket   = []byte("accounts")      //идентификатор зарегистрированного пользователя -> запись пользователя
+	loginsBucket     = []byte("logins")        //логин -> идентификатор пользователя
+	teamsBucket      = []byte("teams")         //идентификатор команды -> запись команды
+	teamMembers      = []byte("team_members")  //команда + пользователь -> запись участника
+	memberTeams      = []byte("member_teams")  //пользователь + команда -> пусто
+	teamURLsBucket   = []byte("team_urls")     //команда + порядковый номер ссылки -> код
+)
+
+// urlRecord - значение в бакете ссылок
+type urlRecord struct {
+	Seq          uint64             `json:"seq"`
+	ShortURL     models.ShortURL    `json:"short_url"`
+	OriginalURL  models.OriginalURL `json:"original_url"`
+	UserID       uuid.UUID          `json:"user_id"`
+	TeamID       *uuid.UUID         `json:"team_id,omitempty"` //nil - личная ссылка
+	IsDel        bool               `json:"is_deleted"`
+	ExpiresAt    *time.Time         `json:"expires_at,omitempty"`
+	RedirectType int                `json:"redirect_type,omitempty"`
+	ForwardQuery bool               `json:"forward_query,omitempty"`
+}
+
+func (r urlRecord) model() models.ShortenURL {
+	result := models.ShortenURL{
+		ShortURL:     r.ShortURL,
+		OriginalURL:  r.OriginalURL,
+		UserID:       r.UserID,
+		IsDel:        r.IsDel,
+		ExpiresAt:    r.ExpiresAt,
+		RedirectType: r.RedirectType,
+		ForwardQuery: r.ForwardQuery,
+	}
+	if r.TeamID != nil {
+		result.TeamID = *r.TeamID
+	}
+	return result
+}
+
+// Storage - хранилище во встраиваемой транзакционной базе bbolt, индексы хранятся в отдельных бакетах
+type Storage struct {
+	DB *bbolt.DB
+}
+
+func New(filename string) (*Storage, error) {
+	//создаем папку, если ее нет
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		logger.Sugar.Infow("Bolt New. Create dir error.")
+		return nil, err
+	}
+
+	//второй процесс с тем же файлом не ждет блокировку бесконечно
+	db, err := bbolt.Open(filename, 0600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		logger.Sugar.Infow("Bolt New. Open database error.")
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{urlsBucket, originalsBucket, usersBucket, clicksBucket, outboxBucket, outboxJobsBucket, counterBucket, apiKeysBucket, apiKeyUsers, accountsBucket, loginsBucket, teamsBucket, teamMembers, memberTeams, teamURLsBucket} {
+			if _, e := tx.CreateBucketIfNotExists(name); e != nil {
+				return e
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Sugar.Infow("Bolt New. Create buckets error.")
+		db.Close()
+		return nil, err
+	}
+
+	return &Storage{DB: db}, nil
+}
+
+func (s *Storage) Close() error {
+	return s.DB.Close()
+}
+
+// uint64Key - ключ из числа, байтовый порядок ключей совпадает с числовым
+func uint64Key(n uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, n)
+	return key
+}
+
+// userKey - ключ индекса ссылок пользователя или команды, ссылки одного владельца лежат подряд в порядке сохранения
+func userKey(userID uuid.UUID, seq uint64) []byte {
+	return append(userID[:], uint64Key(seq)...)
+}
+
+func getURL(tx *bbolt.Tx, shortURL models.ShortURL) (urlRecord, error) {
+	var record urlRecord
+
+	data := tx.Bucket(urlsBucket).Get([]byte(shortURL))
+	if data == nil {
+		return record, errs.ErrShortURLNotFound
+	}
+
+	if err := json.Unmarshal(data, &record); err != nil {
+		logger.Sugar.Infow("Bolt GetURL. Unmarshal error.")
+		return record, err
+	}
+	return record, nil
+}
+
+func putURL(tx *bbolt.Tx, record urlRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(urlsBucket).Put([]byte(record.ShortURL), data)
+}
+
+// save в рамках транзакции проверяет уникальность оригинальной ссылки и кода и сохраняет ссылку во все индексы
+func save(tx *bbolt.Tx, item models.ShortenURL) (models.ShortURL, error) {
+	originals := tx.Bucket(originalsBucket)
+
+	//поиск уже сохраненной оригинальной ссылки
+	if shortURL := originals.Get([]byte(item.OriginalURL)); shortURL != nil {
+		return models.ShortURL(shortURL), errs.ErrUniqueIndex
+	}
+
+	//короткая ссылка (например, пользовательский alias) уже занята
+	urls := tx.Bucket(urlsBucket)
+	if urls.Get([]byte(item.ShortURL)) != nil {
+		return "", errs.ErrShortURLExists
+	}
+
+	seq, err := urls.NextSequence()
+	if err != nil {
+		return "", err
+	}
+
+	record := urlRecord{
+		Seq:          seq,
+		ShortURL:     item.ShortURL,
+		OriginalURL:  item.OriginalURL,
+		UserID:       item.UserID,
+		ExpiresAt:    item.ExpiresAt,
+		RedirectType: item.RedirectType,
+		ForwardQuery: item.ForwardQuery,
+	}
+	if item.TeamID != uuid.Nil {
+		record.TeamID = &item.TeamID
+	}
+
+	if err = putURL(tx, record); err != nil {
+		return "", err
+	}
+
+	if err = originals.Put([]byte(item.OriginalURL), []byte(item.ShortURL)); err != nil {
+		return "", err
+	}
+
+	if err = tx.Bucket(usersBucket).Put(userKey(item.UserID, seq), []byte(item.ShortURL)); err != nil {
+		return "", err
+	}
+
+	if item.TeamID != uuid.Nil {
+		if err = tx.Bucket(teamURLsBucket).Put(userKey(item.TeamID, seq), []byte(item.ShortURL)); err != nil {
+			return "", err
+		}
+	}
+
+	return item.ShortURL, nil
+}
+
+func (s *Storage) SaveURL(ctx context.Context, item models.ShortenURL) (models.ShortURL, error) {
+	var result models.ShortURL
+
+	//ошибка уникальности возвращается вместе с уже сохраненным кодом, поэтому выносим ее из транзакции
+	var saveErr error
+
+	err := s.DB.Update(func(tx *bbolt.Tx) error {
+		result, saveErr = save(tx, item)
+		if errors.Is(saveErr, errs.ErrUniqueIndex) {
+			return nil
+		}
+		return saveErr
+	})
+	if err != nil {
+		return "", storageError(err)
+	}
+	return result, saveErr
+}
+
+func (s *Storage) GetURL(ctx context.Context, shortURL models.ShortURL) (models.ShortenURL, error) {
+	var record urlRecord
+
+	err := s.DB.View(func(tx *bbolt.Tx) error {
+		var e error
+		record, e = getURL(tx, shortURL)
+		return e
+	})
+	if err != nil {
+		return models.ShortenURL{}, storageError(err)
+	}
+	return record.model(), nil
+}
+
+func (s *Storage) GetShortURL(ctx context.Context, originalURL models.OriginalURL) (models.ShortURL, error) {
+	var shortURL models.ShortURL
+
+	err := s.DB.View(func(tx *bbolt.Tx) error {
+		if su := tx.Bucket(originalsBucket).Get([]byte(originalURL)); su != nil {
+			shortURL = models.ShortURL(su)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", storageError(err)
+	}
+
+	if shortURL != "" {
+		return shortURL, errs.ErrUniqueIndex
+	}
+	return "", nil
+}
+
+func (s *Storage) InsertBatch(ctx context.Context, batch []models.BatchRequest, host models.Host, userID uuid.UUID) ([]models.BatchResponse, error) {
+	var result []models.BatchResponse
+
+	now := time.Now()
+
+	//пачка сохраняется в одной транзакции: при коллизии кода не остается ни одной ссылки и сервис повторяет пачку целиком
+	err := s.DB.Update(func(tx *bbolt.Tx) error {
+		//коды, сохраненные этой пачкой: повтор URL внутри пачки конфликтом не считается
+		added := make(map[models.ShortURL]bool)
+
+		for _, row := range batch {
+			if err := expireOriginal(tx, models.OriginalURL(row.URL), now); err != nil {
+				return err
+			}
+
+			//уже сохраненная оригинальная ссылка возвращается со своим кодом
+			shortURL, err := save(tx, models.ShortenURL{
+				OriginalURL:  models.OriginalURL(row.URL),
+				ShortURL:     row.ShortURL,
+				UserID:       userID,
+				ExpiresAt:    row.ExpiresAt,
+				RedirectType: row.RedirectType,
+				ForwardQuery: row.ForwardQuery,
+			})
+			if err != nil && !errors.Is(err, errs.ErrUniqueIndex) {
+				logger.Sugar.Infow("Bolt InsertBatch. Insert error.")
+				return err
+			}
+
+			if err == nil {
+				added[shortURL] = true
+			}
+
+			//составляем результирующий сокращённый URL и добавляем в массив
+			resultShortURL := "http://" + string(host) + "/" + string(shortURL)
+
+			if _, e := url.Parse(resultShortURL); e != nil {
+				logger.Sugar.Infow("Bolt InsertBatch. Not result URL.")
+				return e
+			}
+
+			result = append(result, models.BatchResponse{
+				CorrelationID: row.CorrelationID,
+				ShortURL:      resultShortURL,
+				Conflict:      !added[shortURL],
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return result, nil
+}
+
+// ListByUserID - личные ссылки пользователя, ссылки команд в список не входят
+func (s *Storage) ListByUserID(ctx context.Context, host models.Host, userID uuid.UUID) ([]models.ShortenURL, error) {
+	return s.list(host, usersBucket, userID, uuid.Nil)
+}
+
+// list - ссылки из индекса bucket по владельцу owner, принадлежащие команде teamID (uuid.Nil - личные),
+// с полным адресом короткой ссылки
+func (s *Storage) list(host models.Host, bucket []byte, owner, teamID uuid.UUID) ([]models.ShortenURL, error) {
+	var result []models.ShortenURL
+
+	err := s.DB.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(bucket).Cursor()
+		prefix := owner[:]
+
+		for k, code := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, code = c.Next() {
+			record, err := getURL(tx, models.ShortURL(code))
+			if err != nil {
+				return err
+			}
+
+			row := record.model()
+			if row.TeamID != teamID {
+				continue
+			}
+
+			//составляем результирующий сокращённый URL и добавляем в массив
+			resultShortURL := "http://" + string(host) + "/" + string(row.ShortURL)
+
+			if _, e := url.Parse(resultShortURL); e != nil {
+				logger.Sugar.Infow("Bolt list. Not result URL.")
+				return e
+			}
+
+			result = append(result, models.ShortenURL{
+				OriginalURL:  row.OriginalURL,
+				ShortURL:     models.ShortURL(resultShortURL),
+				IsDel:        row.IsDel,
+				ExpiresAt:    row.ExpiresAt,
+				RedirectType: row.RedirectType,
+				ForwardQuery: row.ForwardQuery,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return result, nil
+}
+
+func (s *Storage) DeleteURL(ctx context.Context, deletedItems []models.DeletedURLS) ([]models.DeletedURLS, error) {
+	var result []models.DeletedURLS
+
+	err := s.DB.Update(func(tx *bbolt.Tx) error {
+		for _, item := range deletedItems {
+			row, err := getURL(tx, item.ShortURL)
+			if errors.Is(err, errs.ErrShortURLNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			//удалить можно только свою и еще не удаленную ссылку
+			if !row.model().DeletableBy(item) || row.IsDel {
+				continue
+			}
+
+			if err = markDeleted(tx, row); err != nil {
+				return err
+			}
+			result = append(result, item)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Sugar.Infow("Bolt DeleteURL. Update error.")
+		return nil, storageError(err)
+	}
+	return result, nil
+}
+
+// markDeleted помечает ссылку удаленной и убирает ее из индекса оригинальных URL, чтобы тот же URL можно было сократить заново
+func markDeleted(tx *bbolt.Tx, row urlRecord) error {
+	row.IsDel = true
+	if err := putURL(tx, row); err != nil {
+		return err
+	}
+
+	originals := tx.Bucket(originalsBucket)
+	if string(originals.Get([]byte(row.OriginalURL))) == string(row.ShortURL) {
+		return originals.Delete([]byte(row.OriginalURL))
+	}
+	return nil
+}
+
+// expireOriginal помечает удаленной истекшую, но еще не обработанную ссылку на originalURL,
+// чтобы пачка сократила URL заново, а не вернула мертвый код конфликтом
+func expireOriginal(tx *bbolt.Tx, originalURL models.OriginalURL, now time.Time) error {
+	shortURL := tx.Bucket(originalsBucket).Get([]byte(originalURL))
+	if shortURL == nil {
+		return nil
+	}
+
+	row, err := getURL(tx, models.ShortURL(shortURL))
+	if err != nil {
+		return err
+	}
+
+	if row.IsDel || !row.model().IsExpired(now) {
+		return nil
+	}
+	return markDeleted(tx, row)
+}
+
+func (s *Storage) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	var count int64
+
+	err := s.DB.Update(func(tx *bbolt.Tx) error {
+		var expired []urlRecord
+
+		//менять бакет во время обхода курсором нельзя, поэтому сначала собираем истекшие ссылки
+		err := tx.Bucket(urlsBucket).ForEach(func(k, v []byte) error {
+			var row urlRecord
+			if err := json.Unmarshal(v, &row); err != nil {
+				return err
+			}
+
+			if !row.IsDel && row.model().IsExpired(now) {
+				expired = append(expired, row)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, row := range expired {
+			if err = markDeleted(tx, row); err != nil {
+				return err
+			}
+		}
+		count = int64(len(expired))
+		return nil
+	})
+	if err != nil {
+		logger.Sugar.Infow("Bolt DeleteExpired. Update error.")
+		return 0, storageError(err)
+	}
+	return count, nil
+}
+
+// NextID - счетчик для стратегий генерации кодов на основе числового идентификатора
+func (s *Storage) NextID(ctx context.Context) (int64, error) {
+	var id uint64
+
+	err := s.DB.Update(func(tx *bbolt.Tx) error {
+		var e error
+		id, e = tx.Bucket(counterBucket).NextSequence()
+		return e
+	})
+	if err != nil {
+		return 0, storageError(err)
+	}
+	return int64(id), nil
+}
+
+// storageError помечает ошибки самой базы (диск, закрытая база, поврежденные данные) как недоступность хранилища,
+// доменные ошибки возвращаются как есть
+func storageError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := errs.As(err); ok {
+		return err
+	}
+	return fmt.Errorf("%w: %w", errs.ErrStorageUnavailable, err)
+}
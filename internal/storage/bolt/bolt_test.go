@@ -0,0 +1,246 @@
+package bolt
+
+import (
+	"context"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStorage(t *testing.T) {
+	logger.Initialize()
+	ctx := context.Background()
+
+	t.Run("Bolt. Indexes in both directions.", func(t *testing.T) {
+		s, err := New(filepath.Join(t.TempDir(), "short-url.db"))
+		require.NoError(t, err)
+		defer s.Close()
+
+		userID := uuid.New()
+
+		shortURL, err := s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk", UserID: userID})
+		require.NoError(t, err)
+		assert.Equal(t, models.ShortURL("jB9Wbk"), shortURL)
+
+		_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://yandex.ru/", ShortURL: "wqev4E", UserID: userID})
+		require.NoError(t, err)
+
+		row, err := s.GetURL(ctx, "jB9Wbk")
+		require.NoError(t, err)
+		assert.Equal(t, models.OriginalURL("https://practicum.yandex.ru/"), row.OriginalURL)
+		assert.Equal(t, userID, row.UserID)
+
+		shortURL, err = s.GetShortURL(ctx, "https://practicum.yandex.ru/")
+		assert.ErrorIs(t, err, errs.ErrUniqueIndex)
+		assert.Equal(t, models.ShortURL("jB9Wbk"), shortURL)
+
+		//повторное сокращение возвращает сохраненный код
+		shortURL, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "abcdef", UserID: userID})
+		assert.ErrorIs(t, err, errs.ErrUniqueIndex)
+		assert.Equal(t, models.ShortURL("jB9Wbk"), shortURL)
+
+		_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://ya.ru/", ShortURL: "jB9Wbk", UserID: userID})
+		assert.ErrorIs(t, err, errs.ErrShortURLExists)
+
+		list, err := s.ListByUserID(ctx, "localhost:8080", userID)
+		require.NoError(t, err)
+		require.Len(t, list, 2)
+		assert.Equal(t, models.ShortURL("http://localhost:8080/jB9Wbk"), list[0].ShortURL)
+		assert.Equal(t, models.ShortURL("http://localhost:8080/wqev4E"), list[1].ShortURL)
+
+		list, err = s.ListByUserID(ctx, "localhost:8080", uuid.New())
+		require.NoError(t, err)
+		assert.Empty(t, list)
+
+		_, err = s.GetURL(ctx, "abcdef")
+		assert.ErrorIs(t, err, errs.ErrShortURLNotFound)
+	})
+
+	t.Run("Bolt. Batch is atomic.", func(t *testing.T) {
+		s, err := New(filepath.Join(t.TempDir(), "short-url.db"))
+		require.NoError(t, err)
+		defer s.Close()
+
+		userID := uuid.New()
+
+		_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://ya.ru/", ShortURL: "taken1", UserID: userID})
+		require.NoError(t, err)
+
+		//коллизия кода откатывает всю пачку
+		_, err = s.InsertBatch(ctx, []models.BatchRequest{
+			{CorrelationID: "1", URL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk"},
+			{CorrelationID: "2", URL: "https://yandex.ru/", ShortURL: "taken1"},
+		}, "localhost:8080", userID)
+		assert.ErrorIs(t, err, errs.ErrShortURLExists)
+
+		_, err = s.GetURL(ctx, "jB9Wbk")
+		assert.ErrorIs(t, err, errs.ErrShortURLNotFound)
+
+		result, err := s.InsertBatch(ctx, []models.BatchRequest{
+			{CorrelationID: "1", URL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk"},
+			{CorrelationID: "2", URL: "https://ya.ru/", ShortURL: "wqev4E"},
+		}, "localhost:8080", userID)
+		require.NoError(t, err)
+		assert.Equal(t, []models.BatchResponse{
+			{CorrelationID: "1", ShortURL: "http://localhost:8080/jB9Wbk"},
+			{CorrelationID: "2", ShortURL: "http://localhost:8080/taken1", Conflict: true},
+		}, result)
+	})
+
+	t.Run("Bolt. Delete and expire.", func(t *testing.T) {
+		s, err := New(filepath.Join(t.TempDir(), "short-url.db"))
+		require.NoError(t, err)
+		defer s.Close()
+
+		owner := uuid.New()
+		expiresAt := time.Now().Add(-time.Minute).UTC()
+
+		_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk", UserID: owner})
+		require.NoError(t, err)
+		_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://yandex.ru/", ShortURL: "wqev4E", UserID: owner, ExpiresAt: &expiresAt})
+		require.NoError(t, err)
+
+		deleted, err := s.DeleteURL(ctx, []models.DeletedURLS{
+			{UserID: uuid.New(), ShortURL: "jB9Wbk"},
+			{UserID: owner, ShortURL: "jB9Wbk"},
+			{UserID: owner, ShortURL: "jB9Wbk"},
+			{UserID: owner, ShortURL: "abcdef"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []models.DeletedURLS{{UserID: owner, ShortURL: "jB9Wbk"}}, deleted)
+
+		count, err := s.DeleteExpired(ctx, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+
+		row, err := s.GetURL(ctx, "wqev4E")
+		require.NoError(t, err)
+		assert.True(t, row.IsDel)
+	})
+
+	t.Run("Bolt. State survives restart.", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "short-url.db")
+		userID := uuid.New()
+		jobID := uuid.New()
+		clickedAt := time.Now().UTC()
+
+		s, err := New(filename)
+		require.NoError(t, err)
+
+		_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk", UserID: userID})
+		require.NoError(t, err)
+		require.NoError(t, s.SaveClicks(ctx, []models.Click{{ShortURL: "jB9Wbk", ClickedAt: clickedAt}}))
+		require.NoError(t, s.EnqueueDeletes(ctx, jobID, []models.DeletedURLS{{UserID: userID, ShortURL: "jB9Wbk"}}))
+
+		id, err := s.NextID(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), id)
+		require.NoError(t, s.Close())
+
+		s, err = New(filename)
+		require.NoError(t, err)
+		defer s.Close()
+
+		row, err := s.GetURL(ctx, "jB9Wbk")
+		require.NoError(t, err)
+		assert.Equal(t, userID, row.UserID)
+
+		clicks, err := s.ListClicks(ctx, "jB9Wbk", clickedAt.Add(-time.Hour), clickedAt.Add(time.Hour))
+		require.NoError(t, err)
+		assert.Len(t, clicks, 1)
+
+		items, err := s.GetDeleteJob(ctx, jobID)
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+		assert.Equal(t, userID, items[0].UserID)
+
+		id, err = s.NextID(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), id)
+	})
+
+	t.Run("Bolt. Clicks by period.", func(t *testing.T) {
+		s, err := New(filepath.Join(t.TempDir(), "short-url.db"))
+		require.NoError(t, err)
+		defer s.Close()
+
+		base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		require.NoError(t, s.SaveClicks(ctx, []models.Click{
+			{ShortURL: "jB9Wbk", ClickedAt: base},
+			{ShortURL: "jB9Wbk", ClickedAt: base},
+			{ShortURL: "jB9Wbk", ClickedAt: base.Add(time.Hour)},
+			{ShortURL: "jB9Wbk", ClickedAt: base.Add(2 * time.Hour)},
+			{ShortURL: "jB9Wb", ClickedAt: base},
+			{ShortURL: "jB9Wbkk", ClickedAt: base},
+		}))
+
+		clicks, err := s.ListClicks(ctx, "jB9Wbk", base, base.Add(2*time.Hour))
+		require.NoError(t, err)
+		assert.Len(t, clicks, 3)
+
+		clicks, err = s.ListClicks(ctx, "jB9Wbk", time.Time{}, base.Add(3*time.Hour))
+		require.NoError(t, err)
+		assert.Len(t, clicks, 4)
+	})
+
+	t.Run("Bolt. Outbox lifecycle.", func(t *testing.T) {
+		s, err := New(filepath.Join(t.TempDir(), "short-url.db"))
+		require.NoError(t, err)
+		defer s.Close()
+
+		userID := uuid.New()
+		jobID := uuid.New()
+
+		require.NoError(t, s.EnqueueDeletes(ctx, jobID, []models.DeletedURLS{
+			{UserID: userID, ShortURL: "jB9Wbk"},
+			{UserID: userID, ShortURL: "wqev4E"},
+		}))
+		require.NoError(t, s.EnqueueDeletes(ctx, uuid.New(), []models.DeletedURLS{{UserID: uuid.New(), ShortURL: "abcdef"}}))
+
+		items, err := s.FetchDeletes(ctx, time.Now(), 2)
+		require.NoError(t, err)
+		require.Len(t, items, 2)
+		assert.Equal(t, models.ShortURL("jB9Wbk"), items[0].ShortURL)
+
+		items[0].Status = models.OutboxDone
+		items[0].Result = models.DeleteResultDeleted
+		items[0].UpdatedAt = time.Now().Add(-time.Hour)
+		items[1].Status = models.OutboxDead
+		require.NoError(t, s.UpdateDeletes(ctx, items))
+
+		dead, err := s.ListDeadDeletes(ctx, userID)
+		require.NoError(t, err)
+		require.Len(t, dead, 1)
+		assert.Equal(t, models.ShortURL("wqev4E"), dead[0].ShortURL)
+
+		items, err = s.FetchDeletes(ctx, time.Now(), 10)
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+		assert.Equal(t, models.ShortURL("abcdef"), items[0].ShortURL)
+
+		count, err := s.PurgeDeletes(ctx, time.Now().Add(-time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+
+		job, err := s.GetDeleteJob(ctx, jobID)
+		require.NoError(t, err)
+		require.Len(t, job, 1)
+		assert.Equal(t, models.OutboxDead, job[0].Status)
+	})
+
+	t.Run("Bolt. Closed database is unavailable.", func(t *testing.T) {
+		s, err := New(filepath.Join(t.TempDir(), "short-url.db"))
+		require.NoError(t, err)
+		require.NoError(t, s.Close())
+
+		_, err = s.GetURL(ctx, "jB9Wbk")
+		assert.ErrorIs(t, err, errs.ErrStorageUnavailable)
+	})
+}
@@ -0,0 +1,92 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/dubrovsky1/url-shortener/internal/stats"
+	"go.etcd.io/bbolt"
+	"time"
+)
+
+// clickPrefix - начало ключей переходов по коду, нулевой байт отделяет код от времени
+func clickPrefix(shortURL models.ShortURL) []byte {
+	return append([]byte(shortURL), 0)
+}
+
+// clickTime - время перехода в ключе, переходы одного кода упорядочены по времени.
+// Время до 1970 года в ключ не попадает, его заменяет ноль
+func clickTime(t time.Time) uint64 {
+	if t.Before(time.Unix(0, 0)) {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+func (s *Storage) SaveClicks(ctx context.Context, clicks []models.Click) error {
+	err := s.DB.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(clicksBucket)
+
+		for _, click := range clicks {
+			data, err := json.Marshal(click)
+			if err != nil {
+				return err
+			}
+
+			//порядковый номер различает переходы в одну и ту же наносекунду
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+
+			key := append(clickPrefix(click.ShortURL), uint64Key(clickTime(click.ClickedAt))...)
+			key = append(key, uint64Key(seq)...)
+
+			if err = b.Put(key, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Sugar.Infow("Bolt SaveClicks. Update error.")
+		return storageError(err)
+	}
+	return nil
+}
+
+func (s *Storage) ListClicks(ctx context.Context, shortURL models.ShortURL, from, to time.Time) ([]models.Click, error) {
+	var result []models.Click
+
+	err := s.DB.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(clicksBucket).Cursor()
+		prefix := clickPrefix(shortURL)
+		end := append(clickPrefix(shortURL), uint64Key(clickTime(to))...)
+
+		//читаем только диапазон ключей [from, to) нужного кода
+		for k, v := c.Seek(append(prefix, uint64Key(clickTime(from))...)); k != nil && bytes.HasPrefix(k, prefix) && bytes.Compare(k, end) < 0; k, v = c.Next() {
+			var click models.Click
+			if err := json.Unmarshal(v, &click); err != nil {
+				logger.Sugar.Infow("Bolt ListClicks. Unmarshal error.")
+				return err
+			}
+			result = append(result, click)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return result, nil
+}
+
+// ClickStats читает события периода по диапазону ключей и агрегирует их, запросов у bbolt нет
+func (s *Storage) ClickStats(ctx context.Context, shortURL models.ShortURL, params models.StatsParams) (models.Stats, error) {
+	clicks, err := s.ListClicks(ctx, shortURL, params.From, params.To)
+	if err != nil {
+		return models.Stats{}, err
+	}
+	return stats.Build(shortURL, params, clicks), nil
+}
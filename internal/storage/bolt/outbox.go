@@ -0,0 +1,239 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/google/uuid"
+	"go.etcd.io/bbolt"
+	"time"
+)
+
+// outboxRecord - значение в бакете очереди на удаление, в отличие от ответа API хранит владельца ссылки
+type outboxRecord struct {
+	models.OutboxItem
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (r outboxRecord) item() models.OutboxItem {
+	item := r.OutboxItem
+	item.UserID = r.UserID
+	return item
+}
+
+// outboxJobKey - ключ индекса записей задания
+func outboxJobKey(jobID uuid.UUID, id int64) []byte {
+	return append(jobID[:], uint64Key(uint64(id))...)
+}
+
+func putOutbox(b *bbolt.Bucket, item models.OutboxItem) error {
+	data, err := json.Marshal(outboxRecord{OutboxItem: item, UserID: item.UserID})
+	if err != nil {
+		return err
+	}
+	return b.Put(uint64Key(uint64(item.ID)), data)
+}
+
+func unmarshalOutbox(data []byte) (models.OutboxItem, error) {
+	var record outboxRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		logger.Sugar.Infow("Bolt outbox. Unmarshal error.")
+		return models.OutboxItem{}, err
+	}
+	return record.item(), nil
+}
+
+// EnqueueDeletes ставит ссылки в очередь на удаление под заданием jobID
+func (s *Storage) EnqueueDeletes(ctx context.Context, jobID uuid.UUID, items []models.DeletedURLS) error {
+	now := time.Now()
+
+	err := s.DB.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(outboxBucket)
+		jobs := tx.Bucket(outboxJobsBucket)
+
+		for _, item := range items {
+			id, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+
+			err = putOutbox(b, models.OutboxItem{
+				ID:            int64(id),
+				JobID:         jobID,
+				UserID:        item.UserID,
+				ShortURL:      item.ShortURL,
+				Status:        models.OutboxPending,
+				NextAttemptAt: now,
+				CreatedAt:     now,
+				UpdatedAt:     now,
+			})
+			if err != nil {
+				return err
+			}
+
+			if err = jobs.Put(outboxJobKey(jobID, int64(id)), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Sugar.Infow("Bolt EnqueueDeletes. Update error.")
+		return storageError(err)
+	}
+	return nil
+}
+
+// FetchDeletes - готовые к обработке записи очереди в порядке поступления
+func (s *Storage) FetchDeletes(ctx context.Context, now time.Time, limit int) ([]models.OutboxItem, error) {
+	var result []models.OutboxItem
+
+	err := s.DB.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(outboxBucket).Cursor()
+
+		for k, v := c.First(); k != nil && len(result) < limit; k, v = c.Next() {
+			item, err := unmarshalOutbox(v)
+			if err != nil {
+				return err
+			}
+
+			if item.Status == models.OutboxPending && !item.NextAttemptAt.After(now) {
+				result = append(result, item)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return result, nil
+}
+
+// UpdateDeletes сохраняет новое состояние записей очереди
+func (s *Storage) UpdateDeletes(ctx context.Context, items []models.OutboxItem) error {
+	err := s.DB.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(outboxBucket)
+
+		for _, item := range items {
+			//запись могла быть уже вычищена из очереди
+			data := b.Get(uint64Key(uint64(item.ID)))
+			if data == nil {
+				continue
+			}
+
+			//владельца записи меняет только MergeUser, обработчик очереди мог прочитать запись до передачи
+			current, err := unmarshalOutbox(data)
+			if err != nil {
+				return err
+			}
+			item.UserID = current.UserID
+
+			if err = putOutbox(b, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Sugar.Infow("Bolt UpdateDeletes. Update error.")
+		return storageError(err)
+	}
+	return nil
+}
+
+// GetDeleteJob - записи очереди, относящиеся к заданию jobID
+func (s *Storage) GetDeleteJob(ctx context.Context, jobID uuid.UUID) ([]models.OutboxItem, error) {
+	var result []models.OutboxItem
+
+	err := s.DB.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(outboxBucket)
+		c := tx.Bucket(outboxJobsBucket).Cursor()
+		prefix := jobID[:]
+
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			data := b.Get(k[len(prefix):])
+			if data == nil {
+				continue
+			}
+
+			item, err := unmarshalOutbox(data)
+			if err != nil {
+				return err
+			}
+			result = append(result, item)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return result, nil
+}
+
+// ListDeadDeletes - записи пользователя, исчерпавшие попытки удаления
+func (s *Storage) ListDeadDeletes(ctx context.Context, userID uuid.UUID) ([]models.OutboxItem, error) {
+	var result []models.OutboxItem
+
+	err := s.DB.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(outboxBucket).ForEach(func(k, v []byte) error {
+			item, err := unmarshalOutbox(v)
+			if err != nil {
+				return err
+			}
+
+			if item.Status == models.OutboxDead && item.UserID == userID {
+				result = append(result, item)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return result, nil
+}
+
+// PurgeDeletes убирает обработанные записи, последний раз изменявшиеся раньше before
+func (s *Storage) PurgeDeletes(ctx context.Context, before time.Time) (int64, error) {
+	var count int64
+
+	err := s.DB.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(outboxBucket)
+		var purged []models.OutboxItem
+
+		err := b.ForEach(func(k, v []byte) error {
+			item, err := unmarshalOutbox(v)
+			if err != nil {
+				return err
+			}
+
+			if item.Status == models.OutboxDone && item.UpdatedAt.Before(before) {
+				purged = append(purged, item)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		jobs := tx.Bucket(outboxJobsBucket)
+
+		for _, item := range purged {
+			if err = b.Delete(uint64Key(uint64(item.ID))); err != nil {
+				return err
+			}
+			if err = jobs.Delete(outboxJobKey(item.JobID, item.ID)); err != nil {
+				return err
+			}
+		}
+		count = int64(len(purged))
+		return nil
+	})
+	if err != nil {
+		logger.Sugar.Infow("Bolt PurgeDeletes. Update error.")
+		return 0, storageError(err)
+	}
+	return count, nil
+}
@@ -0,0 +1,223 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/google/uuid"
+	"go.etcd.io/bbolt"
+	"sort"
+	"time"
+)
+
+// teamRecord - значение в бакете команд
+type teamRecord struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// memberRecord - значение в бакете участников команд
+type memberRecord struct {
+	TeamID    uuid.UUID   `json:"team_id"`
+	UserID    uuid.UUID   `json:"user_id"`
+	Role      models.Role `json:"role"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+func memberKey(first, second uuid.UUID) []byte {
+	return append(first[:], second[:]...)
+}
+
+func getMember(tx *bbolt.Tx, teamID, userID uuid.UUID) (models.TeamMember, error) {
+	data := tx.Bucket(teamMembers).Get(memberKey(teamID, userID))
+	if data == nil {
+		return models.TeamMember{}, errs.ErrTeamMemberNotFound
+	}
+
+	var record memberRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return models.TeamMember{}, err
+	}
+	return models.TeamMember(record), nil
+}
+
+func putMember(tx *bbolt.Tx, member models.TeamMember) error {
+	data, err := json.Marshal(memberRecord(member))
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Bucket(teamMembers).Put(memberKey(member.TeamID, member.UserID), data); err != nil {
+		return err
+	}
+	return tx.Bucket(memberTeams).Put(memberKey(member.UserID, member.TeamID), nil)
+}
+
+// CreateTeam в одной транзакции сохраняет новую команду и ее первого владельца
+func (s *Storage) CreateTeam(ctx context.Context, team models.Team, owner models.TeamMember) error {
+	err := s.DB.Update(func(tx *bbolt.Tx) error {
+		data, err := json.Marshal(teamRecord{ID: team.ID, Name: team.Name, CreatedAt: team.CreatedAt})
+		if err != nil {
+			return err
+		}
+
+		if err = tx.Bucket(teamsBucket).Put(team.ID[:], data); err != nil {
+			return err
+		}
+
+		owner.TeamID = team.ID
+		return putMember(tx, owner)
+	})
+	return storageError(err)
+}
+
+// ListTeams - команды пользователя с его ролью в порядке создания
+func (s *Storage) ListTeams(ctx context.Context, userID uuid.UUID) ([]models.Team, error) {
+	var result []models.Team
+
+	err := s.DB.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(memberTeams).Cursor()
+		prefix := userID[:]
+
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			teamID, err := uuid.FromBytes(k[len(prefix):])
+			if err != nil {
+				return err
+			}
+
+			member, err := getMember(tx, teamID, userID)
+			if err != nil {
+				return err
+			}
+
+			var record teamRecord
+			if err = json.Unmarshal(tx.Bucket(teamsBucket).Get(teamID[:]), &record); err != nil {
+				return err
+			}
+
+			result = append(result, models.Team{ID: record.ID, Name: record.Name, CreatedAt: record.CreatedAt, Role: member.Role})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result, nil
+}
+
+// SaveTeamMember добавляет участника или меняет его роль, момент вступления не меняется
+func (s *Storage) SaveTeamMember(ctx context.Context, member models.TeamMember) error {
+	err := s.DB.Update(func(tx *bbolt.Tx) error {
+		if tx.Bucket(teamsBucket).Get(member.TeamID[:]) == nil {
+			return errs.ErrTeamNotFound
+		}
+
+		if member.Role != models.RoleOwner {
+			if err := keepOwner(tx, member.TeamID, member.UserID); err != nil {
+				return err
+			}
+		}
+
+		if current, err := getMember(tx, member.TeamID, member.UserID); err == nil {
+			member.CreatedAt = current.CreatedAt
+		}
+		return putMember(tx, member)
+	})
+	return storageError(err)
+}
+
+// GetTeamMember - участие пользователя в команде
+func (s *Storage) GetTeamMember(ctx context.Context, teamID, userID uuid.UUID) (models.TeamMember, error) {
+	var result models.TeamMember
+
+	err := s.DB.View(func(tx *bbolt.Tx) error {
+		var e error
+		result, e = getMember(tx, teamID, userID)
+		return e
+	})
+	if err != nil {
+		return models.TeamMember{}, storageError(err)
+	}
+	return result, nil
+}
+
+// ListTeamMembers - участники команды в порядке вступления
+func (s *Storage) ListTeamMembers(ctx context.Context, teamID uuid.UUID) ([]models.TeamMember, error) {
+	result := []models.TeamMember{}
+
+	err := s.DB.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(teamMembers).Cursor()
+		prefix := teamID[:]
+
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var record memberRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+			result = append(result, models.TeamMember(record))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result, nil
+}
+
+// DeleteTeamMember исключает пользователя из команды, созданные им ссылки остаются у команды
+func (s *Storage) DeleteTeamMember(ctx context.Context, teamID, userID uuid.UUID) error {
+	err := s.DB.Update(func(tx *bbolt.Tx) error {
+		if _, err := getMember(tx, teamID, userID); err != nil {
+			return err
+		}
+		if err := keepOwner(tx, teamID, userID); err != nil {
+			return err
+		}
+
+		if err := tx.Bucket(teamMembers).Delete(memberKey(teamID, userID)); err != nil {
+			return err
+		}
+		return tx.Bucket(memberTeams).Delete(memberKey(userID, teamID))
+	})
+	return storageError(err)
+}
+
+// keepOwner - ErrTeamLastOwner, если userID единственный владелец команды. Транзакции записи в bbolt идут по очереди,
+// поэтому проверка и следующая за ней запись не пересекаются с другими изменениями команды
+func keepOwner(tx *bbolt.Tx, teamID, userID uuid.UUID) error {
+	c := tx.Bucket(teamMembers).Cursor()
+	prefix := teamID[:]
+	last := false
+
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		var record memberRecord
+		if err := json.Unmarshal(v, &record); err != nil {
+			return err
+		}
+
+		if record.Role != models.RoleOwner {
+			continue
+		}
+		if record.UserID != userID {
+			return nil
+		}
+		last = true
+	}
+
+	if last {
+		return errs.ErrTeamLastOwner
+	}
+	return nil
+}
+
+// ListByTeamID - ссылки команды в порядке сохранения
+func (s *Storage) ListByTeamID(ctx context.Context, host models.Host, teamID uuid.UUID) ([]models.ShortenURL, error) {
+	return s.list(host, teamURLsBucket, teamID, teamID)
+}
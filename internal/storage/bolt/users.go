@@ -0,0 +1,225 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/google/uuid"
+	"go.etcd.io/bbolt"
+	"time"
+)
+
+// userRecord - значение в бакете пользователей
+type userRecord struct {
+	ID           uuid.UUID `json:"id"`
+	Login        string    `json:"login"`
+	PasswordHash string    `json:"password_hash"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func getUser(tx *bbolt.Tx, id []byte) (models.User, error) {
+	data := tx.Bucket(accountsBucket).Get(id)
+	if data == nil {
+		return models.User{}, errs.ErrUserNotFound
+	}
+
+	var record userRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return models.User{}, err
+	}
+	return models.User(record), nil
+}
+
+// CreateUser сохраняет нового пользователя, логин должен быть свободен
+func (s *Storage) CreateUser(ctx context.Context, user models.User) error {
+	err := s.DB.Update(func(tx *bbolt.Tx) error {
+		logins := tx.Bucket(loginsBucket)
+		accounts := tx.Bucket(accountsBucket)
+
+		if logins.Get([]byte(user.Login)) != nil || accounts.Get(user.ID[:]) != nil {
+			return errs.ErrUserExists
+		}
+
+		data, err := json.Marshal(userRecord(user))
+		if err != nil {
+			return err
+		}
+
+		if err = accounts.Put(user.ID[:], data); err != nil {
+			return err
+		}
+		return logins.Put([]byte(user.Login), user.ID[:])
+	})
+	return storageError(err)
+}
+
+// GetUserByLogin - пользователь по логину
+func (s *Storage) GetUserByLogin(ctx context.Context, login string) (models.User, error) {
+	var result models.User
+
+	err := s.DB.View(func(tx *bbolt.Tx) error {
+		id := tx.Bucket(loginsBucket).Get([]byte(login))
+		if id == nil {
+			return errs.ErrUserNotFound
+		}
+
+		var e error
+		result, e = getUser(tx, id)
+		return e
+	})
+	if err != nil {
+		return models.User{}, storageError(err)
+	}
+	return result, nil
+}
+
+// GetUserByID - пользователь по идентификатору
+func (s *Storage) GetUserByID(ctx context.Context, id uuid.UUID) (models.User, error) {
+	var result models.User
+
+	err := s.DB.View(func(tx *bbolt.Tx) error {
+		var e error
+		result, e = getUser(tx, id[:])
+		return e
+	})
+	if err != nil {
+		return models.User{}, storageError(err)
+	}
+	return result, nil
+}
+
+// MergeUser в одной транзакции передает ссылки, API-ключи, участие в командах и задания на удаление
+// пользователя from пользователю to, возвращает число перенесенных ссылок
+func (s *Storage) MergeUser(ctx context.Context, from, to uuid.UUID) (int64, error) {
+	var merged int64
+
+	err := s.DB.Update(func(tx *bbolt.Tx) error {
+		var e error
+		if merged, e = mergeIndex(tx, usersBucket, from, to, func(code []byte) error {
+			row, err := getURL(tx, models.ShortURL(code))
+			if err != nil {
+				return err
+			}
+			row.UserID = to
+			return putURL(tx, row)
+		}); e != nil {
+			return e
+		}
+
+		if _, e = mergeIndex(tx, apiKeyUsers, from, to, func(hash []byte) error {
+			key, err := getAPIKey(tx, hash)
+			if err != nil {
+				return err
+			}
+			key.UserID = to
+			return putAPIKey(tx, key)
+		}); e != nil {
+			return e
+		}
+
+		if e = mergeMembers(tx, from, to); e != nil {
+			return e
+		}
+		return mergeOutbox(tx, from, to)
+	})
+	if err != nil {
+		return 0, storageError(err)
+	}
+	return merged, nil
+}
+
+// mergeIndex переносит записи индекса пользователя from под пользователя to с теми же порядковыми номерами,
+// поэтому перенесенные записи встают среди записей to в порядке сохранения. update обновляет сам объект по значению индекса
+func mergeIndex(tx *bbolt.Tx, bucket []byte, from, to uuid.UUID, update func([]byte) error) (int64, error) {
+	b := tx.Bucket(bucket)
+	prefix := from[:]
+
+	//ключи собираем до изменений: курсор bbolt не переживает запись в бакет
+	var keys, values [][]byte
+	c := b.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		keys = append(keys, bytes.Clone(k))
+		values = append(values, bytes.Clone(v))
+	}
+
+	for i, k := range keys {
+		if err := update(values[i]); err != nil {
+			return 0, err
+		}
+		if err := b.Delete(k); err != nil {
+			return 0, err
+		}
+		if err := b.Put(append(to[:], k[len(prefix):]...), values[i]); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(keys)), nil
+}
+
+// mergeMembers заменяет участие from в командах участием to, если оба пользователя в одной команде, остается старшая роль
+func mergeMembers(tx *bbolt.Tx, from, to uuid.UUID) error {
+	prefix := from[:]
+
+	var teamIDs []uuid.UUID
+	c := tx.Bucket(memberTeams).Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		teamID, err := uuid.FromBytes(k[len(prefix):])
+		if err != nil {
+			return err
+		}
+		teamIDs = append(teamIDs, teamID)
+	}
+
+	for _, teamID := range teamIDs {
+		member, err := getMember(tx, teamID, from)
+		if err != nil {
+			return err
+		}
+
+		member.UserID = to
+		if current, errCurrent := getMember(tx, teamID, to); errCurrent == nil {
+			member = current.Merge(member)
+		}
+
+		if err = tx.Bucket(teamMembers).Delete(memberKey(teamID, from)); err != nil {
+			return err
+		}
+		if err = tx.Bucket(memberTeams).Delete(memberKey(from, teamID)); err != nil {
+			return err
+		}
+		if err = putMember(tx, member); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeOutbox передает записи очереди на удаление, индекса по пользователю у очереди нет, поэтому просматривается весь бакет
+func mergeOutbox(tx *bbolt.Tx, from, to uuid.UUID) error {
+	b := tx.Bucket(outboxBucket)
+
+	var items []models.OutboxItem
+	err := b.ForEach(func(k, v []byte) error {
+		item, err := unmarshalOutbox(v)
+		if err != nil {
+			return err
+		}
+		if item.UserID == from {
+			item.UserID = to
+			items = append(items, item)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err = putOutbox(b, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/google/uuid"
+	"slices"
+	"sort"
+	"time"
+)
+
+// apiKeyRecord - строка журнала API-ключей, последняя строка ключа - его актуальное состояние
+type apiKeyRecord struct {
+	ID        uuid.UUID      `json:"id"`
+	UserID    uuid.UUID      `json:"user_id"`
+	Name      string         `json:"name"`
+	Prefix    string         `json:"prefix"`
+	Hash      string         `json:"hash"`
+	Scopes    []models.Scope `json:"scopes"`
+	CreatedAt time.Time      `json:"created_at"`
+	RevokedAt *time.Time     `json:"revoked_at,omitempty"`
+}
+
+// loadAPIKeys восстанавливает API-ключи из журнала
+func (s *Storage) loadAPIKeys() error {
+	s.apiKeys = make(map[string]models.APIKey)
+
+	err := readLog(s.APIKeysFilename, func(data []byte) error {
+		var record apiKeyRecord
+
+		if err := json.Unmarshal(data, &record); err != nil {
+			logger.Sugar.Infow("Unmarshal api key record error.")
+			return err
+		}
+
+		s.apiKeys[record.Hash] = models.APIKey(record)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	//отзыв ключа должен оказаться на диске до ответа пользователю
+	s.apiKeysLog, err = openLogFile(s.APIKeysFilename, SyncPolicy{Mode: SyncAlways})
+	return err
+}
+
+// putAPIKey дописывает состояние ключа в журнал и обновляет индекс
+func (s *Storage) putAPIKey(key models.APIKey) error {
+	key.Scopes = slices.Clone(key.Scopes)
+
+	lines, err := marshalLines([]apiKeyRecord{apiKeyRecord(key)})
+	if err != nil {
+		return err
+	}
+
+	if err = s.apiKeysLog.Append(lines...); err != nil {
+		return err
+	}
+
+	s.apiKeys[key.Hash] = key
+	return nil
+}
+
+// SaveAPIKey сохраняет новый API-ключ
+func (s *Storage) SaveAPIKey(ctx context.Context, key models.APIKey) error {
+	s.apiKeysMu.Lock()
+	defer s.apiKeysMu.Unlock()
+
+	return s.putAPIKey(key)
+}
+
+// GetAPIKey - ключ по хешу, в том числе отозванный
+func (s *Storage) GetAPIKey(ctx context.Context, hash string) (models.APIKey, error) {
+	s.apiKeysMu.RLock()
+	defer s.apiKeysMu.RUnlock()
+
+	key, ok := s.apiKeys[hash]
+	if !ok {
+		return models.APIKey{}, errs.ErrAPIKeyNotFound
+	}
+	key.Scopes = slices.Clone(key.Scopes)
+	return key, nil
+}
+
+// ListAPIKeys - ключи пользователя в порядке создания
+func (s *Storage) ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]models.APIKey, error) {
+	s.apiKeysMu.RLock()
+	defer s.apiKeysMu.RUnlock()
+
+	var result []models.APIKey
+	for _, key := range s.apiKeys {
+		if key.UserID == userID {
+			key.Scopes = slices.Clone(key.Scopes)
+			result = append(result, key)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result, nil
+}
+
+// RevokeAPIKey отзывает ключ пользователя, повторный отзыв не меняет момент отзыва
+func (s *Storage) RevokeAPIKey(ctx context.Context, userID, keyID uuid.UUID, now time.Time) error {
+	s.apiKeysMu.Lock()
+	defer s.apiKeysMu.Unlock()
+
+	for _, key := range s.apiKeys {
+		if key.ID != keyID || key.UserID != userID {
+			continue
+		}
+
+		if key.RevokedAt != nil {
+			return nil
+		}
+		key.RevokedAt = &now
+		return s.putAPIKey(key)
+	}
+	return errs.ErrAPIKeyNotFound
+}
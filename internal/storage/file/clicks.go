@@ -0,0 +1,74 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/dubrovsky1/url-shortener/internal/stats"
+	"sort"
+	"time"
+)
+
+// loadClicks читает события переходов из отдельного файла рядом с основным
+func (s *Storage) loadClicks() error {
+	err := readLog(s.ClicksFilename, func(data []byte) error {
+		var click models.Click
+
+		if err := json.Unmarshal(data, &click); err != nil {
+			logger.Sugar.Infow("Unmarshal click error.")
+			return err
+		}
+		s.Clicks = append(s.Clicks, click)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.clicksLog, err = openLogFile(s.ClicksFilename, s.syncPolicy)
+	return err
+}
+
+func (s *Storage) SaveClicks(ctx context.Context, clicks []models.Click) error {
+	lines, err := marshalLines(clicks)
+	if err != nil {
+		return err
+	}
+
+	s.clicksMu.Lock()
+	defer s.clicksMu.Unlock()
+
+	if err = s.clicksLog.Append(lines...); err != nil {
+		return err
+	}
+
+	s.Clicks = append(s.Clicks, clicks...)
+	return nil
+}
+
+func (s *Storage) ListClicks(ctx context.Context, shortURL models.ShortURL, from, to time.Time) ([]models.Click, error) {
+	s.clicksMu.RLock()
+	defer s.clicksMu.RUnlock()
+
+	var result []models.Click
+
+	for _, click := range s.Clicks {
+		if click.ShortURL == shortURL && !click.ClickedAt.Before(from) && click.ClickedAt.Before(to) {
+			result = append(result, click)
+		}
+	}
+
+	//события могли прийти пачками не по порядку, отдаем их по времени перехода, как и база
+	sort.SliceStable(result, func(i, j int) bool { return result[i].ClickedAt.Before(result[j].ClickedAt) })
+	return result, nil
+}
+
+// ClickStats - события файлового хранилища держатся в памяти, агрегируем их без обращения к файлу
+func (s *Storage) ClickStats(ctx context.Context, shortURL models.ShortURL, params models.StatsParams) (models.Stats, error) {
+	clicks, err := s.ListClicks(ctx, shortURL, params.From, params.To)
+	if err != nil {
+		return models.Stats{}, err
+	}
+	return stats.Build(shortURL, params, clicks), nil
+}
@@ -1,42 +1,133 @@
 package file
 
 import (
-	"bufio"
 	"context"
-	"encoding/json"
 	"errors"
 	errs "github.com/dubrovsky1/url-shortener/internal/errors"
-	"github.com/dubrovsky1/url-shortener/internal/generator"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
 	"github.com/dubrovsky1/url-shortener/internal/models"
 	"github.com/google/uuid"
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"sync"
+	"time"
 )
 
+// операции журнала ссылок, строки без op записаны до появления журнала и считаются put
+const (
+	opPut = "put" //новая ссылка или полное состояние ссылки после сжатия
+	opDel = "del" //ссылка помечена удаленной
+	opOwn = "own" //ссылка передана пользователю UserID
+)
+
+// ShortenURL - строка журнала ссылок
 type ShortenURL struct {
-	UUID        uint               `json:"uuid"`
-	ShortURL    models.ShortURL    `json:"short_url"`
-	OriginalURL models.OriginalURL `json:"original_url"`
-	UserID      uuid.UUID          `json:"user_id"`
-	IsDel       bool               `json:"is_deleted"`
+	Op           string             `json:"op,omitempty"`
+	UUID         uint               `json:"uuid"`
+	ShortURL     models.ShortURL    `json:"short_url"`
+	OriginalURL  models.OriginalURL `json:"original_url"`
+	UserID       uuid.UUID          `json:"user_id"`
+	TeamID       *uuid.UUID         `json:"team_id,omitempty"` //nil - личная ссылка
+	IsDel        bool               `json:"is_deleted"`
+	ExpiresAt    *time.Time         `json:"expires_at,omitempty"`
+	RedirectType int                `json:"redirect_type,omitempty"`
+	ForwardQuery bool               `json:"forward_query,omitempty"`
 }
 
+// Storage - хранилище в файле-журнале операций, состояние и индексы восстанавливаются при открытии
 type Storage struct {
-	Urls     []ShortenURL
-	Filename string
-	maxUUID  uint
+	Filename        string
+	Clicks          []models.Click
+	ClicksFilename  string
+	Outbox          map[int64]models.OutboxItem
+	OutboxFilename  string
+	APIKeysFilename string
+	UsersFilename   string
+	TeamsFilename   string
+	CompactRatio    float64 //сжатие запускается, когда лишних строк журнала больше, чем CompactRatio от числа ссылок
+	urls            map[models.ShortURL]ShortenURL
+	originals       map[models.OriginalURL]models.ShortURL
+	users           map[uuid.UUID][]models.ShortURL
+	teamLinks       map[uuid.UUID][]models.ShortURL //коды ссылок команды, под той же блокировкой mu, что и ссылки
+	syncPolicy      SyncPolicy
+	log             *logFile //журнал ссылок
+	clicksLog       *logFile
+	outboxLog       *logFile
+	apiKeysLog      *logFile
+	logRecords      int //число строк в журнале ссылок
+	maxUUID         uint
+	lastID          uint
+	mu              sync.RWMutex
+	clicksMu        sync.RWMutex
+	outboxID        int64
+	outboxMu        sync.Mutex
+	apiKeys         map[string]models.APIKey //API-ключи по хешу
+	apiKeysMu       sync.RWMutex
+	usersLog        *logFile
+	accounts        map[uuid.UUID]models.User //зарегистрированные пользователи
+	logins          map[string]uuid.UUID
+	accountMu       sync.RWMutex
+	teamsLog        *logFile
+	teams           map[uuid.UUID]models.Team
+	members         map[uuid.UUID]map[uuid.UUID]models.TeamMember //участники по команде и пользователю
+	teamsMu         sync.RWMutex
+	compactCh       chan struct{} //сигнал фоновому сжатию журнала ссылок
+	compactMu       sync.Mutex    //сжатия по запросу и в фоне не идут одновременно
+	done            chan struct{}
+	wg              sync.WaitGroup
 }
 
+// Option - необязательная настройка файлового хранилища, передается в New
+type Option func(*Storage)
+
+// WithSyncPolicy задает политику сброса журналов ссылок и переходов на диск,
+// очередь на удаление сбрасывается на диск всегда до ответа пользователю
+func WithSyncPolicy(policy SyncPolicy) Option {
+	return func(s *Storage) {
+		s.syncPolicy = policy
+	}
+}
+
+// DefaultCompactRatio - журнал сжимается, когда лишних строк в нем больше, чем ссылок
+const DefaultCompactRatio = 1.0
+
+// минимальное число лишних строк, ради которого стоит переписывать журнал
+const compactMinGarbage = 1000
+
+// Close останавливает фоновое сжатие, сбрасывает журналы на диск и закрывает их
 func (s *Storage) Close() error {
-	return nil
+	var result []error
+
+	if s.done != nil {
+		close(s.done)
+		s.wg.Wait()
+	}
+
+	for _, log := range []*logFile{s.log, s.clicksLog, s.outboxLog, s.apiKeysLog, s.usersLog, s.teamsLog} {
+		if log != nil {
+			result = append(result, log.Close())
+		}
+	}
+	return errors.Join(result...)
 }
 
-func New(filename string) (*Storage, error) {
-	var s Storage
-	s.Filename = filename
-	s.maxUUID = 0
+func New(filename string, opts ...Option) (*Storage, error) {
+	s := &Storage{
+		Filename:     filename,
+		CompactRatio: DefaultCompactRatio,
+		urls:         make(map[models.ShortURL]ShortenURL),
+		originals:    make(map[models.OriginalURL]models.ShortURL),
+		users:        make(map[uuid.UUID][]models.ShortURL),
+		teamLinks:    make(map[uuid.UUID][]models.ShortURL),
+		syncPolicy:   DefaultSyncPolicy,
+		compactCh:    make(chan struct{}, 1),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
 
 	dir := filepath.Dir(filename)
 
@@ -49,167 +140,272 @@ func New(filename string) (*Storage, error) {
 		}
 	}
 
-	//создаем файл, если его нет
-	if _, err := os.Stat(s.Filename); os.IsNotExist(err) {
-		newFile, errCreate := os.Create(s.Filename)
-		if errCreate != nil {
-			logger.Sugar.Infow("Create file error.")
-			return nil, errCreate
-		}
-		newFile.Close()
+	//читаем журнал и строим индексы только при инициализации хранилища, чтобы каждый раз не считывать данные из файла
+	if err := s.loadLog(); err != nil {
+		s.Close()
+		return nil, err
 	}
 
-	file, err := os.Open(s.Filename)
-	if err != nil {
-		logger.Sugar.Infow("Open file error.")
+	//события переходов храним в отдельном файле, чтобы не смешивать их со ссылками
+	s.ClicksFilename = filename + ".clicks"
+	if err := s.loadClicks(); err != nil {
+		s.Close()
 		return nil, err
 	}
-	defer file.Close()
 
-	//сканнер для чтения данных из файла
-	scanner := bufio.NewScanner(file)
-
-	//читаем файл построчно и заполняем структуру только при инициализации хранилища, чтобы каждый раз не считывать данные из файла
-	for scanner.Scan() {
-		data := scanner.Bytes()
-		currentShortenURL := ShortenURL{}
+	//очередь на удаление - журнал, который переживает перезапуск
+	s.OutboxFilename = filename + ".outbox"
+	if err := s.loadOutbox(); err != nil {
+		s.Close()
+		return nil, err
+	}
 
-		err = json.Unmarshal(data, &currentShortenURL)
+	s.APIKeysFilename = filename + ".keys"
+	if err := s.loadAPIKeys(); err != nil {
+		s.Close()
+		return nil, err
+	}
 
-		if err != nil {
-			logger.Sugar.Infow("Unmarshal currentShortenURL error.")
-			return nil, err
-		}
-		s.Urls = append(s.Urls, currentShortenURL)
+	s.UsersFilename = filename + ".users"
+	if err := s.loadUsers(); err != nil {
+		s.Close()
+		return nil, err
+	}
 
-		s.maxUUID = currentShortenURL.UUID
+	s.TeamsFilename = filename + ".teams"
+	if err := s.loadTeams(); err != nil {
+		s.Close()
+		return nil, err
 	}
 
-	return &s, nil
+	//журнал ссылок сжимается в фоне, чтобы удаления не держали s.mu на время перезаписи
+	s.done = make(chan struct{})
+	s.wg.Add(1)
+	go s.compactRun()
+
+	return s, nil
 }
 
-func (s *Storage) WriteFile(item *ShortenURL) error {
-	data, err := json.Marshal(item)
-	if err != nil {
-		logger.Sugar.Infow("Marshal su error.")
-		return err
-	}
+// apply применяет строку журнала к индексам
+func (s *Storage) apply(record ShortenURL) {
+	switch record.Op {
+	case opDel:
+		if row, ok := s.urls[record.ShortURL]; ok {
+			row.IsDel = true
+			s.urls[record.ShortURL] = row
+
+			//удаленная ссылка не мешает сократить тот же URL заново
+			if s.originals[row.OriginalURL] == row.ShortURL {
+				delete(s.originals, row.OriginalURL)
+			}
+		}
+	case opOwn:
+		if row, ok := s.urls[record.ShortURL]; ok && row.UserID != record.UserID {
+			s.users[row.UserID] = slices.DeleteFunc(s.users[row.UserID], func(code models.ShortURL) bool { return code == record.ShortURL })
+			if len(s.users[row.UserID]) == 0 {
+				delete(s.users, row.UserID)
+			}
+			s.users[record.UserID] = append(s.users[record.UserID], record.ShortURL)
 
-	//открываем файл, чтобы начать с ним работать
-	file, err := os.OpenFile(s.Filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		logger.Sugar.Infow("Open file error.")
-		return err
+			row.UserID = record.UserID
+			s.urls[record.ShortURL] = row
+		}
+	default:
+		record.Op = ""
+		if _, ok := s.urls[record.ShortURL]; !ok {
+			s.users[record.UserID] = append(s.users[record.UserID], record.ShortURL)
+			if record.TeamID != nil {
+				s.teamLinks[*record.TeamID] = append(s.teamLinks[*record.TeamID], record.ShortURL)
+			}
+		}
+		s.urls[record.ShortURL] = record
+		if !record.IsDel {
+			s.originals[record.OriginalURL] = record.ShortURL
+		}
+
+		if record.UUID > s.maxUUID {
+			s.maxUUID = record.UUID
+		}
 	}
-	defer file.Close()
+}
 
-	//поле для записи в файл
-	writer := bufio.NewWriter(file)
+func (s *Storage) SaveURL(ctx context.Context, item models.ShortenURL) (models.ShortURL, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	// записываем событие в буфер
-	if _, err = writer.Write(data); err != nil {
-		logger.Sugar.Infow("Write file error.")
-		return err
-	}
+	return s.save(item)
+}
 
-	// добавляем перенос строки
-	if err = writer.WriteByte('\n'); err != nil {
-		logger.Sugar.Infow("Write \\n error.")
-		return err
-	}
+// save проверяет уникальность оригинальной ссылки и кода, дописывает ссылку в журнал и индексы
+// checkBatch проверяет коды пачки до записи первой строки: при коллизии сервис повторит пачку с новыми кодами,
+// и строки, сохраненные до коллизии, вернулись бы ему конфликтами
+func (s *Storage) checkBatch(batch []models.BatchRequest) error {
+	claimed := make(map[models.ShortURL]struct{}, len(batch))
+	seen := make(map[string]struct{}, len(batch))
+
+	for _, row := range batch {
+		//для уже сохраненной оригинальной ссылки и повтора внутри пачки код строки не используется
+		if _, ok := s.originals[models.OriginalURL(row.URL)]; ok {
+			continue
+		}
+		if _, ok := seen[row.URL]; ok {
+			continue
+		}
+		seen[row.URL] = struct{}{}
 
-	// записываем буфер в файл
-	writer.Flush()
+		if _, ok := s.urls[row.ShortURL]; ok {
+			return errs.ErrShortURLExists
+		}
+		if _, ok := claimed[row.ShortURL]; ok {
+			return errs.ErrShortURLExists
+		}
+		claimed[row.ShortURL] = struct{}{}
+	}
 	return nil
 }
 
-func (s *Storage) SaveURL(ctx context.Context, item models.ShortenURL) (models.ShortURL, error) {
+func (s *Storage) save(item models.ShortenURL) (models.ShortURL, error) {
 	//поиск уже сохраненной оригинальной ссылки
-	shortURL, err := s.GetShortURL(ctx, item.OriginalURL)
-	if err != nil {
-		return shortURL, err
+	if shortURL, ok := s.originals[item.OriginalURL]; ok {
+		return shortURL, errs.ErrUniqueIndex
 	}
 
-	//создаем объект с сокращенной ссылкой, добавляем в хранилище и записываем в конец файла
-	su := ShortenURL{
-		UUID:        s.maxUUID + 1,
-		ShortURL:    item.ShortURL,
-		OriginalURL: item.OriginalURL,
-		UserID:      item.UserID,
-		IsDel:       false,
+	//короткая ссылка (например, пользовательский alias) уже занята
+	if _, ok := s.urls[item.ShortURL]; ok {
+		return "", errs.ErrShortURLExists
 	}
 
-	s.Urls = append(s.Urls, su)
-	s.maxUUID++
+	//создаем объект с сокращенной ссылкой, записываем в конец журнала и добавляем в индексы
+	su := ShortenURL{
+		Op:           opPut,
+		UUID:         s.maxUUID + 1,
+		ShortURL:     item.ShortURL,
+		OriginalURL:  item.OriginalURL,
+		UserID:       item.UserID,
+		ExpiresAt:    item.ExpiresAt,
+		RedirectType: item.RedirectType,
+		ForwardQuery: item.ForwardQuery,
+	}
+	if item.TeamID != uuid.Nil {
+		su.TeamID = &item.TeamID
+	}
 
-	err = s.WriteFile(&su)
-	if err != nil {
-		return item.ShortURL, err
+	if err := s.appendLog(su); err != nil {
+		return "", err
 	}
 
+	s.apply(su)
 	return item.ShortURL, nil
 }
 
 func (s *Storage) GetURL(ctx context.Context, shortURL models.ShortURL) (models.ShortenURL, error) {
-	//делаю поиск по массиву из Storage, тк чтение из файла происходит при инициализации хранилища
-	for _, r := range s.Urls {
-		if r.ShortURL == shortURL {
-			result := models.ShortenURL{
-				OriginalURL: r.OriginalURL,
-				IsDel:       r.IsDel,
-			}
-			return result, nil
-		}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	r, ok := s.urls[shortURL]
+	if !ok {
+		return models.ShortenURL{}, errs.ErrShortURLNotFound
 	}
-	return models.ShortenURL{}, errors.New("the short url is missing")
+
+	return r.model(), nil
+}
+
+// model - ссылка из строки журнала
+func (r ShortenURL) model() models.ShortenURL {
+	result := models.ShortenURL{
+		ShortURL:     r.ShortURL,
+		OriginalURL:  r.OriginalURL,
+		UserID:       r.UserID,
+		IsDel:        r.IsDel,
+		ExpiresAt:    r.ExpiresAt,
+		RedirectType: r.RedirectType,
+		ForwardQuery: r.ForwardQuery,
+	}
+	if r.TeamID != nil {
+		result.TeamID = *r.TeamID
+	}
+	return result
 }
 
 func (s *Storage) GetShortURL(ctx context.Context, originalURL models.OriginalURL) (models.ShortURL, error) {
-	for _, r := range s.Urls {
-		if r.OriginalURL == originalURL {
-			return r.ShortURL, errs.ErrUniqueIndex
-		}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if shortURL, ok := s.originals[originalURL]; ok {
+		return shortURL, errs.ErrUniqueIndex
 	}
 	return "", nil
 }
 
 func (s *Storage) InsertBatch(ctx context.Context, batch []models.BatchRequest, host models.Host, userID uuid.UUID) ([]models.BatchResponse, error) {
-	var result []models.BatchResponse
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	//истекшие, но еще не обработанные ссылки на URL пачки помечаем удаленными, чтобы сократить URL заново,
+	//а не вернуть мертвый код конфликтом
+	now := time.Now()
+	var tombstones []ShortenURL
+	seen := make(map[models.ShortURL]struct{})
 
 	for _, row := range batch {
-		var err error
+		shortURL, ok := s.originals[models.OriginalURL(row.URL)]
+		if !ok {
+			continue
+		}
+		if _, ok = seen[shortURL]; ok {
+			continue
+		}
+		seen[shortURL] = struct{}{}
 
-		var curItem = models.ShortenURL{
-			OriginalURL: models.OriginalURL(row.URL),
-			UserID:      userID,
-			IsDel:       false,
+		if existing := s.urls[shortURL]; !existing.IsDel && existing.ExpiresAt != nil && !now.Before(*existing.ExpiresAt) {
+			tombstones = append(tombstones, ShortenURL{Op: opDel, ShortURL: existing.ShortURL, UserID: existing.UserID, IsDel: true})
 		}
+	}
 
-		//поиск уже сохраненной оригинальной ссылки
-		curItem.ShortURL, err = s.GetShortURL(ctx, curItem.OriginalURL)
+	if err := s.appendTombstones(tombstones); err != nil {
+		return nil, err
+	}
 
-		if err == nil {
-			//гененрируем короткую ссылку
-			curItem.ShortURL = models.ShortURL(generator.GetShortURL())
+	if err := s.checkBatch(batch); err != nil {
+		return nil, err
+	}
 
-			curItem.ShortURL, err = s.SaveURL(ctx, curItem)
-			if err != nil {
-				logger.Sugar.Infow("File InsertBatch. Insert error.")
-				return nil, err
-			}
+	var result []models.BatchResponse
+
+	//коды, сохраненные этой пачкой: повтор URL внутри пачки конфликтом не считается
+	added := make(map[models.ShortURL]bool)
+
+	for _, row := range batch {
+		//коллизии кодов проверены checkBatch, уже сохраненная оригинальная ссылка возвращается со своим кодом
+		shortURL, err := s.save(models.ShortenURL{
+			OriginalURL:  models.OriginalURL(row.URL),
+			ShortURL:     row.ShortURL,
+			UserID:       userID,
+			ExpiresAt:    row.ExpiresAt,
+			RedirectType: row.RedirectType,
+			ForwardQuery: row.ForwardQuery,
+		})
+		if err != nil && !errors.Is(err, errs.ErrUniqueIndex) {
+			logger.Sugar.Infow("File InsertBatch. Insert error.")
+			return nil, err
+		}
+
+		if err == nil {
+			added[shortURL] = true
 		}
 
 		//составляем результирующий сокращённый URL и добавляем в массив
-		resultShortURL := "http://" + string(host) + "/" + string(curItem.ShortURL)
+		resultShortURL := "http://" + string(host) + "/" + string(shortURL)
 
 		if _, e := url.Parse(resultShortURL); e != nil {
-			logger.Sugar.Infow("Postgresql InsertBatch. Not result URL.")
+			logger.Sugar.Infow("File InsertBatch. Not result URL.")
 			return nil, e
 		}
 
 		r := models.BatchResponse{
 			CorrelationID: row.CorrelationID,
 			ShortURL:      resultShortURL,
+			Conflict:      !added[shortURL],
 		}
 
 		result = append(result, r)
@@ -218,73 +414,118 @@ func (s *Storage) InsertBatch(ctx context.Context, batch []models.BatchRequest,
 	return result, nil
 }
 
+// ListByUserID - личные ссылки пользователя, ссылки команд в список не входят
 func (s *Storage) ListByUserID(ctx context.Context, host models.Host, userID uuid.UUID) ([]models.ShortenURL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.list(host, s.users[userID], uuid.Nil)
+}
+
+// list - ссылки по кодам, принадлежащие команде teamID (uuid.Nil - личные), с полным адресом короткой ссылки
+func (s *Storage) list(host models.Host, codes []models.ShortURL, teamID uuid.UUID) ([]models.ShortenURL, error) {
 	var result []models.ShortenURL
 
-	for _, row := range s.Urls {
-		if row.UserID == userID {
+	for _, code := range codes {
+		row := s.urls[code].model()
+		if row.TeamID != teamID {
+			continue
+		}
 
-			//составляем результирующий сокращённый URL и добавляем в массив
-			resultShortURL := "http://" + string(host) + "/" + string(row.ShortURL)
+		//составляем результирующий сокращённый URL и добавляем в массив
+		resultShortURL := "http://" + string(host) + "/" + string(row.ShortURL)
 
-			if _, e := url.Parse(resultShortURL); e != nil {
-				logger.Sugar.Infow("Postgresql ListByUserID. Not result URL.")
-				return nil, e
-			}
+		if _, e := url.Parse(resultShortURL); e != nil {
+			logger.Sugar.Infow("File list. Not result URL.")
+			return nil, e
+		}
 
-			var curItem = models.ShortenURL{
-				OriginalURL: row.OriginalURL,
-				ShortURL:    models.ShortURL(resultShortURL),
-				IsDel:       row.IsDel,
-			}
-			result = append(result, curItem)
+		var curItem = models.ShortenURL{
+			OriginalURL:  row.OriginalURL,
+			ShortURL:     models.ShortURL(resultShortURL),
+			IsDel:        row.IsDel,
+			ExpiresAt:    row.ExpiresAt,
+			RedirectType: row.RedirectType,
+			ForwardQuery: row.ForwardQuery,
 		}
+		result = append(result, curItem)
 	}
 	return result, nil
 }
 
-func (s *Storage) DeleteURL(ctx context.Context, deletedItems []models.DeletedURLS) error {
-	//открываем файл с полным очищением - O_TRUNC, чтобы перезаписать стоки из Urls с учетом обновленного признака IsDel
-	file, err := os.OpenFile(s.Filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND|os.O_TRUNC, 0666)
-	if err != nil {
-		logger.Sugar.Infow("Open file error.")
-		return err
-	}
-	defer file.Close()
+func (s *Storage) DeleteURL(ctx context.Context, deletedItems []models.DeletedURLS) ([]models.DeletedURLS, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	//поле для записи в файл
-	writer := bufio.NewWriter(file)
+	var result []models.DeletedURLS
+	var tombstones []ShortenURL
 
-	for i, row := range s.Urls {
-		for _, item := range deletedItems {
-			if row.UserID == item.UserID && row.ShortURL == item.ShortURL {
-				row.IsDel = true
-				s.Urls[i].IsDel = true
-			}
-		}
+	//память меняется только после записи журнала, поэтому повтор кода в одном запросе отсекаем отдельно
+	seen := make(map[models.ShortURL]bool)
 
-		data, errJSON := json.Marshal(row)
-		if errJSON != nil {
-			logger.Sugar.Infow("Marshal su error.")
-			return errJSON
+	for _, item := range deletedItems {
+		//удалить можно только свою и еще не удаленную ссылку
+		row, ok := s.urls[item.ShortURL]
+		if !ok || !row.model().DeletableBy(item) || row.IsDel || seen[item.ShortURL] {
+			continue
 		}
+		seen[item.ShortURL] = true
 
-		// записываем событие в буфер
-		if _, err = writer.Write(data); err != nil {
-			logger.Sugar.Infow("Write file error.")
-			return err
-		}
+		tombstones = append(tombstones, ShortenURL{Op: opDel, ShortURL: item.ShortURL, UserID: item.UserID, IsDel: true})
+		result = append(result, item)
+	}
+
+	if err := s.appendTombstones(tombstones); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
 
-		// добавляем перенос строки
-		if err = writer.WriteByte('\n'); err != nil {
-			logger.Sugar.Infow("Write \\n error.")
-			return err
+// NextID - счетчик для стратегий генерации кодов, продолжает нумерацию записей файла (maxUUID)
+func (s *Storage) NextID(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lastID < s.maxUUID {
+		s.lastID = s.maxUUID
+	}
+	s.lastID++
+	return int64(s.lastID), nil
+}
+
+func (s *Storage) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var tombstones []ShortenURL
+
+	for _, row := range s.urls {
+		if !row.IsDel && row.ExpiresAt != nil && !now.Before(*row.ExpiresAt) {
+			tombstones = append(tombstones, ShortenURL{Op: opDel, ShortURL: row.ShortURL, UserID: row.UserID, IsDel: true})
 		}
+	}
+
+	if err := s.appendTombstones(tombstones); err != nil {
+		return 0, err
+	}
+	return int64(len(tombstones)), nil
+}
 
+// appendTombstones дописывает отметки об удалении в журнал, применяет их к памяти и будит фоновое сжатие,
+// если лишних строк стало слишком много. При ошибке записи память не меняется и расходиться с журналом не может
+func (s *Storage) appendTombstones(tombstones []ShortenURL) error {
+	if len(tombstones) == 0 {
+		return nil
 	}
-	// записываем буфер в файл
-	writer.Flush()
 
-	return nil
+	if err := s.appendLog(tombstones...); err != nil {
+		return err
+	}
+
+	for _, tombstone := range tombstones {
+		s.apply(tombstone)
+	}
 
+	s.requestCompact()
+	return nil
 }
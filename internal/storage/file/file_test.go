@@ -0,0 +1,440 @@
+package file
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func countLines(t *testing.T, filename string) int {
+	file, err := os.Open(filename)
+	require.NoError(t, err)
+	defer file.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines++
+	}
+	require.NoError(t, scanner.Err())
+	return lines
+}
+
+func TestStorage(t *testing.T) {
+	logger.Initialize()
+	ctx := context.Background()
+
+	t.Run("File. Log replay after restart.", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "short-url-db.json")
+		userID := uuid.New()
+
+		s, err := New(filename, WithSyncPolicy(SyncPolicy{Mode: SyncAlways}))
+		require.NoError(t, err)
+
+		_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk", UserID: userID})
+		require.NoError(t, err)
+		_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://yandex.ru/", ShortURL: "wqev4E", UserID: userID})
+		require.NoError(t, err)
+
+		deleted, err := s.DeleteURL(ctx, []models.DeletedURLS{{UserID: userID, ShortURL: "jB9Wbk"}, {UserID: uuid.New(), ShortURL: "wqev4E"}})
+		require.NoError(t, err)
+		assert.Len(t, deleted, 1)
+
+		//удаление дописывается отметкой, а не переписывает файл
+		assert.Equal(t, 3, countLines(t, filename))
+		require.NoError(t, s.Close())
+
+		s, err = New(filename)
+		require.NoError(t, err)
+		defer s.Close()
+
+		row, err := s.GetURL(ctx, "jB9Wbk")
+		require.NoError(t, err)
+		assert.True(t, row.IsDel)
+
+		row, err = s.GetURL(ctx, "wqev4E")
+		require.NoError(t, err)
+		assert.False(t, row.IsDel)
+
+		shortURL, _ := s.GetShortURL(ctx, "https://yandex.ru/")
+		assert.Equal(t, models.ShortURL("wqev4E"), shortURL)
+
+		list, err := s.ListByUserID(ctx, "localhost:8080", userID)
+		require.NoError(t, err)
+		assert.Len(t, list, 2)
+
+		//нумерация продолжается после перезапуска
+		id, err := s.NextID(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), id)
+	})
+
+	t.Run("File. Failed log write keeps links.", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "short-url-db.json")
+		userID := uuid.New()
+		expiresAt := time.Now().Add(-time.Hour)
+
+		s, err := New(filename)
+		require.NoError(t, err)
+
+		_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk", UserID: userID})
+		require.NoError(t, err)
+		_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://yandex.ru/", ShortURL: "wqev4E", UserID: userID, ExpiresAt: &expiresAt})
+		require.NoError(t, err)
+
+		//журнал недоступен для записи - удаление не должно остаться только в памяти
+		require.NoError(t, s.log.file.Close())
+
+		_, err = s.DeleteURL(ctx, []models.DeletedURLS{{UserID: userID, ShortURL: "jB9Wbk"}})
+		require.Error(t, err)
+		_, err = s.DeleteExpired(ctx, time.Now())
+		require.Error(t, err)
+
+		for _, code := range []models.ShortURL{"jB9Wbk", "wqev4E"} {
+			row, errGet := s.GetURL(ctx, code)
+			require.NoError(t, errGet)
+			assert.False(t, row.IsDel, "Ссылка не должна быть удалена без записи в журнал")
+		}
+		s.Close()
+	})
+
+	t.Run("File. Failed append does not break later writes.", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "short-url-db.json")
+
+		l, err := openLogFile(filename, SyncPolicy{Mode: SyncNever})
+		require.NoError(t, err)
+		defer l.Close()
+
+		require.NoError(t, l.Append([]byte(`{"n":1}`)))
+
+		//запись в файл, открытый только на чтение, завершается ошибкой, как при переполнении диска
+		file := l.file
+		l.file, err = os.Open(filename)
+		require.NoError(t, err)
+
+		err = l.Append([]byte(`{"n":2}`))
+		require.Error(t, err)
+		require.NoError(t, l.file.Close())
+
+		//после восстановления диска запись снова проходит
+		l.file = file
+		require.NoError(t, l.Append([]byte(`{"n":3}`)))
+
+		data, err := os.ReadFile(filename)
+		require.NoError(t, err)
+		assert.Equal(t, "{\"n\":1}\n{\"n\":3}\n", string(data))
+	})
+
+	t.Run("File. Records written before the log format.", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "short-url-db.json")
+		userID := uuid.New()
+
+		legacy := `{"uuid":1,"short_url":"jB9Wbk","original_url":"https://practicum.yandex.ru/","user_id":"` + userID.String() + `","is_deleted":true}
+{"uuid":2,"short_url":"wqev4E","original_url":"https://yandex.ru/","user_id":"` + userID.String() + `","is_deleted":false}
+`
+		require.NoError(t, os.WriteFile(filename, []byte(legacy), 0666))
+
+		s, err := New(filename)
+		require.NoError(t, err)
+		defer s.Close()
+
+		row, err := s.GetURL(ctx, "jB9Wbk")
+		require.NoError(t, err)
+		assert.True(t, row.IsDel)
+
+		row, err = s.GetURL(ctx, "wqev4E")
+		require.NoError(t, err)
+		assert.False(t, row.IsDel)
+	})
+
+	t.Run("File. Compaction keeps state.", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "short-url-db.json")
+		userID := uuid.New()
+		expiresAt := time.Now().Add(-time.Minute).UTC()
+
+		s, err := New(filename, WithSyncPolicy(SyncPolicy{Mode: SyncNever}))
+		require.NoError(t, err)
+
+		_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk", UserID: userID})
+		require.NoError(t, err)
+		_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://yandex.ru/", ShortURL: "wqev4E", UserID: userID, ExpiresAt: &expiresAt})
+		require.NoError(t, err)
+
+		_, err = s.DeleteURL(ctx, []models.DeletedURLS{{UserID: userID, ShortURL: "jB9Wbk"}})
+		require.NoError(t, err)
+
+		count, err := s.DeleteExpired(ctx, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+		assert.Equal(t, 4, countLines(t, filename))
+
+		require.NoError(t, s.Compact(ctx))
+		assert.Equal(t, 2, countLines(t, filename))
+
+		_, err = os.Stat(filename + ".compact")
+		assert.True(t, os.IsNotExist(err), "Временный файл сжатия должен быть переименован")
+
+		//после сжатия журнал продолжает принимать записи
+		_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://ya.ru/", ShortURL: "p0Lk3s", UserID: userID})
+		require.NoError(t, err)
+		assert.Equal(t, 3, countLines(t, filename))
+		require.NoError(t, s.Close())
+
+		s, err = New(filename)
+		require.NoError(t, err)
+		defer s.Close()
+
+		for _, code := range []models.ShortURL{"jB9Wbk", "wqev4E"} {
+			row, errGet := s.GetURL(ctx, code)
+			require.NoError(t, errGet)
+			assert.True(t, row.IsDel)
+		}
+	})
+
+	t.Run("File. Deletes compact the log in background.", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "short-url-db.json")
+		userID := uuid.New()
+
+		s, err := New(filename, WithSyncPolicy(SyncPolicy{Mode: SyncNever}))
+		require.NoError(t, err)
+		s.CompactRatio = 0.5
+
+		deleted := make([]models.DeletedURLS, 0, compactMinGarbage)
+		for i := 0; i < compactMinGarbage; i++ {
+			code := models.ShortURL(fmt.Sprintf("c%05d", i))
+			_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: models.OriginalURL(fmt.Sprintf("https://ya.ru/%d", i)), ShortURL: code, UserID: userID})
+			require.NoError(t, err)
+			deleted = append(deleted, models.DeletedURLS{UserID: userID, ShortURL: code})
+		}
+
+		_, err = s.DeleteURL(ctx, deleted)
+		require.NoError(t, err)
+
+		//запись, пришедшая во время сжатия, не должна потеряться при подмене журнала
+		_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk", UserID: userID})
+		require.NoError(t, err)
+
+		assert.Eventually(t, func() bool {
+			return countLines(t, filename) == compactMinGarbage+1
+		}, time.Second*5, time.Millisecond*10)
+		require.NoError(t, s.Close())
+
+		s, err = New(filename)
+		require.NoError(t, err)
+		defer s.Close()
+
+		row, err := s.GetURL(ctx, "jB9Wbk")
+		require.NoError(t, err)
+		assert.False(t, row.IsDel)
+
+		row, err = s.GetURL(ctx, "c00000")
+		require.NoError(t, err)
+		assert.True(t, row.IsDel)
+	})
+
+	t.Run("File. User merge survives restart.", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "short-url-db.json")
+		anonymous, userID := uuid.New(), uuid.New()
+
+		s, err := New(filename, WithSyncPolicy(SyncPolicy{Mode: SyncNever}))
+		require.NoError(t, err)
+
+		require.NoError(t, s.CreateUser(ctx, models.User{ID: userID, Login: "alice", PasswordHash: "hash", CreatedAt: time.Now().UTC()}))
+
+		_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk", UserID: anonymous})
+		require.NoError(t, err)
+
+		merged, err := s.MergeUser(ctx, anonymous, userID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), merged)
+
+		//передача дописывается строкой own
+		assert.Equal(t, 2, countLines(t, filename))
+		require.NoError(t, s.Close())
+
+		s, err = New(filename)
+		require.NoError(t, err)
+		defer s.Close()
+
+		user, err := s.GetUserByLogin(ctx, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, userID, user.ID)
+
+		row, err := s.GetURL(ctx, "jB9Wbk")
+		require.NoError(t, err)
+		assert.Equal(t, userID, row.UserID)
+
+		list, err := s.ListByUserID(ctx, "localhost:8080", userID)
+		require.NoError(t, err)
+		assert.Len(t, list, 1)
+
+		list, err = s.ListByUserID(ctx, "localhost:8080", anonymous)
+		require.NoError(t, err)
+		assert.Empty(t, list)
+	})
+
+	t.Run("File. Teams survive restart.", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "short-url-db.json")
+		owner, editor, leaver := uuid.New(), uuid.New(), uuid.New()
+		team := models.Team{ID: uuid.New(), Name: "marketing", CreatedAt: time.Now().UTC()}
+		joinedAt := team.CreatedAt.Add(time.Minute)
+
+		s, err := New(filename)
+		require.NoError(t, err)
+
+		require.NoError(t, s.CreateTeam(ctx, team, models.TeamMember{TeamID: team.ID, UserID: owner, Role: models.RoleOwner, CreatedAt: team.CreatedAt}))
+		require.NoError(t, s.SaveTeamMember(ctx, models.TeamMember{TeamID: team.ID, UserID: editor, Role: models.RoleViewer, CreatedAt: joinedAt}))
+		require.NoError(t, s.SaveTeamMember(ctx, models.TeamMember{TeamID: team.ID, UserID: editor, Role: models.RoleEditor, CreatedAt: joinedAt}))
+		require.NoError(t, s.SaveTeamMember(ctx, models.TeamMember{TeamID: team.ID, UserID: leaver, Role: models.RoleViewer, CreatedAt: joinedAt}))
+		require.NoError(t, s.DeleteTeamMember(ctx, team.ID, leaver))
+
+		_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk", UserID: editor, TeamID: team.ID})
+		require.NoError(t, err)
+
+		//команды пишутся в отдельный журнал, ссылки - в основной
+		assert.Equal(t, 1, countLines(t, filename))
+		assert.Equal(t, 6, countLines(t, s.TeamsFilename))
+		require.NoError(t, s.Close())
+
+		s, err = New(filename)
+		require.NoError(t, err)
+		defer s.Close()
+
+		members, err := s.ListTeamMembers(ctx, team.ID)
+		require.NoError(t, err)
+		require.Len(t, members, 2)
+		assert.Equal(t, owner, members[0].UserID)
+		assert.Equal(t, editor, members[1].UserID)
+		assert.Equal(t, models.RoleEditor, members[1].Role)
+
+		row, err := s.GetURL(ctx, "jB9Wbk")
+		require.NoError(t, err)
+		assert.Equal(t, team.ID, row.TeamID)
+
+		list, err := s.ListByTeamID(ctx, "localhost:8080", team.ID)
+		require.NoError(t, err)
+		assert.Len(t, list, 1)
+
+		list, err = s.ListByUserID(ctx, "localhost:8080", editor)
+		require.NoError(t, err)
+		assert.Empty(t, list)
+	})
+
+	t.Run("File. Truncated last record.", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "short-url-db.json")
+		userID := uuid.New()
+
+		records := `{"op":"put","uuid":1,"short_url":"jB9Wbk","original_url":"https://practicum.yandex.ru/","user_id":"` + userID.String() + `","is_deleted":false}
+{"op":"put","uuid":2,"short_url":"wqev4E","orig`
+		require.NoError(t, os.WriteFile(filename, []byte(records), 0666))
+
+		s, err := New(filename)
+		require.NoError(t, err)
+		defer s.Close()
+
+		_, err = s.GetURL(ctx, "jB9Wbk")
+		require.NoError(t, err)
+
+		_, err = s.GetURL(ctx, "wqev4E")
+		assert.Error(t, err)
+
+		//оборванная строка отрезана, новая запись ложится с новой строки
+		_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://yandex.ru/", ShortURL: "wqev4E", UserID: userID})
+		require.NoError(t, err)
+		assert.Equal(t, 2, countLines(t, filename))
+	})
+
+	t.Run("File. Corrupted record in the middle.", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "short-url-db.json")
+		userID := uuid.New()
+
+		records := `{"op":"put","uuid":1,"short_url":"jB9W
+{"op":"put","uuid":2,"short_url":"wqev4E","original_url":"https://yandex.ru/","user_id":"` + userID.String() + `","is_deleted":false}
+`
+		require.NoError(t, os.WriteFile(filename, []byte(records), 0666))
+
+		_, err := New(filename)
+		assert.Error(t, err)
+	})
+
+	t.Run("File. Concurrent writes.", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "short-url-db.json")
+
+		s, err := New(filename, WithSyncPolicy(SyncPolicy{Mode: SyncInterval, Interval: time.Millisecond}))
+		require.NoError(t, err)
+
+		const workers = 8
+		const perWorker = 100
+
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				userID := uuid.New()
+
+				for i := 0; i < perWorker; i++ {
+					code := models.ShortURL(fmt.Sprintf("w%di%d", w, i))
+
+					_, errSave := s.SaveURL(ctx, models.ShortenURL{
+						OriginalURL: models.OriginalURL(fmt.Sprintf("https://example.com/%d/%d", w, i)),
+						ShortURL:    code,
+						UserID:      userID,
+					})
+					assert.NoError(t, errSave)
+
+					assert.NoError(t, s.SaveClicks(ctx, []models.Click{{ShortURL: code, ClickedAt: time.Now()}}))
+				}
+			}(w)
+		}
+		wg.Wait()
+		require.NoError(t, s.Close())
+
+		//строки не перемешались и все читаются после перезапуска
+		assert.Equal(t, workers*perWorker, countLines(t, filename))
+
+		s, err = New(filename)
+		require.NoError(t, err)
+		defer s.Close()
+
+		id, err := s.NextID(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(workers*perWorker+1), id)
+	})
+}
+
+func TestParseSyncPolicy(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    SyncPolicy
+		wantErr bool
+	}{
+		{value: "always", want: SyncPolicy{Mode: SyncAlways}},
+		{value: "never", want: SyncPolicy{Mode: SyncNever}},
+		{value: "100ms", want: SyncPolicy{Mode: SyncInterval, Interval: 100 * time.Millisecond}},
+		{value: "0s", wantErr: true},
+		{value: "sometimes", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			policy, err := ParseSyncPolicy(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, policy)
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// loadLog читает журнал ссылок, восстанавливает по нему индексы и открывает журнал на дозапись
+func (s *Storage) loadLog() error {
+	err := readLog(s.Filename, func(data []byte) error {
+		var record ShortenURL
+
+		if err := json.Unmarshal(data, &record); err != nil {
+			logger.Sugar.Infow("Unmarshal currentShortenURL error.")
+			return err
+		}
+
+		s.apply(record)
+		s.logRecords++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.log, err = openLogFile(s.Filename, s.syncPolicy); err != nil {
+		return err
+	}
+
+	if s.needCompact() {
+		return s.compact()
+	}
+	return nil
+}
+
+// appendLog дописывает строки в конец журнала
+func (s *Storage) appendLog(records ...ShortenURL) error {
+	lines, err := marshalLines(records)
+	if err != nil {
+		return err
+	}
+
+	if err = s.log.Append(lines...); err != nil {
+		return err
+	}
+
+	s.logRecords += len(records)
+	return nil
+}
+
+func marshalLines[T any](records []T) ([][]byte, error) {
+	lines := make([][]byte, len(records))
+
+	for i, record := range records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			logger.Sugar.Infow("Marshal record error.")
+			return nil, err
+		}
+		lines[i] = data
+	}
+	return lines, nil
+}
+
+// needCompact - лишних строк (отметок об удалении) в журнале больше допустимого
+func (s *Storage) needCompact() bool {
+	garbage := s.logRecords - len(s.urls)
+	return garbage >= compactMinGarbage && float64(garbage) > s.CompactRatio*float64(len(s.urls))
+}
+
+// Compact по запросу переписывает журнал только актуальными состояниями ссылок
+func (s *Storage) Compact(ctx context.Context) error {
+	return s.compact()
+}
+
+// requestCompact будит фоновое сжатие, если лишних строк в журнале больше допустимого.
+// Вызывается под s.mu и не ждет сжатия: запрос не должен стоять, пока переписывается журнал
+func (s *Storage) requestCompact() {
+	if !s.needCompact() {
+		return
+	}
+
+	select {
+	case s.compactCh <- struct{}{}:
+	default:
+		//сжатие уже запрошено
+	}
+}
+
+// compactRun сжимает журнал в фоне по сигналу requestCompact
+func (s *Storage) compactRun() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.compactCh:
+			if err := s.compact(); err != nil {
+				logger.Sugar.Infow("File storage compact error.", "err", err)
+			}
+		}
+	}
+}
+
+// compact пишет новый журнал во временный файл и атомарно подменяет им старый:
+// при падении посередине на диске остается либо старый, либо новый журнал целиком.
+// Снимок ссылок пишется без блокировки, под s.mu к нему дописываются только строки,
+// пришедшие в журнал за время записи, и файл подменяет журнал
+func (s *Storage) compact() error {
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
+	s.mu.RLock()
+	records := make([]ShortenURL, 0, len(s.urls))
+	for _, row := range s.urls {
+		row.Op = opPut
+		records = append(records, row)
+	}
+	logRecords := s.logRecords
+	offset := s.log.Size()
+	s.mu.RUnlock()
+
+	//сохраняем порядок добавления ссылок
+	sort.Slice(records, func(i, j int) bool { return records[i].UUID < records[j].UUID })
+
+	lines, err := marshalLines(records)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := writeTmpLog(s.log, lines)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	//строки, дописанные после снимка, переносим как есть: поверх снимка они дают текущее состояние
+	tail, err := s.log.Tail(offset)
+	if err == nil {
+		err = tmp.AppendRaw(tail)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.filename)
+		return err
+	}
+
+	if err = swapLog(s.log, tmp); err != nil {
+		return err
+	}
+
+	logger.Sugar.Infow("File storage compacted.", "records", s.logRecords, "urls", len(records))
+	s.logRecords = len(records) + s.logRecords - logRecords
+	return nil
+}
+
+// replaceLog записывает строки во временный файл, сбрасывает его на диск и подменяет им журнал
+func replaceLog(log *logFile, lines [][]byte) error {
+	tmp, err := writeTmpLog(log, lines)
+	if err != nil {
+		return err
+	}
+	return swapLog(log, tmp)
+}
+
+// writeTmpLog записывает строки во временный файл рядом с журналом
+func writeTmpLog(log *logFile, lines [][]byte) (*logFile, error) {
+	tmpFilename := log.filename + ".compact"
+
+	//остаток прерванного сжатия не должен попасть в новый журнал
+	os.Remove(tmpFilename)
+
+	tmp, err := openLogFile(tmpFilename, SyncPolicy{Mode: SyncNever})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tmp.Append(lines...); err != nil {
+		logger.Sugar.Infow("Write compact file error.", "filename", tmpFilename)
+		tmp.Close()
+		os.Remove(tmpFilename)
+		return nil, err
+	}
+	return tmp, nil
+}
+
+// swapLog сбрасывает временный файл на диск и подменяет им журнал
+func swapLog(log *logFile, tmp *logFile) error {
+	//новый журнал должен оказаться на диске до переименования
+	if err := tmp.Close(); err != nil {
+		logger.Sugar.Infow("Write compact file error.", "filename", tmp.filename)
+		os.Remove(tmp.filename)
+		return err
+	}
+
+	if err := log.Replace(tmp.filename); err != nil {
+		os.Remove(tmp.filename)
+		return err
+	}
+
+	//фиксируем само переименование
+	if err := syncDir(filepath.Dir(log.filename)); err != nil {
+		logger.Sugar.Infow("Sync dir error.")
+		return err
+	}
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
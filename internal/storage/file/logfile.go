@@ -0,0 +1,302 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// режимы сброса журнала на диск, по аналогии с appendfsync в Redis AOF
+const (
+	SyncAlways   = "always"   //fsync после каждой записи
+	SyncInterval = "interval" //fsync в фоне не чаще, чем раз в Interval
+	SyncNever    = "never"    //сброс на диск остается операционной системе
+)
+
+// SyncPolicy - политика сброса журнала на диск
+type SyncPolicy struct {
+	Mode     string
+	Interval time.Duration
+}
+
+// DefaultSyncPolicy - fsync раз в секунду: теряется не больше секунды записей при падении машины
+var DefaultSyncPolicy = SyncPolicy{Mode: SyncInterval, Interval: time.Second}
+
+// ParseSyncPolicy разбирает политику из конфигурации: always, never или интервал вида 100ms, 1s
+func ParseSyncPolicy(value string) (SyncPolicy, error) {
+	switch value {
+	case SyncAlways:
+		return SyncPolicy{Mode: SyncAlways}, nil
+	case SyncNever:
+		return SyncPolicy{Mode: SyncNever}, nil
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		return SyncPolicy{}, fmt.Errorf("not valid fsync policy %q: want always, never or positive duration", value)
+	}
+	return SyncPolicy{Mode: SyncInterval, Interval: interval}, nil
+}
+
+// logFile - открытый на дозапись файл журнала, запись и сброс на диск идут под одной блокировкой.
+// Записи идут в файл без промежуточного буфера: ошибка bufio.Writer запоминается и повторялась бы для всех следующих записей
+type logFile struct {
+	mu       sync.Mutex
+	filename string
+	file     *os.File
+	size     int64 //длина журнала после последней успешной записи
+	policy   SyncPolicy
+	dirty    bool //есть записи, еще не сброшенные на диск
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// openLogFile открывает журнал на дозапись и при политике interval запускает фоновый сброс на диск
+func openLogFile(filename string, policy SyncPolicy) (*logFile, error) {
+	l := &logFile{filename: filename, policy: policy, done: make(chan struct{})}
+
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	if policy.Mode == SyncInterval {
+		l.wg.Add(1)
+		go l.syncRun()
+	}
+	return l, nil
+}
+
+func (l *logFile) open() error {
+	file, err := os.OpenFile(l.filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		logger.Sugar.Infow("Open log file error.", "filename", l.filename)
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		logger.Sugar.Infow("Stat log file error.", "filename", l.filename)
+		return err
+	}
+
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// Append дописывает строки в журнал одной записью, каждая строка уходит в файл целиком вместе с переносом
+func (l *logFile) Append(lines ...[]byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return l.write(buf.Bytes())
+}
+
+// AppendRaw дописывает в журнал готовые строки вместе с переносами, например хвост другого журнала
+func (l *logFile) AppendRaw(data []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.write(data)
+}
+
+func (l *logFile) write(data []byte) error {
+	n, err := l.file.Write(data)
+	if err != nil {
+		logger.Sugar.Infow("Write log file error.", "filename", l.filename)
+
+		//часть записи могла попасть в файл, отрезаем ее, чтобы следующая запись не склеилась с оборванной строкой
+		if errTruncate := l.file.Truncate(l.size); errTruncate != nil {
+			logger.Sugar.Infow("Truncate log file error.", "filename", l.filename)
+		}
+		return unavailable(err)
+	}
+	l.size += int64(n)
+
+	if l.policy.Mode == SyncAlways {
+		return l.sync()
+	}
+	l.dirty = true
+	return nil
+}
+
+// Size - длина журнала после последней успешной записи
+func (l *logFile) Size() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.size
+}
+
+// Tail читает журнал начиная со смещения offset до конца последней успешной записи
+func (l *logFile) Tail(offset int64) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.Open(l.filename)
+	if err != nil {
+		logger.Sugar.Infow("Open log file error.", "filename", l.filename)
+		return nil, err
+	}
+	defer file.Close()
+
+	data := make([]byte, l.size-offset)
+	if _, err = file.ReadAt(data, offset); err != nil {
+		logger.Sugar.Infow("Read log file error.", "filename", l.filename)
+		return nil, err
+	}
+	return data, nil
+}
+
+// Sync сбрасывает журнал на диск независимо от политики
+func (l *logFile) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.sync()
+}
+
+func (l *logFile) sync() error {
+	if err := l.file.Sync(); err != nil {
+		logger.Sugar.Infow("Sync log file error.", "filename", l.filename)
+		return unavailable(err)
+	}
+	l.dirty = false
+	return nil
+}
+
+func (l *logFile) syncRun() {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(l.policy.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			l.mu.Lock()
+			if l.dirty {
+				l.sync()
+			}
+			l.mu.Unlock()
+		}
+	}
+}
+
+// Replace атомарно подменяет журнал файлом tmpFilename и переоткрывает его на дозапись
+func (l *logFile) Replace(tmpFilename string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpFilename, l.filename); err != nil {
+		logger.Sugar.Infow("Rename log file error.", "filename", l.filename)
+		//старый журнал на месте, продолжаем писать в него
+		if errOpen := l.open(); errOpen != nil {
+			return errors.Join(err, errOpen)
+		}
+		return err
+	}
+
+	l.dirty = false
+	return l.open()
+}
+
+// Close останавливает фоновый сброс и сбрасывает остаток журнала на диск
+func (l *logFile) Close() error {
+	close(l.done)
+	l.wg.Wait()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	return l.file.Close()
+}
+
+// readLog читает журнал построчно и передает строки в apply.
+// Оборванная последняя строка (запись прервалась падением процесса) отрезается от файла, а не считается ошибкой
+func readLog(filename string, apply func([]byte) error) error {
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		logger.Sugar.Infow("Open log file error.", "filename", filename)
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64
+
+	for {
+		line, errRead := reader.ReadBytes('\n')
+		if errRead != nil && !errors.Is(errRead, io.EOF) {
+			logger.Sugar.Infow("Read log file error.", "filename", filename)
+			return errRead
+		}
+
+		complete := errRead == nil
+		data := bytes.TrimSpace(line)
+
+		if len(data) > 0 {
+			if errApply := apply(data); errApply != nil {
+				//испорчена строка в середине журнала - это уже не обрыв записи, дальше читать нельзя
+				if complete && !isLastLine(reader) {
+					logger.Sugar.Infow("Log file corrupted.", "filename", filename, "offset", offset)
+					return errApply
+				}
+
+				logger.Sugar.Infow("Truncated log record dropped.", "filename", filename, "offset", offset)
+				return truncate(file, offset)
+			}
+
+			//последняя строка цела, но без переноса - дописываем его, чтобы следующая запись легла с новой строки
+			if !complete {
+				_, err = file.WriteAt([]byte{'\n'}, offset+int64(len(line)))
+				return err
+			}
+		}
+
+		if !complete {
+			return nil
+		}
+		offset += int64(len(line))
+	}
+}
+
+// isLastLine - в журнале после текущей строки нет данных
+func isLastLine(reader *bufio.Reader) bool {
+	_, err := reader.Peek(1)
+	return err != nil
+}
+
+func truncate(file *os.File, offset int64) error {
+	if err := file.Truncate(offset); err != nil {
+		logger.Sugar.Infow("Truncate log file error.")
+		return err
+	}
+	return file.Sync()
+}
+
+// unavailable - ошибка записи на диск, запрос можно повторить, когда место или диск вернутся
+func unavailable(err error) error {
+	return fmt.Errorf("%w: %w", errs.ErrStorageUnavailable, err)
+}
@@ -0,0 +1,252 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/google/uuid"
+	"sort"
+	"time"
+)
+
+// операции журнала очереди на удаление
+const (
+	outboxOpPut  = "put"  //новая запись или новое состояние записи
+	outboxOpDone = "done" //запись убрана из очереди
+)
+
+// outboxRecord - строка журнала очереди на удаление
+type outboxRecord struct {
+	Op            string          `json:"op"`
+	ID            int64           `json:"id"`
+	JobID         uuid.UUID       `json:"job_id,omitempty"`
+	UserID        uuid.UUID       `json:"user_id,omitempty"`
+	ShortURL      models.ShortURL `json:"short_url,omitempty"`
+	Status        string          `json:"status,omitempty"`
+	Result        string          `json:"result,omitempty"`
+	Attempts      int             `json:"attempts,omitempty"`
+	NextAttemptAt time.Time       `json:"next_attempt_at,omitempty"`
+	LastError     string          `json:"last_error,omitempty"`
+	CreatedAt     time.Time       `json:"created_at,omitempty"`
+	UpdatedAt     time.Time       `json:"updated_at,omitempty"`
+}
+
+func newOutboxRecord(item models.OutboxItem) outboxRecord {
+	return outboxRecord{
+		Op:            outboxOpPut,
+		ID:            item.ID,
+		JobID:         item.JobID,
+		UserID:        item.UserID,
+		ShortURL:      item.ShortURL,
+		Status:        item.Status,
+		Result:        item.Result,
+		Attempts:      item.Attempts,
+		NextAttemptAt: item.NextAttemptAt,
+		LastError:     item.LastError,
+		CreatedAt:     item.CreatedAt,
+		UpdatedAt:     item.UpdatedAt,
+	}
+}
+
+func (r outboxRecord) item() models.OutboxItem {
+	return models.OutboxItem{
+		ID:            r.ID,
+		JobID:         r.JobID,
+		UserID:        r.UserID,
+		ShortURL:      r.ShortURL,
+		Status:        r.Status,
+		Result:        r.Result,
+		Attempts:      r.Attempts,
+		NextAttemptAt: r.NextAttemptAt,
+		LastError:     r.LastError,
+		CreatedAt:     r.CreatedAt,
+		UpdatedAt:     r.UpdatedAt,
+	}
+}
+
+// loadOutbox восстанавливает очередь на удаление из журнала и сжимает его до актуального состояния
+func (s *Storage) loadOutbox() error {
+	s.Outbox = make(map[int64]models.OutboxItem)
+	records := 0
+
+	err := readLog(s.OutboxFilename, func(data []byte) error {
+		var record outboxRecord
+
+		if err := json.Unmarshal(data, &record); err != nil {
+			logger.Sugar.Infow("Unmarshal outbox record error.")
+			return err
+		}
+		records++
+
+		switch record.Op {
+		case outboxOpPut:
+			s.Outbox[record.ID] = record.item()
+		case outboxOpDone:
+			delete(s.Outbox, record.ID)
+		}
+
+		if record.ID > s.outboxID {
+			s.outboxID = record.ID
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	//пользователь получит 202 только после того, как записи окажутся на диске
+	if s.outboxLog, err = openLogFile(s.OutboxFilename, SyncPolicy{Mode: SyncAlways}); err != nil {
+		return err
+	}
+
+	if records == len(s.Outbox) {
+		return nil
+	}
+	return s.compactOutbox()
+}
+
+// compactOutbox переписывает журнал только актуальными записями через временный файл
+func (s *Storage) compactOutbox() error {
+	records := make([]outboxRecord, 0, len(s.Outbox))
+	for _, item := range s.Outbox {
+		records = append(records, newOutboxRecord(item))
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+
+	lines, err := marshalLines(records)
+	if err != nil {
+		return err
+	}
+	return replaceLog(s.outboxLog, lines)
+}
+
+// appendOutbox дописывает записи в журнал
+func (s *Storage) appendOutbox(records []outboxRecord) error {
+	lines, err := marshalLines(records)
+	if err != nil {
+		return err
+	}
+	return s.outboxLog.Append(lines...)
+}
+
+// EnqueueDeletes ставит ссылки в очередь на удаление под заданием jobID
+func (s *Storage) EnqueueDeletes(ctx context.Context, jobID uuid.UUID, items []models.DeletedURLS) error {
+	s.outboxMu.Lock()
+	defer s.outboxMu.Unlock()
+
+	now := time.Now()
+	records := make([]outboxRecord, len(items))
+
+	for i, item := range items {
+		records[i] = newOutboxRecord(models.OutboxItem{
+			ID:            s.outboxID + int64(i) + 1,
+			JobID:         jobID,
+			UserID:        item.UserID,
+			ShortURL:      item.ShortURL,
+			Status:        models.OutboxPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		})
+	}
+
+	if err := s.appendOutbox(records); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		s.Outbox[record.ID] = record.item()
+	}
+	s.outboxID += int64(len(items))
+	return nil
+}
+
+// FetchDeletes - готовые к обработке записи очереди в порядке поступления
+func (s *Storage) FetchDeletes(ctx context.Context, now time.Time, limit int) ([]models.OutboxItem, error) {
+	result := s.selectOutbox(func(item models.OutboxItem) bool {
+		return item.Status == models.OutboxPending && !item.NextAttemptAt.After(now)
+	})
+
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// UpdateDeletes сохраняет новое состояние записей очереди
+func (s *Storage) UpdateDeletes(ctx context.Context, items []models.OutboxItem) error {
+	s.outboxMu.Lock()
+	defer s.outboxMu.Unlock()
+
+	//владельца записи меняет только MergeUser, обработчик очереди мог прочитать запись до передачи
+	updated := make([]models.OutboxItem, len(items))
+	records := make([]outboxRecord, len(items))
+	for i, item := range items {
+		if current, ok := s.Outbox[item.ID]; ok {
+			item.UserID = current.UserID
+		}
+		updated[i] = item
+		records[i] = newOutboxRecord(item)
+	}
+
+	if err := s.appendOutbox(records); err != nil {
+		return err
+	}
+
+	for _, item := range updated {
+		s.Outbox[item.ID] = item
+	}
+	return nil
+}
+
+// GetDeleteJob - записи очереди, относящиеся к заданию jobID
+func (s *Storage) GetDeleteJob(ctx context.Context, jobID uuid.UUID) ([]models.OutboxItem, error) {
+	return s.selectOutbox(func(item models.OutboxItem) bool {
+		return item.JobID == jobID
+	}), nil
+}
+
+// ListDeadDeletes - записи пользователя, исчерпавшие попытки удаления
+func (s *Storage) ListDeadDeletes(ctx context.Context, userID uuid.UUID) ([]models.OutboxItem, error) {
+	return s.selectOutbox(func(item models.OutboxItem) bool {
+		return item.Status == models.OutboxDead && item.UserID == userID
+	}), nil
+}
+
+// PurgeDeletes убирает обработанные записи, последний раз изменявшиеся раньше before, и сжимает журнал
+func (s *Storage) PurgeDeletes(ctx context.Context, before time.Time) (int64, error) {
+	s.outboxMu.Lock()
+	defer s.outboxMu.Unlock()
+
+	var count int64
+
+	for id, item := range s.Outbox {
+		if item.Status == models.OutboxDone && item.UpdatedAt.Before(before) {
+			delete(s.Outbox, id)
+			count++
+		}
+	}
+
+	if count == 0 {
+		return 0, nil
+	}
+	return count, s.compactOutbox()
+}
+
+// selectOutbox - записи очереди, подходящие под условие, в порядке поступления
+func (s *Storage) selectOutbox(match func(models.OutboxItem) bool) []models.OutboxItem {
+	s.outboxMu.Lock()
+	defer s.outboxMu.Unlock()
+
+	var result []models.OutboxItem
+
+	for _, item := range s.Outbox {
+		if match(item) {
+			result = append(result, item)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
@@ -0,0 +1,199 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/google/uuid"
+	"sort"
+	"time"
+)
+
+// операции журнала команд
+const (
+	teamOpCreate = "team"   //новая команда
+	teamOpMember = "member" //участник добавлен или сменил роль
+	teamOpLeave  = "leave"  //участник исключен
+)
+
+// teamRecord - строка журнала команд
+type teamRecord struct {
+	Op        string      `json:"op"`
+	TeamID    uuid.UUID   `json:"team_id"`
+	Name      string      `json:"name,omitempty"`
+	UserID    uuid.UUID   `json:"user_id"`
+	Role      models.Role `json:"role,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// loadTeams восстанавливает команды и участников из журнала
+func (s *Storage) loadTeams() error {
+	s.teams = make(map[uuid.UUID]models.Team)
+	s.members = make(map[uuid.UUID]map[uuid.UUID]models.TeamMember)
+
+	err := readLog(s.TeamsFilename, func(data []byte) error {
+		var record teamRecord
+
+		if err := json.Unmarshal(data, &record); err != nil {
+			logger.Sugar.Infow("Unmarshal team record error.")
+			return err
+		}
+
+		s.applyTeam(record)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	//выданные и отнятые права должны оказаться на диске до ответа пользователю
+	s.teamsLog, err = openLogFile(s.TeamsFilename, SyncPolicy{Mode: SyncAlways})
+	return err
+}
+
+// applyTeam применяет строку журнала команд к индексам
+func (s *Storage) applyTeam(record teamRecord) {
+	switch record.Op {
+	case teamOpCreate:
+		s.teams[record.TeamID] = models.Team{ID: record.TeamID, Name: record.Name, CreatedAt: record.CreatedAt}
+		s.members[record.TeamID] = make(map[uuid.UUID]models.TeamMember)
+	case teamOpMember:
+		if members, ok := s.members[record.TeamID]; ok {
+			members[record.UserID] = models.TeamMember{TeamID: record.TeamID, UserID: record.UserID, Role: record.Role, CreatedAt: record.CreatedAt}
+		}
+	case teamOpLeave:
+		delete(s.members[record.TeamID], record.UserID)
+	}
+}
+
+// appendTeams дописывает строки в журнал команд и применяет их
+func (s *Storage) appendTeams(records ...teamRecord) error {
+	lines, err := marshalLines(records)
+	if err != nil {
+		return err
+	}
+
+	if err = s.teamsLog.Append(lines...); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		s.applyTeam(record)
+	}
+	return nil
+}
+
+// CreateTeam сохраняет новую команду вместе с ее первым владельцем
+func (s *Storage) CreateTeam(ctx context.Context, team models.Team, owner models.TeamMember) error {
+	s.teamsMu.Lock()
+	defer s.teamsMu.Unlock()
+
+	return s.appendTeams(
+		teamRecord{Op: teamOpCreate, TeamID: team.ID, Name: team.Name, CreatedAt: team.CreatedAt},
+		teamRecord{Op: teamOpMember, TeamID: team.ID, UserID: owner.UserID, Role: owner.Role, CreatedAt: owner.CreatedAt},
+	)
+}
+
+// ListTeams - команды пользователя с его ролью в порядке создания
+func (s *Storage) ListTeams(ctx context.Context, userID uuid.UUID) ([]models.Team, error) {
+	s.teamsMu.RLock()
+	defer s.teamsMu.RUnlock()
+
+	var result []models.Team
+	for teamID, members := range s.members {
+		if member, ok := members[userID]; ok {
+			team := s.teams[teamID]
+			team.Role = member.Role
+			result = append(result, team)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result, nil
+}
+
+// SaveTeamMember добавляет участника или меняет его роль, момент вступления не меняется
+func (s *Storage) SaveTeamMember(ctx context.Context, member models.TeamMember) error {
+	s.teamsMu.Lock()
+	defer s.teamsMu.Unlock()
+
+	members, ok := s.members[member.TeamID]
+	if !ok {
+		return errs.ErrTeamNotFound
+	}
+
+	if member.Role != models.RoleOwner && lastOwner(members, member.UserID) {
+		return errs.ErrTeamLastOwner
+	}
+
+	if current, exists := members[member.UserID]; exists {
+		member.CreatedAt = current.CreatedAt
+	}
+
+	return s.appendTeams(teamRecord{Op: teamOpMember, TeamID: member.TeamID, UserID: member.UserID, Role: member.Role, CreatedAt: member.CreatedAt})
+}
+
+// GetTeamMember - участие пользователя в команде
+func (s *Storage) GetTeamMember(ctx context.Context, teamID, userID uuid.UUID) (models.TeamMember, error) {
+	s.teamsMu.RLock()
+	defer s.teamsMu.RUnlock()
+
+	member, ok := s.members[teamID][userID]
+	if !ok {
+		return models.TeamMember{}, errs.ErrTeamMemberNotFound
+	}
+	return member, nil
+}
+
+// ListTeamMembers - участники команды в порядке вступления
+func (s *Storage) ListTeamMembers(ctx context.Context, teamID uuid.UUID) ([]models.TeamMember, error) {
+	s.teamsMu.RLock()
+	defer s.teamsMu.RUnlock()
+
+	result := make([]models.TeamMember, 0, len(s.members[teamID]))
+	for _, member := range s.members[teamID] {
+		result = append(result, member)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result, nil
+}
+
+// DeleteTeamMember исключает пользователя из команды, созданные им ссылки остаются у команды
+func (s *Storage) DeleteTeamMember(ctx context.Context, teamID, userID uuid.UUID) error {
+	s.teamsMu.Lock()
+	defer s.teamsMu.Unlock()
+
+	if _, ok := s.members[teamID][userID]; !ok {
+		return errs.ErrTeamMemberNotFound
+	}
+	if lastOwner(s.members[teamID], userID) {
+		return errs.ErrTeamLastOwner
+	}
+
+	return s.appendTeams(teamRecord{Op: teamOpLeave, TeamID: teamID, UserID: userID, CreatedAt: time.Now().UTC()})
+}
+
+// lastOwner - userID единственный владелец команды, понизить или исключить его нельзя
+func lastOwner(members map[uuid.UUID]models.TeamMember, userID uuid.UUID) bool {
+	if members[userID].Role != models.RoleOwner {
+		return false
+	}
+
+	for id, member := range members {
+		if id != userID && member.Role == models.RoleOwner {
+			return false
+		}
+	}
+	return true
+}
+
+// ListByTeamID - ссылки команды в порядке сохранения
+func (s *Storage) ListByTeamID(ctx context.Context, host models.Host, teamID uuid.UUID) ([]models.ShortenURL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.list(host, s.teamLinks[teamID], teamID)
+}
@@ -0,0 +1,223 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/google/uuid"
+	"time"
+)
+
+// userRecord - строка журнала пользователей
+type userRecord struct {
+	ID           uuid.UUID `json:"id"`
+	Login        string    `json:"login"`
+	PasswordHash string    `json:"password_hash"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// loadUsers восстанавливает пользователей из журнала
+func (s *Storage) loadUsers() error {
+	s.accounts = make(map[uuid.UUID]models.User)
+	s.logins = make(map[string]uuid.UUID)
+
+	err := readLog(s.UsersFilename, func(data []byte) error {
+		var record userRecord
+
+		if err := json.Unmarshal(data, &record); err != nil {
+			logger.Sugar.Infow("Unmarshal user record error.")
+			return err
+		}
+
+		s.accounts[record.ID] = models.User(record)
+		s.logins[record.Login] = record.ID
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	//пользователь, получивший ответ о регистрации, не должен пропасть после падения
+	s.usersLog, err = openLogFile(s.UsersFilename, SyncPolicy{Mode: SyncAlways})
+	return err
+}
+
+// CreateUser сохраняет нового пользователя, логин должен быть свободен
+func (s *Storage) CreateUser(ctx context.Context, user models.User) error {
+	s.accountMu.Lock()
+	defer s.accountMu.Unlock()
+
+	if _, ok := s.logins[user.Login]; ok {
+		return errs.ErrUserExists
+	}
+	if _, ok := s.accounts[user.ID]; ok {
+		return errs.ErrUserExists
+	}
+
+	lines, err := marshalLines([]userRecord{userRecord(user)})
+	if err != nil {
+		return err
+	}
+
+	if err = s.usersLog.Append(lines...); err != nil {
+		return err
+	}
+
+	s.accounts[user.ID] = user
+	s.logins[user.Login] = user.ID
+	return nil
+}
+
+// GetUserByLogin - пользователь по логину
+func (s *Storage) GetUserByLogin(ctx context.Context, login string) (models.User, error) {
+	s.accountMu.RLock()
+	defer s.accountMu.RUnlock()
+
+	id, ok := s.logins[login]
+	if !ok {
+		return models.User{}, errs.ErrUserNotFound
+	}
+	return s.accounts[id], nil
+}
+
+// GetUserByID - пользователь по идентификатору
+func (s *Storage) GetUserByID(ctx context.Context, id uuid.UUID) (models.User, error) {
+	s.accountMu.RLock()
+	defer s.accountMu.RUnlock()
+
+	user, ok := s.accounts[id]
+	if !ok {
+		return models.User{}, errs.ErrUserNotFound
+	}
+	return user, nil
+}
+
+// MergeUser передает ссылки, API-ключи, участие в командах и задания на удаление пользователя from пользователю to,
+// возвращает число перенесенных ссылок. Передача ссылок записывается в журнал ссылок строками own и сбрасывается на диск до ответа
+func (s *Storage) MergeUser(ctx context.Context, from, to uuid.UUID) (int64, error) {
+	merged, err := s.mergeURLs(from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = s.mergeAPIKeys(from, to); err != nil {
+		return merged, err
+	}
+	if err = s.mergeTeams(from, to); err != nil {
+		return merged, err
+	}
+	return merged, s.mergeOutbox(from, to)
+}
+
+func (s *Storage) mergeAPIKeys(from, to uuid.UUID) error {
+	s.apiKeysMu.Lock()
+	defer s.apiKeysMu.Unlock()
+
+	for _, key := range s.apiKeys {
+		if key.UserID != from {
+			continue
+		}
+
+		key.UserID = to
+		if err := s.putAPIKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeTeams заменяет участие from участием to, если оба пользователя в одной команде, остается старшая роль
+func (s *Storage) mergeTeams(from, to uuid.UUID) error {
+	s.teamsMu.Lock()
+	defer s.teamsMu.Unlock()
+
+	var records []teamRecord
+	for teamID, members := range s.members {
+		member, ok := members[from]
+		if !ok {
+			continue
+		}
+
+		member.UserID = to
+		if current, exists := members[to]; exists {
+			member = current.Merge(member)
+		}
+
+		records = append(records,
+			teamRecord{Op: teamOpLeave, TeamID: teamID, UserID: from, CreatedAt: time.Now().UTC()},
+			teamRecord{Op: teamOpMember, TeamID: teamID, UserID: to, Role: member.Role, CreatedAt: member.CreatedAt},
+		)
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+	return s.appendTeams(records...)
+}
+
+func (s *Storage) mergeOutbox(from, to uuid.UUID) error {
+	s.outboxMu.Lock()
+	defer s.outboxMu.Unlock()
+
+	var items []models.OutboxItem
+	for _, item := range s.Outbox {
+		if item.UserID == from {
+			item.UserID = to
+			items = append(items, item)
+		}
+	}
+
+	if len(items) == 0 {
+		return nil
+	}
+
+	records := make([]outboxRecord, len(items))
+	for i, item := range items {
+		records[i] = newOutboxRecord(item)
+	}
+
+	if err := s.appendOutbox(records); err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		s.Outbox[item.ID] = item
+	}
+	return nil
+}
+
+func (s *Storage) mergeURLs(from, to uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	codes := s.users[from]
+	if len(codes) == 0 {
+		return 0, nil
+	}
+
+	records := make([]ShortenURL, len(codes))
+	for i, code := range codes {
+		records[i] = ShortenURL{Op: opOwn, ShortURL: code, UserID: to}
+	}
+
+	if err := s.appendLog(records...); err != nil {
+		return 0, err
+	}
+	if err := s.log.Sync(); err != nil {
+		return 0, err
+	}
+
+	//индексы меняем целиком, а не построчно через apply
+	for _, code := range codes {
+		row := s.urls[code]
+		row.UserID = to
+		s.urls[code] = row
+	}
+	s.users[to] = append(s.users[to], codes...)
+	delete(s.users, from)
+
+	s.requestCompact()
+	return int64(len(codes)), nil
+}
@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"context"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/google/uuid"
+	"slices"
+	"sort"
+	"time"
+)
+
+// SaveAPIKey сохраняет новый API-ключ
+func (s *Storage) SaveAPIKey(ctx context.Context, key models.APIKey) error {
+	s.apiKeysMu.Lock()
+	defer s.apiKeysMu.Unlock()
+
+	key.Scopes = slices.Clone(key.Scopes)
+	s.apiKeys[key.Hash] = key
+	return nil
+}
+
+// GetAPIKey - ключ по хешу, в том числе отозванный
+func (s *Storage) GetAPIKey(ctx context.Context, hash string) (models.APIKey, error) {
+	s.apiKeysMu.RLock()
+	defer s.apiKeysMu.RUnlock()
+
+	key, ok := s.apiKeys[hash]
+	if !ok {
+		return models.APIKey{}, errs.ErrAPIKeyNotFound
+	}
+	key.Scopes = slices.Clone(key.Scopes)
+	return key, nil
+}
+
+// ListAPIKeys - ключи пользователя в порядке создания
+func (s *Storage) ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]models.APIKey, error) {
+	s.apiKeysMu.RLock()
+	defer s.apiKeysMu.RUnlock()
+
+	var result []models.APIKey
+	for _, key := range s.apiKeys {
+		if key.UserID == userID {
+			key.Scopes = slices.Clone(key.Scopes)
+			result = append(result, key)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result, nil
+}
+
+// RevokeAPIKey отзывает ключ пользователя, повторный отзыв не меняет момент отзыва
+func (s *Storage) RevokeAPIKey(ctx context.Context, userID, keyID uuid.UUID, now time.Time) error {
+	s.apiKeysMu.Lock()
+	defer s.apiKeysMu.Unlock()
+
+	for hash, key := range s.apiKeys {
+		if key.ID != keyID || key.UserID != userID {
+			continue
+		}
+
+		if key.RevokedAt == nil {
+			key.RevokedAt = &now
+			s.apiKeys[hash] = key
+		}
+		return nil
+	}
+	return errs.ErrAPIKeyNotFound
+}
@@ -6,49 +6,189 @@ import (
 	errs "github.com/dubrovsky1/url-shortener/internal/errors"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
 	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/dubrovsky1/url-shortener/internal/stats"
 	"github.com/google/uuid"
+	"hash/fnv"
 	"net/url"
-
-	"github.com/dubrovsky1/url-shortener/internal/generator"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-type Storage struct {
+// количество сегментов каждой карты, запросы к разным сегментам не блокируют друг друга
+const shardCount = 32
+
+// urlShard - сегмент ссылок по короткому коду
+type urlShard struct {
+	mu   sync.RWMutex
 	urls map[models.ShortURL]models.ShortenURL
 }
 
+// originalShard - сегмент обратного индекса: оригинальный URL -> короткий код
+type originalShard struct {
+	mu        sync.Mutex
+	originals map[models.OriginalURL]models.ShortURL
+}
+
+// userShard - сегмент индекса ссылок пользователя
+type userShard struct {
+	mu    sync.RWMutex
+	codes map[uuid.UUID][]models.ShortURL
+}
+
+// Storage - потокобезопасное хранилище в памяти.
+// Порядок захвата блокировок: originalShard -> urlShard -> userShard -> teamsMu, обратного порядка нет нигде
+type Storage struct {
+	urls      [shardCount]urlShard
+	originals [shardCount]originalShard
+	users     [shardCount]userShard
+	clicks    map[models.ShortURL][]models.Click
+	clicksMu  sync.RWMutex
+	lastID    int64
+	outbox    map[int64]models.OutboxItem //очередь на удаление, обработчик работает в отдельной горутине
+	outboxID  int64
+	outboxMu  sync.Mutex
+	apiKeys   map[string]models.APIKey //API-ключи по хешу
+	apiKeysMu sync.RWMutex
+	accounts  map[uuid.UUID]models.User //зарегистрированные пользователи
+	logins    map[string]uuid.UUID
+	accountMu sync.RWMutex
+	teams     map[uuid.UUID]models.Team                     //команды
+	members   map[uuid.UUID]map[uuid.UUID]models.TeamMember //участники по команде и пользователю
+	teamLinks map[uuid.UUID][]models.ShortURL               //коды ссылок команды в порядке сохранения
+	teamsMu   sync.RWMutex
+}
+
 func New() *Storage {
-	return &Storage{make(map[models.ShortURL]models.ShortenURL)}
+	s := &Storage{
+		clicks:    make(map[models.ShortURL][]models.Click),
+		outbox:    make(map[int64]models.OutboxItem),
+		apiKeys:   make(map[string]models.APIKey),
+		accounts:  make(map[uuid.UUID]models.User),
+		logins:    make(map[string]uuid.UUID),
+		teams:     make(map[uuid.UUID]models.Team),
+		members:   make(map[uuid.UUID]map[uuid.UUID]models.TeamMember),
+		teamLinks: make(map[uuid.UUID][]models.ShortURL),
+	}
+
+	for i := 0; i < shardCount; i++ {
+		s.urls[i].urls = make(map[models.ShortURL]models.ShortenURL)
+		s.originals[i].originals = make(map[models.OriginalURL]models.ShortURL)
+		s.users[i].codes = make(map[uuid.UUID][]models.ShortURL)
+	}
+	return s
 }
 
 func (s *Storage) Close() error {
 	return nil
 }
 
+func shardIndex(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % shardCount)
+}
+
+func (s *Storage) urlShard(shortURL models.ShortURL) *urlShard {
+	return &s.urls[shardIndex(string(shortURL))]
+}
+
+func (s *Storage) originalShard(originalURL models.OriginalURL) *originalShard {
+	return &s.originals[shardIndex(string(originalURL))]
+}
+
+func (s *Storage) userShard(userID uuid.UUID) *userShard {
+	return &s.users[shardIndex(userID.String())]
+}
+
 func (s *Storage) SaveURL(ctx context.Context, item models.ShortenURL) (models.ShortURL, error) {
+	return s.save(item)
+}
+
+// save атомарно проверяет уникальность оригинальной ссылки и кода и сохраняет ссылку во все индексы
+func (s *Storage) save(item models.ShortenURL) (models.ShortURL, error) {
+	//пока держим сегмент оригинальной ссылки, ту же ссылку никто другой сохранить не сможет
+	ors := s.originalShard(item.OriginalURL)
+	ors.mu.Lock()
+	defer ors.mu.Unlock()
+
 	//поиск уже сохраненной оригинальной ссылки
-	shortURL, err := s.GetShortURL(ctx, item.OriginalURL)
-	if err != nil {
-		return shortURL, err
+	if shortURL, ok := ors.originals[item.OriginalURL]; ok {
+		return shortURL, errs.ErrUniqueIndex
+	}
+
+	//короткая ссылка (например, пользовательский alias) уже занята
+	us := s.urlShard(item.ShortURL)
+	us.mu.Lock()
+	if _, ok := us.urls[item.ShortURL]; ok {
+		us.mu.Unlock()
+		return "", errs.ErrShortURLExists
 	}
 
 	//запоминаем url, соответствующий короткой ссылке
-	s.urls[item.ShortURL] = item
+	us.urls[item.ShortURL] = item
+	us.mu.Unlock()
+
+	ors.originals[item.OriginalURL] = item.ShortURL
+
+	uss := s.userShard(item.UserID)
+	uss.mu.Lock()
+	uss.codes[item.UserID] = append(uss.codes[item.UserID], item.ShortURL)
+	uss.mu.Unlock()
+
+	if item.TeamID != uuid.Nil {
+		s.teamsMu.Lock()
+		s.teamLinks[item.TeamID] = append(s.teamLinks[item.TeamID], item.ShortURL)
+		s.teamsMu.Unlock()
+	}
 
 	return item.ShortURL, nil
 }
 
+// unsave откатывает ссылку, сохраненную save
+func (s *Storage) unsave(item models.ShortenURL) {
+	ors := s.originalShard(item.OriginalURL)
+	ors.mu.Lock()
+	defer ors.mu.Unlock()
+
+	us := s.urlShard(item.ShortURL)
+	us.mu.Lock()
+	delete(us.urls, item.ShortURL)
+	us.mu.Unlock()
+
+	if ors.originals[item.OriginalURL] == item.ShortURL {
+		delete(ors.originals, item.OriginalURL)
+	}
+
+	uss := s.userShard(item.UserID)
+	uss.mu.Lock()
+	if i := slices.Index(uss.codes[item.UserID], item.ShortURL); i >= 0 {
+		uss.codes[item.UserID] = slices.Delete(uss.codes[item.UserID], i, i+1)
+	}
+	uss.mu.Unlock()
+}
+
 func (s *Storage) GetURL(ctx context.Context, shortURL models.ShortURL) (models.ShortenURL, error) {
-	if _, ok := s.urls[shortURL]; !ok {
-		return models.ShortenURL{}, errors.New("the short url is missing")
+	us := s.urlShard(shortURL)
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+
+	row, ok := us.urls[shortURL]
+	if !ok {
+		return models.ShortenURL{}, errs.ErrShortURLNotFound
 	}
-	return s.urls[shortURL], nil
+	return row, nil
 }
 
 func (s *Storage) GetShortURL(ctx context.Context, originalURL models.OriginalURL) (models.ShortURL, error) {
-	for su, ou := range s.urls {
-		if ou.OriginalURL == originalURL {
-			return su, errs.ErrUniqueIndex
-		}
+	ors := s.originalShard(originalURL)
+	ors.mu.Lock()
+	defer ors.mu.Unlock()
+
+	if su, ok := ors.originals[originalURL]; ok {
+		return su, errs.ErrUniqueIndex
 	}
 	return "", nil
 }
@@ -56,36 +196,54 @@ func (s *Storage) GetShortURL(ctx context.Context, originalURL models.OriginalUR
 func (s *Storage) InsertBatch(ctx context.Context, batch []models.BatchRequest, host models.Host, userID uuid.UUID) ([]models.BatchResponse, error) {
 	var result []models.BatchResponse
 
+	//коды, сохраненные этой пачкой: повтор URL внутри пачки конфликтом не считается
+	added := make(map[models.ShortURL]bool)
+
+	//ссылки, сохраненные этой пачкой, в порядке сохранения для отката
+	var saved []models.ShortenURL
+
+	now := time.Now()
+
 	for _, row := range batch {
-		var err error
+		s.expireOriginal(models.OriginalURL(row.URL), now)
 
-		var curItem = models.ShortenURL{
-			OriginalURL: models.OriginalURL(row.URL),
-			UserID:      userID,
+		//код сгенерирован сервисом, при коллизии сервис повторит пачку с новыми кодами,
+		//уже сохраненная оригинальная ссылка возвращается со своим кодом
+		item := models.ShortenURL{
+			OriginalURL:  models.OriginalURL(row.URL),
+			ShortURL:     row.ShortURL,
+			UserID:       userID,
+			ExpiresAt:    row.ExpiresAt,
+			RedirectType: row.RedirectType,
+			ForwardQuery: row.ForwardQuery,
 		}
 
-		//поиск уже сохраненной оригинальной ссылки
-		curItem.ShortURL, err = s.GetShortURL(ctx, curItem.OriginalURL)
+		shortURL, err := s.save(item)
+		if err != nil && !errors.Is(err, errs.ErrUniqueIndex) {
+			//пачка сохраняется целиком или никак, иначе при повторе строки этой пачки вернулись бы конфликтами
+			for i := len(saved) - 1; i >= 0; i-- {
+				s.unsave(saved[i])
+			}
+			return nil, err
+		}
 
 		if err == nil {
-			//гененрируем короткую ссылку
-			curItem.ShortURL = models.ShortURL(generator.GetShortURL())
-
-			//запоминаем url, соответствующий короткой ссылке
-			s.urls[curItem.ShortURL] = curItem
+			added[shortURL] = true
+			saved = append(saved, item)
 		}
 
 		//составляем результирующий сокращённый URL и добавляем в массив
-		resultShortURL := "http://" + string(host) + "/" + string(curItem.ShortURL)
+		resultShortURL := "http://" + string(host) + "/" + string(shortURL)
 
 		if _, e := url.Parse(resultShortURL); e != nil {
-			logger.Sugar.Infow("Postgresql InsertBatch. Not result URL.")
+			logger.Sugar.Infow("Memory InsertBatch. Not result URL.")
 			return nil, e
 		}
 
 		r := models.BatchResponse{
 			CorrelationID: row.CorrelationID,
 			ShortURL:      resultShortURL,
+			Conflict:      !added[shortURL],
 		}
 
 		result = append(result, r)
@@ -94,42 +252,170 @@ func (s *Storage) InsertBatch(ctx context.Context, batch []models.BatchRequest,
 	return result, nil
 }
 
+// ListByUserID - личные ссылки пользователя, ссылки команд в список не входят
 func (s *Storage) ListByUserID(ctx context.Context, host models.Host, userID uuid.UUID) ([]models.ShortenURL, error) {
+	//копируем коды пользователя, чтобы не держать его сегмент во время чтения ссылок
+	uss := s.userShard(userID)
+	uss.mu.RLock()
+	codes := append([]models.ShortURL(nil), uss.codes[userID]...)
+	uss.mu.RUnlock()
+
+	return s.list(ctx, host, codes, uuid.Nil)
+}
+
+// list - ссылки по кодам, принадлежащие команде teamID (uuid.Nil - личные), с полным адресом короткой ссылки
+func (s *Storage) list(ctx context.Context, host models.Host, codes []models.ShortURL, teamID uuid.UUID) ([]models.ShortenURL, error) {
 	var result []models.ShortenURL
 
-	for _, row := range s.urls {
-		if row.UserID == userID {
+	for _, code := range codes {
+		row, err := s.GetURL(ctx, code)
+		if err != nil || row.TeamID != teamID {
+			continue
+		}
 
-			//составляем результирующий сокращённый URL и добавляем в массив
-			resultShortURL := "http://" + string(host) + "/" + string(row.ShortURL)
+		//составляем результирующий сокращённый URL и добавляем в массив
+		resultShortURL := "http://" + string(host) + "/" + string(row.ShortURL)
 
-			if _, e := url.Parse(resultShortURL); e != nil {
-				logger.Sugar.Infow("Postgresql ListByUserID. Not result URL.")
-				return nil, e
-			}
+		if _, e := url.Parse(resultShortURL); e != nil {
+			logger.Sugar.Infow("Memory list. Not result URL.")
+			return nil, e
+		}
 
-			var curItem = models.ShortenURL{
-				OriginalURL: row.OriginalURL,
-				ShortURL:    models.ShortURL(resultShortURL),
-			}
-			result = append(result, curItem)
+		var curItem = models.ShortenURL{
+			OriginalURL:  row.OriginalURL,
+			ShortURL:     models.ShortURL(resultShortURL),
+			IsDel:        row.IsDel,
+			ExpiresAt:    row.ExpiresAt,
+			RedirectType: row.RedirectType,
+			ForwardQuery: row.ForwardQuery,
 		}
+		result = append(result, curItem)
 	}
 	return result, nil
 }
 
-func (s *Storage) DeleteURL(ctx context.Context, deletedItems []models.DeletedURLS) error {
+func (s *Storage) DeleteURL(ctx context.Context, deletedItems []models.DeletedURLS) ([]models.DeletedURLS, error) {
+	var result []models.DeletedURLS
+
 	for _, item := range deletedItems {
-		if _, ok := s.urls[item.ShortURL]; ok {
-			deleted := models.ShortenURL{
-				ID:          s.urls[item.ShortURL].ID,
-				OriginalURL: s.urls[item.ShortURL].OriginalURL,
-				ShortURL:    s.urls[item.ShortURL].ShortURL,
-				UserID:      s.urls[item.ShortURL].UserID,
-				IsDel:       true,
+		us := s.urlShard(item.ShortURL)
+		us.mu.Lock()
+
+		//удалить можно только свою и еще не удаленную ссылку
+		row, ok := us.urls[item.ShortURL]
+		if ok && row.DeletableBy(item) && !row.IsDel {
+			row.IsDel = true
+			us.urls[item.ShortURL] = row
+			result = append(result, item)
+		} else {
+			ok = false
+		}
+		us.mu.Unlock()
+
+		if ok {
+			s.forgetOriginal(row.OriginalURL, row.ShortURL)
+		}
+	}
+	return result, nil
+}
+
+// forgetOriginal убирает удаленную ссылку из индекса оригинальных URL, чтобы тот же URL можно было сократить заново.
+// Сегмент оригинальной ссылки захватывается, когда сегмент кода уже отпущен, поэтому проверяем, что индекс указывает на этот код
+func (s *Storage) forgetOriginal(originalURL models.OriginalURL, shortURL models.ShortURL) {
+	ors := s.originalShard(originalURL)
+	ors.mu.Lock()
+	if ors.originals[originalURL] == shortURL {
+		delete(ors.originals, originalURL)
+	}
+	ors.mu.Unlock()
+}
+
+// expireOriginal помечает удаленной истекшую, но еще не обработанную ссылку на originalURL,
+// чтобы пачка сократила URL заново, а не вернула мертвый код конфликтом
+func (s *Storage) expireOriginal(originalURL models.OriginalURL, now time.Time) {
+	ors := s.originalShard(originalURL)
+	ors.mu.Lock()
+	defer ors.mu.Unlock()
+
+	shortURL, ok := ors.originals[originalURL]
+	if !ok {
+		return
+	}
+
+	us := s.urlShard(shortURL)
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	row, ok := us.urls[shortURL]
+	if !ok || row.IsDel || !row.IsExpired(now) {
+		return
+	}
+
+	row.IsDel = true
+	us.urls[shortURL] = row
+	delete(ors.originals, originalURL)
+}
+
+func (s *Storage) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	var expired []models.ShortenURL
+
+	for i := range s.urls {
+		us := &s.urls[i]
+		us.mu.Lock()
+
+		for su, row := range us.urls {
+			if !row.IsDel && row.IsExpired(now) {
+				row.IsDel = true
+				us.urls[su] = row
+				expired = append(expired, row)
 			}
-			s.urls[item.ShortURL] = deleted
 		}
+		us.mu.Unlock()
+	}
+
+	for _, row := range expired {
+		s.forgetOriginal(row.OriginalURL, row.ShortURL)
+	}
+	return int64(len(expired)), nil
+}
+
+func (s *Storage) SaveClicks(ctx context.Context, clicks []models.Click) error {
+	s.clicksMu.Lock()
+	defer s.clicksMu.Unlock()
+
+	for _, click := range clicks {
+		s.clicks[click.ShortURL] = append(s.clicks[click.ShortURL], click)
 	}
 	return nil
 }
+
+func (s *Storage) ListClicks(ctx context.Context, shortURL models.ShortURL, from, to time.Time) ([]models.Click, error) {
+	s.clicksMu.RLock()
+	defer s.clicksMu.RUnlock()
+
+	var result []models.Click
+
+	for _, click := range s.clicks[shortURL] {
+		if !click.ClickedAt.Before(from) && click.ClickedAt.Before(to) {
+			result = append(result, click)
+		}
+	}
+
+	//события могли прийти пачками не по порядку, отдаем их по времени перехода, как и база
+	sort.SliceStable(result, func(i, j int) bool { return result[i].ClickedAt.Before(result[j].ClickedAt) })
+	return result, nil
+}
+
+// ClickStats агрегирует события периода, уже лежащие в памяти
+func (s *Storage) ClickStats(ctx context.Context, shortURL models.ShortURL, params models.StatsParams) (models.Stats, error) {
+	clicks, err := s.ListClicks(ctx, shortURL, params.From, params.To)
+	if err != nil {
+		return models.Stats{}, err
+	}
+	return stats.Build(shortURL, params, clicks), nil
+}
+
+// NextID - счетчик для стратегий генерации кодов на основе числового идентификатора
+func (s *Storage) NextID(ctx context.Context) (int64, error) {
+	return atomic.AddInt64(&s.lastID, 1), nil
+}
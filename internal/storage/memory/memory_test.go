@@ -0,0 +1,136 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStorage(t *testing.T) {
+	logger.Initialize()
+	ctx := context.Background()
+
+	t.Run("Memory. Indexes in both directions.", func(t *testing.T) {
+		s := New()
+		userID := uuid.New()
+
+		shortURL, err := s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk", UserID: userID})
+		require.NoError(t, err)
+		assert.Equal(t, models.ShortURL("jB9Wbk"), shortURL)
+
+		row, err := s.GetURL(ctx, "jB9Wbk")
+		require.NoError(t, err)
+		assert.Equal(t, models.OriginalURL("https://practicum.yandex.ru/"), row.OriginalURL)
+
+		shortURL, err = s.GetShortURL(ctx, "https://practicum.yandex.ru/")
+		assert.ErrorIs(t, err, errs.ErrUniqueIndex)
+		assert.Equal(t, models.ShortURL("jB9Wbk"), shortURL)
+
+		list, err := s.ListByUserID(ctx, "localhost:8080", userID)
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		assert.Equal(t, models.ShortURL("http://localhost:8080/jB9Wbk"), list[0].ShortURL)
+
+		_, err = s.GetURL(ctx, "abcdef")
+		assert.ErrorIs(t, err, errs.ErrShortURLNotFound)
+	})
+
+	t.Run("Memory. Same original url saved concurrently.", func(t *testing.T) {
+		s := New()
+
+		const workers = 50
+		var saved atomic.Int32
+		codes := make([]models.ShortURL, workers)
+
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				shortURL, err := s.SaveURL(ctx, models.ShortenURL{
+					OriginalURL: "https://practicum.yandex.ru/",
+					ShortURL:    models.ShortURL(fmt.Sprintf("code%d", i)),
+					UserID:      uuid.New(),
+				})
+				if err == nil {
+					saved.Add(1)
+				} else {
+					assert.ErrorIs(t, err, errs.ErrUniqueIndex)
+				}
+				codes[i] = shortURL
+			}(i)
+		}
+		wg.Wait()
+
+		//сохраняется ровно одна ссылка, остальные получают ее код
+		assert.Equal(t, int32(1), saved.Load())
+		for _, code := range codes {
+			assert.Equal(t, codes[0], code)
+		}
+	})
+
+	t.Run("Memory. Parallel load.", func(t *testing.T) {
+		s := New()
+
+		const workers = 16
+		const perWorker = 200
+
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				userID := uuid.New()
+
+				for i := 0; i < perWorker; i++ {
+					code := models.ShortURL(fmt.Sprintf("w%di%d", w, i))
+					original := models.OriginalURL(fmt.Sprintf("https://example.com/%d/%d", w, i))
+
+					_, err := s.SaveURL(ctx, models.ShortenURL{OriginalURL: original, ShortURL: code, UserID: userID})
+					assert.NoError(t, err)
+
+					_, err = s.GetURL(ctx, code)
+					assert.NoError(t, err)
+
+					_, err = s.GetShortURL(ctx, original)
+					assert.True(t, errors.Is(err, errs.ErrUniqueIndex))
+
+					if i%10 == 0 {
+						_, err = s.ListByUserID(ctx, "localhost:8080", userID)
+						assert.NoError(t, err)
+						_, err = s.DeleteURL(ctx, []models.DeletedURLS{{UserID: userID, ShortURL: code}})
+						assert.NoError(t, err)
+						assert.NoError(t, s.SaveClicks(ctx, []models.Click{{ShortURL: code, ClickedAt: time.Now()}}))
+					}
+				}
+
+				list, err := s.ListByUserID(ctx, "localhost:8080", userID)
+				assert.NoError(t, err)
+				assert.Len(t, list, perWorker)
+			}(w)
+		}
+
+		//параллельно с записью идут фоновые процессы хранилища
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				_, err := s.DeleteExpired(ctx, time.Now())
+				assert.NoError(t, err)
+				_, err = s.ListClicks(ctx, "w0i0", time.Time{}, time.Now().Add(time.Hour))
+				assert.NoError(t, err)
+			}
+		}()
+		wg.Wait()
+	})
+}
@@ -0,0 +1,106 @@
+package memory
+
+import (
+	"context"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/google/uuid"
+	"sort"
+	"time"
+)
+
+// EnqueueDeletes ставит ссылки в очередь на удаление под заданием jobID
+func (s *Storage) EnqueueDeletes(ctx context.Context, jobID uuid.UUID, items []models.DeletedURLS) error {
+	s.outboxMu.Lock()
+	defer s.outboxMu.Unlock()
+
+	now := time.Now()
+
+	for _, item := range items {
+		s.outboxID++
+		s.outbox[s.outboxID] = models.OutboxItem{
+			ID:            s.outboxID,
+			JobID:         jobID,
+			UserID:        item.UserID,
+			ShortURL:      item.ShortURL,
+			Status:        models.OutboxPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+	}
+	return nil
+}
+
+// FetchDeletes - готовые к обработке записи очереди в порядке поступления
+func (s *Storage) FetchDeletes(ctx context.Context, now time.Time, limit int) ([]models.OutboxItem, error) {
+	result := s.selectOutbox(func(item models.OutboxItem) bool {
+		return item.Status == models.OutboxPending && !item.NextAttemptAt.After(now)
+	})
+
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// UpdateDeletes сохраняет новое состояние записей очереди
+func (s *Storage) UpdateDeletes(ctx context.Context, items []models.OutboxItem) error {
+	s.outboxMu.Lock()
+	defer s.outboxMu.Unlock()
+
+	//владельца записи меняет только MergeUser, обработчик очереди мог прочитать запись до передачи
+	for _, item := range items {
+		if current, ok := s.outbox[item.ID]; ok {
+			item.UserID = current.UserID
+			s.outbox[item.ID] = item
+		}
+	}
+	return nil
+}
+
+// GetDeleteJob - записи очереди, относящиеся к заданию jobID
+func (s *Storage) GetDeleteJob(ctx context.Context, jobID uuid.UUID) ([]models.OutboxItem, error) {
+	return s.selectOutbox(func(item models.OutboxItem) bool {
+		return item.JobID == jobID
+	}), nil
+}
+
+// ListDeadDeletes - записи пользователя, исчерпавшие попытки удаления
+func (s *Storage) ListDeadDeletes(ctx context.Context, userID uuid.UUID) ([]models.OutboxItem, error) {
+	return s.selectOutbox(func(item models.OutboxItem) bool {
+		return item.Status == models.OutboxDead && item.UserID == userID
+	}), nil
+}
+
+// PurgeDeletes убирает обработанные записи, последний раз изменявшиеся раньше before
+func (s *Storage) PurgeDeletes(ctx context.Context, before time.Time) (int64, error) {
+	s.outboxMu.Lock()
+	defer s.outboxMu.Unlock()
+
+	var count int64
+
+	for id, item := range s.outbox {
+		if item.Status == models.OutboxDone && item.UpdatedAt.Before(before) {
+			delete(s.outbox, id)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// selectOutbox - записи очереди, подходящие под условие, в порядке поступления
+func (s *Storage) selectOutbox(match func(models.OutboxItem) bool) []models.OutboxItem {
+	s.outboxMu.Lock()
+	defer s.outboxMu.Unlock()
+
+	var result []models.OutboxItem
+
+	for _, item := range s.outbox {
+		if match(item) {
+			result = append(result, item)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
@@ -0,0 +1,125 @@
+package memory
+
+import (
+	"context"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/google/uuid"
+	"sort"
+)
+
+// CreateTeam сохраняет новую команду вместе с ее первым владельцем
+func (s *Storage) CreateTeam(ctx context.Context, team models.Team, owner models.TeamMember) error {
+	s.teamsMu.Lock()
+	defer s.teamsMu.Unlock()
+
+	team.Role = ""
+	s.teams[team.ID] = team
+
+	owner.TeamID = team.ID
+	s.members[team.ID] = map[uuid.UUID]models.TeamMember{owner.UserID: owner}
+	return nil
+}
+
+// ListTeams - команды пользователя с его ролью в порядке создания
+func (s *Storage) ListTeams(ctx context.Context, userID uuid.UUID) ([]models.Team, error) {
+	s.teamsMu.RLock()
+	defer s.teamsMu.RUnlock()
+
+	var result []models.Team
+	for teamID, members := range s.members {
+		if member, ok := members[userID]; ok {
+			team := s.teams[teamID]
+			team.Role = member.Role
+			result = append(result, team)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result, nil
+}
+
+// SaveTeamMember добавляет участника или меняет его роль, момент вступления не меняется
+func (s *Storage) SaveTeamMember(ctx context.Context, member models.TeamMember) error {
+	s.teamsMu.Lock()
+	defer s.teamsMu.Unlock()
+
+	members, ok := s.members[member.TeamID]
+	if !ok {
+		return errs.ErrTeamNotFound
+	}
+
+	if member.Role != models.RoleOwner && lastOwner(members, member.UserID) {
+		return errs.ErrTeamLastOwner
+	}
+
+	if current, exists := members[member.UserID]; exists {
+		member.CreatedAt = current.CreatedAt
+	}
+	members[member.UserID] = member
+	return nil
+}
+
+// GetTeamMember - участие пользователя в команде
+func (s *Storage) GetTeamMember(ctx context.Context, teamID, userID uuid.UUID) (models.TeamMember, error) {
+	s.teamsMu.RLock()
+	defer s.teamsMu.RUnlock()
+
+	member, ok := s.members[teamID][userID]
+	if !ok {
+		return models.TeamMember{}, errs.ErrTeamMemberNotFound
+	}
+	return member, nil
+}
+
+// ListTeamMembers - участники команды в порядке вступления
+func (s *Storage) ListTeamMembers(ctx context.Context, teamID uuid.UUID) ([]models.TeamMember, error) {
+	s.teamsMu.RLock()
+	defer s.teamsMu.RUnlock()
+
+	result := make([]models.TeamMember, 0, len(s.members[teamID]))
+	for _, member := range s.members[teamID] {
+		result = append(result, member)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result, nil
+}
+
+// DeleteTeamMember исключает пользователя из команды, созданные им ссылки остаются у команды
+func (s *Storage) DeleteTeamMember(ctx context.Context, teamID, userID uuid.UUID) error {
+	s.teamsMu.Lock()
+	defer s.teamsMu.Unlock()
+
+	if _, ok := s.members[teamID][userID]; !ok {
+		return errs.ErrTeamMemberNotFound
+	}
+	if lastOwner(s.members[teamID], userID) {
+		return errs.ErrTeamLastOwner
+	}
+	delete(s.members[teamID], userID)
+	return nil
+}
+
+// lastOwner - userID единственный владелец команды, понизить или исключить его нельзя
+func lastOwner(members map[uuid.UUID]models.TeamMember, userID uuid.UUID) bool {
+	if members[userID].Role != models.RoleOwner {
+		return false
+	}
+
+	for id, member := range members {
+		if id != userID && member.Role == models.RoleOwner {
+			return false
+		}
+	}
+	return true
+}
+
+// ListByTeamID - ссылки команды в порядке сохранения
+func (s *Storage) ListByTeamID(ctx context.Context, host models.Host, teamID uuid.UUID) ([]models.ShortenURL, error) {
+	s.teamsMu.RLock()
+	codes := append([]models.ShortURL(nil), s.teamLinks[teamID]...)
+	s.teamsMu.RUnlock()
+
+	return s.list(ctx, host, codes, teamID)
+}
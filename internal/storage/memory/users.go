@@ -0,0 +1,112 @@
+package memory
+
+import (
+	"context"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/google/uuid"
+)
+
+// CreateUser сохраняет нового пользователя, логин должен быть свободен
+func (s *Storage) CreateUser(ctx context.Context, user models.User) error {
+	s.accountMu.Lock()
+	defer s.accountMu.Unlock()
+
+	if _, ok := s.logins[user.Login]; ok {
+		return errs.ErrUserExists
+	}
+	if _, ok := s.accounts[user.ID]; ok {
+		return errs.ErrUserExists
+	}
+
+	s.accounts[user.ID] = user
+	s.logins[user.Login] = user.ID
+	return nil
+}
+
+// GetUserByLogin - пользователь по логину
+func (s *Storage) GetUserByLogin(ctx context.Context, login string) (models.User, error) {
+	s.accountMu.RLock()
+	defer s.accountMu.RUnlock()
+
+	id, ok := s.logins[login]
+	if !ok {
+		return models.User{}, errs.ErrUserNotFound
+	}
+	return s.accounts[id], nil
+}
+
+// GetUserByID - пользователь по идентификатору
+func (s *Storage) GetUserByID(ctx context.Context, id uuid.UUID) (models.User, error) {
+	s.accountMu.RLock()
+	defer s.accountMu.RUnlock()
+
+	user, ok := s.accounts[id]
+	if !ok {
+		return models.User{}, errs.ErrUserNotFound
+	}
+	return user, nil
+}
+
+// MergeUser передает ссылки, API-ключи, участие в командах и задания на удаление пользователя from пользователю to,
+// возвращает число перенесенных ссылок
+func (s *Storage) MergeUser(ctx context.Context, from, to uuid.UUID) (int64, error) {
+	//забираем коды целиком, чтобы не держать два сегмента пользователей сразу
+	uss := s.userShard(from)
+	uss.mu.Lock()
+	codes := uss.codes[from]
+	delete(uss.codes, from)
+	uss.mu.Unlock()
+
+	for _, code := range codes {
+		us := s.urlShard(code)
+		us.mu.Lock()
+		if row, ok := us.urls[code]; ok {
+			row.UserID = to
+			us.urls[code] = row
+		}
+		us.mu.Unlock()
+	}
+
+	uss = s.userShard(to)
+	uss.mu.Lock()
+	uss.codes[to] = append(uss.codes[to], codes...)
+	uss.mu.Unlock()
+
+	s.apiKeysMu.Lock()
+	for hash, key := range s.apiKeys {
+		if key.UserID == from {
+			key.UserID = to
+			s.apiKeys[hash] = key
+		}
+	}
+	s.apiKeysMu.Unlock()
+
+	//если оба пользователя в одной команде, остается одно участие со старшей ролью
+	s.teamsMu.Lock()
+	for _, members := range s.members {
+		member, ok := members[from]
+		if !ok {
+			continue
+		}
+		delete(members, from)
+
+		member.UserID = to
+		if current, exists := members[to]; exists {
+			member = current.Merge(member)
+		}
+		members[to] = member
+	}
+	s.teamsMu.Unlock()
+
+	s.outboxMu.Lock()
+	for id, item := range s.outbox {
+		if item.UserID == from {
+			item.UserID = to
+			s.outbox[id] = item
+		}
+	}
+	s.outboxMu.Unlock()
+
+	return int64(len(codes)), nil
+}
@@ -7,6 +7,7 @@ package mocks
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	models "github.com/dubrovsky1/url-shortener/internal/models"
 	gomock "github.com/golang/mock/gomock"
@@ -36,6 +37,21 @@ func (m *MockStorager) EXPECT() *MockStoragerMockRecorder {
 	return m.recorder
 }
 
+// ClickStats mocks base method.
+func (m *MockStorager) ClickStats(arg0 context.Context, arg1 models.ShortURL, arg2 models.StatsParams) (models.Stats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClickStats", arg0, arg1, arg2)
+	ret0, _ := ret[0].(models.Stats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClickStats indicates an expected call of ClickStats.
+func (mr *MockStoragerMockRecorder) ClickStats(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClickStats", reflect.TypeOf((*MockStorager)(nil).ClickStats), arg0, arg1, arg2)
+}
+
 // Close mocks base method.
 func (m *MockStorager) Close() error {
 	m.ctrl.T.Helper()
@@ -50,20 +66,137 @@ func (mr *MockStoragerMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockStorager)(nil).Close))
 }
 
-// DeleteURL mocks base method.
-func (m *MockStorager) DeleteURL(arg0 context.Context, arg1 []models.DeletedURLS) error {
+// CreateTeam mocks base method.
+func (m *MockStorager) CreateTeam(arg0 context.Context, arg1 models.Team, arg2 models.TeamMember) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteURL", arg0, arg1)
+	ret := m.ctrl.Call(m, "CreateTeam", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateTeam indicates an expected call of CreateTeam.
+func (mr *MockStoragerMockRecorder) CreateTeam(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTeam", reflect.TypeOf((*MockStorager)(nil).CreateTeam), arg0, arg1, arg2)
+}
+
+// CreateUser mocks base method.
+func (m *MockStorager) CreateUser(arg0 context.Context, arg1 models.User) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUser", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateUser indicates an expected call of CreateUser.
+func (mr *MockStoragerMockRecorder) CreateUser(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockStorager)(nil).CreateUser), arg0, arg1)
+}
+
+// DeleteExpired mocks base method.
+func (m *MockStorager) DeleteExpired(arg0 context.Context, arg1 time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteExpired", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteExpired indicates an expected call of DeleteExpired.
+func (mr *MockStoragerMockRecorder) DeleteExpired(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteExpired", reflect.TypeOf((*MockStorager)(nil).DeleteExpired), arg0, arg1)
+}
+
+// DeleteTeamMember mocks base method.
+func (m *MockStorager) DeleteTeamMember(arg0 context.Context, arg1, arg2 uuid.UUID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteTeamMember", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
+// DeleteTeamMember indicates an expected call of DeleteTeamMember.
+func (mr *MockStoragerMockRecorder) DeleteTeamMember(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteTeamMember", reflect.TypeOf((*MockStorager)(nil).DeleteTeamMember), arg0, arg1, arg2)
+}
+
+// DeleteURL mocks base method.
+func (m *MockStorager) DeleteURL(arg0 context.Context, arg1 []models.DeletedURLS) ([]models.DeletedURLS, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteURL", arg0, arg1)
+	ret0, _ := ret[0].([]models.DeletedURLS)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
 // DeleteURL indicates an expected call of DeleteURL.
 func (mr *MockStoragerMockRecorder) DeleteURL(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteURL", reflect.TypeOf((*MockStorager)(nil).DeleteURL), arg0, arg1)
 }
 
+// EnqueueDeletes mocks base method.
+func (m *MockStorager) EnqueueDeletes(arg0 context.Context, arg1 uuid.UUID, arg2 []models.DeletedURLS) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnqueueDeletes", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnqueueDeletes indicates an expected call of EnqueueDeletes.
+func (mr *MockStoragerMockRecorder) EnqueueDeletes(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnqueueDeletes", reflect.TypeOf((*MockStorager)(nil).EnqueueDeletes), arg0, arg1, arg2)
+}
+
+// FetchDeletes mocks base method.
+func (m *MockStorager) FetchDeletes(arg0 context.Context, arg1 time.Time, arg2 int) ([]models.OutboxItem, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FetchDeletes", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]models.OutboxItem)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FetchDeletes indicates an expected call of FetchDeletes.
+func (mr *MockStoragerMockRecorder) FetchDeletes(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchDeletes", reflect.TypeOf((*MockStorager)(nil).FetchDeletes), arg0, arg1, arg2)
+}
+
+// GetAPIKey mocks base method.
+func (m *MockStorager) GetAPIKey(arg0 context.Context, arg1 string) (models.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAPIKey", arg0, arg1)
+	ret0, _ := ret[0].(models.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAPIKey indicates an expected call of GetAPIKey.
+func (mr *MockStoragerMockRecorder) GetAPIKey(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPIKey", reflect.TypeOf((*MockStorager)(nil).GetAPIKey), arg0, arg1)
+}
+
+// GetDeleteJob mocks base method.
+func (m *MockStorager) GetDeleteJob(arg0 context.Context, arg1 uuid.UUID) ([]models.OutboxItem, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeleteJob", arg0, arg1)
+	ret0, _ := ret[0].([]models.OutboxItem)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeleteJob indicates an expected call of GetDeleteJob.
+func (mr *MockStoragerMockRecorder) GetDeleteJob(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeleteJob", reflect.TypeOf((*MockStorager)(nil).GetDeleteJob), arg0, arg1)
+}
+
 // GetShortURL mocks base method.
 func (m *MockStorager) GetShortURL(arg0 context.Context, arg1 models.OriginalURL) (models.ShortURL, error) {
 	m.ctrl.T.Helper()
@@ -79,6 +212,21 @@ func (mr *MockStoragerMockRecorder) GetShortURL(arg0, arg1 interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetShortURL", reflect.TypeOf((*MockStorager)(nil).GetShortURL), arg0, arg1)
 }
 
+// GetTeamMember mocks base method.
+func (m *MockStorager) GetTeamMember(arg0 context.Context, arg1, arg2 uuid.UUID) (models.TeamMember, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTeamMember", arg0, arg1, arg2)
+	ret0, _ := ret[0].(models.TeamMember)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTeamMember indicates an expected call of GetTeamMember.
+func (mr *MockStoragerMockRecorder) GetTeamMember(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTeamMember", reflect.TypeOf((*MockStorager)(nil).GetTeamMember), arg0, arg1, arg2)
+}
+
 // GetURL mocks base method.
 func (m *MockStorager) GetURL(arg0 context.Context, arg1 models.ShortURL) (models.ShortenURL, error) {
 	m.ctrl.T.Helper()
@@ -94,6 +242,36 @@ func (mr *MockStoragerMockRecorder) GetURL(arg0, arg1 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetURL", reflect.TypeOf((*MockStorager)(nil).GetURL), arg0, arg1)
 }
 
+// GetUserByID mocks base method.
+func (m *MockStorager) GetUserByID(arg0 context.Context, arg1 uuid.UUID) (models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByID", arg0, arg1)
+	ret0, _ := ret[0].(models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByID indicates an expected call of GetUserByID.
+func (mr *MockStoragerMockRecorder) GetUserByID(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByID", reflect.TypeOf((*MockStorager)(nil).GetUserByID), arg0, arg1)
+}
+
+// GetUserByLogin mocks base method.
+func (m *MockStorager) GetUserByLogin(arg0 context.Context, arg1 string) (models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByLogin", arg0, arg1)
+	ret0, _ := ret[0].(models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByLogin indicates an expected call of GetUserByLogin.
+func (mr *MockStoragerMockRecorder) GetUserByLogin(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByLogin", reflect.TypeOf((*MockStorager)(nil).GetUserByLogin), arg0, arg1)
+}
+
 // InsertBatch mocks base method.
 func (m *MockStorager) InsertBatch(arg0 context.Context, arg1 []models.BatchRequest, arg2 models.Host, arg3 uuid.UUID) ([]models.BatchResponse, error) {
 	m.ctrl.T.Helper()
@@ -109,6 +287,36 @@ func (mr *MockStoragerMockRecorder) InsertBatch(arg0, arg1, arg2, arg3 interface
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertBatch", reflect.TypeOf((*MockStorager)(nil).InsertBatch), arg0, arg1, arg2, arg3)
 }
 
+// ListAPIKeys mocks base method.
+func (m *MockStorager) ListAPIKeys(arg0 context.Context, arg1 uuid.UUID) ([]models.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAPIKeys", arg0, arg1)
+	ret0, _ := ret[0].([]models.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAPIKeys indicates an expected call of ListAPIKeys.
+func (mr *MockStoragerMockRecorder) ListAPIKeys(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAPIKeys", reflect.TypeOf((*MockStorager)(nil).ListAPIKeys), arg0, arg1)
+}
+
+// ListByTeamID mocks base method.
+func (m *MockStorager) ListByTeamID(arg0 context.Context, arg1 models.Host, arg2 uuid.UUID) ([]models.ShortenURL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListByTeamID", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]models.ShortenURL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListByTeamID indicates an expected call of ListByTeamID.
+func (mr *MockStoragerMockRecorder) ListByTeamID(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListByTeamID", reflect.TypeOf((*MockStorager)(nil).ListByTeamID), arg0, arg1, arg2)
+}
+
 // ListByUserID mocks base method.
 func (m *MockStorager) ListByUserID(arg0 context.Context, arg1 models.Host, arg2 uuid.UUID) ([]models.ShortenURL, error) {
 	m.ctrl.T.Helper()
@@ -124,6 +332,167 @@ func (mr *MockStoragerMockRecorder) ListByUserID(arg0, arg1, arg2 interface{}) *
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListByUserID", reflect.TypeOf((*MockStorager)(nil).ListByUserID), arg0, arg1, arg2)
 }
 
+// ListClicks mocks base method.
+func (m *MockStorager) ListClicks(arg0 context.Context, arg1 models.ShortURL, arg2, arg3 time.Time) ([]models.Click, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListClicks", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]models.Click)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListClicks indicates an expected call of ListClicks.
+func (mr *MockStoragerMockRecorder) ListClicks(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListClicks", reflect.TypeOf((*MockStorager)(nil).ListClicks), arg0, arg1, arg2, arg3)
+}
+
+// ListDeadDeletes mocks base method.
+func (m *MockStorager) ListDeadDeletes(arg0 context.Context, arg1 uuid.UUID) ([]models.OutboxItem, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListDeadDeletes", arg0, arg1)
+	ret0, _ := ret[0].([]models.OutboxItem)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListDeadDeletes indicates an expected call of ListDeadDeletes.
+func (mr *MockStoragerMockRecorder) ListDeadDeletes(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListDeadDeletes", reflect.TypeOf((*MockStorager)(nil).ListDeadDeletes), arg0, arg1)
+}
+
+// ListTeamMembers mocks base method.
+func (m *MockStorager) ListTeamMembers(arg0 context.Context, arg1 uuid.UUID) ([]models.TeamMember, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListTeamMembers", arg0, arg1)
+	ret0, _ := ret[0].([]models.TeamMember)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListTeamMembers indicates an expected call of ListTeamMembers.
+func (mr *MockStoragerMockRecorder) ListTeamMembers(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTeamMembers", reflect.TypeOf((*MockStorager)(nil).ListTeamMembers), arg0, arg1)
+}
+
+// ListTeams mocks base method.
+func (m *MockStorager) ListTeams(arg0 context.Context, arg1 uuid.UUID) ([]models.Team, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListTeams", arg0, arg1)
+	ret0, _ := ret[0].([]models.Team)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListTeams indicates an expected call of ListTeams.
+func (mr *MockStoragerMockRecorder) ListTeams(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTeams", reflect.TypeOf((*MockStorager)(nil).ListTeams), arg0, arg1)
+}
+
+// MergeUser mocks base method.
+func (m *MockStorager) MergeUser(arg0 context.Context, arg1, arg2 uuid.UUID) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MergeUser", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MergeUser indicates an expected call of MergeUser.
+func (mr *MockStoragerMockRecorder) MergeUser(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MergeUser", reflect.TypeOf((*MockStorager)(nil).MergeUser), arg0, arg1, arg2)
+}
+
+// NextID mocks base method.
+func (m *MockStorager) NextID(arg0 context.Context) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NextID", arg0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NextID indicates an expected call of NextID.
+func (mr *MockStoragerMockRecorder) NextID(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NextID", reflect.TypeOf((*MockStorager)(nil).NextID), arg0)
+}
+
+// PurgeDeletes mocks base method.
+func (m *MockStorager) PurgeDeletes(arg0 context.Context, arg1 time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeDeletes", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeDeletes indicates an expected call of PurgeDeletes.
+func (mr *MockStoragerMockRecorder) PurgeDeletes(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeDeletes", reflect.TypeOf((*MockStorager)(nil).PurgeDeletes), arg0, arg1)
+}
+
+// RevokeAPIKey mocks base method.
+func (m *MockStorager) RevokeAPIKey(arg0 context.Context, arg1, arg2 uuid.UUID, arg3 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAPIKey", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAPIKey indicates an expected call of RevokeAPIKey.
+func (mr *MockStoragerMockRecorder) RevokeAPIKey(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAPIKey", reflect.TypeOf((*MockStorager)(nil).RevokeAPIKey), arg0, arg1, arg2, arg3)
+}
+
+// SaveAPIKey mocks base method.
+func (m *MockStorager) SaveAPIKey(arg0 context.Context, arg1 models.APIKey) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveAPIKey", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveAPIKey indicates an expected call of SaveAPIKey.
+func (mr *MockStoragerMockRecorder) SaveAPIKey(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveAPIKey", reflect.TypeOf((*MockStorager)(nil).SaveAPIKey), arg0, arg1)
+}
+
+// SaveClicks mocks base method.
+func (m *MockStorager) SaveClicks(arg0 context.Context, arg1 []models.Click) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveClicks", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveClicks indicates an expected call of SaveClicks.
+func (mr *MockStoragerMockRecorder) SaveClicks(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveClicks", reflect.TypeOf((*MockStorager)(nil).SaveClicks), arg0, arg1)
+}
+
+// SaveTeamMember mocks base method.
+func (m *MockStorager) SaveTeamMember(arg0 context.Context, arg1 models.TeamMember) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveTeamMember", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveTeamMember indicates an expected call of SaveTeamMember.
+func (mr *MockStoragerMockRecorder) SaveTeamMember(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveTeamMember", reflect.TypeOf((*MockStorager)(nil).SaveTeamMember), arg0, arg1)
+}
+
 // SaveURL mocks base method.
 func (m *MockStorager) SaveURL(arg0 context.Context, arg1 models.ShortenURL) (models.ShortURL, error) {
 	m.ctrl.T.Helper()
@@ -138,3 +507,17 @@ func (mr *MockStoragerMockRecorder) SaveURL(arg0, arg1 interface{}) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveURL", reflect.TypeOf((*MockStorager)(nil).SaveURL), arg0, arg1)
 }
+
+// UpdateDeletes mocks base method.
+func (m *MockStorager) UpdateDeletes(arg0 context.Context, arg1 []models.OutboxItem) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateDeletes", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateDeletes indicates an expected call of UpdateDeletes.
+func (mr *MockStoragerMockRecorder) UpdateDeletes(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateDeletes", reflect.TypeOf((*MockStorager)(nil).UpdateDeletes), arg0, arg1)
+}
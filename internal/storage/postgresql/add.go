@@ -2,30 +2,38 @@ package postgresql
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	errs "github.com/dubrovsky1/url-shortener/internal/errors"
-	"github.com/dubrovsky1/url-shortener/internal/generator"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
 	"github.com/dubrovsky1/url-shortener/internal/models"
 	"github.com/google/uuid"
 	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"net/url"
+	"time"
 )
 
 func (s *Storage) SaveURL(ctx context.Context, item models.ShortenURL) (models.ShortURL, error) {
-	_, err := s.DB.ExecContext(ctx, `
+	_, err := s.Pool.Exec(ctx, `
 												insert into shorten_urls 
 												(
 													original_url, 
 													shorten_url,
-												    created_user_id
+												    created_user_id,
+												    expires_at,
+												    redirect_type,
+												    forward_query,
+												    team_id
 												) 
 												select $1 as original_url, 
 												       $2 as shorten_url,
-												       $3 as created_user_id;
-		`, item.OriginalURL, item.ShortURL, item.UserID,
+												       $3 as created_user_id,
+												       $4 as expires_at,
+												       $5 as redirect_type,
+												       $6 as forward_query,
+												       $7 as team_id;
+		`, item.OriginalURL, item.ShortURL, item.UserID, item.ExpiresAt, item.RedirectType, item.ForwardQuery, nullUUID(item.TeamID),
 	)
 
 	if err != nil {
@@ -34,103 +42,266 @@ func (s *Storage) SaveURL(ctx context.Context, item models.ShortenURL) (models.S
 
 		//As - попытка привести возникшую при запросе ошибку err к "ошибкам в базах postgres"
 		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
-			err = errs.ErrUniqueIndex
+			//нарушение уникальности не по оригинальным ссылкам означает, что занята сама короткая ссылка
+			if pgErr.ConstraintName != "uix_original_url" {
+				return "", errs.ErrShortURLExists
+			}
 
 			//поиск короткой ссылки по уже сохраненному в бд оригинальному URL
 			shortURL, errGetShortURL := s.GetShortURL(ctx, item.OriginalURL)
-			if errGetShortURL != nil {
+			if errGetShortURL != nil && !errors.Is(errGetShortURL, errs.ErrUniqueIndex) {
 				logger.Sugar.Infow("Postgresql SaveURL. Find ShortURL error.")
 				return "", errGetShortURL
 			}
-			return shortURL, err
+			return shortURL, errs.ErrUniqueIndex
+		}
+		//ссылка сохраняется в несуществующую команду
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.ForeignKeyViolation {
+			return "", errs.ErrTeamNotFound
 		}
 		//случай, если возникла ошибка, которая не связана с дублированием originalURL
 		logger.Sugar.Infow("Postgresql SaveURL. Insert error.")
-		return "", err
+		return "", storageError(err)
 	}
 
 	return item.ShortURL, nil
 }
 
+// InsertBatch загружает пачку через COPY во временную таблицу и одним запросом
+// вставляет новые ссылки и возвращает коды как для новых, так и для уже существующих оригинальных URL
 func (s *Storage) InsertBatch(ctx context.Context, batch []models.BatchRequest, host models.Host, userID uuid.UUID) ([]models.BatchResponse, error) {
-	var result []models.BatchResponse
-
 	//открытие транзакции
-	tx, err := s.DB.BeginTx(ctx, nil)
+	tx, err := s.Pool.Begin(ctx)
 	if err != nil {
 		logger.Sugar.Infow("Postgresql InsertBatch. Begin transaction error.")
-		return nil, err
+		return nil, storageError(err)
 	}
 	// если Commit будет раньше, то откат проигнорируется
-	defer tx.Rollback()
+	defer tx.Rollback(ctx)
 
-	//подготовка скомпилированных запросов
-	insertQuery, err := tx.PrepareContext(ctx, `
-                                                   insert into shorten_urls 
+	_, err = tx.Exec(ctx, `
+                                                   create temp table tmp_batch
                                                    (
-                                                       original_url, 
-                                                       shorten_url,
-                                                       created_user_id
-                                                   ) 
-                                                   select $1 as original_url, 
-                                                          $2 as shorten_url,
-                                                          $3 as created_user_id
-                                                   on conflict (original_url) 
-                                                   do nothing;
+                                                       ord             int         not null,
+                                                       original_url    text        not null,
+                                                       shorten_url     text        not null,
+                                                       created_user_id uuid        null,
+                                                       expires_at      timestamptz null,
+                                                       redirect_type   smallint    not null,
+                                                       forward_query   bool        not null
+                                                   ) on commit drop;
 	`)
 	if err != nil {
-		logger.Sugar.Infow("Postgresql InsertBatch. Prepare query insert error.")
-		return nil, err
+		logger.Sugar.Infow("Postgresql InsertBatch. Create temp table error.")
+		return nil, storageError(err)
 	}
-	defer insertQuery.Close()
 
-	selectShortURLQuery, err := tx.PrepareContext(ctx, `
-                                                                 select su.shorten_url
-                                                                 from shorten_urls su
-                                                                 where su.original_url = $1;
+	rows := make([][]any, len(batch))
+	for i, row := range batch {
+		//код сгенерирован сервисом
+		rows[i] = []any{i, row.URL, string(row.ShortURL), userID, row.ExpiresAt, row.RedirectType, row.ForwardQuery}
+	}
+
+	_, err = tx.CopyFrom(ctx,
+		pgx.Identifier{"tmp_batch"},
+		[]string{"ord", "original_url", "shorten_url", "created_user_id", "expires_at", "redirect_type", "forward_query"},
+		pgx.CopyFromRows(rows),
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql InsertBatch. Copy error.")
+		return nil, storageError(err)
+	}
+
+	//истекшие, но еще не обработанные ссылки на URL пачки помечаем удаленными, чтобы сократить URL заново,
+	//а не вернуть мертвый код конфликтом
+	_, err = tx.Exec(ctx, `
+                                                   update shorten_urls s
+                                                   set is_deleted = true
+                                                   from tmp_batch t
+                                                   where s.original_url = t.original_url
+                                                     and not s.is_deleted
+                                                     and s.expires_at <= $1;
+	`, time.Now())
+	if err != nil {
+		logger.Sugar.Infow("Postgresql InsertBatch. Expire urls error.")
+		return nil, storageError(err)
+	}
+
+	//из повторов внутри пачки вставляем первую строку, уже сохраненные ссылки не трогаем,
+	//внешний select видит таблицу до вставки, поэтому новые коды берем из returning
+	result, err := tx.Query(ctx, `
+                                                   with ins as (
+                                                       insert into shorten_urls 
+                                                       (
+                                                           original_url, 
+                                                           shorten_url,
+                                                           created_user_id,
+                                                           expires_at,
+                                                           redirect_type,
+                                                           forward_query
+                                                       )
+                                                       select distinct on (t.original_url)
+                                                              t.original_url,
+                                                              t.shorten_url,
+                                                              t.created_user_id,
+                                                              t.expires_at,
+                                                              t.redirect_type,
+                                                              t.forward_query
+                                                       from tmp_batch t
+                                                       order by t.original_url, t.ord
+                                                       on conflict (original_url) where not is_deleted
+                                                       do nothing
+                                                       returning original_url, shorten_url
+                                                   )
+                                                   select t.ord,
+                                                          coalesce(ins.shorten_url, su.shorten_url) as shorten_url,
+                                                          ins.shorten_url is null                   as conflict
+                                                   from tmp_batch t
+                                                   left join ins on ins.original_url = t.original_url
+                                                   left join shorten_urls su on su.original_url = t.original_url and not su.is_deleted
+                                                   order by t.ord;
 	`)
 	if err != nil {
-		logger.Sugar.Infow("Postgresql InsertBatch. Prepare query select shorten_url error.")
-		return nil, err
+		return nil, batchError(err)
 	}
-	defer selectShortURLQuery.Close()
 
-	for _, row := range batch {
-		//гененрируем короткую ссылку
-		shortURL := generator.GetShortURL()
+	codes := make([]*string, len(batch))
+	conflicts := make([]bool, len(batch))
+	var lost []string
+
+	for result.Next() {
+		var ord int
+		var shortURL *string
+		var conflict bool
 
-		//прикрепляем к транзакции выполнение запроса поиска shorten_url, если original_url уже есть в базе
-		res := selectShortURLQuery.QueryRowContext(ctx, row.URL)
-		err = res.Scan(&shortURL)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		if err = result.Scan(&ord, &shortURL, &conflict); err != nil {
 			logger.Sugar.Infow("Postgresql InsertBatch. Scan error.")
+			result.Close()
 			return nil, err
 		}
+		codes[ord], conflicts[ord] = shortURL, conflict
+	}
+	result.Close()
 
-		//прикрепляем к транзакции выполнение запроса вставки, передавая в скомпилированный запрос данные по каждой ссылке из входящего слайса
-		_, err = insertQuery.ExecContext(ctx, row.URL, shortURL, userID)
-		if err != nil {
-			logger.Sugar.Infow("Postgresql InsertBatch. ExecContext error.")
-			return nil, err
+	if err = result.Err(); err != nil {
+		return nil, batchError(err)
+	}
+
+	//ссылку, которую параллельно вставила другая транзакция, снимок запроса не видит: on conflict ее пропустил,
+	//а join не нашел. Новый запрос видит ее уже сохраненной
+	for i, code := range codes {
+		if code == nil {
+			lost = append(lost, batch[i].URL)
+		}
+	}
+
+	if len(lost) > 0 {
+		saved, errSaved := selectShortURLs(ctx, tx, lost)
+		if errSaved != nil {
+			return nil, errSaved
 		}
 
-		//составляем результирующий сокращённый URL и добавляем в слайс
-		resultShortURL := "http://" + string(host) + "/" + shortURL
+		for i := range codes {
+			if codes[i] != nil {
+				continue
+			}
+
+			//ссылку успели и удалить - сервис повторит пачку, и она сохранится заново
+			code, ok := saved[batch[i].URL]
+			if !ok {
+				logger.Sugar.Infow("Postgresql InsertBatch. Concurrently inserted url not found.", "original_url", batch[i].URL)
+				return nil, errs.ErrShortURLExists
+			}
+			codes[i] = &code
+		}
+	}
+
+	response := make([]models.BatchResponse, len(batch))
+	conflictCount := 0
+
+	for i, code := range codes {
+		if conflicts[i] {
+			conflictCount++
+		}
+
+		//составляем результирующий сокращённый URL
+		resultShortURL := "http://" + string(host) + "/" + *code
 
 		if _, e := url.Parse(resultShortURL); e != nil {
 			logger.Sugar.Infow("Postgresql InsertBatch. Not result URL.")
 			return nil, e
 		}
 
-		r := models.BatchResponse{
-			CorrelationID: row.CorrelationID,
+		response[i] = models.BatchResponse{
+			CorrelationID: batch[i].CorrelationID,
 			ShortURL:      resultShortURL,
+			Conflict:      conflicts[i],
 		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Sugar.Infow("Postgresql InsertBatch. Commit error.")
+		return nil, storageError(err)
+	}
+
+	logger.Sugar.Infow("Postgresql InsertBatch.", "count", len(batch), "conflicts", conflictCount)
+
+	return response, nil
+}
+
+// selectShortURLs - коды неудаленных ссылок по оригинальным URL
+func selectShortURLs(ctx context.Context, tx pgx.Tx, originalURLs []string) (map[string]string, error) {
+	result := make(map[string]string, len(originalURLs))
 
-		result = append(result, r)
+	rows, err := tx.Query(ctx, `
+												select s.original_url,
+												       s.shorten_url
+												from shorten_urls s
+												where s.original_url = any($1)
+												  and not s.is_deleted;
+		`, originalURLs,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql InsertBatch. Select saved urls error.")
+		return nil, storageError(err)
 	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var originalURL, shortURL string
 
-	tx.Commit()
+		if err = rows.Scan(&originalURL, &shortURL); err != nil {
+			logger.Sugar.Infow("Postgresql InsertBatch. Scan saved urls error.")
+			return nil, storageError(err)
+		}
+		result[originalURL] = shortURL
+	}
 
+	if rows.Err() != nil {
+		return nil, storageError(rows.Err())
+	}
 	return result, nil
 }
+
+// batchError - конфликт по оригинальной ссылке гасится on conflict, значит нарушение уникальности
+// означает занятый код и сервис повторит пачку с новыми кодами
+func batchError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+		return errs.ErrShortURLExists
+	}
+	logger.Sugar.Infow("Postgresql InsertBatch. Upsert error.")
+	return storageError(err)
+}
+
+// NextID - очередное значение последовательности для стратегий генерации кодов на основе числового идентификатора
+func (s *Storage) NextID(ctx context.Context) (int64, error) {
+	var id int64
+
+	row := s.Pool.QueryRow(ctx, `select nextval('shorten_urls_code_seq');`)
+	if err := row.Scan(&id); err != nil {
+		logger.Sugar.Infow("Postgresql NextID. Scan error.")
+		return 0, storageError(err)
+	}
+	return id, nil
+}
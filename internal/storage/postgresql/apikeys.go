@@ -0,0 +1,138 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+// apiKeyColumns - поля ключа в порядке сканирования scanAPIKey
+const apiKeyColumns = `
+												       k.id,
+												       k.created_user_id,
+												       k.name,
+												       k.prefix,
+												       k.key_hash,
+												       k.scopes,
+												       k.created_at,
+												       k.revoked_at`
+
+func scanAPIKey(row pgx.Row) (models.APIKey, error) {
+	var key models.APIKey
+	var scopes []string
+
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.Hash, &scopes, &key.CreatedAt, &key.RevokedAt)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+
+	for _, scope := range scopes {
+		key.Scopes = append(key.Scopes, models.Scope(scope))
+	}
+	return key, nil
+}
+
+// SaveAPIKey сохраняет новый API-ключ
+func (s *Storage) SaveAPIKey(ctx context.Context, key models.APIKey) error {
+	scopes := make([]string, len(key.Scopes))
+	for i, scope := range key.Scopes {
+		scopes[i] = string(scope)
+	}
+
+	_, err := s.Pool.Exec(ctx, `
+												insert into api_keys 
+												(
+													id,
+													created_user_id,
+													name,
+													prefix,
+													key_hash,
+													scopes,
+													created_at
+												) 
+												values ($1, $2, $3, $4, $5, $6, $7);
+		`, key.ID, key.UserID, key.Name, key.Prefix, key.Hash, scopes, key.CreatedAt,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql SaveAPIKey. Insert error.")
+		return storageError(err)
+	}
+	return nil
+}
+
+// GetAPIKey - ключ по хешу, в том числе отозванный
+func (s *Storage) GetAPIKey(ctx context.Context, hash string) (models.APIKey, error) {
+	row := s.Pool.QueryRow(ctx, `
+												select `+apiKeyColumns+`
+												from api_keys k 
+												where k.key_hash = $1;
+		`, hash,
+	)
+
+	key, err := scanAPIKey(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.APIKey{}, errs.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		logger.Sugar.Infow("Postgresql GetAPIKey. Scan error.")
+		return models.APIKey{}, storageError(err)
+	}
+	return key, nil
+}
+
+// ListAPIKeys - ключи пользователя в порядке создания
+func (s *Storage) ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]models.APIKey, error) {
+	rows, err := s.Pool.Query(ctx, `
+												select `+apiKeyColumns+`
+												from api_keys k 
+												where k.created_user_id = $1
+												order by k.created_at, k.id;
+		`, userID,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql ListAPIKeys. Query error.")
+		return nil, storageError(err)
+	}
+	defer rows.Close()
+
+	var result []models.APIKey
+
+	for rows.Next() {
+		key, errScan := scanAPIKey(rows)
+		if errScan != nil {
+			logger.Sugar.Infow("Postgresql ListAPIKeys. Scan error.")
+			return nil, storageError(errScan)
+		}
+		result = append(result, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, storageError(err)
+	}
+	return result, nil
+}
+
+// RevokeAPIKey отзывает ключ пользователя, повторный отзыв не меняет момент отзыва
+func (s *Storage) RevokeAPIKey(ctx context.Context, userID, keyID uuid.UUID, now time.Time) error {
+	res, err := s.Pool.Exec(ctx, `
+												update api_keys 
+												set revoked_at = coalesce(revoked_at, $3) 
+												where id = $1 
+												  and created_user_id = $2;
+		`, keyID, userID, now,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql RevokeAPIKey. Update error.")
+		return storageError(err)
+	}
+
+	if res.RowsAffected() == 0 {
+		return errs.ErrAPIKeyNotFound
+	}
+	return nil
+}
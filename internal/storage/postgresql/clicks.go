@@ -0,0 +1,232 @@
+package postgresql
+
+import (
+	"context"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/dubrovsky1/url-shortener/internal/stats"
+	"time"
+)
+
+// SaveClicks записывает пачку событий переходов одним запросом через unnest массивов
+func (s *Storage) SaveClicks(ctx context.Context, clicks []models.Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	shortURLs := make([]string, len(clicks))
+	clickedAt := make([]time.Time, len(clicks))
+	referrers := make([]string, len(clicks))
+	userAgents := make([]string, len(clicks))
+	ipHashes := make([]string, len(clicks))
+
+	for i, click := range clicks {
+		shortURLs[i] = string(click.ShortURL)
+		clickedAt[i] = click.ClickedAt
+		referrers[i] = click.Referrer
+		userAgents[i] = click.UserAgent
+		ipHashes[i] = click.IPHash
+	}
+
+	_, err := s.Pool.Exec(ctx, `
+												insert into clicks 
+												(
+													shorten_url,
+													clicked_at,
+													referrer,
+													user_agent,
+													ip_hash
+												)
+												select c.shorten_url,
+												       c.clicked_at,
+												       nullif(c.referrer, ''),
+												       nullif(c.user_agent, ''),
+												       nullif(c.ip_hash, '')
+												from unnest($1::text[], $2::timestamptz[], $3::text[], $4::text[], $5::text[]) 
+												    as c(shorten_url, clicked_at, referrer, user_agent, ip_hash);
+		`, shortURLs, clickedAt, referrers, userAgents, ipHashes,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql SaveClicks. Insert error.")
+		return storageError(err)
+	}
+	return nil
+}
+
+func (s *Storage) ListClicks(ctx context.Context, shortURL models.ShortURL, from, to time.Time) ([]models.Click, error) {
+	var result []models.Click
+
+	rows, err := s.Pool.Query(ctx, `
+												select c.shorten_url,
+												       c.clicked_at,
+												       coalesce(c.referrer, ''),
+												       coalesce(c.user_agent, ''),
+												       coalesce(c.ip_hash, '')
+												from clicks c 
+												where c.shorten_url = $1
+												  and c.clicked_at >= $2
+												  and c.clicked_at < $3
+												order by c.clicked_at;
+		`, shortURL, from, to,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql ListClicks. Query error.")
+		return nil, storageError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cur models.Click
+
+		err = rows.Scan(&cur.ShortURL, &cur.ClickedAt, &cur.Referrer, &cur.UserAgent, &cur.IPHash)
+		if err != nil {
+			logger.Sugar.Infow("Postgresql ListClicks. Scan error.")
+			return nil, storageError(err)
+		}
+		result = append(result, cur)
+	}
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return result, nil
+}
+
+// ClickStats агрегирует события периода в базе, в сервис уходят только итоги. Правила группировки
+// источников и User-Agent повторяют stats.ReferrerName и stats.UserAgentFamily
+func (s *Storage) ClickStats(ctx context.Context, shortURL models.ShortURL, params models.StatsParams) (models.Stats, error) {
+	result := stats.New(shortURL, params)
+
+	//итоги и временной ряд одним запросом: строка с пустым интервалом - итог за весь период.
+	//date_trunc('week') начинает неделю с понедельника, как и stats.BucketStart
+	rows, err := s.Pool.Query(ctx, `
+												select c.bucket,
+												       count(*),
+												       count(distinct c.ip_hash)
+												from (
+													select date_trunc($4::text, c.clicked_at at time zone 'UTC') as bucket,
+													       c.ip_hash
+													from clicks c
+													where c.shorten_url = $1
+													  and c.clicked_at >= $2
+													  and c.clicked_at < $3
+												) c
+												group by grouping sets ((c.bucket), ());
+		`, shortURL, params.From, params.To, params.Bucket,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql ClickStats. Series query error.")
+		return models.Stats{}, storageError(err)
+	}
+
+	for rows.Next() {
+		var (
+			bucket         *time.Time
+			clicks, unique int
+		)
+
+		if err = rows.Scan(&bucket, &clicks, &unique); err != nil {
+			rows.Close()
+			logger.Sugar.Infow("Postgresql ClickStats. Series scan error.")
+			return models.Stats{}, storageError(err)
+		}
+
+		if bucket == nil {
+			result.TotalClicks, result.UniqueVisitors = clicks, unique
+			continue
+		}
+
+		if i := stats.Index(result, bucket.UTC()); i >= 0 {
+			result.Series[i].Clicks = clicks
+			result.Series[i].UniqueVisitors = unique
+		}
+	}
+	rows.Close()
+
+	if rows.Err() != nil {
+		return models.Stats{}, storageError(rows.Err())
+	}
+
+	//источник сводим к хосту без www, ссылки без хоста оставляем как есть
+	if result.TopReferrers, err = s.clickCounts(ctx, `
+												select r.name,
+												       count(*) as cnt
+												from (
+													select coalesce(
+													           nullif(regexp_replace(lower(substring(c.referrer from '^[A-Za-z][A-Za-z0-9+.-]*://(?:[^@/?#]*@)?([^/?#]*)')), '^www\.', ''), ''),
+													           c.referrer,
+													           '(direct)'
+													       ) as name
+													from clicks c
+													where c.shorten_url = $1
+													  and c.clicked_at >= $2
+													  and c.clicked_at < $3
+												) r
+												group by r.name
+												order by cnt desc, r.name collate "C"
+												limit $4;
+		`, shortURL, params.From, params.To, stats.TopReferrers,
+	); err != nil {
+		return models.Stats{}, err
+	}
+
+	//порядок проверок важен, как и в stats.UserAgentFamily
+	if result.UserAgents, err = s.clickCounts(ctx, `
+												select u.name,
+												       count(*) as cnt
+												from (
+													select case
+													           when ua is null then 'Unknown'
+													           when ua like '%bot%' or ua like '%spider%' or ua like '%crawl%' then 'Bot'
+													           when ua like '%edg/%' then 'Edge'
+													           when ua like '%yabrowser/%' then 'Yandex Browser'
+													           when ua like '%opr/%' or ua like '%opera%' then 'Opera'
+													           when ua like '%firefox/%' or ua like '%fxios/%' then 'Firefox'
+													           when ua like '%chrome/%' or ua like '%crios/%' then 'Chrome'
+													           when ua like '%safari/%' then 'Safari'
+													           when ua like '%curl/%' then 'curl'
+													           else 'Other'
+													       end as name
+													from clicks c
+													cross join lateral (select lower(c.user_agent) as ua) l
+													where c.shorten_url = $1
+													  and c.clicked_at >= $2
+													  and c.clicked_at < $3
+												) u
+												group by u.name
+												order by cnt desc, u.name collate "C";
+		`, shortURL, params.From, params.To,
+	); err != nil {
+		return models.Stats{}, err
+	}
+
+	return result, nil
+}
+
+// clickCounts - счетчики переходов в разрезе, который строит запрос
+func (s *Storage) clickCounts(ctx context.Context, query string, args ...any) ([]models.StatsCount, error) {
+	result := []models.StatsCount{}
+
+	rows, err := s.Pool.Query(ctx, query, args...)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql ClickStats. Counts query error.")
+		return nil, storageError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cur models.StatsCount
+
+		if err = rows.Scan(&cur.Name, &cur.Count); err != nil {
+			logger.Sugar.Infow("Postgresql ClickStats. Counts scan error.")
+			return nil, storageError(err)
+		}
+		result = append(result, cur)
+	}
+
+	if rows.Err() != nil {
+		return nil, storageError(rows.Err())
+	}
+	return result, nil
+}
@@ -1,46 +1,100 @@
 package postgresql
 
 import (
-	"bytes"
 	"context"
-	"errors"
-	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
 	"github.com/dubrovsky1/url-shortener/internal/models"
-	"github.com/jackc/pgerrcode"
-	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/google/uuid"
+	"time"
 )
 
-// Здесь как обычно обращаемся к базе, только сам вызов метода и наполнение deletedItems будет контролироваться сервисом
-func (s *Storage) DeleteURL(ctx context.Context, deletedItems []models.DeletedURLS) error {
-	if len(deletedItems) > 0 {
-		query := bytes.NewBufferString("with del(created_user_id, shorten_url) as (values ")
-
-		for i, item := range deletedItems {
-			query.WriteString("('")
-			query.WriteString(item.UserID.String())
-			query.WriteString("'::uuid, '")
-			query.WriteString(string(item.ShortURL))
-			query.WriteString("'::text)")
-
-			if i < len(deletedItems)-1 {
-				query.WriteString(",")
-			}
-		}
+// DefaultDeleteChunkSize - сколько ссылок помечается удаленными одним запросом, если размер не задан
+const DefaultDeleteChunkSize = 1000
 
-		query.WriteString(") update shorten_urls su set is_deleted = true from del where su.created_user_id = del.created_user_id and su.shorten_url = del.shorten_url;")
+// Здесь как обычно обращаемся к базе, только сам вызов метода и наполнение deletedItems будет контролироваться сервисом.
+// Коды передаются массивами-параметрами и режутся на порции, возвращаются фактически удаленные записи.
+// Пустой TeamID передается как uuid.Nil: такая запись удаляет только личную ссылку пользователя
+func (s *Storage) DeleteURL(ctx context.Context, deletedItems []models.DeletedURLS) ([]models.DeletedURLS, error) {
+	var result []models.DeletedURLS
 
-		//logger.Sugar.Infow("Delete log.", "query", query.String())
+	chunkSize := s.DeleteChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultDeleteChunkSize
+	}
 
-		_, err := s.DB.ExecContext(ctx, query.String())
+	for start := 0; start < len(deletedItems); start += chunkSize {
+		end := min(start+chunkSize, len(deletedItems))
 
+		deleted, err := s.deleteChunk(ctx, deletedItems[start:end])
 		if err != nil {
-			var pgErr *pgconn.PgError
+			return result, err
+		}
+		result = append(result, deleted...)
+	}
+	return result, nil
+}
+
+func (s *Storage) deleteChunk(ctx context.Context, chunk []models.DeletedURLS) ([]models.DeletedURLS, error) {
+	var result []models.DeletedURLS
+
+	userIDs := make([]uuid.UUID, len(chunk))
+	shortURLs := make([]string, len(chunk))
+	teamIDs := make([]uuid.UUID, len(chunk))
+
+	for i, item := range chunk {
+		userIDs[i] = item.UserID
+		shortURLs[i] = string(item.ShortURL)
+		teamIDs[i] = item.TeamID
+	}
 
-			if errors.As(err, &pgErr) && pgerrcode.IsNoData(pgErr.Code) {
-				return errs.ErrShortURLNotFound
-			}
-			return err
+	rows, err := s.Pool.Query(ctx, `
+												update shorten_urls su 
+												set is_deleted = true 
+												from unnest($1::uuid[], $2::text[], $3::uuid[]) as del(created_user_id, shorten_url, team_id) 
+												where su.shorten_url = del.shorten_url 
+												  and not su.is_deleted
+												  and (
+												      (del.team_id = $4 and su.team_id is null and su.created_user_id = del.created_user_id)
+												      or su.team_id = del.team_id
+												  )
+												returning del.created_user_id, su.shorten_url, del.team_id;
+		`, userIDs, shortURLs, teamIDs, uuid.Nil,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql DeleteURL. Update error.")
+		return nil, storageError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.DeletedURLS
+
+		if err = rows.Scan(&item.UserID, &item.ShortURL, &item.TeamID); err != nil {
+			logger.Sugar.Infow("Postgresql DeleteURL. Scan error.")
+			return nil, storageError(err)
 		}
+		result = append(result, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		logger.Sugar.Infow("Postgresql DeleteURL. Rows error.")
+		return nil, storageError(err)
+	}
+	return result, nil
+}
+
+// DeleteExpired помечает удаленными ссылки, срок жизни которых истек к моменту now
+func (s *Storage) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	res, err := s.Pool.Exec(ctx, `
+												update shorten_urls 
+												set is_deleted = true 
+												where expires_at <= $1 
+												  and not is_deleted;
+		`, now,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql DeleteExpired. Update error.")
+		return 0, storageError(err)
 	}
-	return nil
+	return res.RowsAffected(), nil
 }
@@ -2,27 +2,39 @@ package postgresql
 
 import (
 	"context"
+	"errors"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
 	"github.com/dubrovsky1/url-shortener/internal/models"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"net/url"
 )
 
 func (s *Storage) GetURL(ctx context.Context, shortURL models.ShortURL) (models.ShortenURL, error) {
 	var shortenURL models.ShortenURL
 
-	row := s.DB.QueryRowContext(ctx, `
-												select s.original_url,
-												       s.is_deleted
+	row := s.Pool.QueryRow(ctx, `
+												select s.shorten_url,
+												       s.original_url,
+												       s.created_user_id,
+												       s.is_deleted,
+												       s.expires_at,
+												       s.redirect_type,
+												       s.forward_query,
+												       s.team_id
 												from shorten_urls s 
 												where s.shorten_url = $1;
 		`, shortURL,
 	)
 
-	err := row.Scan(&shortenURL.OriginalURL, &shortenURL.IsDel)
+	err := row.Scan(&shortenURL.ShortURL, &shortenURL.OriginalURL, &shortenURL.UserID, &shortenURL.IsDel, &shortenURL.ExpiresAt, &shortenURL.RedirectType, &shortenURL.ForwardQuery, &shortenURL.TeamID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.ShortenURL{}, errs.ErrShortURLNotFound
+	}
 	if err != nil {
 		logger.Sugar.Infow("Postgresql GetURL. Scan error.", "error", err.Error())
-		return models.ShortenURL{}, err
+		return models.ShortenURL{}, storageError(err)
 	}
 	return shortenURL, nil
 }
@@ -30,45 +42,77 @@ func (s *Storage) GetURL(ctx context.Context, shortURL models.ShortURL) (models.
 func (s *Storage) GetShortURL(ctx context.Context, originalURL models.OriginalURL) (models.ShortURL, error) {
 	var shortURL models.ShortURL
 
-	row := s.DB.QueryRowContext(ctx, `
+	row := s.Pool.QueryRow(ctx, `
 												select s.shorten_url 
 												from shorten_urls s 
-												where s.original_url = $1;
+												where s.original_url = $1
+												  and not s.is_deleted;
 		`, originalURL,
 	)
 
 	err := row.Scan(&shortURL)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
 	if err != nil {
 		logger.Sugar.Infow("Postgresql GetShortURL. Scan error.")
-		return "", err
+		return "", storageError(err)
 	}
 
-	return shortURL, nil
+	//как и остальные хранилища, сообщаем, что оригинальный URL уже сокращен
+	return shortURL, errs.ErrUniqueIndex
 }
 
+// ListByUserID - личные ссылки пользователя, ссылки его команд отдаются ListByTeamID
 func (s *Storage) ListByUserID(ctx context.Context, host models.Host, u uuid.UUID) ([]models.ShortenURL, error) {
-	var result []models.ShortenURL
-
-	rows, err := s.DB.QueryContext(ctx, `
+	return s.list(ctx, host, `
 												select s.original_url,
-												       s.shorten_url
+												       s.shorten_url,
+												       s.is_deleted,
+												       s.expires_at,
+												       s.redirect_type,
+												       s.forward_query
 												from shorten_urls s 
-												where s.created_user_id = $1;
+												where s.created_user_id = $1
+												  and s.team_id is null
+												order by s.id;
 		`, u,
 	)
+}
+
+// ListByTeamID - ссылки команды в порядке сохранения
+func (s *Storage) ListByTeamID(ctx context.Context, host models.Host, teamID uuid.UUID) ([]models.ShortenURL, error) {
+	return s.list(ctx, host, `
+												select s.original_url,
+												       s.shorten_url,
+												       s.is_deleted,
+												       s.expires_at,
+												       s.redirect_type,
+												       s.forward_query
+												from shorten_urls s 
+												where s.team_id = $1
+												order by s.id;
+		`, teamID,
+	)
+}
+
+func (s *Storage) list(ctx context.Context, host models.Host, query string, arg any) ([]models.ShortenURL, error) {
+	var result []models.ShortenURL
+
+	rows, err := s.Pool.Query(ctx, query, arg)
 	if err != nil {
-		logger.Sugar.Infow("Postgresql GetByUserId. QueryContext error.")
-		return nil, err
+		logger.Sugar.Infow("Postgresql List. Query error.")
+		return nil, storageError(err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var cur models.ShortenURL
 
-		err = rows.Scan(&cur.OriginalURL, &cur.ShortURL)
+		err = rows.Scan(&cur.OriginalURL, &cur.ShortURL, &cur.IsDel, &cur.ExpiresAt, &cur.RedirectType, &cur.ForwardQuery)
 		if err != nil {
-			logger.Sugar.Infow("Postgresql GetByUserId. Scan error.")
-			return nil, err
+			logger.Sugar.Infow("Postgresql List. Scan error.")
+			return nil, storageError(err)
 		}
 
 		//составляем результирующий сокращённый URL и добавляем в слайс
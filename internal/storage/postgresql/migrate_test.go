@@ -0,0 +1,24 @@
+package postgresql
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	//версии должны идти подряд начиная с 1, у каждой миграции есть up и down
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version, "Версии миграций должны идти подряд")
+		assert.NotEmpty(t, m.Name, "Пустое имя миграции")
+		assert.NotEmpty(t, m.Up, "Пустая up миграция")
+		assert.NotEmpty(t, m.Down, "Пустая down миграция")
+	}
+
+	migrator := &Migrator{migrations: migrations}
+	assert.Equal(t, len(migrations), migrator.Latest(), "Последняя версия не совпадает с количеством миграций")
+}
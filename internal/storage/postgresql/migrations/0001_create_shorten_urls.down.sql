@@ -0,0 +1 @@
+drop table if exists shorten_urls;
@@ -0,0 +1,3 @@
+drop index if exists ix_expires_at;
+
+alter table shorten_urls drop column if exists expires_at;
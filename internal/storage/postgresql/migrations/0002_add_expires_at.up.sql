@@ -0,0 +1,5 @@
+alter table shorten_urls add column if not exists expires_at timestamptz null;
+
+comment on column shorten_urls.expires_at is 'Момент истечения срока жизни ссылки';
+
+create index if not exists ix_expires_at on shorten_urls (expires_at) where not is_deleted;
@@ -0,0 +1,20 @@
+create table if not exists clicks
+(
+    id          bigserial   primary key,
+    shorten_url text        not null,
+    clicked_at  timestamptz not null,
+    referrer    text        null,
+    user_agent  text        null,
+    ip_hash     text        null
+);
+
+comment on table clicks is 'Таблица событий переходов по сокращенным ссылкам';
+
+comment on column clicks.id is 'Идентификатор';
+comment on column clicks.shorten_url is 'Сокращенный URL';
+comment on column clicks.clicked_at is 'Момент перехода';
+comment on column clicks.referrer is 'Источник перехода';
+comment on column clicks.user_agent is 'User-Agent клиента';
+comment on column clicks.ip_hash is 'Хеш IP-адреса клиента';
+
+create index if not exists ix_clicks_shorten_url_clicked_at on clicks (shorten_url, clicked_at);
@@ -0,0 +1 @@
+drop sequence if exists shorten_urls_code_seq;
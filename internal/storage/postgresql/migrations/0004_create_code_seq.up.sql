@@ -0,0 +1,3 @@
+create sequence if not exists shorten_urls_code_seq;
+
+comment on sequence shorten_urls_code_seq is 'Последовательность для генерации сокращенных URL';
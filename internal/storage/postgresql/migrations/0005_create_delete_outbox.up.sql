@@ -0,0 +1,25 @@
+create table if not exists delete_outbox
+(
+    id              bigserial   primary key,
+    created_user_id uuid        not null,
+    shorten_url     text        not null,
+    status          text        not null default 'pending',
+    attempts        int         not null default 0,
+    next_attempt_at timestamptz not null default now(),
+    last_error      text        null,
+    created_at      timestamptz not null default now()
+);
+
+comment on table delete_outbox is 'Очередь ссылок, принятых к удалению';
+
+comment on column delete_outbox.id is 'Идентификатор';
+comment on column delete_outbox.created_user_id is 'Идентификатор пользователя, запросившего удаление';
+comment on column delete_outbox.shorten_url is 'Сокращенный URL';
+comment on column delete_outbox.status is 'Состояние: pending - ожидает обработки, dead - попытки исчерпаны';
+comment on column delete_outbox.attempts is 'Число неудачных попыток';
+comment on column delete_outbox.next_attempt_at is 'Момент следующей попытки';
+comment on column delete_outbox.last_error is 'Ошибка последней попытки';
+comment on column delete_outbox.created_at is 'Момент постановки в очередь';
+
+create index if not exists ix_delete_outbox_pending on delete_outbox (next_attempt_at, id) where status = 'pending';
+create index if not exists ix_delete_outbox_dead on delete_outbox (created_user_id) where status = 'dead';
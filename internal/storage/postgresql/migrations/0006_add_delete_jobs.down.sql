@@ -0,0 +1,6 @@
+drop index if exists ix_delete_outbox_done;
+drop index if exists ix_delete_outbox_job_id;
+
+alter table delete_outbox drop column if exists updated_at;
+alter table delete_outbox drop column if exists result;
+alter table delete_outbox drop column if exists job_id;
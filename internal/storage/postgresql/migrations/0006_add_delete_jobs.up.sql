@@ -0,0 +1,10 @@
+alter table delete_outbox add column if not exists job_id uuid null;
+alter table delete_outbox add column if not exists result text null;
+alter table delete_outbox add column if not exists updated_at timestamptz not null default now();
+
+comment on column delete_outbox.job_id is 'Идентификатор задания на удаление';
+comment on column delete_outbox.result is 'Результат удаления: deleted, not_found, not_owned';
+comment on column delete_outbox.updated_at is 'Момент последнего изменения записи';
+
+create index if not exists ix_delete_outbox_job_id on delete_outbox (job_id);
+create index if not exists ix_delete_outbox_done on delete_outbox (updated_at) where status = 'done';
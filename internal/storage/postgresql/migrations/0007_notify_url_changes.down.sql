@@ -0,0 +1,2 @@
+drop trigger if exists tr_shorten_urls_changed on shorten_urls;
+drop function if exists notify_shorten_urls_changed();
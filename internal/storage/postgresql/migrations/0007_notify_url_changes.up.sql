@@ -0,0 +1,21 @@
+create or replace function notify_shorten_urls_changed() returns trigger as
+$$
+begin
+    if tg_op in ('UPDATE', 'DELETE') then
+        perform pg_notify('shorten_urls_changed', old.shorten_url);
+    end if;
+    if tg_op = 'INSERT' or (tg_op = 'UPDATE' and new.shorten_url <> old.shorten_url) then
+        perform pg_notify('shorten_urls_changed', new.shorten_url);
+    end if;
+    return null;
+end;
+$$ language plpgsql;
+
+comment on function notify_shorten_urls_changed() is 'Сообщает экземплярам сервиса код измененной ссылки для сброса кеша';
+
+drop trigger if exists tr_shorten_urls_changed on shorten_urls;
+create trigger tr_shorten_urls_changed
+    after insert or update or delete
+    on shorten_urls
+    for each row
+execute function notify_shorten_urls_changed();
@@ -0,0 +1,2 @@
+alter table shorten_urls drop column if exists forward_query;
+alter table shorten_urls drop column if exists redirect_type;
@@ -0,0 +1,5 @@
+alter table shorten_urls add column if not exists redirect_type smallint not null default 307;
+alter table shorten_urls add column if not exists forward_query bool not null default false;
+
+comment on column shorten_urls.redirect_type is 'Код ответа при переходе: 301, 302, 307 или 308';
+comment on column shorten_urls.forward_query is 'Передавать ли параметры запроса перехода в оригинальный URL';
@@ -0,0 +1,24 @@
+create table if not exists api_keys
+(
+    id              uuid        primary key,
+    created_user_id uuid        not null,
+    name            text        not null,
+    prefix          text        not null,
+    key_hash        text        not null unique,
+    scopes          text[]      not null,
+    created_at      timestamptz not null default now(),
+    revoked_at      timestamptz null
+);
+
+comment on table api_keys is 'Долгоживущие ключи доступа к API';
+
+comment on column api_keys.id is 'Идентификатор';
+comment on column api_keys.created_user_id is 'Владелец ключа';
+comment on column api_keys.name is 'Название ключа';
+comment on column api_keys.prefix is 'Начало ключа для поиска в списке';
+comment on column api_keys.key_hash is 'SHA-256 ключа, сам ключ не хранится';
+comment on column api_keys.scopes is 'Права ключа: read, write, delete';
+comment on column api_keys.created_at is 'Момент создания';
+comment on column api_keys.revoked_at is 'Момент отзыва';
+
+create index if not exists ix_api_keys_created_user_id on api_keys (created_user_id, created_at);
@@ -0,0 +1,16 @@
+create table if not exists users
+(
+    id            uuid        primary key,
+    login         text        not null,
+    password_hash text        not null,
+    created_at    timestamptz not null default now()
+);
+
+comment on table users is 'Зарегистрированные пользователи';
+
+comment on column users.id is 'Идентификатор, он же UserID в токене';
+comment on column users.login is 'Логин в нижнем регистре';
+comment on column users.password_hash is 'Хеш пароля bcrypt';
+comment on column users.created_at is 'Момент регистрации';
+
+create unique index if not exists uix_users_login on users (login);
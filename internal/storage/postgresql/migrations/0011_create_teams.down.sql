@@ -0,0 +1,3 @@
+alter table shorten_urls drop column if exists team_id;
+drop table if exists team_members;
+drop table if exists teams;
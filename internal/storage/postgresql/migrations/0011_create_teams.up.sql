@@ -0,0 +1,36 @@
+create table if not exists teams
+(
+    id         uuid        primary key,
+    name       text        not null,
+    created_at timestamptz not null default now()
+);
+
+comment on table teams is 'Команды, ссылки которых доступны всем участникам';
+
+comment on column teams.id is 'Идентификатор';
+comment on column teams.name is 'Название команды';
+comment on column teams.created_at is 'Момент создания';
+
+create table if not exists team_members
+(
+    team_id    uuid        not null references teams (id) on delete cascade,
+    user_id    uuid        not null,
+    role       text        not null,
+    created_at timestamptz not null default now(),
+    primary key (team_id, user_id)
+);
+
+comment on table team_members is 'Участники команд';
+
+comment on column team_members.team_id is 'Команда';
+comment on column team_members.user_id is 'Пользователь';
+comment on column team_members.role is 'Роль: owner, editor или viewer';
+comment on column team_members.created_at is 'Момент вступления';
+
+create index if not exists ix_team_members_user_id on team_members (user_id);
+
+alter table shorten_urls add column if not exists team_id uuid null references teams (id);
+
+comment on column shorten_urls.team_id is 'Команда, которой принадлежит ссылка, null - личная ссылка created_user_id';
+
+create index if not exists ix_shorten_urls_team_id on shorten_urls (team_id, id) where team_id is not null;
@@ -0,0 +1,4 @@
+drop index if exists uix_original_url;
+
+--при нескольких сокращениях одного URL после удаления откат не пройдет, пока лишние строки не удалены
+create unique index if not exists uix_original_url on shorten_urls (original_url);
@@ -0,0 +1,3 @@
+drop index if exists uix_original_url;
+
+create unique index if not exists uix_original_url on shorten_urls (original_url) where not is_deleted;
@@ -0,0 +1,86 @@
+package postgresql
+
+import (
+	"context"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"time"
+)
+
+// канал, в который триггер на shorten_urls пишет коды измененных ссылок
+const urlsChangedChannel = "shorten_urls_changed"
+
+const (
+	listenMinDelay     = 100 * time.Millisecond //задержка перед первой попыткой переподключения, дальше удваивается
+	listenMaxDelay     = 5 * time.Second        //предел задержки между попытками переподключения
+	listenPingInterval = 15 * time.Second       //как часто проверяется соединение, если уведомлений нет
+	listenPingTimeout  = 5 * time.Second        //сколько ждать ответа на проверку соединения
+)
+
+// Invalidator - получатель кодов ссылок, измененных любым экземпляром сервиса
+type Invalidator interface {
+	Invalidate(...models.ShortURL)
+	Reset()
+}
+
+// Listen подписывается на изменения shorten_urls и передает коды в inv, пока не отменен ctx.
+// При обрыве соединение восстанавливается, а inv сбрасывается целиком: уведомления за время обрыва потеряны
+func (s *Storage) Listen(ctx context.Context, inv Invalidator) {
+	delay := listenMinDelay
+
+	for {
+		subscribed, err := s.listen(ctx, inv)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Sugar.Infow("Postgresql Listen. Connection lost.", "err", err.Error(), "retry", delay.String())
+
+		if subscribed {
+			delay = listenMinDelay
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, listenMaxDelay)
+	}
+}
+
+// listen держит отдельное от пула соединение, чтобы подписка не занимала соединение пула и не закрывалась по его лимитам
+func (s *Storage) listen(ctx context.Context, inv Invalidator) (bool, error) {
+	conn, err := pgx.ConnectConfig(ctx, s.Pool.Config().ConnConfig.Copy())
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close(context.WithoutCancel(ctx))
+
+	if _, err = conn.Exec(ctx, `listen `+urlsChangedChannel+`;`); err != nil {
+		return false, err
+	}
+	inv.Reset()
+
+	for {
+		waitCtx, cancel := context.WithTimeout(ctx, listenPingInterval)
+		n, err := conn.WaitForNotification(waitCtx)
+		cancel()
+
+		switch {
+		case err == nil:
+			inv.Invalidate(models.ShortURL(n.Payload))
+		case pgconn.Timeout(err) && ctx.Err() == nil:
+			//уведомлений не было, проверяем, что соединение живо
+			pingCtx, cancel := context.WithTimeout(ctx, listenPingTimeout)
+			err = conn.Ping(pingCtx)
+			cancel()
+			if err != nil {
+				return true, err
+			}
+		default:
+			return true, err
+		}
+	}
+}
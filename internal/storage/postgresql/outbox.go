@@ -0,0 +1,178 @@
+package postgresql
+
+import (
+	"context"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+// outboxColumns - поля записи очереди в порядке сканирования scanOutbox
+const outboxColumns = `
+												       o.id,
+												       o.job_id,
+												       o.created_user_id,
+												       o.shorten_url,
+												       o.status,
+												       coalesce(o.result, ''),
+												       o.attempts,
+												       o.next_attempt_at,
+												       coalesce(o.last_error, ''),
+												       o.created_at,
+												       o.updated_at`
+
+// EnqueueDeletes ставит ссылки в очередь на удаление под заданием jobID
+func (s *Storage) EnqueueDeletes(ctx context.Context, jobID uuid.UUID, items []models.DeletedURLS) error {
+	userIDs := make([]uuid.UUID, len(items))
+	shortURLs := make([]string, len(items))
+
+	for i, item := range items {
+		userIDs[i] = item.UserID
+		shortURLs[i] = string(item.ShortURL)
+	}
+
+	_, err := s.Pool.Exec(ctx, `
+												insert into delete_outbox 
+												(
+													job_id,
+													created_user_id, 
+													shorten_url
+												) 
+												select $1, d.created_user_id, d.shorten_url 
+												from unnest($2::uuid[], $3::text[]) with ordinality as d(created_user_id, shorten_url, ord)
+												order by d.ord;
+		`, jobID, userIDs, shortURLs,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql EnqueueDeletes. Insert error.")
+		return storageError(err)
+	}
+	return nil
+}
+
+// FetchDeletes - готовые к обработке записи очереди в порядке поступления
+func (s *Storage) FetchDeletes(ctx context.Context, now time.Time, limit int) ([]models.OutboxItem, error) {
+	rows, err := s.Pool.Query(ctx, `
+												select `+outboxColumns+`
+												from delete_outbox o 
+												where o.status = 'pending' 
+												  and o.next_attempt_at <= $1
+												order by o.next_attempt_at, o.id
+												limit $2;
+		`, now, limit,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql FetchDeletes. Query error.")
+		return nil, storageError(err)
+	}
+	return scanOutbox(rows)
+}
+
+// UpdateDeletes сохраняет новое состояние записей очереди
+func (s *Storage) UpdateDeletes(ctx context.Context, items []models.OutboxItem) error {
+	ids := make([]int64, len(items))
+	statuses := make([]string, len(items))
+	results := make([]string, len(items))
+	attempts := make([]int32, len(items))
+	nextAttempts := make([]time.Time, len(items))
+	lastErrors := make([]string, len(items))
+	updates := make([]time.Time, len(items))
+
+	for i, item := range items {
+		ids[i] = item.ID
+		statuses[i] = item.Status
+		results[i] = item.Result
+		attempts[i] = int32(item.Attempts)
+		nextAttempts[i] = item.NextAttemptAt
+		lastErrors[i] = item.LastError
+		updates[i] = item.UpdatedAt
+	}
+
+	_, err := s.Pool.Exec(ctx, `
+												update delete_outbox o 
+												set status = u.status,
+												    result = nullif(u.result, ''),
+												    attempts = u.attempts,
+												    next_attempt_at = u.next_attempt_at,
+												    last_error = nullif(u.last_error, ''),
+												    updated_at = u.updated_at
+												from unnest($1::bigint[], $2::text[], $3::text[], $4::int[], $5::timestamptz[], $6::text[], $7::timestamptz[]) 
+												     as u(id, status, result, attempts, next_attempt_at, last_error, updated_at)
+												where o.id = u.id;
+		`, ids, statuses, results, attempts, nextAttempts, lastErrors, updates,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql UpdateDeletes. Update error.")
+		return storageError(err)
+	}
+	return nil
+}
+
+// GetDeleteJob - записи очереди, относящиеся к заданию jobID
+func (s *Storage) GetDeleteJob(ctx context.Context, jobID uuid.UUID) ([]models.OutboxItem, error) {
+	rows, err := s.Pool.Query(ctx, `
+												select `+outboxColumns+`
+												from delete_outbox o 
+												where o.job_id = $1
+												order by o.id;
+		`, jobID,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql GetDeleteJob. Query error.")
+		return nil, storageError(err)
+	}
+	return scanOutbox(rows)
+}
+
+// ListDeadDeletes - записи пользователя, исчерпавшие попытки удаления
+func (s *Storage) ListDeadDeletes(ctx context.Context, userID uuid.UUID) ([]models.OutboxItem, error) {
+	rows, err := s.Pool.Query(ctx, `
+												select `+outboxColumns+`
+												from delete_outbox o 
+												where o.status = 'dead' 
+												  and o.created_user_id = $1
+												order by o.id;
+		`, userID,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql ListDeadDeletes. Query error.")
+		return nil, storageError(err)
+	}
+	return scanOutbox(rows)
+}
+
+// PurgeDeletes убирает обработанные записи, последний раз изменявшиеся раньше before
+func (s *Storage) PurgeDeletes(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.Pool.Exec(ctx, `delete from delete_outbox where status = 'done' and updated_at < $1;`, before)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql PurgeDeletes. Delete error.")
+		return 0, storageError(err)
+	}
+	return res.RowsAffected(), nil
+}
+
+func scanOutbox(rows pgx.Rows) ([]models.OutboxItem, error) {
+	defer rows.Close()
+
+	var result []models.OutboxItem
+
+	for rows.Next() {
+		var item models.OutboxItem
+
+		err := rows.Scan(&item.ID, &item.JobID, &item.UserID, &item.ShortURL, &item.Status, &item.Result,
+			&item.Attempts, &item.NextAttemptAt, &item.LastError, &item.CreatedAt, &item.UpdatedAt)
+		if err != nil {
+			logger.Sugar.Infow("Postgresql outbox. Scan error.")
+			return nil, storageError(err)
+		}
+		result = append(result, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		logger.Sugar.Infow("Postgresql outbox. Rows error.")
+		return nil, storageError(err)
+	}
+	return result, nil
+}
@@ -2,62 +2,111 @@ package postgresql
 
 import (
 	"context"
-	"database/sql"
+	"errors"
+	"fmt"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"time"
 )
 
+// PoolConfig - ограничения пула соединений, нулевые значения оставляют настройки pgxpool по умолчанию
+type PoolConfig struct {
+	MaxConns        int32
+	MinConns        int32
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+}
+
 type Storage struct {
-	DB *sql.DB
+	Pool            *pgxpool.Pool
+	DeleteChunkSize int //размер порции ссылок в одном запросе на удаление
 }
 
 func (s *Storage) Close() error {
-	s.DB.Close()
+	s.Pool.Close()
 	return nil
 }
 
-func New(connectString string) (*Storage, error) {
-	db, err := sql.Open("pgx", connectString)
+func New(connectString string, poolConfig PoolConfig) (*Storage, error) {
+	pool, err := Open(connectString, poolConfig)
 	if err != nil {
-		logger.Sugar.Infow("Postgresql New. Database connection error.")
 		return nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	if err = db.PingContext(ctx); err != nil {
-		logger.Sugar.Infow("Postgresql New. PingContext error.")
+	migrator, err := NewMigrator(pool)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql New. Load migrations error.")
+		pool.Close()
+		return nil, err
+	}
+
+	//приводим схему к последней версии, если база новее приложения - отказываемся работать
+	if _, err = migrator.Up(ctx); err != nil {
+		logger.Sugar.Infow("Postgresql New. Migrations error.", "err", err.Error())
+		pool.Close()
 		return nil, err
 	}
 
-	queryString := `
-                        create table if not exists shorten_urls
-                        (
-                            id              serial primary key,
-                            original_url    text   not null,
-                            shorten_url     text   not null unique,
-                            created_user_id uuid   null,
-                            is_deleted      bool   not null default false
-                        );
-                        
-                        comment on table shorten_urls is 'Таблица для сокращенных ссылок';
-                        
-                        comment on column shorten_urls.id is 'Идентификатор';
-                        comment on column shorten_urls.original_url is 'Оригинальный URL';
-                        comment on column shorten_urls.shorten_url is 'Сокращенный URL';
-                        comment on column shorten_urls.created_user_id is 'Id создавшего пользователя';
-                        comment on column shorten_urls.is_deleted is 'Признак удаления';
-                                
-                        create unique index if not exists uix_original_url on shorten_urls (original_url);
-					`
-
-	_, err = db.ExecContext(ctx, queryString)
+	return &Storage{Pool: pool}, nil
+}
+
+// Open создает пул соединений и проверяет доступность базы без применения миграций
+func Open(connectString string, poolConfig PoolConfig) (*pgxpool.Pool, error) {
+	cfg, err := pgxpool.ParseConfig(connectString)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql New. Parse connection string error.")
+		return nil, err
+	}
+
+	if poolConfig.MaxConns > 0 {
+		cfg.MaxConns = poolConfig.MaxConns
+	}
+	if poolConfig.MinConns > 0 {
+		cfg.MinConns = poolConfig.MinConns
+	}
+	if poolConfig.MaxConnLifetime > 0 {
+		cfg.MaxConnLifetime = poolConfig.MaxConnLifetime
+	}
+	if poolConfig.MaxConnIdleTime > 0 {
+		cfg.MaxConnIdleTime = poolConfig.MaxConnIdleTime
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
 	if err != nil {
-		logger.Sugar.Infow("Postgresql New. Init query exec error.")
+		logger.Sugar.Infow("Postgresql New. Database connection error.")
+		return nil, err
+	}
+
+	if err = pool.Ping(ctx); err != nil {
+		logger.Sugar.Infow("Postgresql New. Ping error.")
+		pool.Close()
 		return nil, err
 	}
 
-	return &Storage{DB: db}, nil
+	return pool, nil
+}
+
+// storageError помечает ошибки соединения с базой как временную недоступность хранилища,
+// остальные ошибки возвращаются как есть
+func storageError(err error) error {
+	var connectErr *pgconn.ConnectError
+
+	if errors.As(err, &connectErr) || pgconn.Timeout(err) || pgconn.SafeToRetry(err) {
+		return fmt.Errorf("%w: %w", errs.ErrStorageUnavailable, err)
+	}
+	return err
+}
+
+// nullUUID - пустой идентификатор сохраняется как null
+func nullUUID(id uuid.UUID) uuid.NullUUID {
+	return uuid.NullUUID{UUID: id, Valid: id != uuid.Nil}
 }
@@ -0,0 +1,274 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateTeam в одной транзакции сохраняет новую команду и ее первого владельца
+func (s *Storage) CreateTeam(ctx context.Context, team models.Team, owner models.TeamMember) error {
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql CreateTeam. Begin transaction error.")
+		return storageError(err)
+	}
+	// если Commit будет раньше, то откат проигнорируется
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+												insert into teams
+												(
+													id,
+													name,
+													created_at
+												)
+												values ($1, $2, $3);
+		`, team.ID, team.Name, team.CreatedAt,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql CreateTeam. Insert team error.")
+		return storageError(err)
+	}
+
+	_, err = tx.Exec(ctx, `
+												insert into team_members
+												(
+													team_id,
+													user_id,
+													role,
+													created_at
+												)
+												values ($1, $2, $3, $4);
+		`, team.ID, owner.UserID, owner.Role, owner.CreatedAt,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql CreateTeam. Insert owner error.")
+		return storageError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Sugar.Infow("Postgresql CreateTeam. Commit error.")
+		return storageError(err)
+	}
+	return nil
+}
+
+// ListTeams - команды пользователя с его ролью в порядке создания
+func (s *Storage) ListTeams(ctx context.Context, userID uuid.UUID) ([]models.Team, error) {
+	rows, err := s.Pool.Query(ctx, `
+												select t.id, t.name, t.created_at, m.role
+												from teams t
+												join team_members m on m.team_id = t.id
+												where m.user_id = $1
+												order by t.created_at, t.id;
+		`, userID,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql ListTeams. Query error.")
+		return nil, storageError(err)
+	}
+	defer rows.Close()
+
+	var result []models.Team
+	for rows.Next() {
+		var team models.Team
+
+		if err = rows.Scan(&team.ID, &team.Name, &team.CreatedAt, &team.Role); err != nil {
+			logger.Sugar.Infow("Postgresql ListTeams. Scan error.")
+			return nil, storageError(err)
+		}
+		result = append(result, team)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, storageError(err)
+	}
+	return result, nil
+}
+
+// SaveTeamMember добавляет участника или меняет его роль, момент вступления не меняется.
+// Последнего владельца понизить нельзя, проверка и запись идут в одной транзакции под блокировкой команды
+func (s *Storage) SaveTeamMember(ctx context.Context, member models.TeamMember) error {
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql SaveTeamMember. Begin transaction error.")
+		return storageError(err)
+	}
+	// если Commit будет раньше, то откат проигнорируется
+	defer tx.Rollback(ctx)
+
+	if err = lockTeam(ctx, tx, member.TeamID); err != nil {
+		return err
+	}
+
+	if member.Role != models.RoleOwner {
+		if err = keepOwner(ctx, tx, member.TeamID, member.UserID); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+												insert into team_members
+												(
+													team_id,
+													user_id,
+													role,
+													created_at
+												)
+												values ($1, $2, $3, $4)
+												on conflict (team_id, user_id)
+												do update set role = excluded.role;
+		`, member.TeamID, member.UserID, member.Role, member.CreatedAt,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql SaveTeamMember. Upsert error.")
+		return storageError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Sugar.Infow("Postgresql SaveTeamMember. Commit error.")
+		return storageError(err)
+	}
+	return nil
+}
+
+// GetTeamMember - участие пользователя в команде
+func (s *Storage) GetTeamMember(ctx context.Context, teamID, userID uuid.UUID) (models.TeamMember, error) {
+	member := models.TeamMember{TeamID: teamID, UserID: userID}
+
+	err := s.Pool.QueryRow(ctx, `
+												select m.role, m.created_at
+												from team_members m
+												where m.team_id = $1
+												  and m.user_id = $2;
+		`, teamID, userID,
+	).Scan(&member.Role, &member.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.TeamMember{}, errs.ErrTeamMemberNotFound
+	}
+	if err != nil {
+		logger.Sugar.Infow("Postgresql GetTeamMember. Scan error.")
+		return models.TeamMember{}, storageError(err)
+	}
+	return member, nil
+}
+
+// ListTeamMembers - участники команды в порядке вступления
+func (s *Storage) ListTeamMembers(ctx context.Context, teamID uuid.UUID) ([]models.TeamMember, error) {
+	rows, err := s.Pool.Query(ctx, `
+												select m.user_id, m.role, m.created_at
+												from team_members m
+												where m.team_id = $1
+												order by m.created_at, m.user_id;
+		`, teamID,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql ListTeamMembers. Query error.")
+		return nil, storageError(err)
+	}
+	defer rows.Close()
+
+	result := []models.TeamMember{}
+	for rows.Next() {
+		member := models.TeamMember{TeamID: teamID}
+
+		if err = rows.Scan(&member.UserID, &member.Role, &member.CreatedAt); err != nil {
+			logger.Sugar.Infow("Postgresql ListTeamMembers. Scan error.")
+			return nil, storageError(err)
+		}
+		result = append(result, member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, storageError(err)
+	}
+	return result, nil
+}
+
+// DeleteTeamMember исключает пользователя из команды, созданные им ссылки остаются у команды.
+// Последнего владельца исключить нельзя
+func (s *Storage) DeleteTeamMember(ctx context.Context, teamID, userID uuid.UUID) error {
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql DeleteTeamMember. Begin transaction error.")
+		return storageError(err)
+	}
+	// если Commit будет раньше, то откат проигнорируется
+	defer tx.Rollback(ctx)
+
+	if err = lockTeam(ctx, tx, teamID); err != nil {
+		return err
+	}
+	if err = keepOwner(ctx, tx, teamID, userID); err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(ctx, `
+												delete from team_members
+												where team_id = $1
+												  and user_id = $2;
+		`, teamID, userID,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql DeleteTeamMember. Delete error.")
+		return storageError(err)
+	}
+	if res.RowsAffected() == 0 {
+		return errs.ErrTeamMemberNotFound
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Sugar.Infow("Postgresql DeleteTeamMember. Commit error.")
+		return storageError(err)
+	}
+	return nil
+}
+
+// lockTeam блокирует команду до конца транзакции: изменения состава одной команды выполняются по очереди
+func lockTeam(ctx context.Context, tx pgx.Tx, teamID uuid.UUID) error {
+	var id uuid.UUID
+
+	err := tx.QueryRow(ctx, `
+												select id
+												from teams
+												where id = $1
+												for update;
+		`, teamID,
+	).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errs.ErrTeamNotFound
+	}
+	if err != nil {
+		logger.Sugar.Infow("Postgresql lockTeam. Select error.")
+		return storageError(err)
+	}
+	return nil
+}
+
+// keepOwner - ErrTeamLastOwner, если userID единственный владелец команды
+func keepOwner(ctx context.Context, tx pgx.Tx, teamID, userID uuid.UUID) error {
+	var last bool
+
+	err := tx.QueryRow(ctx, `
+												select coalesce(bool_or(user_id = $2), false)
+												       and not coalesce(bool_or(user_id <> $2), false)
+												from team_members
+												where team_id = $1
+												  and role = 'owner';
+		`, teamID, userID,
+	).Scan(&last)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql keepOwner. Select error.")
+		return storageError(err)
+	}
+
+	if last {
+		return errs.ErrTeamLastOwner
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// CreateUser сохраняет нового пользователя, логин должен быть свободен
+func (s *Storage) CreateUser(ctx context.Context, user models.User) error {
+	_, err := s.Pool.Exec(ctx, `
+												insert into users 
+												(
+													id,
+													login,
+													password_hash,
+													created_at
+												) 
+												values ($1, $2, $3, $4);
+		`, user.ID, user.Login, user.PasswordHash, user.CreatedAt,
+	)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+		return errs.ErrUserExists
+	}
+	if err != nil {
+		logger.Sugar.Infow("Postgresql CreateUser. Insert error.")
+		return storageError(err)
+	}
+	return nil
+}
+
+// GetUserByLogin - пользователь по логину
+func (s *Storage) GetUserByLogin(ctx context.Context, login string) (models.User, error) {
+	return s.getUser(ctx, `
+												select u.id, u.login, u.password_hash, u.created_at
+												from users u 
+												where u.login = $1;
+		`, login,
+	)
+}
+
+// GetUserByID - пользователь по идентификатору
+func (s *Storage) GetUserByID(ctx context.Context, id uuid.UUID) (models.User, error) {
+	return s.getUser(ctx, `
+												select u.id, u.login, u.password_hash, u.created_at
+												from users u 
+												where u.id = $1;
+		`, id,
+	)
+}
+
+func (s *Storage) getUser(ctx context.Context, query string, arg any) (models.User, error) {
+	var user models.User
+
+	err := s.Pool.QueryRow(ctx, query, arg).Scan(&user.ID, &user.Login, &user.PasswordHash, &user.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.User{}, errs.ErrUserNotFound
+	}
+	if err != nil {
+		logger.Sugar.Infow("Postgresql GetUser. Scan error.")
+		return models.User{}, storageError(err)
+	}
+	return user, nil
+}
+
+// MergeUser в одной транзакции передает ссылки, API-ключи, участие в командах и задания на удаление
+// пользователя from пользователю to, возвращает число перенесенных ссылок. Триггер изменений ссылок сбрасывает их в кешах реплик
+func (s *Storage) MergeUser(ctx context.Context, from, to uuid.UUID) (int64, error) {
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql MergeUser. Begin transaction error.")
+		return 0, storageError(err)
+	}
+	// если Commit будет раньше, то откат проигнорируется
+	defer tx.Rollback(ctx)
+
+	res, err := tx.Exec(ctx, `
+												update shorten_urls 
+												set created_user_id = $2 
+												where created_user_id = $1;
+		`, from, to,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql MergeUser. Update urls error.")
+		return 0, storageError(err)
+	}
+
+	_, err = tx.Exec(ctx, `
+												update api_keys 
+												set created_user_id = $2 
+												where created_user_id = $1;
+		`, from, to,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql MergeUser. Update api keys error.")
+		return 0, storageError(err)
+	}
+
+	//если оба пользователя в одной команде, остается одно участие со старшей ролью и более ранним вступлением
+	_, err = tx.Exec(ctx, `
+												insert into team_members (team_id, user_id, role, created_at)
+												select team_id, $2, role, created_at
+												from team_members
+												where user_id = $1
+												on conflict (team_id, user_id) do update
+												set role = case 
+												               when team_members.role = 'owner' or excluded.role = 'owner' then 'owner'
+												               when team_members.role = 'editor' or excluded.role = 'editor' then 'editor'
+												               else team_members.role
+												           end,
+												    created_at = least(team_members.created_at, excluded.created_at);
+		`, from, to,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql MergeUser. Merge team members error.")
+		return 0, storageError(err)
+	}
+
+	_, err = tx.Exec(ctx, `
+												delete from team_members 
+												where user_id = $1;
+		`, from,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql MergeUser. Delete team members error.")
+		return 0, storageError(err)
+	}
+
+	_, err = tx.Exec(ctx, `
+												update delete_outbox 
+												set created_user_id = $2 
+												where created_user_id = $1;
+		`, from, to,
+	)
+	if err != nil {
+		logger.Sugar.Infow("Postgresql MergeUser. Update delete outbox error.")
+		return 0, storageError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		logger.Sugar.Infow("Postgresql MergeUser. Commit error.")
+		return 0, storageError(err)
+	}
+	return res.RowsAffected(), nil
+}
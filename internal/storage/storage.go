@@ -5,11 +5,13 @@ import (
 	"github.com/dubrovsky1/url-shortener/internal/config"
 	"github.com/dubrovsky1/url-shortener/internal/middleware/logger"
 	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/dubrovsky1/url-shortener/internal/storage/bolt"
 	"github.com/dubrovsky1/url-shortener/internal/storage/file"
 	"github.com/dubrovsky1/url-shortener/internal/storage/memory"
 	"github.com/dubrovsky1/url-shortener/internal/storage/postgresql"
 	"github.com/google/uuid"
 	"io"
+	"time"
 )
 
 //go:generate mockgen -source=storage.go -destination=../storage/mocks/storage.go -package=mocks
@@ -19,7 +21,33 @@ type Storager interface {
 	GetShortURL(context.Context, models.OriginalURL) (models.ShortURL, error)
 	InsertBatch(context.Context, []models.BatchRequest, models.Host, uuid.UUID) ([]models.BatchResponse, error)
 	ListByUserID(context.Context, models.Host, uuid.UUID) ([]models.ShortenURL, error)
-	DeleteURL(context.Context, []models.DeletedURLS) error
+	DeleteURL(context.Context, []models.DeletedURLS) ([]models.DeletedURLS, error)
+	DeleteExpired(context.Context, time.Time) (int64, error)
+	EnqueueDeletes(context.Context, uuid.UUID, []models.DeletedURLS) error
+	FetchDeletes(context.Context, time.Time, int) ([]models.OutboxItem, error)
+	UpdateDeletes(context.Context, []models.OutboxItem) error
+	GetDeleteJob(context.Context, uuid.UUID) ([]models.OutboxItem, error)
+	ListDeadDeletes(context.Context, uuid.UUID) ([]models.OutboxItem, error)
+	PurgeDeletes(context.Context, time.Time) (int64, error)
+	SaveClicks(context.Context, []models.Click) error
+	ListClicks(context.Context, models.ShortURL, time.Time, time.Time) ([]models.Click, error)
+	ClickStats(context.Context, models.ShortURL, models.StatsParams) (models.Stats, error)
+	SaveAPIKey(context.Context, models.APIKey) error
+	GetAPIKey(context.Context, string) (models.APIKey, error)
+	ListAPIKeys(context.Context, uuid.UUID) ([]models.APIKey, error)
+	RevokeAPIKey(context.Context, uuid.UUID, uuid.UUID, time.Time) error
+	CreateUser(context.Context, models.User) error
+	GetUserByLogin(context.Context, string) (models.User, error)
+	GetUserByID(context.Context, uuid.UUID) (models.User, error)
+	MergeUser(context.Context, uuid.UUID, uuid.UUID) (int64, error)
+	CreateTeam(context.Context, models.Team, models.TeamMember) error
+	ListTeams(context.Context, uuid.UUID) ([]models.Team, error)
+	SaveTeamMember(context.Context, models.TeamMember) error
+	GetTeamMember(context.Context, uuid.UUID, uuid.UUID) (models.TeamMember, error)
+	ListTeamMembers(context.Context, uuid.UUID) ([]models.TeamMember, error)
+	DeleteTeamMember(context.Context, uuid.UUID, uuid.UUID) error
+	ListByTeamID(context.Context, models.Host, uuid.UUID) ([]models.ShortenURL, error)
+	NextID(context.Context) (int64, error)
 	io.Closer
 }
 
@@ -28,13 +56,32 @@ func GetStorage(flags config.Config) (Storager, error) {
 	var err error
 
 	if flags.ConnectionString != "" {
-		db, err = postgresql.New(flags.ConnectionString)
-		if err != nil {
+		pg, errNew := postgresql.New(flags.ConnectionString, postgresql.PoolConfig{
+			MaxConns:        int32(flags.DBMaxConns),
+			MinConns:        int32(flags.DBMinConns),
+			MaxConnLifetime: flags.DBMaxConnLife,
+			MaxConnIdleTime: flags.DBMaxConnIdle,
+		})
+		if errNew != nil {
 			logger.Sugar.Infow("Postgresql storage init error.")
+			return nil, errNew
+		}
+		pg.DeleteChunkSize = flags.DeleteChunkSize
+		db = pg
+	} else if flags.BoltStoragePath != "" {
+		db, err = bolt.New(flags.BoltStoragePath)
+		if err != nil {
+			logger.Sugar.Infow("Bolt storage init error.")
 			return nil, err
 		}
 	} else if flags.FileStoragePath != "" {
-		db, err = file.New(flags.FileStoragePath)
+		syncPolicy, errPolicy := file.ParseSyncPolicy(flags.FileSync)
+		if errPolicy != nil {
+			logger.Sugar.Infow("File storage fsync policy error.")
+			return nil, errPolicy
+		}
+
+		db, err = file.New(flags.FileStoragePath, file.WithSyncPolicy(syncPolicy))
 		if err != nil {
 			logger.Sugar.Infow("File storage init error.")
 			return nil, err
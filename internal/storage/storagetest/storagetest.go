@@ -0,0 +1,798 @@
+// Package storagetest - общий набор проверок, которым должна соответствовать любая реализация storage.Storager
+package storagetest
+
+import (
+	"context"
+	errs "github.com/dubrovsky1/url-shortener/internal/errors"
+	"github.com/dubrovsky1/url-shortener/internal/models"
+	"github.com/dubrovsky1/url-shortener/internal/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Factory создает пустое хранилище для одной проверки, закрытие регистрируется через t.Cleanup
+type Factory func(t *testing.T) storage.Storager
+
+const host models.Host = "localhost:8080"
+
+// Run прогоняет все проверки на хранилищах, созданных newStorage
+func Run(t *testing.T, newStorage Factory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s storage.Storager)
+	}{
+		{name: "SaveURL and GetURL", run: testSaveURL},
+		{name: "GetShortURL", run: testGetShortURL},
+		{name: "InsertBatch", run: testInsertBatch},
+		{name: "ListByUserID", run: testListByUserID},
+		{name: "DeleteURL", run: testDeleteURL},
+		{name: "DeleteExpired", run: testDeleteExpired},
+		{name: "Clicks", run: testClicks},
+		{name: "ClickStats", run: testClickStats},
+		{name: "Outbox", run: testOutbox},
+		{name: "NextID", run: testNextID},
+		{name: "APIKeys", run: testAPIKeys},
+		{name: "Users", run: testUsers},
+		{name: "Teams", run: testTeams},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newStorage(t))
+		})
+	}
+}
+
+func testSaveURL(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	userID := uuid.New()
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Microsecond)
+
+	shortURL, err := s.SaveURL(ctx, models.ShortenURL{
+		OriginalURL:  "https://practicum.yandex.ru/",
+		ShortURL:     "jB9Wbk",
+		UserID:       userID,
+		ExpiresAt:    &expiresAt,
+		RedirectType: http.StatusMovedPermanently,
+		ForwardQuery: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.ShortURL("jB9Wbk"), shortURL)
+
+	row, err := s.GetURL(ctx, "jB9Wbk")
+	require.NoError(t, err)
+	assert.Equal(t, models.ShortURL("jB9Wbk"), row.ShortURL)
+	assert.Equal(t, models.OriginalURL("https://practicum.yandex.ru/"), row.OriginalURL)
+	assert.Equal(t, userID, row.UserID)
+	assert.False(t, row.IsDel)
+	require.NotNil(t, row.ExpiresAt)
+	assert.True(t, expiresAt.Equal(*row.ExpiresAt), "Срок жизни ссылки должен сохраниться")
+	assert.Equal(t, http.StatusMovedPermanently, row.RedirectType)
+	assert.True(t, row.ForwardQuery)
+
+	//повторное сокращение того же URL возвращает сохраненный код и ErrUniqueIndex
+	shortURL, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "abcdef", UserID: uuid.New()})
+	assert.ErrorIs(t, err, errs.ErrUniqueIndex)
+	assert.Equal(t, models.ShortURL("jB9Wbk"), shortURL)
+
+	//занятый код для другого URL - ErrShortURLExists
+	_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://yandex.ru/", ShortURL: "jB9Wbk", UserID: userID})
+	assert.ErrorIs(t, err, errs.ErrShortURLExists)
+
+	_, err = s.GetURL(ctx, "abcdef")
+	assert.ErrorIs(t, err, errs.ErrShortURLNotFound)
+}
+
+func testGetShortURL(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+
+	shortURL, err := s.GetShortURL(ctx, "https://practicum.yandex.ru/")
+	assert.NoError(t, err)
+	assert.Empty(t, shortURL)
+
+	_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk", UserID: uuid.New()})
+	require.NoError(t, err)
+
+	shortURL, err = s.GetShortURL(ctx, "https://practicum.yandex.ru/")
+	assert.ErrorIs(t, err, errs.ErrUniqueIndex)
+	assert.Equal(t, models.ShortURL("jB9Wbk"), shortURL)
+}
+
+func testInsertBatch(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	_, err := s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://ya.ru/", ShortURL: "saved1", UserID: uuid.New()})
+	require.NoError(t, err)
+
+	//уже сохраненный URL возвращается со своим кодом и признаком конфликта, повтор URL внутри пачки конфликтом не является,
+	//порядок ответа совпадает с порядком запроса
+	result, err := s.InsertBatch(ctx, []models.BatchRequest{
+		{CorrelationID: "1", URL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk"},
+		{CorrelationID: "2", URL: "https://ya.ru/", ShortURL: "wqev4E"},
+		{CorrelationID: "3", URL: "https://yandex.ru/", ShortURL: "p0Lk3s", RedirectType: http.StatusPermanentRedirect, ForwardQuery: true},
+		{CorrelationID: "4", URL: "https://practicum.yandex.ru/", ShortURL: "Zx8Yq1"},
+	}, host, userID)
+	require.NoError(t, err)
+	assert.Equal(t, []models.BatchResponse{
+		{CorrelationID: "1", ShortURL: "http://localhost:8080/jB9Wbk"},
+		{CorrelationID: "2", ShortURL: "http://localhost:8080/saved1", Conflict: true},
+		{CorrelationID: "3", ShortURL: "http://localhost:8080/p0Lk3s"},
+		{CorrelationID: "4", ShortURL: "http://localhost:8080/jB9Wbk"},
+	}, result)
+
+	row, err := s.GetURL(ctx, "p0Lk3s")
+	require.NoError(t, err)
+	assert.Equal(t, userID, row.UserID)
+	assert.Equal(t, http.StatusPermanentRedirect, row.RedirectType)
+	assert.True(t, row.ForwardQuery)
+
+	//код из пачки, занятый другой ссылкой, - ErrShortURLExists
+	_, err = s.InsertBatch(ctx, []models.BatchRequest{
+		{CorrelationID: "1", URL: "https://go.dev/", ShortURL: "jB9Wbk"},
+	}, host, userID)
+	assert.ErrorIs(t, err, errs.ErrShortURLExists)
+
+	//коллизия в середине пачки не оставляет сохраненными строки до нее, повтор пачки с новыми кодами не видит их конфликтами
+	_, err = s.InsertBatch(ctx, []models.BatchRequest{
+		{CorrelationID: "1", URL: "https://go.dev/", ShortURL: "Ab3dE5"},
+		{CorrelationID: "2", URL: "https://pkg.go.dev/", ShortURL: "p0Lk3s"},
+		{CorrelationID: "3", URL: "https://go.dev/blog/", ShortURL: "Qw3rTy"},
+	}, host, userID)
+	assert.ErrorIs(t, err, errs.ErrShortURLExists)
+
+	_, err = s.GetURL(ctx, "Ab3dE5")
+	assert.ErrorIs(t, err, errs.ErrShortURLNotFound)
+
+	result, err = s.InsertBatch(ctx, []models.BatchRequest{
+		{CorrelationID: "1", URL: "https://go.dev/", ShortURL: "Lm5nOp"},
+		{CorrelationID: "2", URL: "https://pkg.go.dev/", ShortURL: "Rs7tUv"},
+		{CorrelationID: "3", URL: "https://go.dev/blog/", ShortURL: "Wx9yZa"},
+	}, host, userID)
+	require.NoError(t, err)
+	assert.Equal(t, []models.BatchResponse{
+		{CorrelationID: "1", ShortURL: "http://localhost:8080/Lm5nOp"},
+		{CorrelationID: "2", ShortURL: "http://localhost:8080/Rs7tUv"},
+		{CorrelationID: "3", ShortURL: "http://localhost:8080/Wx9yZa"},
+	}, result)
+
+	list, err := s.ListByUserID(ctx, host, userID)
+	require.NoError(t, err)
+	assert.Len(t, list, 5)
+
+	//истекшая, но еще не помеченная удаленной ссылка не возвращается конфликтом, URL сокращается заново
+	expiresAt := time.Now().Add(-time.Minute).UTC()
+	_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://go.dev/doc/", ShortURL: "Ex1pRd", UserID: userID, ExpiresAt: &expiresAt})
+	require.NoError(t, err)
+
+	result, err = s.InsertBatch(ctx, []models.BatchRequest{
+		{CorrelationID: "1", URL: "https://go.dev/doc/", ShortURL: "Fr3sh1"},
+	}, host, userID)
+	require.NoError(t, err)
+	assert.Equal(t, []models.BatchResponse{{CorrelationID: "1", ShortURL: "http://localhost:8080/Fr3sh1"}}, result)
+
+	row, err = s.GetURL(ctx, "Ex1pRd")
+	require.NoError(t, err)
+	assert.True(t, row.IsDel)
+}
+
+func testListByUserID(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	userID := uuid.New()
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Microsecond)
+
+	_, err := s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk", UserID: userID})
+	require.NoError(t, err)
+	_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://yandex.ru/", ShortURL: "wqev4E", UserID: userID, ExpiresAt: &expiresAt})
+	require.NoError(t, err)
+	_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://ya.ru/", ShortURL: "p0Lk3s", UserID: uuid.New()})
+	require.NoError(t, err)
+
+	_, err = s.DeleteURL(ctx, []models.DeletedURLS{{UserID: userID, ShortURL: "jB9Wbk"}})
+	require.NoError(t, err)
+
+	//ссылки пользователя в порядке сохранения, удаленные остаются в списке с признаком удаления
+	list, err := s.ListByUserID(ctx, host, userID)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+
+	assert.Equal(t, models.ShortURL("http://localhost:8080/jB9Wbk"), list[0].ShortURL)
+	assert.Equal(t, models.OriginalURL("https://practicum.yandex.ru/"), list[0].OriginalURL)
+	assert.True(t, list[0].IsDel)
+	assert.Nil(t, list[0].ExpiresAt)
+
+	assert.Equal(t, models.ShortURL("http://localhost:8080/wqev4E"), list[1].ShortURL)
+	assert.False(t, list[1].IsDel)
+	require.NotNil(t, list[1].ExpiresAt)
+	assert.True(t, expiresAt.Equal(*list[1].ExpiresAt))
+
+	list, err = s.ListByUserID(ctx, host, uuid.New())
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func testDeleteURL(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	owner := uuid.New()
+	stranger := uuid.New()
+
+	_, err := s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk", UserID: owner})
+	require.NoError(t, err)
+	_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://yandex.ru/", ShortURL: "wqev4E", UserID: owner})
+	require.NoError(t, err)
+
+	//возвращаются только действительно удаленные ссылки: чужие, неизвестные и повторы пропускаются
+	deleted, err := s.DeleteURL(ctx, []models.DeletedURLS{
+		{UserID: stranger, ShortURL: "wqev4E"},
+		{UserID: owner, ShortURL: "jB9Wbk"},
+		{UserID: owner, ShortURL: "abcdef"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []models.DeletedURLS{{UserID: owner, ShortURL: "jB9Wbk"}}, deleted)
+
+	deleted, err = s.DeleteURL(ctx, []models.DeletedURLS{{UserID: owner, ShortURL: "jB9Wbk"}})
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+
+	row, err := s.GetURL(ctx, "jB9Wbk")
+	require.NoError(t, err)
+	assert.True(t, row.IsDel)
+
+	row, err = s.GetURL(ctx, "wqev4E")
+	require.NoError(t, err)
+	assert.False(t, row.IsDel)
+
+	//удаленная ссылка не занимает оригинальный URL: его можно сократить заново под новым кодом
+	shortURL, err := s.GetShortURL(ctx, "https://practicum.yandex.ru/")
+	require.NoError(t, err)
+	assert.Empty(t, shortURL)
+
+	shortURL, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "Zx8Yq1", UserID: owner})
+	require.NoError(t, err)
+	assert.Equal(t, models.ShortURL("Zx8Yq1"), shortURL)
+
+	shortURL, err = s.GetShortURL(ctx, "https://practicum.yandex.ru/")
+	assert.ErrorIs(t, err, errs.ErrUniqueIndex)
+	assert.Equal(t, models.ShortURL("Zx8Yq1"), shortURL)
+}
+
+func testDeleteExpired(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	userID := uuid.New()
+	now := time.Now().UTC()
+	expired := now.Add(-time.Minute)
+	alive := now.Add(time.Hour)
+
+	_, err := s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk", UserID: userID, ExpiresAt: &expired})
+	require.NoError(t, err)
+	_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://yandex.ru/", ShortURL: "wqev4E", UserID: userID, ExpiresAt: &alive})
+	require.NoError(t, err)
+	_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://ya.ru/", ShortURL: "p0Lk3s", UserID: userID})
+	require.NoError(t, err)
+
+	count, err := s.DeleteExpired(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	//уже удаленные ссылки повторно не считаются
+	count, err = s.DeleteExpired(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+
+	row, err := s.GetURL(ctx, "jB9Wbk")
+	require.NoError(t, err)
+	assert.True(t, row.IsDel)
+
+	row, err = s.GetURL(ctx, "wqev4E")
+	require.NoError(t, err)
+	assert.False(t, row.IsDel)
+
+	//истекшая ссылка не занимает оригинальный URL
+	shortURL, err := s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "Zx8Yq1", UserID: userID})
+	require.NoError(t, err)
+	assert.Equal(t, models.ShortURL("Zx8Yq1"), shortURL)
+}
+
+func testClicks(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	require.NoError(t, s.SaveClicks(ctx, []models.Click{
+		{ShortURL: "jB9Wbk", ClickedAt: base.Add(time.Hour), Referrer: "https://ya.ru/", UserAgent: "curl/8.0", IPHash: "abc"},
+		{ShortURL: "jB9Wbk", ClickedAt: base},
+		{ShortURL: "jB9Wbk", ClickedAt: base.Add(2 * time.Hour)},
+		{ShortURL: "wqev4E", ClickedAt: base},
+	}))
+
+	//период [from, to), события по времени перехода
+	clicks, err := s.ListClicks(ctx, "jB9Wbk", base, base.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, clicks, 2)
+
+	assert.True(t, base.Equal(clicks[0].ClickedAt))
+	assert.True(t, base.Add(time.Hour).Equal(clicks[1].ClickedAt))
+	assert.Equal(t, models.ShortURL("jB9Wbk"), clicks[1].ShortURL)
+	assert.Equal(t, "https://ya.ru/", clicks[1].Referrer)
+	assert.Equal(t, "curl/8.0", clicks[1].UserAgent)
+	assert.Equal(t, "abc", clicks[1].IPHash)
+
+	clicks, err = s.ListClicks(ctx, "abcdef", base, base.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, clicks)
+}
+
+func testClickStats(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	require.NoError(t, s.SaveClicks(ctx, []models.Click{
+		{ShortURL: "jB9Wbk", ClickedAt: base.Add(time.Hour), Referrer: "https://www.Google.com/search?q=1", UserAgent: "Mozilla/5.0 Chrome/120.0 Safari/537.36", IPHash: "a"},
+		{ShortURL: "jB9Wbk", ClickedAt: base.Add(2 * time.Hour), Referrer: "https://google.com/", UserAgent: "curl/8.0", IPHash: "a"},
+		{ShortURL: "jB9Wbk", ClickedAt: base.Add(26 * time.Hour), UserAgent: "Googlebot/2.1", IPHash: "b"},
+		{ShortURL: "jB9Wbk", ClickedAt: base.Add(27 * time.Hour), Referrer: "android-app://org.telegram.messenger"},
+		{ShortURL: "jB9Wbk", ClickedAt: base.Add(72 * time.Hour)},
+		{ShortURL: "wqev4E", ClickedAt: base.Add(time.Hour), IPHash: "c"},
+	}))
+
+	//период [from, to), пустые интервалы заполнены нулями
+	result, err := s.ClickStats(ctx, "jB9Wbk", models.StatsParams{From: base, To: base.Add(72 * time.Hour), Bucket: "day"})
+	require.NoError(t, err)
+
+	assert.Equal(t, models.ShortURL("jB9Wbk"), result.ShortURL)
+	assert.Equal(t, 4, result.TotalClicks)
+	assert.Equal(t, 2, result.UniqueVisitors)
+	assert.Equal(t, []models.StatsPoint{
+		{Time: base, Clicks: 2, UniqueVisitors: 1},
+		{Time: base.AddDate(0, 0, 1), Clicks: 2, UniqueVisitors: 1},
+		{Time: base.AddDate(0, 0, 2)},
+	}, result.Series)
+	assert.Equal(t, []models.StatsCount{
+		{Name: "google.com", Count: 2},
+		{Name: "(direct)", Count: 1},
+		{Name: "org.telegram.messenger", Count: 1},
+	}, result.TopReferrers)
+	assert.Equal(t, []models.StatsCount{
+		{Name: "Bot", Count: 1},
+		{Name: "Chrome", Count: 1},
+		{Name: "Unknown", Count: 1},
+		{Name: "curl", Count: 1},
+	}, result.UserAgents)
+
+	result, err = s.ClickStats(ctx, "abcdef", models.StatsParams{From: base, To: base.Add(2 * time.Hour), Bucket: "hour"})
+	require.NoError(t, err)
+	assert.Zero(t, result.TotalClicks)
+	assert.Len(t, result.Series, 2)
+	assert.Empty(t, result.TopReferrers)
+}
+
+func testOutbox(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	userID := uuid.New()
+	jobID := uuid.New()
+	otherJobID := uuid.New()
+
+	require.NoError(t, s.EnqueueDeletes(ctx, jobID, []models.DeletedURLS{
+		{UserID: userID, ShortURL: "jB9Wbk"},
+		{UserID: userID, ShortURL: "wqev4E"},
+	}))
+	require.NoError(t, s.EnqueueDeletes(ctx, otherJobID, []models.DeletedURLS{{UserID: uuid.New(), ShortURL: "p0Lk3s"}}))
+
+	//готовые записи в порядке поступления, не больше limit
+	items, err := s.FetchDeletes(ctx, time.Now().Add(time.Second), 2)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, models.ShortURL("jB9Wbk"), items[0].ShortURL)
+	assert.Equal(t, models.ShortURL("wqev4E"), items[1].ShortURL)
+	assert.Equal(t, jobID, items[0].JobID)
+	assert.Equal(t, userID, items[0].UserID)
+	assert.Equal(t, models.OutboxPending, items[0].Status)
+
+	now := time.Now()
+
+	items[0].Status = models.OutboxDone
+	items[0].Result = models.DeleteResultDeleted
+	items[0].UpdatedAt = now.Add(-time.Hour)
+	items[1].Status = models.OutboxDead
+	items[1].Result = models.DeleteResultFailed
+	items[1].Attempts = 3
+	items[1].LastError = "timeout"
+	items[1].UpdatedAt = now
+	require.NoError(t, s.UpdateDeletes(ctx, items))
+
+	//отложенная запись не выдается раньше срока
+	later, err := s.FetchDeletes(ctx, now.Add(time.Second), 10)
+	require.NoError(t, err)
+	require.Len(t, later, 1)
+	later[0].Attempts = 1
+	later[0].NextAttemptAt = now.Add(time.Hour)
+	require.NoError(t, s.UpdateDeletes(ctx, later))
+
+	later, err = s.FetchDeletes(ctx, now.Add(time.Second), 10)
+	require.NoError(t, err)
+	assert.Empty(t, later)
+
+	dead, err := s.ListDeadDeletes(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, models.ShortURL("wqev4E"), dead[0].ShortURL)
+	assert.Equal(t, 3, dead[0].Attempts)
+	assert.Equal(t, "timeout", dead[0].LastError)
+
+	dead, err = s.ListDeadDeletes(ctx, uuid.New())
+	require.NoError(t, err)
+	assert.Empty(t, dead)
+
+	job, err := s.GetDeleteJob(ctx, jobID)
+	require.NoError(t, err)
+	require.Len(t, job, 2)
+	assert.Equal(t, models.DeleteResultDeleted, job[0].Result)
+
+	//вычищаются только обработанные записи, измененные раньше границы
+	count, err := s.PurgeDeletes(ctx, now.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	job, err = s.GetDeleteJob(ctx, jobID)
+	require.NoError(t, err)
+	require.Len(t, job, 1)
+	assert.Equal(t, models.OutboxDead, job[0].Status)
+
+	job, err = s.GetDeleteJob(ctx, uuid.New())
+	require.NoError(t, err)
+	assert.Empty(t, job)
+}
+
+func testNextID(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+
+	first, err := s.NextID(ctx)
+	require.NoError(t, err)
+	assert.Positive(t, first)
+
+	second, err := s.NextID(ctx)
+	require.NoError(t, err)
+	assert.Greater(t, second, first)
+}
+
+func testAPIKeys(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	owner, stranger := uuid.New(), uuid.New()
+
+	first := models.APIKey{ID: uuid.New(), UserID: owner, Name: "ci", Prefix: "usk_first000", Hash: "hash-1",
+		Scopes: []models.Scope{models.ScopeRead, models.ScopeWrite}, CreatedAt: base}
+	second := models.APIKey{ID: uuid.New(), UserID: owner, Name: "backup", Prefix: "usk_second00", Hash: "hash-2",
+		Scopes: []models.Scope{models.ScopeDelete}, CreatedAt: base.Add(time.Hour)}
+	foreign := models.APIKey{ID: uuid.New(), UserID: stranger, Name: "other", Prefix: "usk_foreign0", Hash: "hash-3",
+		Scopes: []models.Scope{models.ScopeRead}, CreatedAt: base}
+
+	for _, key := range []models.APIKey{second, first, foreign} {
+		require.NoError(t, s.SaveAPIKey(ctx, key))
+	}
+
+	got, err := s.GetAPIKey(ctx, "hash-1")
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, got.ID)
+	assert.Equal(t, owner, got.UserID)
+	assert.Equal(t, "ci", got.Name)
+	assert.Equal(t, "usk_first000", got.Prefix)
+	assert.Equal(t, first.Scopes, got.Scopes)
+	assert.True(t, base.Equal(got.CreatedAt))
+	assert.Nil(t, got.RevokedAt)
+
+	_, err = s.GetAPIKey(ctx, "unknown")
+	assert.ErrorIs(t, err, errs.ErrAPIKeyNotFound)
+
+	//ключи пользователя в порядке создания, чужие не попадают
+	keys, err := s.ListAPIKeys(ctx, owner)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, first.ID, keys[0].ID)
+	assert.Equal(t, second.ID, keys[1].ID)
+
+	//чужой ключ отозвать нельзя
+	assert.ErrorIs(t, s.RevokeAPIKey(ctx, owner, foreign.ID, base), errs.ErrAPIKeyNotFound)
+	assert.ErrorIs(t, s.RevokeAPIKey(ctx, owner, uuid.New(), base), errs.ErrAPIKeyNotFound)
+
+	revokedAt := base.Add(2 * time.Hour)
+	require.NoError(t, s.RevokeAPIKey(ctx, owner, first.ID, revokedAt))
+	//повторный отзыв не сдвигает момент отзыва
+	require.NoError(t, s.RevokeAPIKey(ctx, owner, first.ID, revokedAt.Add(time.Hour)))
+
+	got, err = s.GetAPIKey(ctx, "hash-1")
+	require.NoError(t, err)
+	require.NotNil(t, got.RevokedAt)
+	assert.True(t, revokedAt.Equal(*got.RevokedAt))
+
+	got, err = s.GetAPIKey(ctx, "hash-3")
+	require.NoError(t, err)
+	assert.Nil(t, got.RevokedAt)
+}
+
+func testUsers(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	user := models.User{ID: uuid.New(), Login: "alice", PasswordHash: "hash", CreatedAt: createdAt}
+	require.NoError(t, s.CreateUser(ctx, user))
+
+	//логин занят, даже если идентификатор другой
+	err := s.CreateUser(ctx, models.User{ID: uuid.New(), Login: "alice", PasswordHash: "other", CreatedAt: createdAt})
+	assert.ErrorIs(t, err, errs.ErrUserExists)
+
+	got, err := s.GetUserByLogin(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, got.ID)
+	assert.Equal(t, "hash", got.PasswordHash)
+	assert.True(t, createdAt.Equal(got.CreatedAt))
+
+	got, err = s.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", got.Login)
+
+	_, err = s.GetUserByLogin(ctx, "bob")
+	assert.ErrorIs(t, err, errs.ErrUserNotFound)
+	_, err = s.GetUserByID(ctx, uuid.New())
+	assert.ErrorIs(t, err, errs.ErrUserNotFound)
+
+	//ссылки, ключи, команды и задания на удаление анонимного пользователя переходят в учетную запись, чужие остаются на месте
+	anonymous, stranger := uuid.New(), uuid.New()
+
+	_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk", UserID: user.ID})
+	require.NoError(t, err)
+	_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://yandex.ru/", ShortURL: "wqev4E", UserID: anonymous})
+	require.NoError(t, err)
+	_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://ya.ru/", ShortURL: "Ab3dE5", UserID: anonymous})
+	require.NoError(t, err)
+	_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://go.dev/", ShortURL: "Qw3rTy", UserID: stranger})
+	require.NoError(t, err)
+
+	require.NoError(t, s.SaveAPIKey(ctx, models.APIKey{ID: uuid.New(), UserID: anonymous, Name: "ci", Prefix: "usk_anonymou", Hash: "hash-anonymous",
+		Scopes: []models.Scope{models.ScopeRead}, CreatedAt: createdAt}))
+
+	//в общей команде остается старшая роль и более раннее вступление, из остальных команд участие переходит как есть
+	shared := models.Team{ID: uuid.New(), Name: "marketing", CreatedAt: createdAt}
+	require.NoError(t, s.CreateTeam(ctx, shared, models.TeamMember{TeamID: shared.ID, UserID: stranger, Role: models.RoleOwner, CreatedAt: createdAt}))
+	require.NoError(t, s.SaveTeamMember(ctx, models.TeamMember{TeamID: shared.ID, UserID: user.ID, Role: models.RoleViewer, CreatedAt: createdAt.Add(time.Minute)}))
+	require.NoError(t, s.SaveTeamMember(ctx, models.TeamMember{TeamID: shared.ID, UserID: anonymous, Role: models.RoleEditor, CreatedAt: createdAt.Add(2 * time.Minute)}))
+
+	own := models.Team{ID: uuid.New(), Name: "sales", CreatedAt: createdAt.Add(time.Hour)}
+	require.NoError(t, s.CreateTeam(ctx, own, models.TeamMember{TeamID: own.ID, UserID: anonymous, Role: models.RoleOwner, CreatedAt: createdAt.Add(time.Hour)}))
+
+	jobID := uuid.New()
+	require.NoError(t, s.EnqueueDeletes(ctx, jobID, []models.DeletedURLS{{UserID: anonymous, ShortURL: "Ab3dE5"}}))
+
+	//запись очереди, прочитанная обработчиком до переноса
+	stale, err := s.GetDeleteJob(ctx, jobID)
+	require.NoError(t, err)
+	require.Len(t, stale, 1)
+
+	merged, err := s.MergeUser(ctx, anonymous, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), merged)
+
+	list, err := s.ListByUserID(ctx, host, user.ID)
+	require.NoError(t, err)
+
+	var codes []string
+	for _, item := range list {
+		codes = append(codes, string(item.ShortURL))
+	}
+	assert.ElementsMatch(t, []string{"http://" + string(host) + "/jB9Wbk", "http://" + string(host) + "/wqev4E", "http://" + string(host) + "/Ab3dE5"}, codes)
+
+	list, err = s.ListByUserID(ctx, host, anonymous)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	row, err := s.GetURL(ctx, "wqev4E")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, row.UserID)
+
+	row, err = s.GetURL(ctx, "Qw3rTy")
+	require.NoError(t, err)
+	assert.Equal(t, stranger, row.UserID)
+
+	key, err := s.GetAPIKey(ctx, "hash-anonymous")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, key.UserID)
+
+	keys, err := s.ListAPIKeys(ctx, anonymous)
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	member, err := s.GetTeamMember(ctx, shared.ID, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleEditor, member.Role)
+	assert.True(t, createdAt.Add(time.Minute).Equal(member.CreatedAt))
+
+	members, err := s.ListTeamMembers(ctx, shared.ID)
+	require.NoError(t, err)
+	assert.Len(t, members, 2)
+
+	teams, err := s.ListTeams(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, teams, 2)
+	assert.Equal(t, own.ID, teams[1].ID)
+	assert.Equal(t, models.RoleOwner, teams[1].Role)
+
+	teams, err = s.ListTeams(ctx, anonymous)
+	require.NoError(t, err)
+	assert.Empty(t, teams)
+
+	//обновление состояния записи очереди не возвращает ее прежнему владельцу
+	stale[0].Status = models.OutboxDead
+	stale[0].Result = models.DeleteResultFailed
+	stale[0].UpdatedAt = time.Now()
+	require.NoError(t, s.UpdateDeletes(ctx, stale))
+
+	dead, err := s.ListDeadDeletes(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, models.ShortURL("Ab3dE5"), dead[0].ShortURL)
+
+	dead, err = s.ListDeadDeletes(ctx, anonymous)
+	require.NoError(t, err)
+	assert.Empty(t, dead)
+
+	//повторный перенос ничего не делает
+	merged, err = s.MergeUser(ctx, anonymous, user.ID)
+	require.NoError(t, err)
+	assert.Zero(t, merged)
+}
+
+func testTeams(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	owner, editor, stranger := uuid.New(), uuid.New(), uuid.New()
+
+	team := models.Team{ID: uuid.New(), Name: "marketing", CreatedAt: createdAt}
+	require.NoError(t, s.CreateTeam(ctx, team, models.TeamMember{TeamID: team.ID, UserID: owner, Role: models.RoleOwner, CreatedAt: createdAt}))
+
+	other := models.Team{ID: uuid.New(), Name: "sales", CreatedAt: createdAt.Add(time.Hour)}
+	require.NoError(t, s.CreateTeam(ctx, other, models.TeamMember{TeamID: other.ID, UserID: editor, Role: models.RoleOwner, CreatedAt: createdAt}))
+
+	//участник добавляется, при смене роли момент вступления сохраняется
+	joinedAt := createdAt.Add(time.Minute)
+	require.NoError(t, s.SaveTeamMember(ctx, models.TeamMember{TeamID: team.ID, UserID: editor, Role: models.RoleViewer, CreatedAt: joinedAt}))
+	require.NoError(t, s.SaveTeamMember(ctx, models.TeamMember{TeamID: team.ID, UserID: editor, Role: models.RoleEditor, CreatedAt: joinedAt.Add(time.Hour)}))
+
+	err := s.SaveTeamMember(ctx, models.TeamMember{TeamID: uuid.New(), UserID: editor, Role: models.RoleViewer, CreatedAt: joinedAt})
+	assert.ErrorIs(t, err, errs.ErrTeamNotFound)
+
+	member, err := s.GetTeamMember(ctx, team.ID, editor)
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleEditor, member.Role)
+	assert.True(t, joinedAt.Equal(member.CreatedAt))
+
+	_, err = s.GetTeamMember(ctx, team.ID, stranger)
+	assert.ErrorIs(t, err, errs.ErrTeamMemberNotFound)
+
+	//команды пользователя в порядке создания с его ролью в каждой
+	teams, err := s.ListTeams(ctx, editor)
+	require.NoError(t, err)
+	require.Len(t, teams, 2)
+	assert.Equal(t, team.ID, teams[0].ID)
+	assert.Equal(t, "marketing", teams[0].Name)
+	assert.Equal(t, models.RoleEditor, teams[0].Role)
+	assert.Equal(t, other.ID, teams[1].ID)
+	assert.Equal(t, models.RoleOwner, teams[1].Role)
+
+	teams, err = s.ListTeams(ctx, stranger)
+	require.NoError(t, err)
+	assert.Empty(t, teams)
+
+	members, err := s.ListTeamMembers(ctx, team.ID)
+	require.NoError(t, err)
+	require.Len(t, members, 2)
+	assert.Equal(t, owner, members[0].UserID)
+	assert.Equal(t, models.RoleOwner, members[0].Role)
+	assert.Equal(t, editor, members[1].UserID)
+
+	//ссылка команды не попадает в личный список создателя и удаляется только от имени команды
+	_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://practicum.yandex.ru/", ShortURL: "jB9Wbk", UserID: editor, TeamID: team.ID})
+	require.NoError(t, err)
+	_, err = s.SaveURL(ctx, models.ShortenURL{OriginalURL: "https://yandex.ru/", ShortURL: "wqev4E", UserID: editor})
+	require.NoError(t, err)
+
+	row, err := s.GetURL(ctx, "jB9Wbk")
+	require.NoError(t, err)
+	assert.Equal(t, team.ID, row.TeamID)
+	assert.Equal(t, editor, row.UserID)
+
+	row, err = s.GetURL(ctx, "wqev4E")
+	require.NoError(t, err)
+	assert.Equal(t, uuid.Nil, row.TeamID)
+
+	list, err := s.ListByUserID(ctx, host, editor)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, models.ShortURL("http://localhost:8080/wqev4E"), list[0].ShortURL)
+
+	list, err = s.ListByTeamID(ctx, host, team.ID)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, models.ShortURL("http://localhost:8080/jB9Wbk"), list[0].ShortURL)
+	assert.Equal(t, models.OriginalURL("https://practicum.yandex.ru/"), list[0].OriginalURL)
+
+	list, err = s.ListByTeamID(ctx, host, other.ID)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	deleted, err := s.DeleteURL(ctx, []models.DeletedURLS{
+		{UserID: editor, ShortURL: "jB9Wbk"},
+		{UserID: owner, ShortURL: "wqev4E", TeamID: team.ID},
+		{UserID: owner, ShortURL: "jB9Wbk", TeamID: other.ID},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+
+	deleted, err = s.DeleteURL(ctx, []models.DeletedURLS{{UserID: owner, ShortURL: "jB9Wbk", TeamID: team.ID}})
+	require.NoError(t, err)
+	assert.Equal(t, []models.DeletedURLS{{UserID: owner, ShortURL: "jB9Wbk", TeamID: team.ID}}, deleted)
+
+	list, err = s.ListByTeamID(ctx, host, team.ID)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.True(t, list[0].IsDel)
+
+	//исключенный участник теряет доступ, ссылки остаются у команды
+	require.NoError(t, s.DeleteTeamMember(ctx, team.ID, editor))
+	assert.ErrorIs(t, s.DeleteTeamMember(ctx, team.ID, editor), errs.ErrTeamMemberNotFound)
+
+	_, err = s.GetTeamMember(ctx, team.ID, editor)
+	assert.ErrorIs(t, err, errs.ErrTeamMemberNotFound)
+
+	members, err = s.ListTeamMembers(ctx, team.ID)
+	require.NoError(t, err)
+	require.Len(t, members, 1)
+	assert.Equal(t, owner, members[0].UserID)
+
+	list, err = s.ListByTeamID(ctx, host, team.ID)
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+
+	//последнего владельца нельзя ни понизить, ни исключить
+	err = s.SaveTeamMember(ctx, models.TeamMember{TeamID: team.ID, UserID: owner, Role: models.RoleEditor, CreatedAt: createdAt})
+	assert.ErrorIs(t, err, errs.ErrTeamLastOwner)
+	assert.ErrorIs(t, s.DeleteTeamMember(ctx, team.ID, owner), errs.ErrTeamLastOwner)
+
+	//из двух владельцев, одновременно понижающих друг друга, удается только одному
+	require.NoError(t, s.SaveTeamMember(ctx, models.TeamMember{TeamID: team.ID, UserID: editor, Role: models.RoleOwner, CreatedAt: joinedAt}))
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, 2)
+	for _, userID := range []uuid.UUID{owner, editor} {
+		wg.Add(1)
+		go func(userID uuid.UUID) {
+			defer wg.Done()
+			errCh <- s.SaveTeamMember(ctx, models.TeamMember{TeamID: team.ID, UserID: userID, Role: models.RoleViewer, CreatedAt: joinedAt})
+		}(userID)
+	}
+	wg.Wait()
+	close(errCh)
+
+	failed := 0
+	for errSave := range errCh {
+		if errSave != nil {
+			assert.ErrorIs(t, errSave, errs.ErrTeamLastOwner)
+			failed++
+		}
+	}
+	assert.Equal(t, 1, failed)
+
+	members, err = s.ListTeamMembers(ctx, team.ID)
+	require.NoError(t, err)
+
+	owners := 0
+	for _, m := range members {
+		if m.Role == models.RoleOwner {
+			owners++
+		}
+	}
+	assert.Equal(t, 1, owners)
+}